@@ -0,0 +1,307 @@
+// Package cassette records GitHub API interactions to YAML files and replays them offline.
+//
+// A Recorder implements handlers.HTTPClient, so it can be used as the client of the handlers:
+// in record mode it forwards the requests to the wrapped client and captures the request/response pairs,
+// in replay mode it serves the recorded responses and fails on requests that were not recorded.
+// Credentials are never written: the Authorization header is redacted when recording.
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/handlers"
+	"gopkg.in/yaml.v3"
+)
+
+// Mode is the mode of a Recorder
+type Mode string
+
+const (
+	// ModeReplay serves the recorded interactions, without network access
+	ModeReplay Mode = "replay"
+	// ModeRecord forwards the requests to the wrapped client and records the interactions
+	ModeRecord Mode = "record"
+)
+
+// ModeEnv is the environment variable selecting the mode of ModeFromEnv
+const ModeEnv = "CASSETTE_MODE"
+
+// redactedValue replaces the value of the redacted headers
+const redactedValue = "REDACTED"
+
+// redactedHeaders are the request headers whose value is never written to a cassette
+var redactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+
+// ErrNoInteraction is returned in replay mode for requests without a matching recorded interaction
+var ErrNoInteraction = errors.New("no recorded interaction matches the request")
+
+// Request is a recorded request
+type Request struct {
+	Method  string              `yaml:"method"`
+	URL     string              `yaml:"url"`
+	Headers map[string][]string `yaml:"headers,omitempty"`
+	Body    string              `yaml:"body,omitempty"`
+}
+
+// Response is a recorded response
+type Response struct {
+	StatusCode int                 `yaml:"status_code"`
+	Headers    map[string][]string `yaml:"headers,omitempty"`
+	Body       string              `yaml:"body,omitempty"`
+}
+
+// Interaction is a recorded request/response pair
+type Interaction struct {
+	Request  Request  `yaml:"request"`
+	Response Response `yaml:"response"`
+}
+
+// Cassette is the content of a cassette file
+type Cassette struct {
+	Interactions []Interaction `yaml:"interactions"`
+}
+
+// Recorder is an HTTP client recording or replaying the interactions of a cassette file
+type Recorder struct {
+	path   string
+	mode   Mode
+	client handlers.HTTPClient
+
+	mu           sync.Mutex
+	interactions []Interaction
+	used         []bool
+}
+
+var _ handlers.HTTPClient = (*Recorder)(nil)
+
+// ModeFromEnv returns the mode set in the CASSETTE_MODE environment variable, replay by default
+func ModeFromEnv() (Mode, error) {
+	switch mode := Mode(strings.ToLower(os.Getenv(ModeEnv))); mode {
+	case "", ModeReplay:
+		return ModeReplay, nil
+	case ModeRecord:
+		return ModeRecord, nil
+	default:
+		return "", fmt.Errorf("invalid %s %q: must be %s or %s", ModeEnv, mode, ModeReplay, ModeRecord)
+	}
+}
+
+// New creates a Recorder for the cassette file at path.
+// In replay mode the cassette is loaded and the client is not used,
+// in record mode the requests are sent with the client and the cassette is written by Stop.
+func New(path string, mode Mode, client handlers.HTTPClient) (*Recorder, error) {
+	r := &Recorder{path: path, mode: mode, client: client}
+
+	switch mode {
+	case ModeReplay:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read cassette: %w", err)
+		}
+		var cassette Cassette
+		if err := yaml.Unmarshal(data, &cassette); err != nil {
+			return nil, fmt.Errorf("failed to parse cassette %s: %w", path, err)
+		}
+		r.interactions = cassette.Interactions
+		r.used = make([]bool, len(cassette.Interactions))
+	case ModeRecord:
+		if client == nil {
+			return nil, fmt.Errorf("a client is required in %s mode", ModeRecord)
+		}
+	default:
+		return nil, fmt.Errorf("invalid cassette mode %q", mode)
+	}
+
+	return r, nil
+}
+
+// Mode returns the mode of the Recorder
+func (r *Recorder) Mode() Mode {
+	return r.mode
+}
+
+// Do records or replays a request
+func (r *Recorder) Do(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.mode == ModeReplay {
+		return r.replay(req, body)
+	}
+	return r.record(req, body)
+}
+
+// replay returns the response of the first unused interaction matching the request
+func (r *Recorder) replay(req *http.Request, body string) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, interaction := range r.interactions {
+		if r.used[i] || !matches(interaction.Request, req, body) {
+			continue
+		}
+		r.used[i] = true
+		return newResponse(req, interaction.Response), nil
+	}
+	return nil, fmt.Errorf("%w: %s %s", ErrNoInteraction, req.Method, req.URL.String())
+}
+
+// record sends the request with the wrapped client and captures the interaction
+func (r *Recorder) record(req *http.Request, body string) (*http.Response, error) {
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	interaction := Interaction{
+		Request: Request{
+			Method:  req.Method,
+			URL:     req.URL.String(),
+			Headers: redactHeaders(req.Header),
+			Body:    body,
+		},
+		Response: Response{
+			StatusCode: resp.StatusCode,
+			Headers:    cloneHeaders(resp.Header),
+			Body:       string(respBody),
+		},
+	}
+
+	r.mu.Lock()
+	r.interactions = append(r.interactions, interaction)
+	r.used = append(r.used, true)
+	r.mu.Unlock()
+
+	return newResponse(req, interaction.Response), nil
+}
+
+// Unused returns the recorded interactions that were not replayed, as "METHOD URL"
+func (r *Recorder) Unused() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var unused []string
+	for i, interaction := range r.interactions {
+		if !r.used[i] {
+			unused = append(unused, interaction.Request.Method+" "+interaction.Request.URL)
+		}
+	}
+	return unused
+}
+
+// Stop writes the recorded interactions to the cassette file in record mode, it does nothing in replay mode
+func (r *Recorder) Stop() error {
+	if r.mode != ModeRecord {
+		return nil
+	}
+
+	var data bytes.Buffer
+	encoder := yaml.NewEncoder(&data)
+	encoder.SetIndent(2)
+	r.mu.Lock()
+	err := encoder.Encode(Cassette{Interactions: r.interactions})
+	r.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to marshal cassette: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create cassette directory: %w", err)
+	}
+	if err := os.WriteFile(r.path, data.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	return nil
+}
+
+// readRequestBody reads the request body, restoring it so that the request can still be sent
+func readRequestBody(req *http.Request) (string, error) {
+	if req.Body == nil {
+		return "", nil
+	}
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read request body: %w", err)
+	}
+	req.Body.Close()
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return string(body), nil
+}
+
+// matches reports whether a recorded request matches a request by method, URL and body.
+// JSON bodies are compared by value, so that the order of the fields does not matter.
+func matches(recorded Request, req *http.Request, body string) bool {
+	if recorded.Method != req.Method || recorded.URL != req.URL.String() {
+		return false
+	}
+	if recorded.Body == body {
+		return true
+	}
+
+	var recordedValue, value interface{}
+	if json.Unmarshal([]byte(recorded.Body), &recordedValue) != nil || json.Unmarshal([]byte(body), &value) != nil {
+		return false
+	}
+	recordedJSON, _ := json.Marshal(recordedValue)
+	valueJSON, _ := json.Marshal(value)
+	return bytes.Equal(recordedJSON, valueJSON)
+}
+
+func newResponse(req *http.Request, recorded Response) *http.Response {
+	header := make(http.Header)
+	for key, values := range recorded.Headers {
+		for _, value := range values {
+			header.Add(key, value)
+		}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.StatusCode, http.StatusText(recorded.StatusCode)),
+		StatusCode:    recorded.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(recorded.Body)),
+		ContentLength: int64(len(recorded.Body)),
+		Request:       req,
+	}
+}
+
+// redactHeaders copies the request headers, replacing the credentials
+func redactHeaders(header http.Header) map[string][]string {
+	headers := cloneHeaders(header)
+	for _, name := range redactedHeaders {
+		if _, exists := headers[name]; exists {
+			headers[name] = []string{redactedValue}
+		}
+	}
+	return headers
+}
+
+func cloneHeaders(header http.Header) map[string][]string {
+	if len(header) == 0 {
+		return nil
+	}
+	headers := make(map[string][]string, len(header))
+	for key, values := range header {
+		headers[http.CanonicalHeaderKey(key)] = append([]string(nil), values...)
+	}
+	return headers
+}
@@ -0,0 +1,196 @@
+package cassette
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newRequest(t *testing.T, method, url, body string) *http.Request {
+	t.Helper()
+
+	var reqBody io.Reader
+	if body != "" {
+		reqBody = strings.NewReader(body)
+	}
+	req, err := http.NewRequest(method, url, reqBody)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	req.Header.Set("Authorization", "token secret-token")
+	return req
+}
+
+func readBody(t *testing.T, resp *http.Response) string {
+	t.Helper()
+
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read response body: %v", err)
+	}
+	return string(body)
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"method": "` + r.Method + `", "body": ` + string(body) + `}`))
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "cassettes", "record.yaml")
+
+	recorder, err := New(path, ModeRecord, server.Client())
+	if err != nil {
+		t.Fatalf("failed to create recorder: %v", err)
+	}
+	resp, err := recorder.Do(newRequest(t, "PUT", server.URL+"/repos/o/r/collaborators/u", `{"permission": "push"}`))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	recorded := readBody(t, resp)
+	if err := recorder.Stop(); err != nil {
+		t.Fatalf("failed to write cassette: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read cassette: %v", err)
+	}
+	if strings.Contains(string(data), "secret-token") || !strings.Contains(string(data), redactedValue) {
+		t.Errorf("expected the Authorization header to be redacted, got:\n%s", data)
+	}
+
+	replayer, err := New(path, ModeReplay, nil)
+	if err != nil {
+		t.Fatalf("failed to load cassette: %v", err)
+	}
+	// Field order does not matter for JSON bodies
+	resp, err = replayer.Do(newRequest(t, "PUT", server.URL+"/repos/o/r/collaborators/u", `{"permission":"push"}`))
+	if err != nil {
+		t.Fatalf("replay failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusCreated || resp.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected replayed response %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	if body := readBody(t, resp); body != recorded {
+		t.Errorf("expected body %s, got %s", recorded, body)
+	}
+	if calls != 1 {
+		t.Errorf("expected the replay not to reach the server, got %d calls", calls)
+	}
+	if unused := replayer.Unused(); len(unused) != 0 {
+		t.Errorf("expected all interactions to be used, got %v", unused)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "replay.yaml")
+	cassette := `interactions:
+  - request:
+      method: GET
+      url: https://api.github.com/repos/o/r/collaborators/u
+    response:
+      status_code: 404
+  - request:
+      method: GET
+      url: https://api.github.com/repos/o/r/collaborators/u
+    response:
+      status_code: 204
+  - request:
+      method: PATCH
+      url: https://api.github.com/repos/o/r/invitations/1
+      body: '{"permissions": "write"}'
+    response:
+      status_code: 200
+      body: '{"id": 1}'
+`
+	if err := os.WriteFile(path, []byte(cassette), 0o644); err != nil {
+		t.Fatalf("failed to write cassette: %v", err)
+	}
+
+	replayer, err := New(path, ModeReplay, nil)
+	if err != nil {
+		t.Fatalf("failed to load cassette: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		body           string
+		expectedStatus int
+		expectedErr    error
+	}{
+		{name: "first matching interaction", method: "GET", url: "https://api.github.com/repos/o/r/collaborators/u", expectedStatus: http.StatusNotFound},
+		{name: "interactions are used once", method: "GET", url: "https://api.github.com/repos/o/r/collaborators/u", expectedStatus: http.StatusNoContent},
+		{name: "exhausted interaction", method: "GET", url: "https://api.github.com/repos/o/r/collaborators/u", expectedErr: ErrNoInteraction},
+		{name: "different body", method: "PATCH", url: "https://api.github.com/repos/o/r/invitations/1", body: `{"permissions": "read"}`, expectedErr: ErrNoInteraction},
+		{name: "different URL", method: "PATCH", url: "https://api.github.com/repos/o/r/invitations/2", body: `{"permissions": "write"}`, expectedErr: ErrNoInteraction},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := replayer.Do(newRequest(t, tt.method, tt.url, tt.body))
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Errorf("expected error %v, got %v", tt.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+		})
+	}
+
+	if unused := replayer.Unused(); len(unused) != 1 || unused[0] != "PATCH https://api.github.com/repos/o/r/invitations/1" {
+		t.Errorf("unexpected unused interactions %v", unused)
+	}
+}
+
+func TestNew_Errors(t *testing.T) {
+	if _, err := New(filepath.Join(t.TempDir(), "missing.yaml"), ModeReplay, nil); err == nil {
+		t.Errorf("expected an error for a missing cassette")
+	}
+	if _, err := New("unused.yaml", ModeRecord, nil); err == nil {
+		t.Errorf("expected an error recording without a client")
+	}
+	if _, err := New("unused.yaml", Mode("rewind"), nil); err == nil {
+		t.Errorf("expected an error for an invalid mode")
+	}
+}
+
+func TestModeFromEnv(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected Mode
+		wantErr  bool
+	}{
+		{value: "", expected: ModeReplay},
+		{value: "replay", expected: ModeReplay},
+		{value: "RECORD", expected: ModeRecord},
+		{value: "rewind", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Setenv(ModeEnv, tt.value)
+		mode, err := ModeFromEnv()
+		if (err != nil) != tt.wantErr || mode != tt.expected {
+			t.Errorf("%q: got %q, %v", tt.value, mode, err)
+		}
+	}
+}
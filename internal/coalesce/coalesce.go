@@ -0,0 +1,140 @@
+// Package coalesce deduplicates identical concurrent GET requests to the GitHub API.
+//
+// A Client implements handlers.HTTPClient: while a GET request is in flight, identical requests
+// (same URL, same token and same Accept header) wait for its response instead of being sent again.
+// Every caller gets its own copy of the response, so bodies can be read and closed independently.
+package coalesce
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/handlers"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/requeststats"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/utils"
+)
+
+// DefaultTimeout is the deadline of the shared calls when the wrapped client has no longer timeout
+const DefaultTimeout = 30 * time.Second
+
+// Client is an HTTP client sending identical concurrent GET requests only once
+type Client struct {
+	client  handlers.HTTPClient
+	timeout time.Duration
+
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+// call is an in-flight request shared by identical requests
+type call struct {
+	done chan struct{}
+
+	statusCode int
+	header     http.Header
+	body       []byte
+	err        error
+}
+
+var _ handlers.HTTPClient = (*Client)(nil)
+
+// New creates a Client sending the requests with client, whose timeout is given (0 when it has none).
+// Shared calls get their own deadline, the longest of timeout and DefaultTimeout.
+func New(client handlers.HTTPClient, timeout time.Duration) *Client {
+	return &Client{
+		client:  client,
+		timeout: max(timeout, DefaultTimeout),
+		calls:   make(map[string]*call),
+	}
+}
+
+// Do sends a request, sharing the response of an identical GET request already in flight.
+// Requests with other methods are sent as they are.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return c.client.Do(req)
+	}
+
+	key := requestKey(req)
+
+	c.mu.Lock()
+	shared, exists := c.calls[key]
+	if !exists {
+		shared = &call{done: make(chan struct{})}
+		c.calls[key] = shared
+		go c.execute(key, shared, req)
+	}
+	c.mu.Unlock()
+	if exists {
+		requeststats.FromContext(req.Context()).AddCacheHit() // Answered with the response of another request
+	}
+
+	select {
+	case <-shared.done:
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+
+	if shared.err != nil {
+		return nil, shared.err
+	}
+	return shared.newResponse(req), nil
+}
+
+// execute sends the request of a shared call and stores its response.
+// The call is not cancelled with the request that started it, since other callers may be waiting for it:
+// it has its own deadline instead, so that it cannot hang when the wrapped client has no timeout.
+func (c *Client) execute(key string, shared *call, req *http.Request) {
+	defer func() {
+		c.mu.Lock()
+		delete(c.calls, key)
+		c.mu.Unlock()
+		close(shared.done)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(req.Context()), c.timeout)
+	defer cancel()
+
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		shared.err = err
+		return
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		shared.err = fmt.Errorf("failed to read response body: %w", err)
+		return
+	}
+
+	shared.statusCode = resp.StatusCode
+	shared.header = resp.Header.Clone()
+	shared.body = body
+}
+
+// newResponse returns a copy of the shared response for a caller
+func (shared *call) newResponse(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", shared.statusCode, http.StatusText(shared.statusCode)),
+		StatusCode:    shared.statusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        shared.header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(shared.body)),
+		ContentLength: int64(len(shared.body)),
+		Request:       req,
+	}
+}
+
+// requestKey identifies identical requests: the token is hashed, so that it is not kept in memory in clear.
+// The Accept header is part of the key since it selects the representation returned by GitHub.
+func requestKey(req *http.Request) string {
+	return req.URL.String() + "\n" + utils.HashToken(req.Header.Get("Authorization")) + "\n" + req.Header.Get("Accept")
+}
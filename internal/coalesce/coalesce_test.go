@@ -0,0 +1,251 @@
+package coalesce
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/requeststats"
+)
+
+// blockingClient answers the requests once released, counting the requests it receives
+type blockingClient struct {
+	calls   atomic.Int32
+	release chan struct{}
+	err     error
+}
+
+func (c *blockingClient) Do(req *http.Request) (*http.Response, error) {
+	c.calls.Add(1)
+	<-c.release
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(`[{"id": 1}]`)),
+	}, nil
+}
+
+func newRequest(t *testing.T, ctx context.Context, method, url, authHeader string) *http.Request {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	req.Header.Set("Authorization", authHeader)
+	return req
+}
+
+// waitForCalls waits until the client received the expected number of requests
+func waitForCalls(t *testing.T, client *blockingClient, expected int32) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for client.calls.Load() < expected {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d upstream calls, got %d", expected, client.calls.Load())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDo_Coalesces(t *testing.T) {
+	tests := []struct {
+		name          string
+		method        string
+		url           string
+		authHeaders   []string
+		expectedCalls int32
+	}{
+		{
+			name:          "identical GET requests",
+			method:        "GET",
+			url:           "https://api.github.com/repos/o/r/invitations?per_page=30&page=1",
+			authHeaders:   []string{"token a", "token a", "token a"},
+			expectedCalls: 1,
+		},
+		{
+			name:          "different tokens",
+			method:        "GET",
+			url:           "https://api.github.com/repos/o/r/invitations?per_page=30&page=1",
+			authHeaders:   []string{"token a", "token b"},
+			expectedCalls: 2,
+		},
+		{
+			name:          "mutating requests",
+			method:        "DELETE",
+			url:           "https://api.github.com/repos/o/r/invitations/1",
+			authHeaders:   []string{"token a", "token a"},
+			expectedCalls: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := &blockingClient{release: make(chan struct{})}
+			client := New(upstream, 0)
+
+			ctx, stats := requeststats.NewContext(context.Background())
+			bodies := make([]string, len(tt.authHeaders))
+			errs := make([]error, len(tt.authHeaders))
+			var wg sync.WaitGroup
+			for i, authHeader := range tt.authHeaders {
+				wg.Add(1)
+				go func(i int, authHeader string) {
+					defer wg.Done()
+					resp, err := client.Do(newRequest(t, ctx, tt.method, tt.url, authHeader))
+					if err != nil {
+						errs[i] = err
+						return
+					}
+					defer resp.Body.Close()
+					body, _ := io.ReadAll(resp.Body)
+					bodies[i] = string(body)
+				}(i, authHeader)
+			}
+
+			waitForCalls(t, upstream, tt.expectedCalls)
+			// Let the remaining requests reach the client, in case they were not coalesced
+			time.Sleep(20 * time.Millisecond)
+			close(upstream.release)
+			wg.Wait()
+
+			if calls := upstream.calls.Load(); calls != tt.expectedCalls {
+				t.Errorf("expected %d upstream calls, got %d", tt.expectedCalls, calls)
+			}
+			// Coalesced requests are cache hits of the requests they belong to
+			if expectedHits := len(tt.authHeaders) - int(tt.expectedCalls); stats.CacheHits() != expectedHits {
+				t.Errorf("expected %d cache hits, got %d", expectedHits, stats.CacheHits())
+			}
+			for i := range tt.authHeaders {
+				if errs[i] != nil || bodies[i] != `[{"id": 1}]` {
+					t.Errorf("caller %d: unexpected response %q, %v", i, bodies[i], errs[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDo_SequentialRequestsAreSent(t *testing.T) {
+	upstream := &blockingClient{release: make(chan struct{})}
+	close(upstream.release)
+	client := New(upstream, 0)
+
+	for range 2 {
+		resp, err := client.Do(newRequest(t, context.Background(), "GET", "https://api.github.com/orgs/o", "token a"))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+	}
+	if calls := upstream.calls.Load(); calls != 2 {
+		t.Errorf("expected completed requests not to be reused, got %d upstream calls", calls)
+	}
+}
+
+func TestDo_SharedError(t *testing.T) {
+	upstream := &blockingClient{release: make(chan struct{}), err: errors.New("connection refused")}
+	client := New(upstream, 0)
+
+	errs := make(chan error, 2)
+	for range 2 {
+		go func() {
+			_, err := client.Do(newRequest(t, context.Background(), "GET", "https://api.github.com/orgs/o", "token a"))
+			errs <- err
+		}()
+	}
+	waitForCalls(t, upstream, 1)
+	time.Sleep(20 * time.Millisecond)
+	close(upstream.release)
+
+	for range 2 {
+		if err := <-errs; !errors.Is(err, upstream.err) {
+			t.Errorf("expected the upstream error, got %v", err)
+		}
+	}
+}
+
+func TestDo_CancelledCallerDoesNotCancelOthers(t *testing.T) {
+	upstream := &blockingClient{release: make(chan struct{})}
+	client := New(upstream, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := client.Do(newRequest(t, ctx, "GET", "https://api.github.com/orgs/o", "token a"))
+		first <- err
+	}()
+	waitForCalls(t, upstream, 1)
+
+	second := make(chan error, 1)
+	go func() {
+		resp, err := client.Do(newRequest(t, context.Background(), "GET", "https://api.github.com/orgs/o", "token a"))
+		if err == nil {
+			resp.Body.Close()
+		}
+		second <- err
+	}()
+	// Let the second request join the call in flight
+	time.Sleep(20 * time.Millisecond)
+
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the cancelled caller to return context.Canceled, got %v", err)
+	}
+
+	close(upstream.release)
+	if err := <-second; err != nil {
+		t.Errorf("expected the other caller to get the response, got %v", err)
+	}
+	if calls := upstream.calls.Load(); calls != 1 {
+		t.Errorf("expected 1 upstream call, got %d", calls)
+	}
+}
+
+// hangingClient answers the requests only when their context is done
+type hangingClient struct {
+	calls atomic.Int32
+}
+
+func (c *hangingClient) Do(req *http.Request) (*http.Response, error) {
+	c.calls.Add(1)
+	<-req.Context().Done()
+	return nil, req.Context().Err()
+}
+
+func TestDo_SharedCallDeadline(t *testing.T) {
+	upstream := &hangingClient{}
+	client := New(upstream, 0)
+	client.timeout = 20 * time.Millisecond // Without an upstream timeout, DefaultTimeout would apply
+
+	// The caller waits longer than the shared call may last
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := client.Do(newRequest(t, ctx, "GET", "https://api.github.com/orgs/o", "token a")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the shared call to hit its deadline, got %v", err)
+	}
+
+	// The call is not shared anymore once over
+	if _, err := client.Do(newRequest(t, ctx, "GET", "https://api.github.com/orgs/o", "token a")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the shared call to hit its deadline, got %v", err)
+	}
+	if calls := upstream.calls.Load(); calls != 2 {
+		t.Errorf("expected 2 upstream calls, got %d", calls)
+	}
+
+	if timeout := New(upstream, 0).timeout; timeout != DefaultTimeout {
+		t.Errorf("expected DefaultTimeout without upstream timeout, got %v", timeout)
+	}
+	if timeout := New(upstream, time.Minute).timeout; timeout != time.Minute {
+		t.Errorf("expected the upstream timeout when longer, got %v", timeout)
+	}
+}
@@ -0,0 +1,110 @@
+// Package events broadcasts the changes reported by GitHub to the subscribers of the plugin (e.g. a controller sidecar).
+//
+// The Broker keeps the most recent events, so that a subscriber reconnecting with the ID of the last event it received
+// gets the events it missed, and delivers the new events to every subscriber without blocking the publisher.
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultHistorySize is the number of recent events kept for reconnecting subscribers when not configured
+const DefaultHistorySize = 256
+
+// subscriberBuffer is the number of events buffered for a subscriber, further events are dropped for slow subscribers
+const subscriberBuffer = 64
+
+// Event is a change of plugin resources reported by a GitHub webhook
+type Event struct {
+	ID         string    `json:"id"`               // Delivery ID of the webhook
+	Event      string    `json:"event"`            // GitHub event name (e.g. member, team)
+	Action     string    `json:"action,omitempty"` // GitHub event action (e.g. added, removed)
+	Paths      []string  `json:"paths"`            // Paths of the affected plugin resources
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// Broker delivers the published events to the subscribers
+type Broker struct {
+	historySize int
+
+	mu          sync.Mutex
+	history     []Event
+	subscribers map[chan Event]struct{}
+	closed      bool
+}
+
+// NewBroker creates a Broker keeping the given number of recent events (DefaultHistorySize when not positive)
+func NewBroker(historySize int) *Broker {
+	if historySize <= 0 {
+		historySize = DefaultHistorySize
+	}
+	return &Broker{
+		historySize: historySize,
+		subscribers: make(map[chan Event]struct{}),
+	}
+}
+
+// Publish delivers an event to the current subscribers and keeps it in the history.
+// Subscribers whose buffer is full miss the event, so that a slow subscriber does not block the others.
+func (b *Broker) Publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.history = append(b.history, event)
+	if len(b.history) > b.historySize {
+		b.history = b.history[len(b.history)-b.historySize:]
+	}
+
+	for subscriber := range b.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+		}
+	}
+}
+
+// Close ends the subscriptions by closing their channels, e.g. so that open streams do not hold the server shutdown.
+// Subscriptions made after Close get a closed channel.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for subscriber := range b.subscribers {
+		close(subscriber)
+		delete(b.subscribers, subscriber)
+	}
+}
+
+// Subscribe registers a subscriber, returning the events published after lastEventID (none when empty or unknown)
+// and the channel of the next events, closed when the broker is closed. unsubscribe must be called when the subscriber is done.
+func (b *Broker) Subscribe(lastEventID string) (missed []Event, next <-chan Event, unsubscribe func()) {
+	subscriber := make(chan Event, subscriberBuffer)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if lastEventID != "" {
+		for i := len(b.history) - 1; i >= 0; i-- {
+			if b.history[i].ID == lastEventID {
+				missed = append([]Event(nil), b.history[i+1:]...)
+				break
+			}
+		}
+	}
+	if b.closed {
+		close(subscriber)
+	} else {
+		b.subscribers[subscriber] = struct{}{}
+	}
+
+	return missed, subscriber, func() {
+		b.mu.Lock()
+		delete(b.subscribers, subscriber)
+		b.mu.Unlock()
+	}
+}
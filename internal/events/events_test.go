@@ -0,0 +1,88 @@
+package events
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestBroker_Subscribe(t *testing.T) {
+	broker := NewBroker(3)
+	for i := 1; i <= 4; i++ {
+		broker.Publish(Event{ID: fmt.Sprintf("delivery-%d", i)})
+	}
+
+	tests := []struct {
+		name        string
+		lastEventID string
+		expected    []string
+	}{
+		{name: "no last event", lastEventID: ""},
+		{name: "missed events", lastEventID: "delivery-2", expected: []string{"delivery-3", "delivery-4"}},
+		{name: "up to date", lastEventID: "delivery-4"},
+		{name: "evicted from the history", lastEventID: "delivery-1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			missed, _, unsubscribe := broker.Subscribe(tt.lastEventID)
+			defer unsubscribe()
+
+			var ids []string
+			for _, event := range missed {
+				ids = append(ids, event.ID)
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(tt.expected) {
+				t.Errorf("expected missed events %v, got %v", tt.expected, ids)
+			}
+		})
+	}
+}
+
+func TestBroker_Publish(t *testing.T) {
+	broker := NewBroker(0)
+
+	_, first, unsubscribeFirst := broker.Subscribe("")
+	_, second, unsubscribeSecond := broker.Subscribe("")
+	defer unsubscribeSecond()
+
+	broker.Publish(Event{ID: "delivery-1"})
+	for _, next := range []<-chan Event{first, second} {
+		if event := <-next; event.ID != "delivery-1" {
+			t.Errorf("expected delivery-1, got %s", event.ID)
+		}
+	}
+
+	unsubscribeFirst()
+	broker.Publish(Event{ID: "delivery-2"})
+	select {
+	case event := <-first:
+		t.Errorf("expected no event after unsubscribing, got %s", event.ID)
+	default:
+	}
+
+	// A slow subscriber misses the events beyond its buffer, without blocking the publisher
+	for i := 0; i < subscriberBuffer+10; i++ {
+		broker.Publish(Event{ID: fmt.Sprintf("burst-%d", i)})
+	}
+	if buffered := len(second); buffered != subscriberBuffer {
+		t.Errorf("expected %d buffered events, got %d", subscriberBuffer, buffered)
+	}
+}
+
+func TestBroker_Close(t *testing.T) {
+	broker := NewBroker(0)
+	_, before, unsubscribe := broker.Subscribe("")
+	defer unsubscribe()
+
+	broker.Close()
+	broker.Close()
+	broker.Publish(Event{ID: "delivery-1"})
+
+	_, after, unsubscribeAfter := broker.Subscribe("")
+	defer unsubscribeAfter()
+	for _, next := range []<-chan Event{before, after} {
+		if event, ok := <-next; ok {
+			t.Errorf("expected a closed channel, got %s", event.ID)
+		}
+	}
+}
@@ -0,0 +1,457 @@
+// Package fakegithub provides an in-memory, stateful fake of the GitHub REST API endpoints used by the plugin.
+//
+// The fake reproduces the status codes and the quirks of the real API that the plugin works around:
+//   - GET /repos/{owner}/{repo}/collaborators/{username}/permission returns 200 (with permission `none`)
+//     for existing users that are not collaborators.
+//   - The legacy `permission` field reports `write` for `maintain` and `read` for `triage` (and the base role of custom roles),
+//     only `role_name` reports the actual role.
+//   - Invitations use `read`/`write` where collaborators use `pull`/`push`.
+//   - PUT /repos/{owner}/{repo}/collaborators/{username} returns 201 with an invitation for users outside the organization
+//     (updating the pending invitation, if any) and 204 for organization members and existing collaborators.
+//   - Expired invitations are still listed, with `expired: true`.
+//   - The owner of a personal repository is listed as a direct collaborator with the `admin` role.
+//   - DELETE /repos/{owner}/{repo}/collaborators/{username} returns 204 even if the user is not a collaborator.
+//   - GET /orgs/{org}/teams/{team_slug}/repos/{owner}/{repo} returns 204 without the repository media type.
+//   - Nested teams cannot be `secret`, and their privacy defaults to `closed` (`secret` for root teams).
+//   - GET /orgs/{org}/custom-repository-roles returns 404 for users and organizations without custom roles.
+//
+// Handlers build GitHub URLs with the api.github.com host, so the Client of the fake rewrites them to the test server.
+package fakegithub
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GitHubHost is the host of the GitHub API rewritten by the Client of the fake
+const GitHubHost = "api.github.com"
+
+// Base repository roles, as reported in `role_name`
+const (
+	RoleRead     = "read"
+	RoleTriage   = "triage"
+	RoleWrite    = "write"
+	RoleMaintain = "maintain"
+	RoleAdmin    = "admin"
+)
+
+// baseRoleRank orders the base roles, higher ranks include the permissions of the lower ones
+var baseRoleRank = map[string]int{RoleRead: 1, RoleTriage: 2, RoleWrite: 3, RoleMaintain: 4, RoleAdmin: 5}
+
+// Account is a user or an organization
+type Account struct {
+	ID    int64
+	Login string
+	Type  string // User or Organization
+
+	members     map[string]bool   // organization members, by lowercase login
+	customRoles map[string]string // custom repository roles (name → base role), by lowercase name
+	roleNames   map[string]string // custom repository role names, by lowercase name
+}
+
+// Repository is a repository with its direct collaborators and pending invitations
+type Repository struct {
+	ID    int64
+	Owner *Account
+	Name  string
+
+	collaborators map[string]string // role by lowercase login
+	invitations   []*Invitation
+}
+
+// Invitation is a pending repository invitation
+type Invitation struct {
+	ID          int64
+	Invitee     *Account
+	Inviter     *Account
+	Permissions string
+	CreatedAt   time.Time
+	Expired     bool
+}
+
+// Team is an organization team
+type Team struct {
+	ID                  int64
+	Org                 *Account
+	Name                string
+	Slug                string
+	Description         string
+	Privacy             string
+	NotificationSetting string
+	Parent              *Team
+	CreatedAt           time.Time
+
+	repos map[string]string // role by lowercase "owner/repo"
+}
+
+// Server is a fake GitHub API served by an httptest server
+type Server struct {
+	*httptest.Server
+
+	// Now is the clock used for creation timestamps
+	Now func() time.Time
+
+	mu       sync.Mutex
+	nextID   int64
+	token    string
+	accounts map[string]*Account    // by lowercase login
+	repos    map[string]*Repository // by lowercase "owner/repo"
+	teams    map[string]*Team       // by lowercase "org/slug"
+	requests []string
+}
+
+// New starts a fake GitHub API server, to be closed with Close
+func New() *Server {
+	s := &Server{
+		Now:      time.Now,
+		nextID:   1000,
+		accounts: make(map[string]*Account),
+		repos:    make(map[string]*Repository),
+		teams:    make(map[string]*Team),
+	}
+	s.Server = httptest.NewServer(s.routes())
+	return s
+}
+
+// Client returns an HTTP client sending the requests for api.github.com to the fake server
+func (s *Server) Client() *http.Client {
+	target, _ := url.Parse(s.URL)
+	return &http.Client{Transport: &rewriteTransport{target: target, base: s.Server.Client().Transport}}
+}
+
+// rewriteTransport rewrites the GitHub API host to the fake server
+type rewriteTransport struct {
+	target *url.URL
+	base   http.RoundTripper
+}
+
+func (t *rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != GitHubHost {
+		return nil, fmt.Errorf("fakegithub: unexpected host %s", req.URL.Host)
+	}
+	rewritten := req.Clone(req.Context())
+	rewritten.URL.Scheme = t.target.Scheme
+	rewritten.URL.Host = t.target.Host
+	rewritten.Host = t.target.Host
+	return t.base.RoundTrip(rewritten)
+}
+
+// RequireToken makes the fake answer 401 to requests without the given token
+func (s *Server) RequireToken(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = token
+}
+
+// Requests returns the requests received by the fake, as "METHOD /path?query"
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.requests...)
+}
+
+// ResetRequests clears the received requests
+func (s *Server) ResetRequests() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = nil
+}
+
+func (s *Server) newID() int64 {
+	s.nextID++
+	return s.nextID
+}
+
+// AddUser adds a user account
+func (s *Server) AddUser(login string) *Account {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addAccount(login, "User")
+}
+
+// AddOrg adds an organization with the given members, creating the member accounts as needed
+func (s *Server) AddOrg(login string, members ...string) *Account {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	org := s.addAccount(login, "Organization")
+	for _, member := range members {
+		s.addAccount(member, "User")
+		org.members[strings.ToLower(member)] = true
+	}
+	return org
+}
+
+func (s *Server) addAccount(login, accountType string) *Account {
+	if account, exists := s.accounts[strings.ToLower(login)]; exists {
+		return account
+	}
+	account := &Account{
+		ID:          s.newID(),
+		Login:       login,
+		Type:        accountType,
+		members:     make(map[string]bool),
+		customRoles: make(map[string]string),
+		roleNames:   make(map[string]string),
+	}
+	s.accounts[strings.ToLower(login)] = account
+	return account
+}
+
+// AddCustomRole adds a custom repository role to an organization
+func (s *Server) AddCustomRole(org, name, baseRole string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	account := s.accounts[strings.ToLower(org)]
+	account.customRoles[strings.ToLower(name)] = baseRole
+	account.roleNames[strings.ToLower(name)] = name
+}
+
+// AddRepo adds a repository, creating the owner as a user if it does not exist
+func (s *Server) AddRepo(owner, name string) *Repository {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	account, exists := s.accounts[strings.ToLower(owner)]
+	if !exists {
+		account = s.addAccount(owner, "User")
+	}
+	repo := &Repository{ID: s.newID(), Owner: account, Name: name, collaborators: make(map[string]string)}
+	s.repos[repoKey(owner, name)] = repo
+	return repo
+}
+
+// AddCollaborator adds a direct collaborator with the given role, creating the user as needed
+func (s *Server) AddCollaborator(owner, repo, login, role string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.addAccount(login, "User")
+	s.repos[repoKey(owner, repo)].collaborators[strings.ToLower(login)] = role
+}
+
+// AddInvitation adds a pending invitation, creating the user as needed, and returns its ID
+func (s *Server) AddInvitation(owner, repo, login, permissions string, expired bool) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.repos[repoKey(owner, repo)]
+	invitation := &Invitation{
+		ID:          s.newID(),
+		Invitee:     s.addAccount(login, "User"),
+		Inviter:     r.Owner,
+		Permissions: permissions,
+		CreatedAt:   s.Now(),
+		Expired:     expired,
+	}
+	r.invitations = append(r.invitations, invitation)
+	return invitation.ID
+}
+
+// AddTeam adds a team to an organization, nested under the parent team when parentSlug is not empty
+func (s *Server) AddTeam(org, name, parentSlug string) *Team {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	team := &Team{
+		ID:                  s.newID(),
+		Org:                 s.accounts[strings.ToLower(org)],
+		Name:                name,
+		Slug:                slugify(name),
+		Privacy:             "secret",
+		NotificationSetting: "notifications_enabled",
+		CreatedAt:           s.Now(),
+		repos:               make(map[string]string),
+	}
+	if parentSlug != "" {
+		team.Parent = s.teams[teamKey(org, parentSlug)]
+		team.Privacy = "closed"
+	}
+	s.teams[teamKey(org, team.Slug)] = team
+	return team
+}
+
+// AddTeamRepo grants a team a role on a repository
+func (s *Server) AddTeamRepo(org, teamSlug, owner, repo, role string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.teams[teamKey(org, teamSlug)].repos[repoKey(owner, repo)] = role
+}
+
+// Collaborator returns the role of a direct collaborator
+func (s *Server) Collaborator(owner, repo, login string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	role, exists := s.repos[repoKey(owner, repo)].collaborators[strings.ToLower(login)]
+	return role, exists
+}
+
+// Invitation returns the pending invitation of a user
+func (s *Server) Invitation(owner, repo, login string) (Invitation, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if invitation := s.repos[repoKey(owner, repo)].findInvitation(login); invitation != nil {
+		return *invitation, true
+	}
+	return Invitation{}, false
+}
+
+// Team returns a team by slug
+func (s *Server) Team(org, slug string) (Team, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if team, exists := s.teams[teamKey(org, slug)]; exists {
+		return *team, true
+	}
+	return Team{}, false
+}
+
+// TeamRepo returns the role of a team on a repository
+func (s *Server) TeamRepo(org, teamSlug, owner, repo string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	team, exists := s.teams[teamKey(org, teamSlug)]
+	if !exists {
+		return "", false
+	}
+	role, exists := team.repos[repoKey(owner, repo)]
+	return role, exists
+}
+
+func (r *Repository) findInvitation(login string) *Invitation {
+	for _, invitation := range r.invitations {
+		if strings.EqualFold(invitation.Invitee.Login, login) {
+			return invitation
+		}
+	}
+	return nil
+}
+
+func repoKey(owner, repo string) string {
+	return strings.ToLower(owner + "/" + repo)
+}
+
+func teamKey(org, slug string) string {
+	return strings.ToLower(org + "/" + slug)
+}
+
+var nonSlugChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// slugify computes the slug of a team name
+func slugify(name string) string {
+	return strings.Trim(nonSlugChars.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+// routes registers the fake endpoints, every request is logged and authenticated first
+func (s *Server) routes() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /repos/{owner}/{repo}/collaborators", s.listCollaborators)
+	mux.HandleFunc("GET /repos/{owner}/{repo}/collaborators/{username}", s.checkCollaborator)
+	mux.HandleFunc("PUT /repos/{owner}/{repo}/collaborators/{username}", s.putCollaborator)
+	mux.HandleFunc("DELETE /repos/{owner}/{repo}/collaborators/{username}", s.deleteCollaborator)
+	mux.HandleFunc("GET /repos/{owner}/{repo}/collaborators/{username}/permission", s.getPermission)
+	mux.HandleFunc("GET /repos/{owner}/{repo}/invitations", s.listInvitations)
+	mux.HandleFunc("PATCH /repos/{owner}/{repo}/invitations/{id}", s.patchInvitation)
+	mux.HandleFunc("DELETE /repos/{owner}/{repo}/invitations/{id}", s.deleteInvitation)
+
+	mux.HandleFunc("GET /orgs/{org}", s.getOrg)
+	mux.HandleFunc("GET /orgs/{org}/custom-repository-roles", s.listCustomRoles)
+	mux.HandleFunc("GET /orgs/{org}/teams/{team_slug}", s.getTeam)
+	mux.HandleFunc("GET /organizations/{org_id}/team/{team_id}", s.getTeamByID)
+	mux.HandleFunc("POST /orgs/{org}/teams", s.createTeam)
+	mux.HandleFunc("PATCH /orgs/{org}/teams/{team_slug}", s.updateTeam)
+	mux.HandleFunc("DELETE /orgs/{org}/teams/{team_slug}", s.deleteTeam)
+	mux.HandleFunc("GET /orgs/{org}/teams/{team_slug}/repos/{owner}/{repo}", s.checkTeamRepo)
+	mux.HandleFunc("PUT /orgs/{org}/teams/{team_slug}/repos/{owner}/{repo}", s.putTeamRepo)
+	mux.HandleFunc("DELETE /orgs/{org}/teams/{team_slug}/repos/{owner}/{repo}", s.deleteTeamRepo)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, r.Method+" "+r.URL.RequestURI())
+		token := s.token
+		s.mu.Unlock()
+
+		if token != "" && r.Header.Get("Authorization") != "token "+token && r.Header.Get("Authorization") != "Bearer "+token {
+			writeError(w, http.StatusUnauthorized, "Bad credentials")
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, v interface{}) {
+	body, _ := json.Marshal(v)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(statusCode)
+	w.Write(body)
+}
+
+func writeError(w http.ResponseWriter, statusCode int, message string) {
+	writeJSON(w, statusCode, map[string]string{
+		"message":           message,
+		"documentation_url": "https://docs.github.com/rest",
+		"status":            strconv.Itoa(statusCode),
+	})
+}
+
+// paginate returns the items of the requested page (per_page defaults to 30, up to 100)
+func paginate[T any](r *http.Request, items []T) []T {
+	perPage, err := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if err != nil || perPage <= 0 {
+		perPage = 30
+	}
+	if perPage > 100 {
+		perPage = 100
+	}
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page <= 0 {
+		page = 1
+	}
+
+	start := (page - 1) * perPage
+	if start >= len(items) {
+		return []T{}
+	}
+	end := start + perPage
+	if end > len(items) {
+		end = len(items)
+	}
+	return items[start:end]
+}
+
+// sortedKeys returns the keys of a map in order, for stable listings
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func accountJSON(account *Account) map[string]interface{} {
+	return map[string]interface{}{
+		"login":    account.Login,
+		"id":       account.ID,
+		"node_id":  fmt.Sprintf("MDQ6VXNlcj%d", account.ID),
+		"html_url": "https://github.com/" + account.Login,
+		"url":      "https://api.github.com/users/" + account.Login,
+		"type":     account.Type,
+	}
+}
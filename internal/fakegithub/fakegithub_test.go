@@ -0,0 +1,263 @@
+package fakegithub
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const testToken = "test-token-123"
+
+// do sends a request to the fake through its client, as the handlers do
+func do(t *testing.T, s *Server, method, url, body string, headers ...string) (int, map[string]interface{}) {
+	t.Helper()
+
+	var reqBody io.Reader
+	if body != "" {
+		reqBody = strings.NewReader(body)
+	}
+	req, err := http.NewRequest(method, url, reqBody)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	req.Header.Set("Authorization", "token "+testToken)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+
+	resp, err := s.Client().Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data := make(map[string]interface{})
+	b, _ := io.ReadAll(resp.Body)
+	if len(b) > 0 && b[0] == '{' {
+		if err := json.Unmarshal(b, &data); err != nil {
+			t.Fatalf("failed to decode response %s: %v", b, err)
+		}
+	}
+	return resp.StatusCode, data
+}
+
+// doList sends a GET request to the fake and decodes a list response
+func doList(t *testing.T, s *Server, url string) []map[string]interface{} {
+	t.Helper()
+
+	req, _ := http.NewRequest("GET", url, nil)
+	resp, err := s.Client().Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 listing %s, got %d", url, resp.StatusCode)
+	}
+
+	var items []map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&items); err != nil {
+		t.Fatalf("failed to decode list: %v", err)
+	}
+	return items
+}
+
+func TestAuthentication(t *testing.T) {
+	s := New()
+	defer s.Close()
+	s.AddOrg("org")
+	s.RequireToken("other-token")
+
+	if status, _ := do(t, s, "GET", "https://api.github.com/orgs/org", ""); status != http.StatusUnauthorized {
+		t.Errorf("expected 401 with a wrong token, got %d", status)
+	}
+
+	s.RequireToken(testToken)
+	if status, _ := do(t, s, "GET", "https://api.github.com/orgs/org", ""); status != http.StatusOK {
+		t.Errorf("expected 200 with the right token, got %d", status)
+	}
+	if requests := s.Requests(); len(requests) != 2 || requests[1] != "GET /orgs/org" {
+		t.Errorf("unexpected requests %v", requests)
+	}
+}
+
+func TestCollaboratorQuirks(t *testing.T) {
+	s := New()
+	defer s.Close()
+	s.AddOrg("org", "member")
+	s.AddCustomRole("org", "Security Engineer", RoleMaintain)
+	s.AddRepo("org", "repo")
+	s.AddUser("outside")
+	s.AddUser("maintainer")
+	s.AddUser("custom")
+	s.AddCollaborator("org", "repo", "maintainer", RoleMaintain)
+	s.AddCollaborator("org", "repo", "custom", "Security Engineer")
+
+	const repoURL = "https://api.github.com/repos/org/repo"
+
+	t.Run("permission of a non collaborator is none", func(t *testing.T) {
+		status, data := do(t, s, "GET", repoURL+"/collaborators/outside/permission", "")
+		if status != http.StatusOK || data["permission"] != "none" {
+			t.Errorf("expected 200 with permission none, got %d %v", status, data["permission"])
+		}
+	})
+
+	t.Run("legacy permission of maintain is write", func(t *testing.T) {
+		_, data := do(t, s, "GET", repoURL+"/collaborators/maintainer/permission", "")
+		if data["permission"] != "write" || data["role_name"] != "maintain" {
+			t.Errorf("expected permission write and role maintain, got %v %v", data["permission"], data["role_name"])
+		}
+	})
+
+	t.Run("custom role reports its base role as legacy permission", func(t *testing.T) {
+		_, data := do(t, s, "GET", repoURL+"/collaborators/custom/permission", "")
+		if data["permission"] != "write" || data["role_name"] != "Security Engineer" {
+			t.Errorf("expected permission write and role Security Engineer, got %v %v", data["permission"], data["role_name"])
+		}
+	})
+
+	t.Run("organization members are added directly", func(t *testing.T) {
+		if status, _ := do(t, s, "PUT", repoURL+"/collaborators/member", `{"permission": "pull"}`); status != http.StatusNoContent {
+			t.Errorf("expected 204, got %d", status)
+		}
+		if role, _ := s.Collaborator("org", "repo", "member"); role != RoleRead {
+			t.Errorf("expected role read, got %q", role)
+		}
+	})
+
+	t.Run("outside users are invited", func(t *testing.T) {
+		status, data := do(t, s, "PUT", repoURL+"/collaborators/outside", `{"permission": "push"}`)
+		if status != http.StatusCreated || data["permissions"] != "write" {
+			t.Errorf("expected 201 with permissions write, got %d %v", status, data["permissions"])
+		}
+		status, again := do(t, s, "PUT", repoURL+"/collaborators/outside", `{"permission": "admin"}`)
+		if status != http.StatusCreated || again["id"] != data["id"] || again["permissions"] != "admin" {
+			t.Errorf("expected the pending invitation to be updated, got %d %v", status, again)
+		}
+	})
+
+	t.Run("invalid permission", func(t *testing.T) {
+		if status, _ := do(t, s, "PUT", repoURL+"/collaborators/maintainer", `{"permission": "owner"}`); status != http.StatusUnprocessableEntity {
+			t.Errorf("expected 422, got %d", status)
+		}
+	})
+
+	t.Run("invitations reject the collaborator aliases", func(t *testing.T) {
+		invitation, _ := s.Invitation("org", "repo", "outside")
+		url := repoURL + "/invitations/" + strconv.FormatInt(invitation.ID, 10)
+		if status, _ := do(t, s, "PATCH", url, `{"permissions": "push"}`); status != http.StatusUnprocessableEntity {
+			t.Errorf("expected 422 for push, got %d", status)
+		}
+		if status, _ := do(t, s, "PATCH", url, `{"permissions": "write"}`); status != http.StatusOK {
+			t.Errorf("expected 200 for write, got %d", status)
+		}
+	})
+
+	t.Run("removing a non collaborator succeeds", func(t *testing.T) {
+		if status, _ := do(t, s, "DELETE", repoURL+"/collaborators/nobody", ""); status != http.StatusNoContent {
+			t.Errorf("expected 204, got %d", status)
+		}
+	})
+
+	t.Run("organizations without custom roles", func(t *testing.T) {
+		s.AddOrg("plain")
+		if status, _ := do(t, s, "GET", "https://api.github.com/orgs/plain/custom-repository-roles", ""); status != http.StatusNotFound {
+			t.Errorf("expected 404, got %d", status)
+		}
+	})
+}
+
+func TestExpiredInvitation(t *testing.T) {
+	s := New()
+	defer s.Close()
+	s.AddUser("owner")
+	s.AddUser("invitee")
+	s.AddRepo("owner", "repo")
+	id := s.AddInvitation("owner", "repo", "invitee", RoleRead, true)
+
+	status, data := do(t, s, "PUT", "https://api.github.com/repos/owner/repo/collaborators/invitee", `{"permission": "admin"}`)
+	if status != http.StatusCreated || data["expired"] != true || data["permissions"] != RoleRead || int64(data["id"].(float64)) != id {
+		t.Errorf("expected the expired invitation to be returned unchanged, got %d %v", status, data)
+	}
+}
+
+func TestPagination(t *testing.T) {
+	s := New()
+	defer s.Close()
+	s.AddUser("owner")
+	s.AddRepo("owner", "repo")
+	for _, login := range []string{"a", "b", "c", "d", "e"} {
+		s.AddUser(login)
+		s.AddInvitation("owner", "repo", login, RoleRead, false)
+	}
+
+	tests := []struct {
+		query    string
+		expected int
+	}{
+		{query: "", expected: 5},
+		{query: "?per_page=2", expected: 2},
+		{query: "?per_page=2&page=3", expected: 1},
+		{query: "?per_page=2&page=4", expected: 0},
+	}
+	for _, tt := range tests {
+		items := doList(t, s, "https://api.github.com/repos/owner/repo/invitations"+tt.query)
+		if len(items) != tt.expected {
+			t.Errorf("%q: expected %d invitations, got %d", tt.query, tt.expected, len(items))
+		}
+	}
+}
+
+func TestTeamQuirks(t *testing.T) {
+	s := New()
+	defer s.Close()
+	s.AddOrg("org")
+	s.AddRepo("org", "repo")
+	parent := s.AddTeam("org", "Parent", "")
+
+	const teamsURL = "https://api.github.com/orgs/org/teams"
+
+	status, data := do(t, s, "POST", teamsURL, `{"name": "Root Team"}`)
+	if status != http.StatusCreated || data["privacy"] != "secret" || data["slug"] != "root-team" {
+		t.Errorf("expected a secret root-team, got %d %v %v", status, data["privacy"], data["slug"])
+	}
+
+	status, data = do(t, s, "POST", teamsURL, `{"name": "Child", "parent_team_id": `+strconv.FormatInt(parent.ID, 10)+`}`)
+	if status != http.StatusCreated || data["privacy"] != "closed" {
+		t.Errorf("expected a closed nested team, got %d %v", status, data["privacy"])
+	}
+
+	if status, _ := do(t, s, "POST", teamsURL, `{"name": "Secret Child", "privacy": "secret", "parent_team_id": `+strconv.FormatInt(parent.ID, 10)+`}`); status != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422 for a secret nested team, got %d", status)
+	}
+	if status, _ := do(t, s, "POST", teamsURL, `{"name": "Root Team"}`); status != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422 for a duplicate team, got %d", status)
+	}
+
+	status, data = do(t, s, "PATCH", teamsURL+"/root-team", `{"name": "Renamed"}`)
+	if status != http.StatusOK || data["slug"] != "renamed" {
+		t.Errorf("expected the team to be re-slugged, got %d %v", status, data["slug"])
+	}
+	if _, exists := s.Team("org", "root-team"); exists {
+		t.Errorf("expected the old slug to be gone")
+	}
+
+	s.AddTeamRepo("org", "renamed", "org", "repo", RoleTriage)
+	if status, _ := do(t, s, "GET", teamsURL+"/renamed/repos/org/repo", ""); status != http.StatusNoContent {
+		t.Errorf("expected 204 without the repository media type, got %d", status)
+	}
+	status, data = do(t, s, "GET", teamsURL+"/renamed/repos/org/repo", "", "Accept", "application/vnd.github.v3.repository+json")
+	if status != http.StatusOK || data["role_name"] != RoleTriage {
+		t.Errorf("expected 200 with role triage, got %d %v", status, data["role_name"])
+	}
+
+	if status, _ := do(t, s, "DELETE", teamsURL+"/parent", ""); status != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", status)
+	}
+	if _, exists := s.Team("org", "child"); exists {
+		t.Errorf("expected child teams to be deleted with their parent")
+	}
+}
@@ -0,0 +1,376 @@
+package fakegithub
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// resolveRole maps a requested permission to the role stored by the fake:
+// `pull` and `push` are aliases of `read` and `write`, custom roles must be defined by the owner organization
+func resolveRole(owner *Account, permission string) (string, bool) {
+	switch strings.ToLower(permission) {
+	case "pull", RoleRead:
+		return RoleRead, true
+	case "push", RoleWrite:
+		return RoleWrite, true
+	case RoleTriage, RoleMaintain, RoleAdmin:
+		return strings.ToLower(permission), true
+	}
+	if owner != nil {
+		if name, exists := owner.roleNames[strings.ToLower(permission)]; exists {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// baseRole returns the base role of a role, for custom roles the one they extend
+func baseRole(owner *Account, role string) string {
+	if _, isBase := baseRoleRank[role]; isBase {
+		return role
+	}
+	if owner != nil {
+		if base, exists := owner.customRoles[strings.ToLower(role)]; exists {
+			return base
+		}
+	}
+	return RoleRead
+}
+
+// legacyPermission returns the value of the legacy `permission` field, which only knows read, write and admin
+func legacyPermission(owner *Account, role string) string {
+	switch baseRole(owner, role) {
+	case RoleAdmin:
+		return RoleAdmin
+	case RoleMaintain, RoleWrite:
+		return RoleWrite
+	default:
+		return RoleRead
+	}
+}
+
+// permissionsJSON returns the `permissions` object of a role
+func permissionsJSON(owner *Account, role string) map[string]bool {
+	rank := baseRoleRank[baseRole(owner, role)]
+	return map[string]bool{
+		"pull":     rank >= baseRoleRank[RoleRead],
+		"triage":   rank >= baseRoleRank[RoleTriage],
+		"push":     rank >= baseRoleRank[RoleWrite],
+		"maintain": rank >= baseRoleRank[RoleMaintain],
+		"admin":    rank >= baseRoleRank[RoleAdmin],
+	}
+}
+
+func (s *Server) repoJSON(repo *Repository) map[string]interface{} {
+	fullName := repo.Owner.Login + "/" + repo.Name
+	return map[string]interface{}{
+		"id":        repo.ID,
+		"node_id":   fmt.Sprintf("MDEwOlJlcG9zaXRvcnk%d", repo.ID),
+		"name":      repo.Name,
+		"full_name": fullName,
+		"private":   true,
+		"owner":     accountJSON(repo.Owner),
+		"html_url":  "https://github.com/" + fullName,
+		"url":       "https://api.github.com/repos/" + fullName,
+	}
+}
+
+func (s *Server) invitationJSON(repo *Repository, invitation *Invitation) map[string]interface{} {
+	return map[string]interface{}{
+		"id":          invitation.ID,
+		"node_id":     fmt.Sprintf("MDIwOlJlcG9zaXRvcnlJbnZpdGF0aW9u%d", invitation.ID),
+		"repository":  s.repoJSON(repo),
+		"invitee":     accountJSON(invitation.Invitee),
+		"inviter":     accountJSON(invitation.Inviter),
+		"permissions": invitation.Permissions,
+		"created_at":  invitation.CreatedAt.UTC().Format(time.RFC3339),
+		"url":         fmt.Sprintf("https://api.github.com/user/repository_invitations/%d", invitation.ID),
+		"html_url":    "https://github.com/" + repo.Owner.Login + "/" + repo.Name + "/invitations",
+		"expired":     invitation.Expired,
+	}
+}
+
+// lookupRepo returns the repository of the request, answering 404 when it does not exist.
+// It must be called with the lock held.
+func (s *Server) lookupRepo(w http.ResponseWriter, r *http.Request) (*Repository, bool) {
+	repo, exists := s.repos[repoKey(r.PathValue("owner"), r.PathValue("repo"))]
+	if !exists {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return nil, false
+	}
+	return repo, true
+}
+
+// readBody decodes the JSON request body, answering 400 when it is not valid
+func readBody(w http.ResponseWriter, r *http.Request) (map[string]interface{}, bool) {
+	data := make(map[string]interface{})
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Problems parsing JSON")
+		return nil, false
+	}
+	if len(body) == 0 {
+		return data, true
+	}
+	if err := json.Unmarshal(body, &data); err != nil {
+		writeError(w, http.StatusBadRequest, "Problems parsing JSON")
+		return nil, false
+	}
+	return data, true
+}
+
+func (s *Server) listCollaborators(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	repo, ok := s.lookupRepo(w, r)
+	if !ok {
+		return
+	}
+
+	collaborators := repo.collaborators
+	if repo.Owner.Type == "User" {
+		collaborators = make(map[string]string, len(repo.collaborators)+1)
+		for login, role := range repo.collaborators {
+			collaborators[login] = role
+		}
+		collaborators[strings.ToLower(repo.Owner.Login)] = RoleAdmin
+	}
+
+	var items []map[string]interface{}
+	for _, login := range sortedKeys(collaborators) {
+		role := collaborators[login]
+		item := accountJSON(s.accounts[login])
+		item["permissions"] = permissionsJSON(repo.Owner, role)
+		item["role_name"] = role
+		items = append(items, item)
+	}
+	writeJSON(w, http.StatusOK, paginate(r, items))
+}
+
+func (s *Server) checkCollaborator(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	repo, ok := s.lookupRepo(w, r)
+	if !ok {
+		return
+	}
+	if _, exists := repo.collaborators[strings.ToLower(r.PathValue("username"))]; !exists {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) getPermission(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	repo, ok := s.lookupRepo(w, r)
+	if !ok {
+		return
+	}
+	user, exists := s.accounts[strings.ToLower(r.PathValue("username"))]
+	if !exists {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	// Quirk: users that are not collaborators (e.g. removed ones) get 200 with permission none
+	role, isCollaborator := repo.collaborators[strings.ToLower(user.Login)]
+	permission, permissions := "none", map[string]bool{"pull": false, "triage": false, "push": false, "maintain": false, "admin": false}
+	roleName := "none"
+	if isCollaborator {
+		permission, permissions, roleName = legacyPermission(repo.Owner, role), permissionsJSON(repo.Owner, role), role
+	}
+
+	userJSON := accountJSON(user)
+	userJSON["permissions"] = permissions
+	userJSON["role_name"] = roleName
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"permission": permission,
+		"role_name":  roleName,
+		"user":       userJSON,
+	})
+}
+
+func (s *Server) putCollaborator(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	repo, ok := s.lookupRepo(w, r)
+	if !ok {
+		return
+	}
+	user, exists := s.accounts[strings.ToLower(r.PathValue("username"))]
+	if !exists {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	data, ok := readBody(w, r)
+	if !ok {
+		return
+	}
+
+	permission := "push"
+	if value, exists := data["permission"]; exists {
+		permission, _ = value.(string)
+	}
+	role, valid := resolveRole(repo.Owner, permission)
+	if !valid {
+		writeError(w, http.StatusUnprocessableEntity, "Validation Failed")
+		return
+	}
+
+	login := strings.ToLower(user.Login)
+	if _, isCollaborator := repo.collaborators[login]; isCollaborator || repo.Owner.members[login] {
+		repo.collaborators[login] = role
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// Quirk: a pending invitation is returned again (even when expired) instead of sending a new one
+	invitation := repo.findInvitation(user.Login)
+	if invitation == nil {
+		invitation = &Invitation{ID: s.newID(), Invitee: user, Inviter: repo.Owner, CreatedAt: s.Now()}
+		repo.invitations = append(repo.invitations, invitation)
+	}
+	if !invitation.Expired {
+		invitation.Permissions = role
+	}
+	writeJSON(w, http.StatusCreated, s.invitationJSON(repo, invitation))
+}
+
+func (s *Server) deleteCollaborator(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	repo, ok := s.lookupRepo(w, r)
+	if !ok {
+		return
+	}
+	// Quirk: 204 even if the user is not a collaborator
+	delete(repo.collaborators, strings.ToLower(r.PathValue("username")))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) listInvitations(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	repo, ok := s.lookupRepo(w, r)
+	if !ok {
+		return
+	}
+
+	items := make([]map[string]interface{}, 0, len(repo.invitations))
+	for _, invitation := range repo.invitations {
+		items = append(items, s.invitationJSON(repo, invitation))
+	}
+	writeJSON(w, http.StatusOK, paginate(r, items))
+}
+
+// lookupInvitation returns the invitation of the request, answering 404 when it does not exist.
+// It must be called with the lock held.
+func (s *Server) lookupInvitation(w http.ResponseWriter, r *http.Request) (*Repository, int, bool) {
+	repo, ok := s.lookupRepo(w, r)
+	if !ok {
+		return nil, 0, false
+	}
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err == nil {
+		for i, invitation := range repo.invitations {
+			if invitation.ID == id {
+				return repo, i, true
+			}
+		}
+	}
+	writeError(w, http.StatusNotFound, "Not Found")
+	return nil, 0, false
+}
+
+func (s *Server) patchInvitation(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	repo, index, ok := s.lookupInvitation(w, r)
+	if !ok {
+		return
+	}
+	data, ok := readBody(w, r)
+	if !ok {
+		return
+	}
+
+	invitation := repo.invitations[index]
+	if value, exists := data["permissions"]; exists {
+		permissions, _ := value.(string)
+		// Invitations only accept read and write, not their pull and push aliases
+		if strings.EqualFold(permissions, "pull") || strings.EqualFold(permissions, "push") {
+			writeError(w, http.StatusUnprocessableEntity, "Validation Failed")
+			return
+		}
+		role, valid := resolveRole(repo.Owner, permissions)
+		if !valid {
+			writeError(w, http.StatusUnprocessableEntity, "Validation Failed")
+			return
+		}
+		invitation.Permissions = role
+	}
+	writeJSON(w, http.StatusOK, s.invitationJSON(repo, invitation))
+}
+
+func (s *Server) deleteInvitation(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	repo, index, ok := s.lookupInvitation(w, r)
+	if !ok {
+		return
+	}
+	repo.invitations = append(repo.invitations[:index], repo.invitations[index+1:]...)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) getOrg(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	org, exists := s.accounts[strings.ToLower(r.PathValue("org"))]
+	if !exists || org.Type != "Organization" {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	writeJSON(w, http.StatusOK, accountJSON(org))
+}
+
+func (s *Server) listCustomRoles(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	org, exists := s.accounts[strings.ToLower(r.PathValue("org"))]
+	if !exists || org.Type != "Organization" || len(org.customRoles) == 0 {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	var customRoles []map[string]interface{}
+	for i, key := range sortedKeys(org.customRoles) {
+		customRoles = append(customRoles, map[string]interface{}{
+			"id":          i + 1,
+			"name":        org.roleNames[key],
+			"base_role":   org.customRoles[key],
+			"permissions": []string{},
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"total_count":  len(customRoles),
+		"custom_roles": customRoles,
+	})
+}
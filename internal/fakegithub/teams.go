@@ -0,0 +1,307 @@
+package fakegithub
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func (s *Server) teamURL(team *Team) string {
+	return "https://api.github.com/organizations/" + strconv.FormatInt(team.Org.ID, 10) + "/team/" + strconv.FormatInt(team.ID, 10)
+}
+
+// teamSummaryJSON returns the fields shared by teams and parent teams
+func (s *Server) teamSummaryJSON(team *Team) map[string]interface{} {
+	return map[string]interface{}{
+		"id":                   team.ID,
+		"node_id":              "MDQ6VGVhbT" + strconv.FormatInt(team.ID, 10),
+		"url":                  s.teamURL(team),
+		"html_url":             "https://github.com/orgs/" + team.Org.Login + "/teams/" + team.Slug,
+		"name":                 team.Name,
+		"slug":                 team.Slug,
+		"description":          team.Description,
+		"privacy":              team.Privacy,
+		"notification_setting": team.NotificationSetting,
+		"permission":           "pull",
+		"members_url":          s.teamURL(team) + "/members{/member}",
+		"repositories_url":     s.teamURL(team) + "/repos",
+	}
+}
+
+func (s *Server) teamJSON(team *Team) map[string]interface{} {
+	data := s.teamSummaryJSON(team)
+	data["parent"] = nil
+	if team.Parent != nil {
+		data["parent"] = s.teamSummaryJSON(team.Parent)
+	}
+	data["members_count"] = 0
+	data["repos_count"] = len(team.repos)
+	data["created_at"] = team.CreatedAt.UTC().Format(time.RFC3339)
+	data["updated_at"] = team.CreatedAt.UTC().Format(time.RFC3339)
+	data["organization"] = accountJSON(team.Org)
+	return data
+}
+
+// lookupOrg returns the organization of the request, answering 404 when it does not exist.
+// It must be called with the lock held.
+func (s *Server) lookupOrg(w http.ResponseWriter, r *http.Request) (*Account, bool) {
+	org, exists := s.accounts[strings.ToLower(r.PathValue("org"))]
+	if !exists || org.Type != "Organization" {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return nil, false
+	}
+	return org, true
+}
+
+// lookupTeam returns the team of the request, answering 404 when it does not exist.
+// It must be called with the lock held.
+func (s *Server) lookupTeam(w http.ResponseWriter, r *http.Request) (*Team, bool) {
+	team, exists := s.teams[teamKey(r.PathValue("org"), r.PathValue("team_slug"))]
+	if !exists {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return nil, false
+	}
+	return team, true
+}
+
+// teamByID returns a team of an organization by ID. It must be called with the lock held.
+func (s *Server) teamByID(org *Account, id int64) *Team {
+	for _, team := range s.teams {
+		if team.Org == org && team.ID == id {
+			return team
+		}
+	}
+	return nil
+}
+
+func (s *Server) getTeam(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	team, ok := s.lookupTeam(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, s.teamJSON(team))
+}
+
+func (s *Server) getTeamByID(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	orgID, _ := strconv.ParseInt(r.PathValue("org_id"), 10, 64)
+	teamID, _ := strconv.ParseInt(r.PathValue("team_id"), 10, 64)
+	for _, account := range s.accounts {
+		if account.ID == orgID {
+			if team := s.teamByID(account, teamID); team != nil {
+				writeJSON(w, http.StatusOK, s.teamJSON(team))
+				return
+			}
+		}
+	}
+	writeError(w, http.StatusNotFound, "Not Found")
+}
+
+// applyTeamFields applies the fields of a create or update request to a team, returning a validation message on failure.
+// It must be called with the lock held.
+func (s *Server) applyTeamFields(team *Team, data map[string]interface{}) string {
+	if value, exists := data["name"]; exists {
+		name, _ := value.(string)
+		if name == "" {
+			return "Validation Failed: name is missing"
+		}
+		if other, exists := s.teams[teamKey(team.Org.Login, slugify(name))]; exists && other != team {
+			return "Validation Failed: name must be unique for this org"
+		}
+		team.Name, team.Slug = name, slugify(name)
+	}
+	if value, exists := data["description"]; exists {
+		team.Description, _ = value.(string)
+	}
+	if value, exists := data["notification_setting"]; exists {
+		team.NotificationSetting, _ = value.(string)
+	}
+
+	if value, exists := data["parent_team_id"]; exists {
+		if value == nil {
+			team.Parent = nil
+		} else {
+			id, _ := value.(float64)
+			parent := s.teamByID(team.Org, int64(id))
+			if parent == nil || parent == team {
+				return "Validation Failed: parent_team_id is not valid"
+			}
+			team.Parent = parent
+		}
+	}
+
+	privacy, _ := data["privacy"].(string)
+	switch privacy {
+	case "":
+		// Quirk: nested teams default to closed, root teams to secret
+		if team.Privacy == "" && team.Parent == nil {
+			team.Privacy = "secret"
+		} else if team.Privacy == "" || team.Parent != nil {
+			team.Privacy = "closed"
+		}
+	case "secret", "closed":
+		team.Privacy = privacy
+	default:
+		return "Validation Failed: privacy is not valid"
+	}
+	if team.Parent != nil && team.Privacy == "secret" {
+		return "Validation Failed: a team cannot be secret if it has a parent"
+	}
+	return ""
+}
+
+func (s *Server) createTeam(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	org, ok := s.lookupOrg(w, r)
+	if !ok {
+		return
+	}
+	data, ok := readBody(w, r)
+	if !ok {
+		return
+	}
+	if _, exists := data["name"]; !exists {
+		writeError(w, http.StatusUnprocessableEntity, "Validation Failed: name is missing")
+		return
+	}
+
+	team := &Team{Org: org, NotificationSetting: "notifications_enabled", CreatedAt: s.Now(), repos: make(map[string]string)}
+	if message := s.applyTeamFields(team, data); message != "" {
+		writeError(w, http.StatusUnprocessableEntity, message)
+		return
+	}
+	team.ID = s.newID()
+	s.teams[teamKey(org.Login, team.Slug)] = team
+	writeJSON(w, http.StatusCreated, s.teamJSON(team))
+}
+
+func (s *Server) updateTeam(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	team, ok := s.lookupTeam(w, r)
+	if !ok {
+		return
+	}
+	data, ok := readBody(w, r)
+	if !ok {
+		return
+	}
+
+	updated := *team
+	if message := s.applyTeamFields(&updated, data); message != "" {
+		writeError(w, http.StatusUnprocessableEntity, message)
+		return
+	}
+	delete(s.teams, teamKey(team.Org.Login, team.Slug))
+	*team = updated
+	s.teams[teamKey(team.Org.Login, team.Slug)] = team
+	writeJSON(w, http.StatusOK, s.teamJSON(team))
+}
+
+func (s *Server) deleteTeam(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	team, ok := s.lookupTeam(w, r)
+	if !ok {
+		return
+	}
+	s.removeTeam(team)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// removeTeam removes a team along with its child teams. It must be called with the lock held.
+func (s *Server) removeTeam(team *Team) {
+	delete(s.teams, teamKey(team.Org.Login, team.Slug))
+	for _, child := range s.teams {
+		if child.Parent == team {
+			s.removeTeam(child)
+		}
+	}
+}
+
+// lookupTeamRepo returns the team and the repository of the request, answering 404 when one of them does not exist.
+// It must be called with the lock held.
+func (s *Server) lookupTeamRepo(w http.ResponseWriter, r *http.Request) (*Team, *Repository, bool) {
+	team, ok := s.lookupTeam(w, r)
+	if !ok {
+		return nil, nil, false
+	}
+	repo, ok := s.lookupRepo(w, r)
+	if !ok {
+		return nil, nil, false
+	}
+	return team, repo, true
+}
+
+func (s *Server) checkTeamRepo(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	team, repo, ok := s.lookupTeamRepo(w, r)
+	if !ok {
+		return
+	}
+	role, exists := team.repos[repoKey(repo.Owner.Login, repo.Name)]
+	if !exists {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	// Quirk: the repository (with the team permissions) is only returned with the repository media type
+	if !strings.Contains(r.Header.Get("Accept"), "application/vnd.github.v3.repository+json") {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	data := s.repoJSON(repo)
+	data["permissions"] = permissionsJSON(team.Org, role)
+	data["role_name"] = role
+	writeJSON(w, http.StatusOK, data)
+}
+
+func (s *Server) putTeamRepo(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	team, repo, ok := s.lookupTeamRepo(w, r)
+	if !ok {
+		return
+	}
+	data, ok := readBody(w, r)
+	if !ok {
+		return
+	}
+
+	permission := "push"
+	if value, exists := data["permission"]; exists {
+		permission, _ = value.(string)
+	}
+	role, valid := resolveRole(team.Org, permission)
+	if !valid {
+		writeError(w, http.StatusUnprocessableEntity, "Validation Failed")
+		return
+	}
+	team.repos[repoKey(repo.Owner.Login, repo.Name)] = role
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) deleteTeamRepo(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	team, repo, ok := s.lookupTeamRepo(w, r)
+	if !ok {
+		return
+	}
+	delete(team.repos, repoKey(repo.Owner.Login, repo.Name))
+	w.WriteHeader(http.StatusNoContent)
+}
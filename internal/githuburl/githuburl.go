@@ -0,0 +1,89 @@
+// Package githuburl builds the GitHub API URLs from user input.
+//
+// Owners, repositories, usernames, organizations and team slugs come from the request paths (and bodies):
+// they are validated against the GitHub naming rules before any call is made, and each path segment is escaped,
+// so that input like `..%2F` or `?` cannot rewrite the upstream path.
+package githuburl
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// BaseURL is the base URL of the GitHub REST API
+const BaseURL = "https://api.github.com"
+
+// Kind is a kind of name used in GitHub API paths
+type Kind string
+
+const (
+	// Login is a user or organization login (owner, username, org)
+	Login Kind = "login"
+	// Repository is a repository name
+	Repository Kind = "repository name"
+	// TeamSlug is the slug of a team
+	TeamSlug Kind = "team slug"
+)
+
+var (
+	// Logins are alphanumeric with hyphens, managed users (EMU) have an underscore and the enterprise shortcode
+	loginPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,63}$`)
+	// Repository names are made of alphanumerics, hyphens, underscores and dots
+	repositoryPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,100}$`)
+	// Team slugs are derived from the team names: alphanumerics, hyphens, underscores and dots
+	teamSlugPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,255}$`)
+)
+
+// Error reports a name that is not valid for its kind
+type Error struct {
+	Kind  Kind
+	Value string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("invalid %s %q", e.Kind, e.Value)
+}
+
+// Validate checks a name against the GitHub naming rules of its kind
+func Validate(kind Kind, value string) error {
+	var pattern *regexp.Regexp
+	switch kind {
+	case Login:
+		pattern = loginPattern
+	case Repository:
+		pattern = repositoryPattern
+	case TeamSlug:
+		pattern = teamSlugPattern
+	default:
+		return fmt.Errorf("unknown kind %q", kind)
+	}
+
+	if !pattern.MatchString(value) || value == "." || value == ".." {
+		return &Error{Kind: kind, Value: value}
+	}
+	return nil
+}
+
+// Join returns the GitHub API URL of the path segments, each of them escaped.
+// Dot segments are escaped as well, so that they are not resolved as relative paths.
+func Join(segments ...string) string {
+	var b strings.Builder
+	b.WriteString(BaseURL)
+	for _, segment := range segments {
+		b.WriteByte('/')
+		b.WriteString(escapeSegment(segment))
+	}
+	return b.String()
+}
+
+func escapeSegment(segment string) string {
+	switch segment {
+	case ".":
+		return "%2E"
+	case "..":
+		return "%2E%2E"
+	}
+	return url.PathEscape(segment)
+}
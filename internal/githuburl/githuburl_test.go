@@ -0,0 +1,122 @@
+package githuburl
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		kind  Kind
+		value string
+		valid bool
+	}{
+		{kind: Login, value: "octocat", valid: true},
+		{kind: Login, value: "krateoplatformops", valid: true},
+		{kind: Login, value: "mona-lisa", valid: true},
+		{kind: Login, value: "octocat_acme", valid: true},
+		{kind: Login, value: "0", valid: true},
+		{kind: Login, value: "", valid: false},
+		{kind: Login, value: "-octocat", valid: false},
+		{kind: Login, value: "octo cat", valid: false},
+		{kind: Login, value: "octocat/../admin", valid: false},
+		{kind: Login, value: "..", valid: false},
+		{kind: Login, value: "octocat?per_page=1", valid: false},
+		{kind: Login, value: strings.Repeat("a", 65), valid: false},
+		{kind: Repository, value: "github-rest-dynamic-controller-plugin", valid: true},
+		{kind: Repository, value: ".github", valid: true},
+		{kind: Repository, value: "my_repo.v2", valid: true},
+		{kind: Repository, value: ".", valid: false},
+		{kind: Repository, value: "..", valid: false},
+		{kind: Repository, value: "..%2F", valid: false},
+		{kind: Repository, value: "repo#fragment", valid: false},
+		{kind: Repository, value: strings.Repeat("a", 101), valid: false},
+		{kind: TeamSlug, value: "krateo-team", valid: true},
+		{kind: TeamSlug, value: "team_1", valid: true},
+		{kind: TeamSlug, value: "team/members", valid: false},
+		{kind: TeamSlug, value: "", valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.kind)+" "+tt.value, func(t *testing.T) {
+			err := Validate(tt.kind, tt.value)
+			if (err == nil) != tt.valid {
+				t.Fatalf("expected valid %v, got error %v", tt.valid, err)
+			}
+			var invalidName *Error
+			if err != nil && !errors.As(err, &invalidName) {
+				t.Errorf("expected an *Error, got %T", err)
+			}
+		})
+	}
+}
+
+func TestJoin(t *testing.T) {
+	tests := []struct {
+		segments []string
+		expected string
+	}{
+		{segments: []string{"repos", "octocat", "hello-world", "collaborators", "mona"}, expected: "https://api.github.com/repos/octocat/hello-world/collaborators/mona"},
+		{segments: []string{"orgs", "krateo", "teams", "a b"}, expected: "https://api.github.com/orgs/krateo/teams/a%20b"},
+		{segments: []string{"repos", "..", "x?y#z"}, expected: "https://api.github.com/repos/%2E%2E/x%3Fy%23z"},
+		{segments: []string{"repos", "../orgs"}, expected: "https://api.github.com/repos/..%2Forgs"},
+	}
+
+	for _, tt := range tests {
+		if joined := Join(tt.segments...); joined != tt.expected {
+			t.Errorf("expected %s, got %s", tt.expected, joined)
+		}
+	}
+}
+
+// FuzzJoin checks that any segment stays a single path segment of the GitHub API URL
+func FuzzJoin(f *testing.F) {
+	for _, seed := range []string{"octocat", "..", ".", "..%2F", "a/b", "?", "#", "%", "a b", "\x00", "é"} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, segment string) {
+		joined := Join("repos", segment, "collaborators")
+
+		parsed, err := url.Parse(joined)
+		if err != nil {
+			t.Fatalf("failed to parse %q: %v", joined, err)
+		}
+		if parsed.Host != "api.github.com" || parsed.RawQuery != "" || parsed.Fragment != "" {
+			t.Fatalf("segment %q rewrote the URL %q", segment, joined)
+		}
+		parts := strings.Split(parsed.EscapedPath(), "/")
+		if len(parts) != 4 || parts[1] != "repos" || parts[3] != "collaborators" {
+			t.Fatalf("segment %q changed the path %q", segment, parsed.EscapedPath())
+		}
+		if parts[2] == "." || parts[2] == ".." {
+			t.Fatalf("segment %q left a dot segment in %q", segment, joined)
+		}
+		if unescaped, err := url.PathUnescape(parts[2]); err != nil || unescaped != segment {
+			t.Fatalf("segment %q escaped to %q, unescaped as %q (%v)", segment, parts[2], unescaped, err)
+		}
+	})
+}
+
+// FuzzValidate checks that valid names never need escaping
+func FuzzValidate(f *testing.F) {
+	for _, seed := range []string{"octocat", "mona-lisa", "octocat_acme", ".github", "..", "..%2F", "a/b", "a?b"} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, value string) {
+		for _, kind := range []Kind{Login, Repository, TeamSlug} {
+			if Validate(kind, value) != nil {
+				continue
+			}
+			if value == "" || value == "." || value == ".." {
+				t.Fatalf("%s %q should not be valid", kind, value)
+			}
+			if escaped := url.PathEscape(value); escaped != value {
+				t.Fatalf("valid %s %q needs escaping: %q", kind, value, escaped)
+			}
+		}
+	})
+}
@@ -0,0 +1,81 @@
+// Package accesslog logs one line per request served by the plugin: method, route pattern, status, size, latency,
+// and the GitHub API calls and cache hits it took.
+//
+// Routes are logged by their pattern, not by their path, so that the lines can be grouped by route.
+// Logging every request can be too verbose in production: requests can be sampled, while the failed and the slow ones are always logged.
+package accesslog
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/handlers"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/requeststats"
+	"github.com/rs/zerolog"
+)
+
+// Config of the access log
+type Config struct {
+	SampleEvery   int           // Log one in SampleEvery requests (1 logs all of them, 0 none but the failed and the slow ones)
+	SlowThreshold time.Duration // Requests lasting at least this long are always logged (0 to disable)
+	QuietRoutes   []string      // Route patterns logged only when failed or slow, e.g. the health checks
+}
+
+// Handler logs the requests served by next, with the patterns of mux as route labels.
+// Server errors (5xx) and slow requests are always logged, at warning level; the others are sampled.
+func Handler(log *zerolog.Logger, config Config, mux *http.ServeMux, next http.Handler) http.Handler {
+	var served atomic.Uint64
+	quiet := make(map[string]bool, len(config.QuietRoutes))
+	for _, pattern := range config.QuietRoutes {
+		quiet[pattern] = true
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ctx, stats := requeststats.NewContext(r.Context())
+		recorder := handlers.NewResponseRecorder(w, false)
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+		duration := time.Since(start)
+
+		_, pattern := mux.Handler(r)
+		if pattern == "" {
+			pattern = "unmatched"
+		}
+
+		failed := recorder.StatusCode() >= http.StatusInternalServerError
+		slow := config.SlowThreshold > 0 && duration >= config.SlowThreshold
+		if !failed && !slow && (quiet[pattern] || !sample(&served, config.SampleEvery)) {
+			return
+		}
+
+		calls, upstreamDuration := stats.Calls()
+
+		event := log.Info()
+		if failed || slow {
+			event = log.Warn()
+		}
+		event = event.
+			Str("method", r.Method).
+			Str("route", pattern).
+			Int("status", recorder.StatusCode()).
+			Int64("bytes", recorder.Bytes()).
+			Dur("duration", duration).
+			Int("upstream_calls", calls).
+			Dur("upstream_duration", upstreamDuration).
+			Int("cache_hits", stats.CacheHits()).
+			Bool("slow", slow)
+		if requestID := r.Header.Get(handlers.RequestIDHeader); requestID != "" {
+			event = event.Str("request_id", requestID)
+		}
+		if githubRequestIDs := stats.GitHubRequestIDs(); len(githubRequestIDs) > 0 {
+			event = event.Strs("github_request_ids", githubRequestIDs)
+		}
+		event.Msg("Request served")
+	})
+}
+
+// sample reports whether the request is one in `every` requests, counted by served
+func sample(served *atomic.Uint64, every int) bool {
+	return every > 0 && served.Add(1)%uint64(every) == 0
+}
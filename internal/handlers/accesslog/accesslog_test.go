@@ -0,0 +1,165 @@
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/handlers"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/requeststats"
+	"github.com/rs/zerolog"
+)
+
+const teamPattern = "GET /team/orgs/{org}/teams/{team_slug}"
+
+// newMux returns a mux with a team route costing two GitHub API calls and a cache hit, a failing route,
+// a slow route and a health check
+func newMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc(teamPattern, func(w http.ResponseWriter, r *http.Request) {
+		stats := requeststats.FromContext(r.Context())
+		stats.AddCall(100*time.Millisecond, "0400:1")
+		stats.AddCall(50*time.Millisecond, "0400:2")
+		stats.AddCacheHit()
+		w.Write([]byte(`{"slug": "devs"}`))
+	})
+	mux.HandleFunc("DELETE /team/orgs/{org}/teams/{team_slug}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.WriteError(w, r, http.StatusBadGateway, "GitHub API returned error 502")
+	})
+	mux.HandleFunc("PATCH /team/orgs/{org}/teams/{team_slug}", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+	})
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {})
+	return mux
+}
+
+// logLines returns the log lines written to out, decoded
+func logLines(t *testing.T, out *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var lines []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("invalid log line %q: %v", line, err)
+		}
+		lines = append(lines, entry)
+	}
+	return lines
+}
+
+func TestHandler(t *testing.T) {
+	var out bytes.Buffer
+	logger := zerolog.New(&out)
+	mux := newMux()
+	handler := Handler(&logger, Config{SampleEvery: 1}, mux, mux)
+
+	req := httptest.NewRequest("GET", "/team/orgs/krateo/teams/devs", nil)
+	req.Header.Set(handlers.RequestIDHeader, "request-1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	lines := logLines(t, &out)
+	if len(lines) != 1 {
+		t.Fatalf("expected 1 log line, got %d", len(lines))
+	}
+	expected := map[string]any{
+		"level":              "info",
+		"message":            "Request served",
+		"method":             "GET",
+		"route":              teamPattern,
+		"status":             float64(http.StatusOK),
+		"bytes":              float64(len(`{"slug": "devs"}`)),
+		"upstream_calls":     float64(2),
+		"upstream_duration":  float64(150),
+		"cache_hits":         float64(1),
+		"slow":               false,
+		"request_id":         "request-1",
+		"github_request_ids": []any{"0400:1", "0400:2"},
+	}
+	for key, value := range expected {
+		if got, _ := json.Marshal(lines[0][key]); string(got) != mustMarshal(value) {
+			t.Errorf("expected %s to be %v, got %v", key, value, lines[0][key])
+		}
+	}
+	if _, ok := lines[0]["duration"]; !ok {
+		t.Error("expected the latency to be logged")
+	}
+
+	// Paths not matching any route are logged as such, not by path
+	out.Reset()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/unknown/path", nil))
+	if lines := logLines(t, &out); len(lines) != 1 || lines[0]["route"] != "unmatched" || lines[0]["status"] != float64(http.StatusNotFound) {
+		t.Errorf("expected the unmatched request to be logged without its path, got %v", lines)
+	}
+}
+
+func mustMarshal(value any) string {
+	b, _ := json.Marshal(value)
+	return string(b)
+}
+
+func TestHandler_Sampling(t *testing.T) {
+	tests := []struct {
+		name           string
+		config         Config
+		method         string
+		path           string
+		requests       int
+		expectedLines  int
+		expectedLevel  string
+		expectedIsSlow bool
+	}{
+		{name: "all requests", config: Config{SampleEvery: 1}, method: "GET", path: "/team/orgs/krateo/teams/devs", requests: 4, expectedLines: 4, expectedLevel: "info"},
+		{name: "one in two", config: Config{SampleEvery: 2}, method: "GET", path: "/team/orgs/krateo/teams/devs", requests: 4, expectedLines: 2, expectedLevel: "info"},
+		{name: "sampling disabled", config: Config{}, method: "GET", path: "/team/orgs/krateo/teams/devs", requests: 4, expectedLines: 0},
+		{name: "server errors are always logged", config: Config{}, method: "DELETE", path: "/team/orgs/krateo/teams/devs", requests: 3, expectedLines: 3, expectedLevel: "warn"},
+		{name: "slow requests are always logged", config: Config{SlowThreshold: 10 * time.Millisecond}, method: "PATCH", path: "/team/orgs/krateo/teams/devs", requests: 2, expectedLines: 2, expectedLevel: "warn", expectedIsSlow: true},
+		{name: "fast requests are sampled", config: Config{SlowThreshold: time.Minute}, method: "PATCH", path: "/team/orgs/krateo/teams/devs", requests: 2, expectedLines: 0},
+		{name: "quiet routes", config: Config{SampleEvery: 1, QuietRoutes: []string{"GET /healthz"}}, method: "GET", path: "/healthz", requests: 3, expectedLines: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			logger := zerolog.New(&out)
+			mux := newMux()
+			handler := Handler(&logger, tt.config, mux, mux)
+
+			for range tt.requests {
+				handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tt.method, tt.path, nil))
+			}
+
+			lines := logLines(t, &out)
+			if len(lines) != tt.expectedLines {
+				t.Fatalf("expected %d log lines, got %d", tt.expectedLines, len(lines))
+			}
+			for _, line := range lines {
+				if line["level"] != tt.expectedLevel || line["slow"] != tt.expectedIsSlow {
+					t.Errorf("expected level %s and slow %v, got %v", tt.expectedLevel, tt.expectedIsSlow, line)
+				}
+			}
+		})
+	}
+}
+
+func TestHandler_Flush(t *testing.T) {
+	logger := zerolog.Nop()
+	handler := Handler(&logger, Config{SampleEvery: 1}, http.NewServeMux(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("event"))
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Errorf("expected the response to be flushed through the access log, got %v", err)
+		}
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/webhooks/events", nil))
+	if !rr.Flushed {
+		t.Error("expected the response to be flushed")
+	}
+}
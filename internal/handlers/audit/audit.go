@@ -0,0 +1,185 @@
+// Package audit records the mutating requests served by the plugin to append-only sinks.
+//
+// Every record identifies the caller (token hash and GitHub login), the target resource with its value
+// before the request and the requested one, the status of the response and the mutating GitHub API calls made.
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/handlers"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/handlers/dryrun"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/redact"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/utils"
+	"github.com/rs/zerolog"
+)
+
+// Record is an audit record of a mutating request
+type Record struct {
+	Time           time.Time       `json:"time"`
+	RequestID      string          `json:"request_id,omitempty"`
+	Caller         Caller          `json:"caller"`
+	Method         string          `json:"method"`
+	Resource       string          `json:"resource"`                  // Path of the target resource
+	OldValue       json.RawMessage `json:"old_value,omitempty"`       // Resource before the request, when it existed
+	NewValue       json.RawMessage `json:"new_value,omitempty"`       // Requested value (request body)
+	Status         int             `json:"status"`                    // Status of the plugin response
+	UpstreamStatus int             `json:"upstream_status,omitempty"` // Status of the last mutating GitHub API call
+	Upstream       []UpstreamCall  `json:"upstream"`
+}
+
+// Caller identifies the caller of a request without keeping its token
+type Caller struct {
+	TokenHash string `json:"token_hash"`
+	Login     string `json:"login,omitempty"` // GitHub login of the token, when it can be resolved
+}
+
+// UpstreamCall is a mutating GitHub API call made while serving a request
+type UpstreamCall struct {
+	Method          string `json:"method"`
+	URL             string `json:"url"`
+	Status          int    `json:"status,omitempty"`
+	GitHubRequestID string `json:"github_request_id,omitempty"` // X-GitHub-Request-Id of the response
+	Error           string `json:"error,omitempty"`
+}
+
+// Sink stores audit records
+type Sink interface {
+	Write(ctx context.Context, record Record) error
+}
+
+// Auditor records the mutating requests to its sinks
+type Auditor struct {
+	log        *zerolog.Logger
+	reader     http.Handler
+	identities *Identities
+	sinks      []Sink
+	now        func() time.Time
+}
+
+// New creates an Auditor writing to the given sinks.
+// reader serves the GET requests reading the value of the resources before they are changed (e.g. the plugin mux),
+// identities resolves the GitHub login of the callers (optional).
+func New(log *zerolog.Logger, reader http.Handler, identities *Identities, sinks ...Sink) *Auditor {
+	return &Auditor{
+		log:        log,
+		reader:     reader,
+		identities: identities,
+		sinks:      sinks,
+		now:        time.Now,
+	}
+}
+
+// CurrentPath returns the path (and query) of the GET request reading the current value of the target resource of a request.
+// An empty path means that the value is not read (e.g. resource creation).
+type CurrentPath func(r *http.Request) string
+
+// SamePath reads the current value from the GET endpoint of the same path
+func SamePath(r *http.Request) string {
+	return r.URL.Path
+}
+
+// Handler wraps a mutating handler to record its requests.
+// Dry-run requests are not recorded since they change nothing. With a nil Auditor, next is returned as is.
+func Handler(auditor *Auditor, current CurrentPath, next http.Handler) http.Handler {
+	if auditor == nil || len(auditor.sinks) == 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if dryRun, err := dryrun.Enabled(r); err != nil || dryRun {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			handlers.WriteError(w, r, http.StatusBadRequest, "Error reading request body: "+err.Error())
+			return
+		}
+		r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		authHeader := r.Header.Get("Authorization")
+		record := Record{
+			Time:      auditor.now().UTC(),
+			RequestID: r.Header.Get(handlers.RequestIDHeader),
+			Caller:    Caller{TokenHash: utils.HashToken(authHeader)},
+			Method:    r.Method,
+			Resource:  r.URL.Path,
+			NewValue:  rawJSON(body),
+		}
+		if auditor.identities != nil {
+			record.Caller.Login = auditor.identities.Login(r.Context(), authHeader)
+		}
+		if current != nil {
+			if path := current(r); path != "" {
+				record.OldValue = auditor.read(r, path)
+			}
+		}
+
+		calls := &trail{}
+		recorder := handlers.NewResponseRecorder(w, false)
+		next.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), trailKey{}, calls)))
+
+		record.Status = recorder.StatusCode()
+		record.Upstream = calls.list()
+		if len(record.Upstream) > 0 {
+			record.UpstreamStatus = record.Upstream[len(record.Upstream)-1].Status
+		}
+		auditor.write(context.WithoutCancel(r.Context()), r.Pattern, record)
+	})
+}
+
+// read serves a GET request of path with the credentials of r, returning the body of a successful response
+func (a *Auditor) read(r *http.Request, path string) json.RawMessage {
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, path, nil)
+	if err != nil {
+		a.log.Error().Err(err).Str("route", r.Pattern).Str("path", path).Msg("Audit: failed to create the request reading the resource")
+		return nil
+	}
+	req.Header.Set("Authorization", r.Header.Get("Authorization"))
+	if requestID := r.Header.Get(handlers.RequestIDHeader); requestID != "" {
+		req.Header.Set(handlers.RequestIDHeader, requestID)
+	}
+
+	recorder := handlers.NewResponseRecorder(nil, true)
+	a.reader.ServeHTTP(recorder, req)
+	if recorder.StatusCode() != http.StatusOK && recorder.StatusCode() != http.StatusAccepted {
+		return nil // The resource does not exist (or cannot be read)
+	}
+	return rawJSON(recorder.Body())
+}
+
+// write writes a record of a request of route to every sink, logging the failures
+func (a *Auditor) write(ctx context.Context, route string, record Record) {
+	for _, sink := range a.sinks {
+		if err := sink.Write(ctx, record); err != nil {
+			event := a.log.Error().Err(err).
+				Str("route", route).
+				Str("method", record.Method).
+				Str("resource", record.Resource)
+			if record.RequestID != "" {
+				event = event.Str("request_id", record.RequestID)
+			}
+			event.Msg("Audit: failed to write the record")
+		}
+	}
+}
+
+// rawJSON returns the body, redacted, as raw JSON, or as a JSON string when it is not valid JSON
+func rawJSON(body []byte) json.RawMessage {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
+	if json.Valid(body) {
+		return redact.JSON(body)
+	}
+	quoted, _ := json.Marshal(redact.String(string(body)))
+	return quoted
+}
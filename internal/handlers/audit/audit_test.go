@@ -0,0 +1,220 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/handlers"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/utils"
+	"github.com/rs/zerolog"
+)
+
+const testToken = "token test-token-123"
+
+// mockHTTPClient answers the requests with the configured status and body by "METHOD URL" and counts them
+type mockHTTPClient struct {
+	mu        sync.Mutex
+	responses map[string]string
+	statuses  map[string]int
+	requests  []string
+}
+
+func (m *mockHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := req.Method + " " + req.URL.String()
+	m.requests = append(m.requests, key)
+	status, exists := m.statuses[key]
+	if !exists {
+		status = http.StatusNotFound
+	}
+	header := make(http.Header)
+	header.Set(handlers.GitHubRequestIDHeader, fmt.Sprintf("0400:%d", len(m.requests)))
+	return &http.Response{
+		StatusCode: status,
+		Body:       io.NopCloser(strings.NewReader(m.responses[key])),
+		Header:     header,
+	}, nil
+}
+
+// memorySink keeps the records in memory
+type memorySink struct {
+	records []Record
+}
+
+func (s *memorySink) Write(ctx context.Context, record Record) error {
+	s.records = append(s.records, record)
+	return nil
+}
+
+func TestHandler(t *testing.T) {
+	github := &mockHTTPClient{
+		statuses: map[string]int{
+			"GET https://api.github.com/user":                                            http.StatusOK,
+			"PUT https://api.github.com/repos/testowner/testrepo/collaborators/testuser": http.StatusNoContent,
+		},
+		responses: map[string]string{
+			"GET https://api.github.com/user": `{"login": "octocat"}`,
+		},
+	}
+	client := &Client{Client: github}
+
+	// The plugin mux: a GET route reading the current value, and a mutating route sending a GitHub request
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /repository/{owner}/{repo}/collaborators/{username}/permission", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != testToken {
+			http.Error(w, "missing token", http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"permission": "pull"}`))
+	})
+
+	sink := &memorySink{}
+	logger := zerolog.New(io.Discard)
+	auditor := New(&logger, mux, NewIdentities(github), sink)
+	now := time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)
+	auditor.now = func() time.Time { return now }
+
+	current := func(r *http.Request) string { return r.URL.Path + "/permission" }
+	mux.Handle("PATCH /repository/{owner}/{repo}/collaborators/{username}", Handler(auditor, current, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, _ := http.NewRequestWithContext(r.Context(), "PUT", "https://api.github.com/repos/testowner/testrepo/collaborators/testuser", nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	for _, dryRun := range []bool{false, true, false} {
+		target := "/repository/testowner/testrepo/collaborators/testuser"
+		if dryRun {
+			target += "?dry_run=true"
+		}
+		req := httptest.NewRequest("PATCH", target, strings.NewReader(`{"permission": "admin"}`))
+		req.Header.Set("Authorization", testToken)
+		req.Header.Set(handlers.RequestIDHeader, "request-1")
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rr.Code)
+		}
+	}
+
+	if len(sink.records) != 2 {
+		t.Fatalf("expected 2 records (dry-run excluded), got %d", len(sink.records))
+	}
+
+	expected := Record{
+		Time:           now,
+		RequestID:      "request-1",
+		Caller:         Caller{TokenHash: utils.HashToken(testToken), Login: "octocat"},
+		Method:         "PATCH",
+		Resource:       "/repository/testowner/testrepo/collaborators/testuser",
+		OldValue:       json.RawMessage(`{"permission":"pull"}`),
+		NewValue:       json.RawMessage(`{"permission":"admin"}`),
+		Status:         http.StatusOK,
+		UpstreamStatus: http.StatusNoContent,
+		Upstream:       []UpstreamCall{{Method: "PUT", URL: "https://api.github.com/repos/testowner/testrepo/collaborators/testuser", Status: http.StatusNoContent, GitHubRequestID: "0400:2"}},
+	}
+	expectedJSON, _ := json.Marshal(expected)
+	recordJSON, _ := json.Marshal(sink.records[0])
+	if string(recordJSON) != string(expectedJSON) {
+		t.Errorf("unexpected record\n got %s\nwant %s", recordJSON, expectedJSON)
+	}
+
+	// The login is resolved once per token
+	userRequests := 0
+	for _, request := range github.requests {
+		if request == "GET https://api.github.com/user" {
+			userRequests++
+		}
+	}
+	if userRequests != 1 {
+		t.Errorf("expected the login to be resolved once, got %d requests", userRequests)
+	}
+}
+
+// failingSink fails to write the records
+type failingSink struct{}
+
+func (failingSink) Write(ctx context.Context, record Record) error {
+	return errors.New("disk full")
+}
+
+func TestAuditor_WriteFailure(t *testing.T) {
+	var out bytes.Buffer
+	logger := zerolog.New(&out)
+	sink := &memorySink{}
+	auditor := New(&logger, http.NewServeMux(), nil, failingSink{}, sink)
+
+	record := Record{RequestID: "request-1", Method: "DELETE", Resource: "/team/orgs/krateo/teams/devs"}
+	auditor.write(context.Background(), "DELETE /team/orgs/{org}/teams/{team_slug}", record)
+
+	// The failure is logged with structured fields, and the other sinks still get the record
+	var entry map[string]any
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatalf("invalid log line %q: %v", out.String(), err)
+	}
+	expected := map[string]any{
+		"level":      "error",
+		"error":      "disk full",
+		"route":      "DELETE /team/orgs/{org}/teams/{team_slug}",
+		"method":     "DELETE",
+		"resource":   "/team/orgs/krateo/teams/devs",
+		"request_id": "request-1",
+		"message":    "Audit: failed to write the record",
+	}
+	for key, value := range expected {
+		if entry[key] != value {
+			t.Errorf("expected %s to be %v, got %v", key, value, entry[key])
+		}
+	}
+	if len(sink.records) != 1 {
+		t.Errorf("expected the record to be written to the other sinks, got %d records", len(sink.records))
+	}
+}
+
+func TestIdentities_Login(t *testing.T) {
+	tests := []struct {
+		name             string
+		status           int
+		body             string
+		expectedLogin    string
+		expectedRequests int
+	}{
+		{name: "user token", status: http.StatusOK, body: `{"login": "octocat"}`, expectedLogin: "octocat", expectedRequests: 1},
+		{name: "installation token", status: http.StatusForbidden, body: `{"message": "Resource not accessible by integration"}`, expectedRequests: 1},
+		{name: "server error is not cached", status: http.StatusBadGateway, expectedRequests: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &mockHTTPClient{
+				statuses:  map[string]int{"GET https://api.github.com/user": tt.status},
+				responses: map[string]string{"GET https://api.github.com/user": tt.body},
+			}
+			identities := NewIdentities(client)
+
+			for range 2 {
+				if login := identities.Login(context.Background(), testToken); login != tt.expectedLogin {
+					t.Errorf("expected login %q, got %q", tt.expectedLogin, login)
+				}
+			}
+			if len(client.requests) != tt.expectedRequests {
+				t.Errorf("expected %d requests, got %d", tt.expectedRequests, len(client.requests))
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package audit
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/handlers"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/redact"
+)
+
+// trailKey is the context key of the upstream calls of an audited request
+type trailKey struct{}
+
+// trail collects the mutating upstream calls of a request (bulk requests send them concurrently)
+type trail struct {
+	mu    sync.Mutex
+	calls []UpstreamCall
+}
+
+func (t *trail) add(call UpstreamCall) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.calls = append(t.calls, call)
+}
+
+func (t *trail) list() []UpstreamCall {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]UpstreamCall{}, t.calls...)
+}
+
+// Client is an HTTP client recording the mutating requests sent on behalf of an audited request.
+// Requests whose context does not belong to an audited request are sent unchanged.
+type Client struct {
+	Client handlers.HTTPClient
+}
+
+// Do implements the HTTPClient interface
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	calls, audited := req.Context().Value(trailKey{}).(*trail)
+	if !audited || req.Method == http.MethodGet || req.Method == http.MethodHead {
+		return c.Client.Do(req)
+	}
+
+	call := UpstreamCall{Method: req.Method, URL: redact.String(req.URL.String())}
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		call.Error = redact.String(err.Error())
+	} else {
+		call.Status = resp.StatusCode
+		call.GitHubRequestID = resp.Header.Get(handlers.GitHubRequestIDHeader)
+	}
+	calls.add(call)
+	return resp, err
+}
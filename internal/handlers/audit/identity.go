@@ -0,0 +1,83 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/handlers"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/utils"
+)
+
+// Identities resolves the GitHub login of the callers with the /user endpoint, once per token.
+// Logins are keyed by token hash, tokens that have no user (e.g. GitHub App installation tokens) are remembered with an empty login.
+type Identities struct {
+	client handlers.HTTPClient
+
+	mu     sync.Mutex
+	logins map[string]string
+}
+
+// NewIdentities creates an Identities resolving logins with the given client
+func NewIdentities(client handlers.HTTPClient) *Identities {
+	return &Identities{
+		client: client,
+		logins: make(map[string]string),
+	}
+}
+
+// Login returns the GitHub login of the token of an Authorization header, empty when it cannot be resolved
+func (i *Identities) Login(ctx context.Context, authHeader string) string {
+	if authHeader == "" {
+		return ""
+	}
+	key := utils.HashToken(authHeader)
+
+	i.mu.Lock()
+	login, cached := i.logins[key]
+	i.mu.Unlock()
+	if cached {
+		return login
+	}
+
+	login, ok := i.fetchLogin(ctx, authHeader)
+	if ok {
+		i.mu.Lock()
+		i.logins[key] = login
+		i.mu.Unlock()
+	}
+	return login
+}
+
+// fetchLogin gets the login of the authenticated user, reporting whether the answer can be cached
+func (i *Identities) fetchLogin(ctx context.Context, authHeader string) (string, bool) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://api.github.com/user", nil)
+	if err != nil {
+		return "", false
+	}
+	req.Header.Set("Authorization", authHeader)
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return "", false
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var user struct {
+			Login string `json:"login"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+			return "", false
+		}
+		return user.Login, true
+	case http.StatusUnauthorized, http.StatusForbidden:
+		// The token is invalid or is not a user token: it will not resolve later either
+		return "", true
+	default:
+		return "", false
+	}
+}
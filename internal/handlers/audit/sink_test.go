@@ -0,0 +1,72 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	if err := os.WriteFile(path, []byte(`{"method":"DELETE"}`+"\n"), 0o600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	sink, err := NewFileSink(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, method := range []string{"POST", "PATCH"} {
+		if err := sink.Write(context.Background(), Record{Method: method}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read file: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected the records to be appended, got %q", content)
+	}
+	for i, method := range []string{"DELETE", "POST", "PATCH"} {
+		var record Record
+		if err := json.Unmarshal([]byte(lines[i]), &record); err != nil || record.Method != method {
+			t.Errorf("line %d: expected %s record, got %q (%v)", i, method, lines[i], err)
+		}
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		expectError bool
+	}{
+		{name: "accepted", status: http.StatusAccepted},
+		{name: "rejected", status: http.StatusInternalServerError, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &mockHTTPClient{statuses: map[string]int{"POST http://localhost:9880/audit": tt.status}}
+			sink := NewWebhookSink("http://localhost:9880/audit", client)
+
+			err := sink.Write(context.Background(), Record{Method: "POST"})
+			if (err != nil) != tt.expectError {
+				t.Errorf("unexpected error %v", err)
+			}
+			if len(client.requests) != 1 {
+				t.Errorf("expected 1 request, got %d", len(client.requests))
+			}
+		})
+	}
+}
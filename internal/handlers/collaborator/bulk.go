@@ -0,0 +1,463 @@
+package collaborator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/githuburl"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/handlers"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/roles"
+)
+
+// PutCollaborators reconciles the whole set of collaborators of a repository
+func PutCollaborators(opts handlers.HandlerOptions) handlers.Handler {
+	return &bulkHandler{baseHandler: newBaseHandler(opts)}
+}
+
+var _ handlers.Handler = &bulkHandler{}
+
+type bulkHandler struct {
+	*baseHandler
+}
+
+// Results of the reconciliation of a single user
+const (
+	BulkAdded               = "added"
+	BulkInvited             = "invited"
+	BulkUpdated             = "updated"
+	BulkInvitationUpdated   = "invitation_updated"
+	BulkReinvited           = "reinvited"
+	BulkRemoved             = "removed"
+	BulkInvitationCancelled = "invitation_cancelled"
+	BulkUnchanged           = "unchanged"
+	BulkPending             = "pending"
+	BulkExpired             = "expired"
+	BulkFailed              = "failed"
+)
+
+// listPerPage is the page size used to list collaborators and invitations
+const listPerPage = 100
+
+// repoCollaborator is the subset of a GitHub collaborator needed to compute the diff
+type repoCollaborator struct {
+	Login    string `json:"login"`
+	RoleName string `json:"role_name"`
+}
+
+type bulkOperationKind int
+
+const (
+	opNone bulkOperationKind = iota
+	opAdd
+	opUpdate
+	opUpdateInvitation
+	opReinvite
+	opRemove
+	opCancelInvitation
+	opReportExpired
+)
+
+// bulkOperation is a change planned for a single user
+type bulkOperation struct {
+	kind       bulkOperationKind
+	username   string
+	permission string
+	invitation *GitHubInvitation
+	unchanged  string // result reported for opNone (unchanged or pending)
+}
+
+// PUT handler implementation
+// @Summary Reconcile the collaborators of a repository
+// @Description Set the full list of direct collaborators of a repository: users missing from the list are removed (or their invitation is cancelled),
+// @Description new users are added or invited and permissions of existing collaborators and invitations are updated.
+// @Description The response reports the result for each user.
+// @ID put-repo-collaborators
+// @Param owner path string true "Owner of the repository"
+// @Param repo path string true "Name of the repository"
+// @Param collaborators body collaborator.BulkCollaboratorsRequest true "Desired collaborators with their permission"
+// @Param dry_run query bool false "Return the upstream requests that would be sent, without sending them (also X-Dry-Run header)"
+// @Accept json
+// @Produce json
+// @Success 200 {object} collaborator.BulkCollaboratorsResponse "All changes applied"
+// @Success 207 {object} collaborator.BulkCollaboratorsResponse "Some changes failed"
+// @Failure 400 {object} handlers.ErrorResponse "Invalid request body"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden by the plugin policy (policy_violation, with the rule in policy_rule)"
+// @Failure 422 {object} handlers.ErrorResponse "Unknown permission"
+// @Router /repository/{owner}/{repo}/collaborators [put]
+func (h *bulkHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	owner := r.PathValue("owner")
+	repo := r.PathValue("repo")
+	defer h.invalidateInvitations(owner, repo)
+	authHeader := r.Header.Get("Authorization")
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, fmt.Sprintf("Error reading request body: %v", err))
+		return
+	}
+	defer r.Body.Close()
+
+	desired, err := parseDesiredCollaborators(body)
+	if err != nil {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, fmt.Sprintf("Invalid request body: %v", err))
+		return
+	}
+
+	h.Logger(r.Context()).Debug().Msgf("Reconciling %d collaborators of repository %s/%s", len(desired), owner, repo)
+
+	// Validate all permissions before applying any change
+	for i, collaborator := range desired {
+		canonical, known, err := h.canonicalRole(r.Context(), owner, authHeader, collaborator.Permission)
+		if err != nil {
+			h.writeErrorResponse(w, r, handlers.StatusForError(err), fmt.Sprintf("Error resolving custom repository roles: %v", err))
+			return
+		}
+		if !known {
+			h.writeErrorResponse(w, r, http.StatusUnprocessableEntity, fmt.Sprintf("Unknown permission %s for user %s: it is neither a base role nor a custom repository role of %s", collaborator.Permission, collaborator.Username, owner))
+			return
+		}
+		desired[i].Permission = canonical
+	}
+
+	collaborators, ok, err := h.listCollaborators(w, r, owner, repo, authHeader)
+	if err != nil {
+		h.writeErrorResponse(w, r, handlers.StatusForError(err), fmt.Sprintf("Error listing collaborators: %v", err))
+		return
+	}
+	if !ok {
+		return // GitHub error already forwarded
+	}
+
+	invitations, ok, err := h.listInvitations(w, r, owner, repo, authHeader)
+	if err != nil {
+		h.writeErrorResponse(w, r, handlers.StatusForError(err), fmt.Sprintf("Error listing invitations: %v", err))
+		return
+	}
+	if !ok {
+		return // GitHub error already forwarded
+	}
+
+	operations := h.planOperations(owner, desired, collaborators, invitations)
+	// Protected users missing from the list reject the whole reconciliation, before any change is applied
+	for _, operation := range operations {
+		if operation.kind != opRemove {
+			continue
+		}
+		if v := h.Policy.Policy().CheckRemoval([]string{owner + "/" + repo}, operation.username); v != nil {
+			handlers.WritePolicyViolation(w, r, v)
+			return
+		}
+	}
+
+	results := h.applyOperations(r.Context(), owner, repo, authHeader, operations)
+
+	response := BulkCollaboratorsResponse{Results: results, Summary: make(map[string]int)}
+	statusCode := http.StatusOK
+	for _, result := range results {
+		response.Summary[result.Result]++
+		if result.Result == BulkFailed {
+			statusCode = http.StatusMultiStatus
+		}
+	}
+
+	finalBody, err := json.Marshal(response)
+	if err != nil {
+		h.writeErrorResponse(w, r, http.StatusInternalServerError, fmt.Sprintf("Error marshaling response: %v", err))
+		return
+	}
+	h.writeJSONResponse(w, statusCode, finalBody)
+	h.Logger(r.Context()).Debug().Msgf("Reconciled collaborators of repository %s/%s: %v", owner, repo, response.Summary)
+}
+
+// parseDesiredCollaborators reads the desired collaborators from the request body.
+// The list is required (an empty list removes every collaborator) and usernames must be unique.
+func parseDesiredCollaborators(body []byte) ([]DesiredCollaborator, error) {
+	var request struct {
+		Collaborators *[]DesiredCollaborator `json:"collaborators"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil, err
+	}
+	if request.Collaborators == nil {
+		return nil, fmt.Errorf("field collaborators not found")
+	}
+
+	seen := make(map[string]bool)
+	for _, collaborator := range *request.Collaborators {
+		if collaborator.Username == "" {
+			return nil, fmt.Errorf("username is required")
+		}
+		if err := githuburl.Validate(githuburl.Login, collaborator.Username); err != nil {
+			return nil, err
+		}
+		if collaborator.Permission == "" {
+			return nil, fmt.Errorf("permission is required for user %s", collaborator.Username)
+		}
+		key := strings.ToLower(collaborator.Username)
+		if seen[key] {
+			return nil, fmt.Errorf("duplicate user %s", collaborator.Username)
+		}
+		seen[key] = true
+	}
+	return *request.Collaborators, nil
+}
+
+// listCollaborators lists all the direct collaborators of the repository.
+// It returns false when the GitHub error has been forwarded.
+func (h *bulkHandler) listCollaborators(w http.ResponseWriter, r *http.Request, owner, repo, authHeader string) (map[string]repoCollaborator, bool, error) {
+	collaborators := make(map[string]repoCollaborator)
+	for page := 1; ; page++ {
+		url := githuburl.Join("repos", owner, repo, "collaborators") + fmt.Sprintf("?affiliation=direct&per_page=%d&page=%d", listPerPage, page)
+		pageBody, ok, err := h.getPage(w, r, url, authHeader, "listing collaborators")
+		if err != nil || !ok {
+			return nil, false, err
+		}
+
+		var items []repoCollaborator
+		if err := json.Unmarshal(pageBody, &items); err != nil {
+			return nil, false, fmt.Errorf("failed to unmarshal collaborators: %w", err)
+		}
+		for _, item := range items {
+			collaborators[strings.ToLower(item.Login)] = item
+		}
+		if len(items) < listPerPage {
+			return collaborators, true, nil
+		}
+	}
+}
+
+// listInvitations lists all the pending invitations of the repository.
+// It returns false when the GitHub error has been forwarded.
+func (h *bulkHandler) listInvitations(w http.ResponseWriter, r *http.Request, owner, repo, authHeader string) (map[string]GitHubInvitation, bool, error) {
+	invitations := make(map[string]GitHubInvitation)
+	for page := 1; ; page++ {
+		url := githuburl.Join("repos", owner, repo, "invitations") + fmt.Sprintf("?per_page=%d&page=%d", listPerPage, page)
+		pageBody, ok, err := h.getPage(w, r, url, authHeader, "listing invitations")
+		if err != nil || !ok {
+			return nil, false, err
+		}
+
+		items, err := parseInvitations(pageBody)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to unmarshal invitations: %w", err)
+		}
+		for _, item := range items {
+			invitations[strings.ToLower(item.Invitee.Login)] = item
+		}
+		if len(items) < listPerPage {
+			return invitations, true, nil
+		}
+	}
+}
+
+// getPage gets a page of a GitHub list, forwarding the GitHub error when the status is not 200
+func (h *bulkHandler) getPage(w http.ResponseWriter, r *http.Request, url, authHeader, action string) ([]byte, bool, error) {
+	resp, err := h.makeGitHubRequest(r.Context(), "GET", url, authHeader, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		h.forwardGitHubError(w, r, resp, action)
+		return nil, false, nil
+	}
+
+	pageBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read GitHub API response: %w", err)
+	}
+	return pageBody, true, nil
+}
+
+// planOperations computes the changes needed to reach the desired collaborators, sorted by username.
+// The owner of a personal repository is listed as a direct collaborator, it is never removed.
+func (h *bulkHandler) planOperations(owner string, desired []DesiredCollaborator, collaborators map[string]repoCollaborator, invitations map[string]GitHubInvitation) []bulkOperation {
+	var operations []bulkOperation
+	desiredUsers := make(map[string]bool)
+
+	for _, collaborator := range desired {
+		key := strings.ToLower(collaborator.Username)
+		desiredUsers[key] = true
+		operation := bulkOperation{username: collaborator.Username, permission: collaborator.Permission}
+
+		// Existing users are reported with their GitHub login
+		var current *repoCollaborator
+		var invitation *GitHubInvitation
+		if c, exists := collaborators[key]; exists {
+			current = &c
+			operation.username = c.Login
+		} else if i, exists := invitations[key]; exists {
+			invitation = &i
+			operation.username = i.Invitee.Login
+			operation.invitation = invitation
+		}
+
+		diff := diffCollaborator(collaborator.Permission, current, invitation, h.expiredInvitationPolicy())
+		switch diff.Action {
+		case ActionNone:
+			operation.kind, operation.unchanged = opNone, BulkUnchanged
+			if diff.State == StateInvitation {
+				operation.unchanged = BulkPending
+			}
+		case ActionAdd:
+			operation.kind = opAdd
+		case ActionUpdate:
+			operation.kind = opUpdate
+		case ActionUpdateInvitation:
+			operation.kind = opUpdateInvitation
+		case ActionReinvite:
+			operation.kind = opReinvite
+		case ActionReportExpired:
+			operation.kind = opReportExpired
+		}
+		operations = append(operations, operation)
+	}
+
+	for key, current := range collaborators {
+		if !desiredUsers[key] && key != strings.ToLower(owner) {
+			operations = append(operations, bulkOperation{kind: opRemove, username: current.Login, permission: roles.NormalizeRoleName(current.RoleName)})
+		}
+	}
+	for key, invitation := range invitations {
+		if !desiredUsers[key] {
+			if _, isCollaborator := collaborators[key]; isCollaborator {
+				continue
+			}
+			operations = append(operations, bulkOperation{kind: opCancelInvitation, username: invitation.Invitee.Login, permission: roles.NormalizeRoleName(invitation.Permissions), invitation: &invitation})
+		}
+	}
+
+	sort.Slice(operations, func(i, j int) bool {
+		return strings.ToLower(operations[i].username) < strings.ToLower(operations[j].username)
+	})
+	return operations
+}
+
+// applyOperations applies the planned operations with bounded concurrency, keeping the order of the results
+func (h *bulkHandler) applyOperations(ctx context.Context, owner, repo, authHeader string, operations []bulkOperation) []BulkResult {
+	concurrency := h.BulkConcurrency
+	if concurrency <= 0 {
+		concurrency = handlers.DefaultBulkConcurrency
+	}
+
+	results := make([]BulkResult, len(operations))
+	semaphore := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i, operation := range operations {
+		wg.Add(1)
+		go func(i int, operation bulkOperation) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			results[i] = h.applyOperation(ctx, owner, repo, authHeader, operation)
+		}(i, operation)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// applyOperation applies a single planned operation and reports its result
+func (h *bulkHandler) applyOperation(ctx context.Context, owner, repo, authHeader string, operation bulkOperation) BulkResult {
+	result := BulkResult{Username: operation.username, Permission: operation.permission}
+	collaboratorURL := githuburl.Join("repos", owner, repo, "collaborators", operation.username)
+	permissionBody := []byte(fmt.Sprintf(`{"permission":%q}`, operation.permission))
+
+	switch operation.kind {
+	case opNone:
+		result.Result = operation.unchanged
+		return result
+
+	case opReportExpired:
+		result.Result = BulkExpired
+		result.Status = http.StatusGone
+		result.InvitationID = operation.invitation.ID
+		return result
+
+	case opAdd:
+		return h.sendRequest(ctx, result, "PUT", collaboratorURL, authHeader, permissionBody, map[int]string{
+			http.StatusCreated:   BulkInvited,
+			http.StatusNoContent: BulkAdded,
+		})
+
+	case opUpdate:
+		return h.sendRequest(ctx, result, "PUT", collaboratorURL, authHeader, permissionBody, map[int]string{
+			http.StatusNoContent: BulkUpdated,
+		})
+
+	case opUpdateInvitation:
+		result.InvitationID = operation.invitation.ID
+		url := githuburl.Join("repos", owner, repo, "invitations", strconv.FormatInt(operation.invitation.ID, 10))
+		invitationBody := []byte(fmt.Sprintf(`{"permissions":%q}`, roles.InvitationPermission(operation.permission)))
+		return h.sendRequest(ctx, result, "PATCH", url, authHeader, invitationBody, map[int]string{
+			http.StatusOK: BulkInvitationUpdated,
+		})
+
+	case opReinvite:
+		url := githuburl.Join("repos", owner, repo, "invitations", strconv.FormatInt(operation.invitation.ID, 10))
+		result = h.sendRequest(ctx, result, "DELETE", url, authHeader, nil, map[int]string{
+			http.StatusNoContent: BulkReinvited,
+		})
+		if result.Result == BulkFailed {
+			return result
+		}
+		return h.sendRequest(ctx, result, "PUT", collaboratorURL, authHeader, permissionBody, map[int]string{
+			http.StatusCreated:   BulkReinvited,
+			http.StatusNoContent: BulkAdded,
+		})
+
+	case opRemove:
+		return h.sendRequest(ctx, result, "DELETE", collaboratorURL, authHeader, nil, map[int]string{
+			http.StatusNoContent: BulkRemoved,
+		})
+
+	case opCancelInvitation:
+		result.InvitationID = operation.invitation.ID
+		url := githuburl.Join("repos", owner, repo, "invitations", strconv.FormatInt(operation.invitation.ID, 10))
+		return h.sendRequest(ctx, result, "DELETE", url, authHeader, nil, map[int]string{
+			http.StatusNoContent: BulkInvitationCancelled,
+		})
+	}
+
+	result.Result = BulkFailed
+	result.Error = "unknown operation"
+	return result
+}
+
+// sendRequest sends a request to the GitHub API and maps the response status to the result of the operation.
+// Unexpected statuses are reported as failures with the GitHub error message.
+func (h *bulkHandler) sendRequest(ctx context.Context, result BulkResult, method, url, authHeader string, body []byte, outcomes map[int]string) BulkResult {
+	resp, err := h.makeGitHubRequest(ctx, method, url, authHeader, body)
+	if err != nil {
+		result.Result = BulkFailed
+		result.Error = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+
+	result.Status = resp.StatusCode
+	if outcome, ok := outcomes[resp.StatusCode]; ok {
+		result.Result = outcome
+		result.Error = ""
+		return result
+	}
+
+	respBody, _ := io.ReadAll(resp.Body)
+	h.Logger(ctx).Warn().Msgf("GitHub API returned error %d when reconciling user %s", resp.StatusCode, result.Username)
+	result.Result = BulkFailed
+	result.Error = resp.Status
+	if message, err := ReadFieldFromBody(respBody, "message"); err == nil {
+		result.Error = fmt.Sprintf("%v", message)
+	}
+	return result
+}
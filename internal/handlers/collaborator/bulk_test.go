@@ -0,0 +1,256 @@
+package collaborator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/handlers"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/policy"
+	"github.com/rs/zerolog"
+)
+
+var (
+	bulkCollaboratorsURL  = fmt.Sprintf("https://api.github.com/repos/%s/%s/collaborators?affiliation=direct&per_page=100&page=1", testOwner, testRepo)
+	bulkInvitationsURL    = fmt.Sprintf("https://api.github.com/repos/%s/%s/invitations?per_page=100&page=1", testOwner, testRepo)
+	bulkCollaboratorsResp = `[
+		{"login": "alice", "role_name": "write"},
+		{"login": "bob", "role_name": "admin"},
+		{"login": "carol", "role_name": "read"}
+	]`
+	bulkInvitationsResp = `[
+		{"id": 4, "invitee": {"login": "dave"}, "permissions": "read", "expired": false},
+		{"id": 5, "invitee": {"login": "erin"}, "permissions": "write", "expired": true},
+		{"id": 6, "invitee": {"login": "frank"}, "permissions": "read", "expired": false},
+		{"id": 9, "invitee": {"login": "ivan"}, "permissions": "read", "expired": false}
+	]`
+)
+
+func bulkUserURL(username string) string {
+	return fmt.Sprintf("https://api.github.com/repos/%s/%s/collaborators/%s", testOwner, testRepo, username)
+}
+
+func bulkInvitationURL(id int) string {
+	return fmt.Sprintf("https://api.github.com/repos/%s/%s/invitations/%d", testOwner, testRepo, id)
+}
+
+func serveBulk(t *testing.T, mockClient *mockHTTPClient, policy handlers.ExpiredInvitationPolicy, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	logger := zerolog.New(io.Discard).With().Timestamp().Logger()
+	handler := PutCollaborators(handlers.HandlerOptions{
+		Client:                  mockClient,
+		Log:                     &logger,
+		ExpiredInvitationPolicy: policy,
+		BulkConcurrency:         3,
+	})
+
+	mux := http.NewServeMux()
+	mux.Handle("PUT /repository/{owner}/{repo}/collaborators", handler)
+	req := httptest.NewRequest("PUT", fmt.Sprintf("/repository/%s/%s/collaborators", testOwner, testRepo), strings.NewReader(body))
+	req.Header.Set("Authorization", testToken)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestBulkHandler_ServeHTTP(t *testing.T) {
+	mockClient := newMockHTTPClient()
+	mockClient.setResponse(bulkCollaboratorsURL, http.StatusOK, bulkCollaboratorsResp)
+	mockClient.setResponse(bulkInvitationsURL, http.StatusOK, bulkInvitationsResp)
+	mockClient.setResponse(bulkUserURL("bob"), http.StatusNoContent, "")
+	mockClient.setResponse("DELETE "+bulkUserURL("carol"), http.StatusNoContent, "")
+	mockClient.setResponse(bulkInvitationURL(4), http.StatusOK, `{}`)
+	mockClient.setResponse("DELETE "+bulkInvitationURL(5), http.StatusNoContent, "")
+	mockClient.setResponse("PUT "+bulkUserURL("erin"), http.StatusCreated, `{}`)
+	mockClient.setResponse(bulkUserURL("gina"), http.StatusCreated, `{}`)
+	mockClient.setResponse(bulkUserURL("harry"), http.StatusUnprocessableEntity, `{"message": "Validation Failed"}`)
+	mockClient.setResponse("DELETE "+bulkInvitationURL(9), http.StatusNoContent, "")
+
+	rr := serveBulk(t, mockClient, handlers.ExpiredInvitationReinvite, `{"collaborators": [
+		{"username": "alice", "permission": "push"},
+		{"username": "Bob", "permission": "push"},
+		{"username": "dave", "permission": "write"},
+		{"username": "erin", "permission": "push"},
+		{"username": "frank", "permission": "pull"},
+		{"username": "gina", "permission": "triage"},
+		{"username": "harry", "permission": "pull"}
+	]}`)
+
+	if rr.Code != http.StatusMultiStatus {
+		t.Fatalf("handler returned wrong status code: got %v want %v, body %s", rr.Code, http.StatusMultiStatus, rr.Body.String())
+	}
+
+	var response BulkCollaboratorsResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+
+	expected := []struct {
+		username string
+		result   string
+	}{
+		{"alice", BulkUnchanged},
+		{"bob", BulkUpdated},
+		{"carol", BulkRemoved},
+		{"dave", BulkInvitationUpdated},
+		{"erin", BulkReinvited},
+		{"frank", BulkPending},
+		{"gina", BulkInvited},
+		{"harry", BulkFailed},
+		{"ivan", BulkInvitationCancelled},
+	}
+	if len(response.Results) != len(expected) {
+		t.Fatalf("expected %d results, got %d: %+v", len(expected), len(response.Results), response.Results)
+	}
+	for i, e := range expected {
+		result := response.Results[i]
+		if result.Username != e.username || result.Result != e.result {
+			t.Errorf("result %d: got %s %s, want %s %s", i, result.Username, result.Result, e.username, e.result)
+		}
+	}
+	if response.Results[7].Error != "Validation Failed" || response.Results[7].Status != http.StatusUnprocessableEntity {
+		t.Errorf("unexpected failure result %+v", response.Results[7])
+	}
+	if response.Summary[BulkFailed] != 1 || response.Summary[BulkUnchanged] != 1 {
+		t.Errorf("unexpected summary %v", response.Summary)
+	}
+
+	// 2 lists + bob, carol, dave, erin (2), gina, harry, ivan
+	if mockClient.getRequestCount() != 10 {
+		t.Errorf("expected 10 requests, got %d", mockClient.getRequestCount())
+	}
+	for _, req := range mockClient.requests {
+		if req.URL.String() == bulkInvitationURL(4) {
+			body, _ := io.ReadAll(req.Body)
+			if string(body) != `{"permissions":"write"}` {
+				t.Errorf("unexpected invitation update body %s", body)
+			}
+		}
+	}
+}
+
+func TestBulkHandler_ExpiredReportPolicy(t *testing.T) {
+	mockClient := newMockHTTPClient()
+	mockClient.setResponse(bulkCollaboratorsURL, http.StatusOK, `[]`)
+	mockClient.setResponse(bulkInvitationsURL, http.StatusOK, `[{"id": 5, "invitee": {"login": "erin"}, "permissions": "write", "expired": true}]`)
+
+	rr := serveBulk(t, mockClient, handlers.ExpiredInvitationReport, `{"collaborators": [{"username": "erin", "permission": "push"}]}`)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if !strings.Contains(rr.Body.String(), `"result":"expired"`) || !strings.Contains(rr.Body.String(), `"invitation_id":5`) {
+		t.Errorf("unexpected body %s", rr.Body.String())
+	}
+	if mockClient.getRequestCount() != 2 {
+		t.Errorf("expected 2 requests, got %d", mockClient.getRequestCount())
+	}
+}
+
+func TestBulkHandler_InvalidRequests(t *testing.T) {
+	tests := []struct {
+		name             string
+		body             string
+		setupMock        func(*mockHTTPClient)
+		expectedStatus   int
+		expectedBody     string
+		expectedRequests int
+	}{
+		{
+			name:           "missing collaborators field",
+			body:           `{}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "field collaborators not found",
+		},
+		{
+			name:           "duplicate users",
+			body:           `{"collaborators": [{"username": "alice", "permission": "push"}, {"username": "Alice", "permission": "pull"}]}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "duplicate user Alice",
+		},
+		{
+			name:           "invalid username",
+			body:           `{"collaborators": [{"username": "../../orgs/x", "permission": "push"}]}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `invalid login \"../../orgs/x\"`,
+		},
+		{
+			name:           "missing permission",
+			body:           `{"collaborators": [{"username": "alice"}]}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "permission is required",
+		},
+		{
+			name: "GitHub error listing collaborators is forwarded",
+			body: `{"collaborators": []}`,
+			setupMock: func(m *mockHTTPClient) {
+				m.setResponse(bulkCollaboratorsURL, http.StatusForbidden, `{"message": "Must have admin rights to Repository."}`)
+			},
+			expectedStatus:   http.StatusForbidden,
+			expectedBody:     "Must have admin rights",
+			expectedRequests: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := newMockHTTPClient()
+			if tt.setupMock != nil {
+				tt.setupMock(mockClient)
+			}
+
+			rr := serveBulk(t, mockClient, "", tt.body)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tt.expectedStatus)
+			}
+			if !strings.Contains(rr.Body.String(), tt.expectedBody) {
+				t.Errorf("handler returned unexpected body: got %s, want it to contain %s", rr.Body.String(), tt.expectedBody)
+			}
+			if mockClient.getRequestCount() != tt.expectedRequests {
+				t.Errorf("expected %d requests, got %d", tt.expectedRequests, mockClient.getRequestCount())
+			}
+		})
+	}
+}
+
+func TestBulkHandler_ProtectedUser(t *testing.T) {
+	mockClient := newMockHTTPClient()
+	mockClient.setResponse(bulkCollaboratorsURL, http.StatusOK, bulkCollaboratorsResp)
+	mockClient.setResponse(bulkInvitationsURL, http.StatusOK, `[]`)
+
+	filename := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(filename, []byte(`protected_users: [{name: break-glass, users: [Bob]}]`), 0o600); err != nil {
+		t.Fatalf("failed to write policy: %v", err)
+	}
+	logger := zerolog.New(io.Discard)
+	store, err := policy.NewStore(filename, &logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("PUT /repository/{owner}/{repo}/collaborators", PutCollaborators(handlers.HandlerOptions{
+		Client: mockClient,
+		Log:    &logger,
+		Policy: store,
+	}))
+	req := httptest.NewRequest("PUT", fmt.Sprintf("/repository/%s/%s/collaborators", testOwner, testRepo), strings.NewReader(`{"collaborators": [{"username": "alice", "permission": "push"}]}`))
+	req.Header.Set("Authorization", testToken)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), `"policy_rule":"break-glass"`) {
+		t.Errorf("expected violation of rule break-glass, got %d: %s", rr.Code, rr.Body.String())
+	}
+	// Only the listings: no change is applied
+	if mockClient.getRequestCount() != 2 {
+		t.Errorf("expected 2 requests, got %d", mockClient.getRequestCount())
+	}
+}
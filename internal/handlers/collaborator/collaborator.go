@@ -2,11 +2,17 @@ package collaborator
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/githuburl"
 	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/handlers"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/roles"
+	"github.com/rs/zerolog"
 )
 
 // Handler constructors
@@ -69,8 +75,8 @@ const (
 )
 
 // Common methods, defined once on baseHandler
-func (h *baseHandler) makeGitHubRequest(method, url, authHeader string, body []byte) (*http.Response, error) {
-	req, err := http.NewRequest(method, url, nil)
+func (h *baseHandler) makeGitHubRequest(ctx context.Context, method, url, authHeader string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -93,9 +99,9 @@ func (h *baseHandler) makeGitHubRequest(method, url, authHeader string, body []b
 	return resp, nil
 }
 
-func (h *baseHandler) checkCollaboratorStatus(owner, repo, username, authHeader string) (CollaboratorStatus, error) {
-	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/collaborators/%s", owner, repo, username)
-	resp, err := h.makeGitHubRequest("GET", url, authHeader, nil)
+func (h *baseHandler) checkCollaboratorStatus(ctx context.Context, owner, repo, username, authHeader string) (CollaboratorStatus, error) {
+	url := githuburl.Join("repos", owner, repo, "collaborators", username)
+	resp, err := h.makeGitHubRequest(ctx, "GET", url, authHeader, nil)
 	if err != nil {
 		return StatusNotCollaborator, err
 	}
@@ -111,10 +117,9 @@ func (h *baseHandler) checkCollaboratorStatus(owner, repo, username, authHeader
 	}
 }
 
-func (h *baseHandler) writeErrorResponse(w http.ResponseWriter, statusCode int, message string) {
-	h.Log.Print(message)
-	w.WriteHeader(statusCode)
-	w.Write([]byte(message))
+func (h *baseHandler) writeErrorResponse(w http.ResponseWriter, r *http.Request, statusCode int, message string) {
+	handlers.LogStatus(h.Logger(r.Context()), statusCode).Msg(message)
+	handlers.WriteError(w, r, statusCode, message)
 }
 
 func (h *baseHandler) writeJSONResponse(w http.ResponseWriter, statusCode int, body []byte) {
@@ -123,8 +128,206 @@ func (h *baseHandler) writeJSONResponse(w http.ResponseWriter, statusCode int, b
 	w.Write(body)
 }
 
-func (h *baseHandler) findUserInvitation(owner, repo, username, authHeader string) (*GitHubInvitation, bool, error) {
-	return findUserInvitationHelper(h.Client, h.Log, owner, repo, username, authHeader)
+// canonicalizePermission validates the requested permission against the base roles and the custom repository roles of the owner.
+// The request body is rewritten with the canonical permission (e.g. the custom role name as defined in the organization).
+// When no roles resolver is configured, body and permission are returned unchanged.
+func (h *baseHandler) canonicalizePermission(ctx context.Context, owner, authHeader string, body []byte, permission string) ([]byte, string, bool, error) {
+	canonical, known, err := h.canonicalRole(ctx, owner, authHeader, permission)
+	if err != nil || !known {
+		return body, permission, known, err
+	}
+
+	if canonical != permission {
+		body, err = AddFieldToResponse(body, "permission", canonical)
+		if err != nil {
+			return nil, permission, false, err
+		}
+	}
+	return body, canonical, true, nil
+}
+
+// canonicalRole returns the canonical name of a base role or of a custom repository role of the owner.
+// Base roles are returned as requested, custom roles are not validated when no resolver is configured.
+func (h *baseHandler) canonicalRole(ctx context.Context, owner, authHeader, permission string) (string, bool, error) {
+	if h.Roles == nil || roles.IsBaseRole(permission) {
+		return permission, true, nil
+	}
+	return h.Roles.Canonicalize(ctx, owner, authHeader, permission)
+}
+
+// validatePermission canonicalizes the requested permission, writing an error response when it cannot be used
+func (h *baseHandler) validatePermission(w http.ResponseWriter, r *http.Request, owner, authHeader string, body []byte, permission string) ([]byte, string, bool) {
+	body, canonical, known, err := h.canonicalizePermission(r.Context(), owner, authHeader, body, permission)
+	if err != nil {
+		h.writeErrorResponse(w, r, handlers.StatusForError(err), fmt.Sprintf("Error resolving custom repository roles: %v", err))
+		return nil, "", false
+	}
+	if !known {
+		h.writeErrorResponse(w, r, http.StatusUnprocessableEntity, fmt.Sprintf("Unknown permission %s: it is neither a base role nor a custom repository role of %s", permission, owner))
+		return nil, "", false
+	}
+	return body, canonical, true
+}
+
+// expiredInvitationPolicy returns the configured policy for expired invitations
+func (h *baseHandler) expiredInvitationPolicy() handlers.ExpiredInvitationPolicy {
+	if h.ExpiredInvitationPolicy == "" {
+		return handlers.ExpiredInvitationReinvite
+	}
+	return h.ExpiredInvitationPolicy
+}
+
+// writeExpiredInvitationResponse reports an expired invitation with 410 Gone
+func (h *baseHandler) writeExpiredInvitationResponse(w http.ResponseWriter, r *http.Request, username string, invitation *GitHubInvitation) {
+	h.Logger(r.Context()).Debug().Msgf("Invitation for user %s (ID: %d) is expired", username, invitation.ID)
+	finalBody, err := json.Marshal(ExpiredInvitation{
+		ErrorResponse: handlers.ErrorResponse{
+			Code:      handlers.CodeGone,
+			Message:   fmt.Sprintf("Invitation for user %s is expired", username),
+			RequestID: r.Header.Get(handlers.RequestIDHeader),
+		},
+		Expired:      true,
+		InvitationID: invitation.ID,
+		CreatedAt:    invitation.CreatedAt,
+	})
+	if err != nil {
+		h.writeErrorResponse(w, r, http.StatusGone, fmt.Sprintf("Invitation for user %s is expired", username))
+		return
+	}
+	h.writeJSONResponse(w, http.StatusGone, finalBody)
+}
+
+// handleExpiredInvitation applies the expired invitation policy:
+// it either reports the expired invitation or deletes it and invites the user again with the requested permission
+func (h *baseHandler) handleExpiredInvitation(w http.ResponseWriter, r *http.Request, owner, repo, username, authHeader string, invitation *GitHubInvitation, body []byte, permission string) error {
+	if h.expiredInvitationPolicy() == handlers.ExpiredInvitationReport {
+		h.writeExpiredInvitationResponse(w, r, username, invitation)
+		return nil
+	}
+
+	h.Logger(r.Context()).Debug().Msgf("Invitation for user %s (ID: %d) is expired, deleting it and sending a new one", username, invitation.ID)
+
+	url := githuburl.Join("repos", owner, repo, "invitations", strconv.FormatInt(invitation.ID, 10))
+	resp, err := h.makeGitHubRequest(r.Context(), "DELETE", url, authHeader, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		h.forwardGitHubError(w, r, resp, "deleting expired invitation")
+		return nil
+	}
+
+	url = githuburl.Join("repos", owner, repo, "collaborators", username)
+	resp, err = h.makeGitHubRequest(r.Context(), "PUT", url, authHeader, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusCreated: // Invitation sent
+		message := fmt.Sprintf("Expired invitation replaced, invitation sent to user %s for repository %s/%s with permission %s", username, owner, repo, permission)
+		finalBody, err := AddFieldToResponse([]byte("{}"), "message", message)
+		if err != nil {
+			return fmt.Errorf("failed to add message field: %w", err)
+		}
+		h.writeJSONResponse(w, http.StatusAccepted, finalBody)
+		h.Logger(r.Context()).Debug().Msgf("Invitation sent again to user %s", username)
+
+	case http.StatusNoContent: // User became a collaborator in the meantime
+		h.Logger(r.Context()).Debug().Msgf("User %s is already a collaborator", username)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		h.forwardGitHubError(w, r, resp, "sending a new invitation")
+	}
+	return nil
+}
+
+// forwardGitHubError forwards an error response from the GitHub API
+func (h *baseHandler) forwardGitHubError(w http.ResponseWriter, r *http.Request, resp *http.Response, action string) {
+	respBody, _ := io.ReadAll(resp.Body)
+	h.writeGitHubError(w, r, resp.StatusCode, respBody, action)
+}
+
+// writeGitHubError writes the error of a GitHub API response whose body has already been read
+func (h *baseHandler) writeGitHubError(w http.ResponseWriter, r *http.Request, statusCode int, body []byte, action string) {
+	h.Logger(r.Context()).Warn().Msgf("GitHub API returned error %d when %s", statusCode, action)
+	handlers.WriteUpstreamError(w, r, statusCode, body, fmt.Sprintf("GitHub API returned error %d when %s", statusCode, action))
+}
+
+// writePendingInvitationResponse reports a pending invitation with 202 Accepted
+func (h *baseHandler) writePendingInvitationResponse(w http.ResponseWriter, r *http.Request, owner, authHeader, username string, invitation *GitHubInvitation) {
+	h.Logger(r.Context()).Debug().Msgf("User %s has a pending invitation (ID: %d)", username, invitation.ID)
+	finalBody, err := json.Marshal(PendingInvitation{
+		Message:      fmt.Sprintf("User %s has a pending invitation", username),
+		Permission:   h.invitationPermission(r.Context(), owner, authHeader, invitation),
+		InvitationID: invitation.ID,
+		CreatedAt:    invitation.CreatedAt,
+		Expired:      invitation.Expired,
+	})
+	if err != nil {
+		h.writeErrorResponse(w, r, http.StatusInternalServerError, fmt.Sprintf("Error marshaling pending invitation: %v", err))
+		return
+	}
+	h.writeJSONResponse(w, http.StatusAccepted, finalBody)
+}
+
+// invitationPermission returns the permission of an invitation in the request vocabulary, with custom roles
+// reported with the name defined in the organization as for collaborators, so that it matches the requested one
+func (h *baseHandler) invitationPermission(ctx context.Context, owner, authHeader string, invitation *GitHubInvitation) string {
+	permission := roles.NormalizeRoleName(invitation.Permissions)
+	if h.Roles == nil || roles.IsBaseRole(permission) {
+		return permission
+	}
+	canonical, known, err := h.Roles.Canonicalize(ctx, owner, authHeader, permission)
+	if err != nil {
+		h.Logger(ctx).Warn().Msgf("Failed to resolve custom repository roles, reporting role %s as is: %v", permission, err)
+		return permission
+	}
+	if known {
+		return canonical
+	}
+	return permission
+}
+
+// readIncludePending reads the optional include_pending query parameter
+func readIncludePending(r *http.Request) (bool, error) {
+	value := r.URL.Query().Get("include_pending")
+	if value == "" {
+		return false, nil
+	}
+	includePending, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid include_pending %q", value)
+	}
+	return includePending, nil
+}
+
+// findUserInvitation returns the pending invitation of a user, from the invitation index when configured
+func (h *baseHandler) findUserInvitation(ctx context.Context, owner, repo, username, authHeader string) (*GitHubInvitation, bool, error) {
+	if h.Invitations == nil {
+		return findUserInvitationHelper(ctx, h.Client, h.Logger(ctx), owner, repo, username, authHeader)
+	}
+
+	raw, found, err := h.Invitations.Lookup(ctx, owner, repo, authHeader, username)
+	if err != nil || !found {
+		return nil, false, err
+	}
+	var invitation GitHubInvitation
+	if err := json.Unmarshal(raw, &invitation); err != nil {
+		return nil, false, fmt.Errorf("failed to unmarshal invitation: %w", err)
+	}
+	return &invitation, true, nil
+}
+
+// invalidateInvitations drops the cached invitations of a repository, after requests that may change them
+func (h *baseHandler) invalidateInvitations(owner, repo string) {
+	if h.Invitations != nil {
+		h.Invitations.Invalidate(owner, repo)
+	}
 }
 
 // GET handler implementation
@@ -134,8 +337,13 @@ func (h *baseHandler) findUserInvitation(owner, repo, username, authHeader strin
 // @Param owner path string true "Owner of the repository"
 // @Param repo path string true "Name of the repository"
 // @Param username path string true "Username of the collaborator"
+// @Param include_pending query bool false "Report pending invitations with 202 instead of 404"
 // @Produce json
 // @Success 200 {object} collaborator.RepoPermissions
+// @Success 202 {object} collaborator.PendingInvitation "Invitation pending (include_pending only)"
+// @Failure 400 {object} handlers.ErrorResponse "Invalid include_pending query parameter"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden by the plugin policy (policy_violation, with the rule in policy_rule)"
+// @Failure 410 {object} collaborator.ExpiredInvitation "Invitation expired (report policy only)"
 // @Router /repository/{owner}/{repo}/collaborators/{username}/permission [get]
 func (h *getHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	owner := r.PathValue("owner")
@@ -143,30 +351,54 @@ func (h *getHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	username := r.PathValue("username")
 	authHeader := r.Header.Get("Authorization")
 
-	h.Log.Printf("Getting permission for user %s in repository %s/%s", username, owner, repo)
+	includePending, err := readIncludePending(r)
+	if err != nil {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, fmt.Sprintf("Error reading include_pending query parameter: %v", err))
+		return
+	}
 
-	status, err := h.checkCollaboratorStatus(owner, repo, username, authHeader)
+	h.Logger(r.Context()).Debug().Msgf("Getting permission for user %s in repository %s/%s", username, owner, repo)
+
+	status, err := h.checkCollaboratorStatus(r.Context(), owner, repo, username, authHeader)
 	if err != nil {
-		h.writeErrorResponse(w, http.StatusInternalServerError, fmt.Sprintf("Error checking collaborator status: %v", err))
+		h.writeErrorResponse(w, r, handlers.StatusForError(err), fmt.Sprintf("Error checking collaborator status: %v", err))
 		return
 	}
 
 	if status != StatusCollaborator {
-		h.Log.Printf("User %s is not a collaborator of repository %s/%s, or the user does not exist", username, owner, repo)
-		h.writeErrorResponse(w, http.StatusNotFound, "User is not a collaborator of the repository or the user does not exist")
+		// Invitations are checked when pending invitations are requested, or with the report policy,
+		// so that an expired invitation is reported with 410 Gone instead of a plain 404
+		if includePending || h.expiredInvitationPolicy() == handlers.ExpiredInvitationReport {
+			invitation, found, err := h.findUserInvitation(r.Context(), owner, repo, username, authHeader)
+			if err != nil {
+				h.writeErrorResponse(w, r, handlers.StatusForError(err), fmt.Sprintf("Error checking invitations: %v", err))
+				return
+			}
+			if found && invitation.Expired && h.expiredInvitationPolicy() == handlers.ExpiredInvitationReport {
+				h.writeExpiredInvitationResponse(w, r, username, invitation)
+				return
+			}
+			if found && includePending {
+				h.writePendingInvitationResponse(w, r, owner, authHeader, username, invitation)
+				return
+			}
+		}
+
+		h.Logger(r.Context()).Debug().Msgf("User %s is not a collaborator of repository %s/%s, or the user does not exist", username, owner, repo)
+		h.writeErrorResponse(w, r, http.StatusNotFound, "User is not a collaborator of the repository or the user does not exist")
 		return
 	}
 
 	// Get user permission
-	err = h.getUserPermissionAndRespond(w, owner, repo, username, authHeader)
+	err = h.getUserPermissionAndRespond(w, r, owner, repo, username, authHeader)
 	if err != nil {
-		h.writeErrorResponse(w, http.StatusInternalServerError, fmt.Sprintf("Error getting user permission: %v", err))
+		h.writeErrorResponse(w, r, handlers.StatusForError(err), fmt.Sprintf("Error getting user permission: %v", err))
 	}
 }
 
-func (h *getHandler) getUserPermissionAndRespond(w http.ResponseWriter, owner, repo, username, authHeader string) error {
-	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/collaborators/%s/permission", owner, repo, username)
-	resp, err := h.makeGitHubRequest("GET", url, authHeader, nil)
+func (h *getHandler) getUserPermissionAndRespond(w http.ResponseWriter, r *http.Request, owner, repo, username, authHeader string) error {
+	url := githuburl.Join("repos", owner, repo, "collaborators", username, "permission")
+	resp, err := h.makeGitHubRequest(r.Context(), "GET", url, authHeader, nil)
 	if err != nil {
 		return err
 	}
@@ -178,19 +410,19 @@ func (h *getHandler) getUserPermissionAndRespond(w http.ResponseWriter, owner, r
 	}
 
 	// Process the response body through the transformation pipeline
-	processedBody, err := h.processPermissionResponse(body, owner, repo, username)
+	processedBody, err := h.processPermissionResponse(r.Context(), body, owner, repo, username, authHeader)
 	if err != nil {
-		h.Log.Printf("Failed to process response, returning original: %v", err)
+		h.Logger(r.Context()).Warn().Msgf("Failed to process response, returning original: %v", err)
 		h.writeJSONResponse(w, http.StatusOK, body)
 		return nil
 	}
 
 	h.writeJSONResponse(w, http.StatusOK, processedBody)
-	h.Log.Printf("Successfully retrieved permission for user %s", username)
+	h.Logger(r.Context()).Debug().Msgf("Successfully retrieved permission for user %s", username)
 	return nil
 }
 
-func (h *getHandler) processPermissionResponse(body []byte, owner, repo, username string) ([]byte, error) {
+func (h *getHandler) processPermissionResponse(ctx context.Context, body []byte, owner, repo, username, authHeader string) ([]byte, error) {
 	// Flatten the response
 	flattenedBody, err := FlattenGitHubUserPermissionBytes(body)
 	if err != nil {
@@ -209,6 +441,20 @@ func (h *getHandler) processPermissionResponse(body []byte, owner, repo, usernam
 		return nil, fmt.Errorf("failed to read permission: %w", err)
 	}
 
+	// Report custom roles with the name defined in the organization, so that it matches the requested one
+	if roleName, ok := permission.(string); ok && h.Roles != nil && !roles.IsBaseRole(roleName) {
+		canonical, known, err := h.Roles.Canonicalize(ctx, owner, authHeader, roleName)
+		if err != nil {
+			h.Logger(ctx).Warn().Msgf("Failed to resolve custom repository roles, reporting role %s as is: %v", roleName, err)
+		} else if known && canonical != roleName {
+			correctedBody, err = AddFieldToResponse(correctedBody, "permission", canonical)
+			if err != nil {
+				return nil, fmt.Errorf("failed to set permission field: %w", err)
+			}
+			permission = canonical
+		}
+	}
+
 	// Add message field
 	message := fmt.Sprintf("User is a collaborator of the repository %s/%s with permission %s", owner, repo, permission)
 	finalBody, err := AddFieldToResponse(correctedBody, "message", message)
@@ -227,41 +473,52 @@ func (h *getHandler) processPermissionResponse(body []byte, owner, repo, usernam
 // @Param repo path string true "Name of the repository"
 // @Param username path string true "Username of the collaborator to add"
 // @Param permission body collaborator.Permission true "Permission to grant to the collaborator"
+// @Param dry_run query bool false "Return the upstream requests that would be sent, without sending them (also X-Dry-Run header)"
+// @Param Idempotency-Key header string false "Key to replay the response of a retried request"
 // @Accept json
 // @Produce json
 // @Success 202  {object} collaborator.Message "Invitation sent to user"
 // @Success 204 "User already collaborator"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden by the plugin policy (policy_violation, with the rule in policy_rule)"
+// @Failure 410 {object} collaborator.ExpiredInvitation "Invitation expired (report policy only)"
+// @Failure 422 {object} handlers.ErrorResponse "Unknown permission"
 // @Router /repository/{owner}/{repo}/collaborators/{username} [post]
 func (h *postHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	owner := r.PathValue("owner")
 	repo := r.PathValue("repo")
+	defer h.invalidateInvitations(owner, repo)
 	username := r.PathValue("username")
 	authHeader := r.Header.Get("Authorization")
 
-	h.Log.Printf("Adding collaborator %s to repository %s/%s", username, owner, repo)
+	h.Logger(r.Context()).Debug().Msgf("Adding collaborator %s to repository %s/%s", username, owner, repo)
 
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		h.writeErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("Error reading request body: %v", err))
+		h.writeErrorResponse(w, r, http.StatusBadRequest, fmt.Sprintf("Error reading request body: %v", err))
 		return
 	}
 	defer r.Body.Close()
 
 	permission, err := ReadFieldFromBody(body, "permission")
 	if err != nil {
-		h.writeErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("Error reading permission from request body: %v", err))
+		h.writeErrorResponse(w, r, http.StatusBadRequest, fmt.Sprintf("Error reading permission from request body: %v", err))
+		return
+	}
+
+	body, canonicalPermission, ok := h.validatePermission(w, r, owner, authHeader, body, fmt.Sprintf("%s", permission))
+	if !ok {
 		return
 	}
 
-	err = h.addCollaborator(w, owner, repo, username, authHeader, body, fmt.Sprintf("%s", permission))
+	err = h.addCollaborator(w, r, owner, repo, username, authHeader, body, canonicalPermission)
 	if err != nil {
-		h.writeErrorResponse(w, http.StatusInternalServerError, fmt.Sprintf("Error adding collaborator: %v", err))
+		h.writeErrorResponse(w, r, handlers.StatusForError(err), fmt.Sprintf("Error adding collaborator: %v", err))
 	}
 }
 
-func (h *postHandler) addCollaborator(w http.ResponseWriter, owner, repo, username, authHeader string, body []byte, permission string) error {
-	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/collaborators/%s", owner, repo, username)
-	resp, err := h.makeGitHubRequest("PUT", url, authHeader, body)
+func (h *postHandler) addCollaborator(w http.ResponseWriter, r *http.Request, owner, repo, username, authHeader string, body []byte, permission string) error {
+	url := githuburl.Join("repos", owner, repo, "collaborators", username)
+	resp, err := h.makeGitHubRequest(r.Context(), "PUT", url, authHeader, body)
 	if err != nil {
 		return err
 	}
@@ -274,27 +531,26 @@ func (h *postHandler) addCollaborator(w http.ResponseWriter, owner, repo, userna
 
 	switch resp.StatusCode {
 	case http.StatusCreated: // Invitation sent
+		// GitHub returns the pending invitation, which could be an expired one
+		var invitation GitHubInvitation
+		if err := json.Unmarshal(respBody, &invitation); err == nil && invitation.Expired {
+			return h.handleExpiredInvitation(w, r, owner, repo, username, authHeader, &invitation, body, permission)
+		}
+
 		message := fmt.Sprintf("Invitation sent to user %s for repository %s/%s with permission %s", username, owner, repo, permission)
 		finalBody, err := AddFieldToResponse([]byte("{}"), "message", message)
 		if err != nil {
 			return fmt.Errorf("failed to add message field: %w", err)
 		}
 		h.writeJSONResponse(w, http.StatusAccepted, finalBody)
-		h.Log.Printf("Invitation sent to user %s", username)
+		h.Logger(r.Context()).Debug().Msgf("Invitation sent to user %s", username)
 
 	case http.StatusNoContent: // User already collaborator
-		h.Log.Printf("User %s is already a collaborator", username)
+		h.Logger(r.Context()).Debug().Msgf("User %s is already a collaborator", username)
 		w.WriteHeader(http.StatusNoContent)
 
 	default:
-		h.Log.Printf("GitHub API returned status %d", resp.StatusCode)
-		w.WriteHeader(resp.StatusCode)
-		if len(respBody) > 0 {
-			w.Header().Set("Content-Type", "application/json")
-			w.Write(respBody)
-		} else {
-			w.Write([]byte(fmt.Sprintf("Error: %s", resp.Status)))
-		}
+		h.writeGitHubError(w, r, resp.StatusCode, respBody, "adding collaborator")
 	}
 
 	return nil
@@ -307,56 +563,67 @@ func (h *postHandler) addCollaborator(w http.ResponseWriter, owner, repo, userna
 // @Param owner path string true "Owner of the repository"
 // @Param repo path string true "Name of the repository"
 // @Param username path string true "Username of the collaborator"
-// @Param permissions body collaborator.Permission true "New permission to set (`pull`, `push`, `admin`, `maintain`, `triage`)"
+// @Param permissions body collaborator.Permission true "New permission to set (`pull`, `push`, `admin`, `maintain`, `triage` or a custom repository role)"
+// @Param dry_run query bool false "Return the upstream requests that would be sent, without sending them (also X-Dry-Run header)"
+// @Param Idempotency-Key header string false "Key to replay the response of a retried request"
 // @Accept json
 // @Produce json
 // @Success 200 {object} collaborator.Message "Permission updated successfully"
-// @Success 202 {object} collaborator.Message "Invitation permission updated"
+// @Success 202 {object} collaborator.Message "Invitation permission updated or expired invitation sent again"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden by the plugin policy (policy_violation, with the rule in policy_rule)"
+// @Failure 410 {object} collaborator.ExpiredInvitation "Invitation expired (report policy only)"
+// @Failure 422 {object} handlers.ErrorResponse "Unknown permission"
 // @Router /repository/{owner}/{repo}/collaborators/{username} [patch]
 func (h *patchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	owner := r.PathValue("owner")
 	repo := r.PathValue("repo")
+	defer h.invalidateInvitations(owner, repo)
 	username := r.PathValue("username")
 	authHeader := r.Header.Get("Authorization")
 
-	h.Log.Printf("Updating permission for user %s in repository %s/%s", username, owner, repo)
+	h.Logger(r.Context()).Debug().Msgf("Updating permission for user %s in repository %s/%s", username, owner, repo)
 
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		h.writeErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("Error reading request body: %v", err))
+		h.writeErrorResponse(w, r, http.StatusBadRequest, fmt.Sprintf("Error reading request body: %v", err))
 		return
 	}
 	defer r.Body.Close()
 
 	permission, err := ReadFieldFromBody(body, "permission")
 	if err != nil {
-		h.writeErrorResponse(w, http.StatusInternalServerError, fmt.Sprintf("Error reading permission from request body: %v", err))
+		h.writeErrorResponse(w, r, http.StatusInternalServerError, fmt.Sprintf("Error reading permission from request body: %v", err))
 		return
 	}
 
-	status, err := h.checkCollaboratorStatus(owner, repo, username, authHeader)
+	body, canonicalPermission, ok := h.validatePermission(w, r, owner, authHeader, body, fmt.Sprintf("%s", permission))
+	if !ok {
+		return
+	}
+
+	status, err := h.checkCollaboratorStatus(r.Context(), owner, repo, username, authHeader)
 	if err != nil {
-		h.writeErrorResponse(w, http.StatusInternalServerError, fmt.Sprintf("Error checking collaborator status: %v", err))
+		h.writeErrorResponse(w, r, handlers.StatusForError(err), fmt.Sprintf("Error checking collaborator status: %v", err))
 		return
 	}
 
 	switch status {
 	case StatusCollaborator:
-		err = h.updateCollaboratorPermission(w, owner, repo, username, authHeader, body, fmt.Sprintf("%s", permission))
+		err = h.updateCollaboratorPermission(w, r, owner, repo, username, authHeader, body, canonicalPermission)
 	case StatusNotCollaborator:
-		err = h.updateInvitationPermission(w, owner, repo, username, authHeader, body, fmt.Sprintf("%s", permission))
+		err = h.updateInvitationPermission(w, r, owner, repo, username, authHeader, body, canonicalPermission)
 	}
 
 	if err != nil {
-		h.writeErrorResponse(w, http.StatusInternalServerError, fmt.Sprintf("Error updating permission: %v", err))
+		h.writeErrorResponse(w, r, handlers.StatusForError(err), fmt.Sprintf("Error updating permission: %v", err))
 	}
 }
 
-func (h *patchHandler) updateCollaboratorPermission(w http.ResponseWriter, owner, repo, username, authHeader string, body []byte, permission string) error {
-	h.Log.Printf("User %s is already a collaborator, updating permission", username)
+func (h *patchHandler) updateCollaboratorPermission(w http.ResponseWriter, r *http.Request, owner, repo, username, authHeader string, body []byte, permission string) error {
+	h.Logger(r.Context()).Debug().Msgf("User %s is already a collaborator, updating permission", username)
 
-	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/collaborators/%s", owner, repo, username)
-	resp, err := h.makeGitHubRequest("PUT", url, authHeader, body)
+	url := githuburl.Join("repos", owner, repo, "collaborators", username)
+	resp, err := h.makeGitHubRequest(r.Context(), "PUT", url, authHeader, body)
 	if err != nil {
 		return err
 	}
@@ -369,49 +636,37 @@ func (h *patchHandler) updateCollaboratorPermission(w http.ResponseWriter, owner
 			return fmt.Errorf("failed to add message field: %w", err)
 		}
 		h.writeJSONResponse(w, http.StatusOK, finalBody)
-		h.Log.Printf("Successfully updated permission for collaborator %s", username)
+		h.Logger(r.Context()).Debug().Msgf("Successfully updated permission for collaborator %s", username)
 		return nil
 	}
 
-	// Forward error from GitHub API
-	respBody, _ := io.ReadAll(resp.Body)
-	h.Log.Printf("GitHub API returned error %d when updating collaborator", resp.StatusCode)
-	w.WriteHeader(resp.StatusCode)
-	if len(respBody) > 0 {
-		w.Header().Set("Content-Type", "application/json")
-		w.Write(respBody)
-	} else {
-		w.Write([]byte(fmt.Sprintf("Error: %s", resp.Status)))
-	}
+	h.forwardGitHubError(w, r, resp, "updating collaborator")
 	return nil
 }
 
-func (h *patchHandler) updateInvitationPermission(w http.ResponseWriter, owner, repo, username, authHeader string, body []byte, permission string) error {
-	h.Log.Printf("User %s is not a collaborator, checking for pending invitations", username)
+func (h *patchHandler) updateInvitationPermission(w http.ResponseWriter, r *http.Request, owner, repo, username, authHeader string, body []byte, permission string) error {
+	h.Logger(r.Context()).Debug().Msgf("User %s is not a collaborator, checking for pending invitations", username)
 
-	invitation, found, err := h.findUserInvitation(owner, repo, username, authHeader)
+	invitation, found, err := h.findUserInvitation(r.Context(), owner, repo, username, authHeader)
 	if err != nil {
 		return fmt.Errorf("error checking invitations: %w", err)
 	}
 
 	if !found {
-		h.Log.Printf("User %s has no collaborator status or pending invitation", username)
-		message := fmt.Sprintf("User %s is not a collaborator and has no pending invitation", username)
-		finalBody, err := AddFieldToResponse([]byte("{}"), "message", message)
-		if err != nil {
-			w.WriteHeader(http.StatusNotFound)
-			w.Write([]byte(fmt.Sprintf("User %s not found as collaborator or invitee", username)))
-			return nil
-		}
-		h.writeJSONResponse(w, http.StatusNotFound, finalBody)
+		h.Logger(r.Context()).Debug().Msgf("User %s has no collaborator status or pending invitation", username)
+		h.writeErrorResponse(w, r, http.StatusNotFound, fmt.Sprintf("User %s is not a collaborator and has no pending invitation", username))
 		return nil
 	}
 
-	return h.updateInvitation(w, owner, repo, username, invitation.ID, authHeader, body, permission)
+	if invitation.Expired {
+		return h.handleExpiredInvitation(w, r, owner, repo, username, authHeader, invitation, body, permission)
+	}
+
+	return h.updateInvitation(w, r, owner, repo, username, invitation.ID, authHeader, body, permission)
 }
 
-func (h *patchHandler) updateInvitation(w http.ResponseWriter, owner, repo, username string, invitationID int64, authHeader string, body []byte, permission string) error {
-	h.Log.Printf("Found pending invitation for user %s (ID: %d), updating permission", username, invitationID)
+func (h *patchHandler) updateInvitation(w http.ResponseWriter, r *http.Request, owner, repo, username string, invitationID int64, authHeader string, body []byte, permission string) error {
+	h.Logger(r.Context()).Debug().Msgf("Found pending invitation for user %s (ID: %d), updating permission", username, invitationID)
 
 	// Correct the request body for invitation API
 	correctedBody, err := CorrectGitHubUserPermissionsFieldReqBody(body)
@@ -419,8 +674,8 @@ func (h *patchHandler) updateInvitation(w http.ResponseWriter, owner, repo, user
 		return fmt.Errorf("failed to correct permissions field: %w", err)
 	}
 
-	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/invitations/%d", owner, repo, invitationID)
-	resp, err := h.makeGitHubRequest("PATCH", url, authHeader, correctedBody)
+	url := githuburl.Join("repos", owner, repo, "invitations", strconv.FormatInt(invitationID, 10))
+	resp, err := h.makeGitHubRequest(r.Context(), "PATCH", url, authHeader, correctedBody)
 	if err != nil {
 		return err
 	}
@@ -433,20 +688,11 @@ func (h *patchHandler) updateInvitation(w http.ResponseWriter, owner, repo, user
 			return fmt.Errorf("failed to add message field: %w", err)
 		}
 		h.writeJSONResponse(w, http.StatusAccepted, finalBody)
-		h.Log.Printf("Successfully updated invitation permission for user %s", username)
+		h.Logger(r.Context()).Debug().Msgf("Successfully updated invitation permission for user %s", username)
 		return nil
 	}
 
-	// Forward error from GitHub API
-	respBody, _ := io.ReadAll(resp.Body)
-	h.Log.Printf("GitHub API returned error %d when updating invitation", resp.StatusCode)
-	w.WriteHeader(resp.StatusCode)
-	if len(respBody) > 0 {
-		w.Header().Set("Content-Type", "application/json")
-		w.Write(respBody)
-	} else {
-		w.Write([]byte(fmt.Sprintf("Error: %s", resp.Status)))
-	}
+	h.forwardGitHubError(w, r, resp, "updating invitation")
 	return nil
 }
 
@@ -457,42 +703,46 @@ func (h *patchHandler) updateInvitation(w http.ResponseWriter, owner, repo, user
 // @Param owner path string true "Owner of the repository"
 // @Param repo path string true "Name of the repository"
 // @Param username path string true "Username of the collaborator to remove"
+// @Param dry_run query bool false "Return the upstream requests that would be sent, without sending them (also X-Dry-Run header)"
+// @Param Idempotency-Key header string false "Key to replay the response of a retried request"
 // @Produce json
 // @Success 200 {object} collaborator.Message "Collaborator removed successfully"
 // @Success 202 {object} collaborator.Message "Invitation cancelled successfully"
 // @Success 404 {object} collaborator.Message "User not found as collaborator or invitee"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden by the plugin policy (policy_violation, with the rule in policy_rule)"
 // @Router /repository/{owner}/{repo}/collaborators/{username} [delete]
 func (h *deleteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	owner := r.PathValue("owner")
 	repo := r.PathValue("repo")
+	defer h.invalidateInvitations(owner, repo)
 	username := r.PathValue("username")
 	authHeader := r.Header.Get("Authorization")
 
-	h.Log.Printf("Removing user %s from repository %s/%s", username, owner, repo)
+	h.Logger(r.Context()).Debug().Msgf("Removing user %s from repository %s/%s", username, owner, repo)
 
-	status, err := h.checkCollaboratorStatus(owner, repo, username, authHeader)
+	status, err := h.checkCollaboratorStatus(r.Context(), owner, repo, username, authHeader)
 	if err != nil {
-		h.writeErrorResponse(w, http.StatusInternalServerError, fmt.Sprintf("Error checking collaborator status: %v", err))
+		h.writeErrorResponse(w, r, handlers.StatusForError(err), fmt.Sprintf("Error checking collaborator status: %v", err))
 		return
 	}
 
 	switch status {
 	case StatusCollaborator:
-		err = h.removeCollaborator(w, owner, repo, username, authHeader)
+		err = h.removeCollaborator(w, r, owner, repo, username, authHeader)
 	case StatusNotCollaborator:
-		err = h.cancelInvitation(w, owner, repo, username, authHeader)
+		err = h.cancelInvitation(w, r, owner, repo, username, authHeader)
 	}
 
 	if err != nil {
-		h.writeErrorResponse(w, http.StatusInternalServerError, fmt.Sprintf("Error removing user: %v", err))
+		h.writeErrorResponse(w, r, handlers.StatusForError(err), fmt.Sprintf("Error removing user: %v", err))
 	}
 }
 
-func (h *deleteHandler) removeCollaborator(w http.ResponseWriter, owner, repo, username, authHeader string) error {
-	h.Log.Printf("User %s is a collaborator, removing from repository", username)
+func (h *deleteHandler) removeCollaborator(w http.ResponseWriter, r *http.Request, owner, repo, username, authHeader string) error {
+	h.Logger(r.Context()).Debug().Msgf("User %s is a collaborator, removing from repository", username)
 
-	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/collaborators/%s", owner, repo, username)
-	resp, err := h.makeGitHubRequest("DELETE", url, authHeader, nil)
+	url := githuburl.Join("repos", owner, repo, "collaborators", username)
+	resp, err := h.makeGitHubRequest(r.Context(), "DELETE", url, authHeader, nil)
 	if err != nil {
 		return err
 	}
@@ -505,48 +755,32 @@ func (h *deleteHandler) removeCollaborator(w http.ResponseWriter, owner, repo, u
 			return fmt.Errorf("failed to add message field: %w", err)
 		}
 		h.writeJSONResponse(w, http.StatusOK, finalBody)
-		h.Log.Printf("Successfully removed collaborator %s", username)
+		h.Logger(r.Context()).Debug().Msgf("Successfully removed collaborator %s", username)
 		return nil
 	}
 
-	// Forward error from GitHub API
-	respBody, _ := io.ReadAll(resp.Body)
-	h.Log.Printf("GitHub API returned error %d when removing collaborator", resp.StatusCode)
-	w.WriteHeader(resp.StatusCode)
-	if len(respBody) > 0 {
-		w.Header().Set("Content-Type", "application/json")
-		w.Write(respBody)
-	} else {
-		w.Write([]byte(fmt.Sprintf("Error: %s", resp.Status)))
-	}
+	h.forwardGitHubError(w, r, resp, "removing collaborator")
 	return nil
 }
 
-func (h *deleteHandler) cancelInvitation(w http.ResponseWriter, owner, repo, username, authHeader string) error {
-	h.Log.Printf("User %s is not a collaborator, checking for pending invitations", username)
+func (h *deleteHandler) cancelInvitation(w http.ResponseWriter, r *http.Request, owner, repo, username, authHeader string) error {
+	h.Logger(r.Context()).Debug().Msgf("User %s is not a collaborator, checking for pending invitations", username)
 
-	invitation, found, err := h.findUserInvitation(owner, repo, username, authHeader)
+	invitation, found, err := h.findUserInvitation(r.Context(), owner, repo, username, authHeader)
 	if err != nil {
 		return fmt.Errorf("error checking invitations: %w", err)
 	}
 
 	if !found {
-		h.Log.Printf("User %s has no collaborator status or pending invitation", username)
-		message := fmt.Sprintf("User %s is not a collaborator and has no pending invitation", username)
-		finalBody, err := AddFieldToResponse([]byte("{}"), "message", message)
-		if err != nil {
-			w.WriteHeader(http.StatusNotFound)
-			w.Write([]byte(fmt.Sprintf("User %s not found as collaborator or invitee", username)))
-			return nil
-		}
-		h.writeJSONResponse(w, http.StatusNotFound, finalBody)
+		h.Logger(r.Context()).Debug().Msgf("User %s has no collaborator status or pending invitation", username)
+		h.writeErrorResponse(w, r, http.StatusNotFound, fmt.Sprintf("User %s is not a collaborator and has no pending invitation", username))
 		return nil
 	}
 
-	h.Log.Printf("Found pending invitation for user %s (ID: %d), cancelling invitation", username, invitation.ID)
+	h.Logger(r.Context()).Debug().Msgf("Found pending invitation for user %s (ID: %d), cancelling invitation", username, invitation.ID)
 
-	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/invitations/%d", owner, repo, invitation.ID)
-	resp, err := h.makeGitHubRequest("DELETE", url, authHeader, nil)
+	url := githuburl.Join("repos", owner, repo, "invitations", strconv.FormatInt(invitation.ID, 10))
+	resp, err := h.makeGitHubRequest(r.Context(), "DELETE", url, authHeader, nil)
 	if err != nil {
 		return err
 	}
@@ -559,20 +793,11 @@ func (h *deleteHandler) cancelInvitation(w http.ResponseWriter, owner, repo, use
 			return fmt.Errorf("failed to add message field: %w", err)
 		}
 		h.writeJSONResponse(w, http.StatusAccepted, finalBody)
-		h.Log.Printf("Successfully cancelled invitation for user %s", username)
+		h.Logger(r.Context()).Debug().Msgf("Successfully cancelled invitation for user %s", username)
 		return nil
 	}
 
-	// Forward error from GitHub API
-	respBody, _ := io.ReadAll(resp.Body)
-	h.Log.Printf("GitHub API returned error %d when cancelling invitation", resp.StatusCode)
-	w.WriteHeader(resp.StatusCode)
-	if len(respBody) > 0 {
-		w.Header().Set("Content-Type", "application/json")
-		w.Write(respBody)
-	} else {
-		w.Write([]byte(fmt.Sprintf("Error: %s", resp.Status)))
-	}
+	h.forwardGitHubError(w, r, resp, "cancelling invitation")
 	return nil
 }
 
@@ -581,16 +806,18 @@ type httpDoer interface {
 }
 
 // Common helper function for finding user invitations
-func findUserInvitationHelper(client httpDoer, logger interface {
-	Printf(string, ...interface{})
-	Print(...interface{})
-}, owner, repo, username, authHeader string) (*GitHubInvitation, bool, error) {
-	logger.Printf("Checking invitations for user %s in repository %s/%s", username, owner, repo)
+func findUserInvitationHelper(ctx context.Context, client httpDoer, logger *zerolog.Logger, owner, repo, username, authHeader string) (*GitHubInvitation, bool, error) {
+	logger.Debug().Msgf("Checking invitations for user %s in repository %s/%s", username, owner, repo)
 	page := 1
 	perPage := 30
 
 	for {
-		req, err := http.NewRequest("GET", fmt.Sprintf("https://api.github.com/repos/%s/%s/invitations?per_page=%d&page=%d", owner, repo, perPage, page), nil)
+		// Stop paginating as soon as the request is cancelled or its deadline expires
+		if err := ctx.Err(); err != nil {
+			return nil, false, err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, "GET", githuburl.Join("repos", owner, repo, "invitations")+fmt.Sprintf("?per_page=%d&page=%d", perPage, page), nil)
 		if err != nil {
 			return nil, false, err
 		}
@@ -607,7 +834,7 @@ func findUserInvitationHelper(client httpDoer, logger interface {
 
 		// If we can't get invitations (not 200 OK), return not found
 		if inviteResp.StatusCode != http.StatusOK {
-			logger.Printf("Failed to get invitations, status: %d", inviteResp.StatusCode)
+			logger.Warn().Msgf("Failed to get invitations, status: %d", inviteResp.StatusCode)
 			return nil, false, nil
 		}
 
@@ -1,15 +1,21 @@
 package collaborator
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/handlers"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/roles"
 	"github.com/rs/zerolog"
 )
 
@@ -17,6 +23,7 @@ import (
 // this is needed for external API calls in the handler
 // it allows us to simulate responses and errors without making real HTTP requests (e.g., for GitHub API calls).
 type mockHTTPClient struct {
+	mu        sync.Mutex // bulk requests are sent concurrently
 	responses map[string]*http.Response
 	errors    map[string]error
 	requests  []*http.Request
@@ -36,6 +43,9 @@ func newMockHTTPClient() *mockHTTPClient {
 // Do implements the http.Client Do method for mockHTTPClient.
 // It simulates sending an HTTP request and returns a response or an error
 func (m *mockHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	// Store the request for verification
 	m.requests = append(m.requests, req)
 
@@ -46,6 +56,11 @@ func (m *mockHTTPClient) Do(req *http.Request) (*http.Response, error) {
 		return nil, err
 	}
 
+	// Responses configured for a specific method ("METHOD URL") take precedence
+	if resp, exists := m.responses[req.Method+" "+key]; exists {
+		return resp, nil
+	}
+
 	// Return configured response or default 404
 	if resp, exists := m.responses[key]; exists {
 		return resp, nil
@@ -1182,7 +1197,7 @@ func TestBaseHandler_Methods(t *testing.T) {
 
 				handler := createTestGetHandler(mockClient)
 
-				status, err := handler.checkCollaboratorStatus(testOwner, testRepo, testUsername, testToken)
+				status, err := handler.checkCollaboratorStatus(context.Background(), testOwner, testRepo, testUsername, testToken)
 
 				if tt.expectError && err == nil {
 					t.Error("expected error but got nil")
@@ -1251,7 +1266,7 @@ func TestFindUserInvitationHelper(t *testing.T) {
 
 			logger := zerolog.New(io.Discard).With().Timestamp().Logger()
 
-			invitation, found, err := findUserInvitationHelper(mockClient, &logger, testOwner, testRepo, testUsername, testToken)
+			invitation, found, err := findUserInvitationHelper(context.Background(), mockClient, &logger, testOwner, testRepo, testUsername, testToken)
 
 			if tt.expectError && err == nil {
 				t.Error("expected error but got nil")
@@ -1271,3 +1286,489 @@ func TestFindUserInvitationHelper(t *testing.T) {
 		})
 	}
 }
+
+func TestFindUserInvitationHelper_Cancelled(t *testing.T) {
+	mockClient := newMockHTTPClient()
+	mockClient.setResponse(fmt.Sprintf("%s?per_page=30&page=1", invitationsExternalURL), http.StatusOK, validInvitationResp)
+	logger := zerolog.New(io.Discard)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, found, err := findUserInvitationHelper(ctx, mockClient, &logger, testOwner, testRepo, testUsername, testToken)
+	if !errors.Is(err, context.Canceled) || found {
+		t.Errorf("expected context.Canceled, got found=%v, err=%v", found, err)
+	}
+	if mockClient.getRequestCount() != 0 {
+		t.Errorf("expected pagination to stop before any request, got %d requests", mockClient.getRequestCount())
+	}
+}
+
+func TestUpstreamTimeout(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "deadline exceeded",
+			err:            &url.Error{Op: "Get", URL: collaboratorExternalURL, Err: context.DeadlineExceeded},
+			expectedStatus: http.StatusGatewayTimeout,
+			expectedBody:   `"code":"timeout"`,
+		},
+		{
+			name:           "network error",
+			err:            fmt.Errorf("network error"),
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   `"code":"internal_error"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := newMockHTTPClient()
+			mockClient.setError(collaboratorExternalURL, tt.err)
+
+			mux := http.NewServeMux()
+			mux.Handle("GET /repository/{owner}/{repo}/collaborators/{username}/permission", handlers.RequestTimeout(time.Minute, createTestGetHandler(mockClient)))
+
+			req := httptest.NewRequest("GET", "/repository/"+testOwner+"/"+testRepo+"/collaborators/"+testUsername+"/permission", nil)
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus || !strings.Contains(rr.Body.String(), tt.expectedBody) {
+				t.Errorf("expected %d with %s, got %d: %s", tt.expectedStatus, tt.expectedBody, rr.Code, rr.Body.String())
+			}
+			if _, hasDeadline := mockClient.requests[0].Context().Deadline(); !hasDeadline {
+				t.Errorf("expected the upstream request to carry the request deadline")
+			}
+		})
+	}
+}
+
+// Test custom repository roles handling
+func TestCustomRepositoryRoles(t *testing.T) {
+	customRolesURL := fmt.Sprintf("https://api.github.com/orgs/%s/custom-repository-roles", testOwner)
+	customRolesResp := `{"total_count": 1, "custom_roles": [{"id": 1, "name": "Security Engineer", "base_role": "maintain"}]}`
+
+	newOpts := func(mockClient *mockHTTPClient) handlers.HandlerOptions {
+		logger := zerolog.New(io.Discard).With().Timestamp().Logger()
+		return handlers.HandlerOptions{
+			Client: mockClient,
+			Log:    &logger,
+			Roles:  roles.NewResolver(mockClient, time.Minute),
+		}
+	}
+
+	t.Run("POST accepts custom role and sends its canonical name", func(t *testing.T) {
+		mockClient := newMockHTTPClient()
+		mockClient.setResponse(customRolesURL, http.StatusOK, customRolesResp)
+		mockClient.setResponse(collaboratorExternalURL, http.StatusCreated, `{}`)
+
+		mux := http.NewServeMux()
+		mux.Handle("POST /repository/{owner}/{repo}/collaborators/{username}", PostCollaborator(newOpts(mockClient)))
+		req := httptest.NewRequest("POST", fmt.Sprintf("/repository/%s/%s/collaborators/%s", testOwner, testRepo, testUsername), strings.NewReader(`{"permission": "security engineer"}`))
+		req.Header.Set("Authorization", testToken)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusAccepted {
+			t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusAccepted)
+		}
+		if mockClient.getRequestCount() != 2 {
+			t.Fatalf("expected 2 requests, got %d", mockClient.getRequestCount())
+		}
+		upstreamBody, _ := io.ReadAll(mockClient.getLastRequest().Body)
+		if !strings.Contains(string(upstreamBody), `"permission":"Security Engineer"`) {
+			t.Errorf("upstream body should contain the canonical custom role name, got %s", upstreamBody)
+		}
+	})
+
+	t.Run("GET reports the custom role of a pending invitation with its canonical name", func(t *testing.T) {
+		mockClient := newMockHTTPClient()
+		mockClient.setResponse(customRolesURL, http.StatusOK, customRolesResp)
+		mockClient.setResponse(collaboratorExternalURL, http.StatusNotFound, `{"message": "Not Found"}`)
+		mockClient.setResponse(fmt.Sprintf("%s?per_page=30&page=1", invitationsExternalURL), http.StatusOK,
+			strings.Replace(validInvitationResp, `"permissions": "read"`, `"permissions": "security engineer"`, 1))
+
+		mux := http.NewServeMux()
+		mux.Handle("GET /repository/{owner}/{repo}/collaborators/{username}/permission", GetCollaborator(newOpts(mockClient)))
+		req := httptest.NewRequest("GET", fmt.Sprintf("/repository/%s/%s/collaborators/%s/permission?include_pending=true", testOwner, testRepo, testUsername), nil)
+		req.Header.Set("Authorization", testToken)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusAccepted || !strings.Contains(rr.Body.String(), `"permission":"Security Engineer"`) {
+			t.Errorf("expected the pending invitation with the canonical custom role name, got %d: %s", rr.Code, rr.Body.String())
+		}
+	})
+
+	t.Run("POST rejects unknown role", func(t *testing.T) {
+		mockClient := newMockHTTPClient()
+		mockClient.setResponse(customRolesURL, http.StatusOK, customRolesResp)
+
+		mux := http.NewServeMux()
+		mux.Handle("POST /repository/{owner}/{repo}/collaborators/{username}", PostCollaborator(newOpts(mockClient)))
+		req := httptest.NewRequest("POST", fmt.Sprintf("/repository/%s/%s/collaborators/%s", testOwner, testRepo, testUsername), strings.NewReader(`{"permission": "auditor"}`))
+		req.Header.Set("Authorization", testToken)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusUnprocessableEntity)
+		}
+		if !strings.Contains(rr.Body.String(), "Unknown permission auditor") {
+			t.Errorf("unexpected body %s", rr.Body.String())
+		}
+		if mockClient.getRequestCount() != 1 {
+			t.Errorf("expected 1 request, got %d", mockClient.getRequestCount())
+		}
+	})
+
+	t.Run("PATCH invitation with custom role", func(t *testing.T) {
+		mockClient := newMockHTTPClient()
+		mockClient.setResponse(customRolesURL, http.StatusOK, customRolesResp)
+		mockClient.setResponse(collaboratorExternalURL, http.StatusNotFound, `{"message": "Not Found"}`)
+		mockClient.setResponse(fmt.Sprintf("%s?per_page=30&page=1", invitationsExternalURL), http.StatusOK, validInvitationResp)
+		mockClient.setResponse(fmt.Sprintf("https://api.github.com/repos/%s/%s/invitations/1", testOwner, testRepo), http.StatusOK, `{}`)
+
+		mux := http.NewServeMux()
+		mux.Handle("PATCH /repository/{owner}/{repo}/collaborators/{username}", PatchCollaborator(newOpts(mockClient)))
+		req := httptest.NewRequest("PATCH", fmt.Sprintf("/repository/%s/%s/collaborators/%s", testOwner, testRepo, testUsername), strings.NewReader(`{"permission": "SECURITY ENGINEER"}`))
+		req.Header.Set("Authorization", testToken)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusAccepted {
+			t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusAccepted)
+		}
+		upstreamBody, _ := io.ReadAll(mockClient.getLastRequest().Body)
+		if !strings.Contains(string(upstreamBody), `"permissions":"Security Engineer"`) {
+			t.Errorf("upstream body should contain the canonical custom role name, got %s", upstreamBody)
+		}
+	})
+
+	t.Run("GET reports the custom role name", func(t *testing.T) {
+		mockClient := newMockHTTPClient()
+		mockClient.setResponse(customRolesURL, http.StatusOK, customRolesResp)
+		mockClient.setResponse(collaboratorExternalURL, http.StatusNoContent, "")
+		mockClient.setResponse(permissionExternalURL, http.StatusOK, `{
+			"permission": "write",
+			"user": {"login": "testuser", "id": 12345, "html_url": "https://github.com/testuser", "permissions": {"admin": false, "maintain": true, "push": true, "triage": true, "pull": true}},
+			"role_name": "security engineer"
+		}`)
+
+		mux := http.NewServeMux()
+		mux.Handle("GET /repository/{owner}/{repo}/collaborators/{username}/permission", GetCollaborator(newOpts(mockClient)))
+		req := httptest.NewRequest("GET", fmt.Sprintf("/repository/%s/%s/collaborators/%s/permission", testOwner, testRepo, testUsername), nil)
+		req.Header.Set("Authorization", testToken)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+		}
+		if !strings.Contains(rr.Body.String(), `"permission":"Security Engineer"`) {
+			t.Errorf("response should report the custom role name, got %s", rr.Body.String())
+		}
+	})
+}
+
+func TestExpiredInvitations(t *testing.T) {
+	expiredInvitationsResp := strings.Replace(validInvitationResp, `"expired": false`, `"expired": true`, 1)
+	expiredInvitationResp := strings.TrimSuffix(strings.TrimPrefix(expiredInvitationsResp, "["), "]")
+	invitationURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/invitations/1", testOwner, testRepo)
+	invitationsPageURL := fmt.Sprintf("%s?per_page=30&page=1", invitationsExternalURL)
+
+	newOpts := func(mockClient *mockHTTPClient, policy handlers.ExpiredInvitationPolicy) handlers.HandlerOptions {
+		logger := zerolog.New(io.Discard).With().Timestamp().Logger()
+		return handlers.HandlerOptions{
+			Client:                  mockClient,
+			Log:                     &logger,
+			ExpiredInvitationPolicy: policy,
+		}
+	}
+
+	tests := []struct {
+		name             string
+		method           string
+		policy           handlers.ExpiredInvitationPolicy
+		body             string
+		setupMock        func(*mockHTTPClient)
+		expectedStatus   int
+		expectedBody     string
+		expectedRequests int
+		expectDelete     bool
+	}{
+		{
+			name:   "GET with report policy returns 410",
+			method: "GET",
+			policy: handlers.ExpiredInvitationReport,
+			setupMock: func(m *mockHTTPClient) {
+				m.setResponse(collaboratorExternalURL, http.StatusNotFound, `{"message": "Not Found"}`)
+				m.setResponse(invitationsPageURL, http.StatusOK, expiredInvitationsResp)
+			},
+			expectedStatus:   http.StatusGone,
+			expectedBody:     `"code":"gone","message":"Invitation for user testuser is expired","expired":true`,
+			expectedRequests: 2,
+		},
+		{
+			name:   "GET with reinvite policy returns 404",
+			method: "GET",
+			policy: handlers.ExpiredInvitationReinvite,
+			setupMock: func(m *mockHTTPClient) {
+				m.setResponse(collaboratorExternalURL, http.StatusNotFound, `{"message": "Not Found"}`)
+			},
+			expectedStatus:   http.StatusNotFound,
+			expectedRequests: 1,
+		},
+		{
+			name:   "POST with reinvite policy deletes the expired invitation and invites again",
+			method: "POST",
+			body:   `{"permission": "push"}`,
+			setupMock: func(m *mockHTTPClient) {
+				// The second PUT gets an empty body, that is a fresh invitation
+				m.setResponse(collaboratorExternalURL, http.StatusCreated, expiredInvitationResp)
+				m.setResponse(invitationURL, http.StatusNoContent, "")
+			},
+			expectedStatus:   http.StatusAccepted,
+			expectedBody:     "Expired invitation replaced",
+			expectedRequests: 3,
+			expectDelete:     true,
+		},
+		{
+			name:   "POST with report policy returns 410",
+			method: "POST",
+			policy: handlers.ExpiredInvitationReport,
+			body:   `{"permission": "push"}`,
+			setupMock: func(m *mockHTTPClient) {
+				m.setResponse(collaboratorExternalURL, http.StatusCreated, expiredInvitationResp)
+			},
+			expectedStatus:   http.StatusGone,
+			expectedBody:     `"invitation_id":1`,
+			expectedRequests: 1,
+		},
+		{
+			name:   "PATCH with reinvite policy deletes the expired invitation and invites again",
+			method: "PATCH",
+			policy: handlers.ExpiredInvitationReinvite,
+			body:   `{"permission": "push"}`,
+			setupMock: func(m *mockHTTPClient) {
+				m.setResponse(collaboratorExternalURL, http.StatusNotFound, `{"message": "Not Found"}`)
+				m.setResponse(invitationsPageURL, http.StatusOK, expiredInvitationsResp)
+				m.setResponse(invitationURL, http.StatusNoContent, "")
+				m.setResponse("PUT "+collaboratorExternalURL, http.StatusCreated, `{}`)
+			},
+			expectedStatus:   http.StatusAccepted,
+			expectedBody:     "Expired invitation replaced",
+			expectedRequests: 4,
+			expectDelete:     true,
+		},
+		{
+			name:   "PATCH with report policy returns 410",
+			method: "PATCH",
+			policy: handlers.ExpiredInvitationReport,
+			body:   `{"permission": "push"}`,
+			setupMock: func(m *mockHTTPClient) {
+				m.setResponse(collaboratorExternalURL, http.StatusNotFound, `{"message": "Not Found"}`)
+				m.setResponse(invitationsPageURL, http.StatusOK, expiredInvitationsResp)
+			},
+			expectedStatus:   http.StatusGone,
+			expectedBody:     `"expired":true`,
+			expectedRequests: 2,
+		},
+		{
+			name:   "PATCH with reinvite policy forwards the error deleting the invitation",
+			method: "PATCH",
+			body:   `{"permission": "push"}`,
+			setupMock: func(m *mockHTTPClient) {
+				m.setResponse(collaboratorExternalURL, http.StatusNotFound, `{"message": "Not Found"}`)
+				m.setResponse(invitationsPageURL, http.StatusOK, expiredInvitationsResp)
+				m.setResponse(invitationURL, http.StatusForbidden, `{"message": "Forbidden"}`)
+			},
+			expectedStatus:   http.StatusForbidden,
+			expectedBody:     "Forbidden",
+			expectedRequests: 3,
+			expectDelete:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := newMockHTTPClient()
+			tt.setupMock(mockClient)
+			opts := newOpts(mockClient, tt.policy)
+
+			mux := http.NewServeMux()
+			mux.Handle("GET /repository/{owner}/{repo}/collaborators/{username}/permission", GetCollaborator(opts))
+			mux.Handle("POST /repository/{owner}/{repo}/collaborators/{username}", PostCollaborator(opts))
+			mux.Handle("PATCH /repository/{owner}/{repo}/collaborators/{username}", PatchCollaborator(opts))
+
+			path := fmt.Sprintf("/repository/%s/%s/collaborators/%s", testOwner, testRepo, testUsername)
+			if tt.method == "GET" {
+				path += "/permission"
+			}
+			req := httptest.NewRequest(tt.method, path, strings.NewReader(tt.body))
+			req.Header.Set("Authorization", testToken)
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v, body %s", rr.Code, tt.expectedStatus, rr.Body.String())
+			}
+			if tt.expectedBody != "" && !strings.Contains(rr.Body.String(), tt.expectedBody) {
+				t.Errorf("handler returned unexpected body: got %s, want it to contain %s", rr.Body.String(), tt.expectedBody)
+			}
+			if mockClient.getRequestCount() != tt.expectedRequests {
+				t.Errorf("expected %d requests, got %d", tt.expectedRequests, mockClient.getRequestCount())
+			}
+
+			deleted := false
+			for _, r := range mockClient.requests {
+				if r.Method == "DELETE" && r.URL.String() == invitationURL {
+					deleted = true
+				}
+			}
+			if deleted != tt.expectDelete {
+				t.Errorf("expected expired invitation deletion %v, got %v", tt.expectDelete, deleted)
+			}
+		})
+	}
+}
+
+func TestParseExpiredInvitationPolicy(t *testing.T) {
+	for value, expected := range map[string]handlers.ExpiredInvitationPolicy{
+		"":         handlers.ExpiredInvitationReinvite,
+		"reinvite": handlers.ExpiredInvitationReinvite,
+		"report":   handlers.ExpiredInvitationReport,
+	} {
+		policy, err := handlers.ParseExpiredInvitationPolicy(value)
+		if err != nil || policy != expected {
+			t.Errorf("ParseExpiredInvitationPolicy(%q) = %q, %v, want %q", value, policy, err, expected)
+		}
+	}
+	if _, err := handlers.ParseExpiredInvitationPolicy("ignore"); err == nil {
+		t.Error("expected an error for an invalid policy")
+	}
+}
+
+func TestGetHandler_IncludePending(t *testing.T) {
+	invitationsPageURL := fmt.Sprintf("%s?per_page=30&page=1", invitationsExternalURL)
+	expiredInvitationsResp := strings.Replace(validInvitationResp, `"expired": false`, `"expired": true`, 1)
+
+	tests := []struct {
+		name             string
+		query            string
+		policy           handlers.ExpiredInvitationPolicy
+		setupMock        func(*mockHTTPClient)
+		expectedStatus   int
+		expectedBody     []string
+		expectedRequests int
+	}{
+		{
+			name:  "pending invitation is reported with 202",
+			query: "?include_pending=true",
+			setupMock: func(m *mockHTTPClient) {
+				m.setResponse(collaboratorExternalURL, http.StatusNotFound, `{"message": "Not Found"}`)
+				m.setResponse(invitationsPageURL, http.StatusOK, validInvitationResp)
+			},
+			expectedStatus:   http.StatusAccepted,
+			expectedBody:     []string{`"permission":"pull"`, `"invitation_id":1`, `"created_at":"2016-06-13T14:52:50-05:00"`, `"expired":false`},
+			expectedRequests: 2,
+		},
+		{
+			name:  "expired invitation is reported with 202 and the reinvite policy",
+			query: "?include_pending=true",
+			setupMock: func(m *mockHTTPClient) {
+				m.setResponse(collaboratorExternalURL, http.StatusNotFound, `{"message": "Not Found"}`)
+				m.setResponse(invitationsPageURL, http.StatusOK, expiredInvitationsResp)
+			},
+			expectedStatus:   http.StatusAccepted,
+			expectedBody:     []string{`"expired":true`},
+			expectedRequests: 2,
+		},
+		{
+			name:   "expired invitation is reported with 410 and the report policy",
+			query:  "?include_pending=true",
+			policy: handlers.ExpiredInvitationReport,
+			setupMock: func(m *mockHTTPClient) {
+				m.setResponse(collaboratorExternalURL, http.StatusNotFound, `{"message": "Not Found"}`)
+				m.setResponse(invitationsPageURL, http.StatusOK, expiredInvitationsResp)
+			},
+			expectedStatus:   http.StatusGone,
+			expectedBody:     []string{`"expired":true`},
+			expectedRequests: 2,
+		},
+		{
+			name:  "no invitation returns 404",
+			query: "?include_pending=true",
+			setupMock: func(m *mockHTTPClient) {
+				m.setResponse(collaboratorExternalURL, http.StatusNotFound, `{"message": "Not Found"}`)
+				m.setResponse(invitationsPageURL, http.StatusOK, emptyInvitationResp)
+			},
+			expectedStatus:   http.StatusNotFound,
+			expectedRequests: 2,
+		},
+		{
+			name: "invitations are not checked without include_pending",
+			setupMock: func(m *mockHTTPClient) {
+				m.setResponse(collaboratorExternalURL, http.StatusNotFound, `{"message": "Not Found"}`)
+				m.setResponse(invitationsPageURL, http.StatusOK, validInvitationResp)
+			},
+			expectedStatus:   http.StatusNotFound,
+			expectedRequests: 1,
+		},
+		{
+			name:  "collaborator is reported as usual",
+			query: "?include_pending=true",
+			setupMock: func(m *mockHTTPClient) {
+				m.setResponse(collaboratorExternalURL, http.StatusNoContent, "")
+				m.setResponse(permissionExternalURL, http.StatusOK, validPermissionResp)
+			},
+			expectedStatus:   http.StatusOK,
+			expectedBody:     []string{`"permission":"admin"`},
+			expectedRequests: 2,
+		},
+		{
+			name:             "invalid include_pending",
+			query:            "?include_pending=maybe",
+			setupMock:        func(m *mockHTTPClient) {},
+			expectedStatus:   http.StatusBadRequest,
+			expectedBody:     []string{"invalid include_pending"},
+			expectedRequests: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := newMockHTTPClient()
+			tt.setupMock(mockClient)
+			logger := zerolog.New(io.Discard).With().Timestamp().Logger()
+			handler := GetCollaborator(handlers.HandlerOptions{
+				Client:                  mockClient,
+				Log:                     &logger,
+				ExpiredInvitationPolicy: tt.policy,
+			})
+
+			mux := http.NewServeMux()
+			mux.Handle("GET /repository/{owner}/{repo}/collaborators/{username}/permission", handler)
+			req := httptest.NewRequest("GET", fmt.Sprintf("/repository/%s/%s/collaborators/%s/permission%s", testOwner, testRepo, testUsername, tt.query), nil)
+			req.Header.Set("Authorization", testToken)
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v, body %s", rr.Code, tt.expectedStatus, rr.Body.String())
+			}
+			for _, expected := range tt.expectedBody {
+				if !strings.Contains(rr.Body.String(), expected) {
+					t.Errorf("handler returned unexpected body: got %s, want it to contain %s", rr.Body.String(), expected)
+				}
+			}
+			if mockClient.getRequestCount() != tt.expectedRequests {
+				t.Errorf("expected %d requests, got %d", tt.expectedRequests, mockClient.getRequestCount())
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package collaborator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/githuburl"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/handlers"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/roles"
+)
+
+// DiffCollaborator compares the desired permission of a user with the current one
+func DiffCollaborator(opts handlers.HandlerOptions) handlers.Handler {
+	return &diffHandler{baseHandler: newBaseHandler(opts)}
+}
+
+var _ handlers.Handler = &diffHandler{}
+
+type diffHandler struct {
+	*baseHandler
+}
+
+// Current state of a user in a repository
+const (
+	StateCollaborator      = "collaborator"
+	StateInvitation        = "invitation"
+	StateExpiredInvitation = "expired_invitation"
+	StateAbsent            = "absent"
+)
+
+// Actions needed to reach the desired state of a user
+const (
+	ActionNone             = "none"
+	ActionAdd              = "add"
+	ActionUpdate           = "update"
+	ActionUpdateInvitation = "update_invitation"
+	ActionReinvite         = "reinvite"
+	ActionReportExpired    = "report_expired"
+)
+
+// POST handler implementation
+// @Summary Compare the desired permission of a user with the current one
+// @Description Get the current collaborator or invitation of a user, normalize both permissions and report the differences with the action needed to reach the desired state.
+// @Description A pending invitation with the desired permission is in sync: no action is needed until the user accepts it.
+// @ID post-repo-collaborator-diff
+// @Param owner path string true "Owner of the repository"
+// @Param repo path string true "Name of the repository"
+// @Param username path string true "Username of the collaborator"
+// @Param permission body collaborator.Permission true "Desired permission"
+// @Accept json
+// @Produce json
+// @Success 200 {object} collaborator.CollaboratorDiff
+// @Failure 400 {object} handlers.ErrorResponse "Invalid request body"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden by the plugin policy (policy_violation, with the rule in policy_rule)"
+// @Failure 422 {object} handlers.ErrorResponse "Unknown permission"
+// @Router /repository/{owner}/{repo}/collaborators/{username}/diff [post]
+func (h *diffHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	owner := r.PathValue("owner")
+	repo := r.PathValue("repo")
+	username := r.PathValue("username")
+	authHeader := r.Header.Get("Authorization")
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, fmt.Sprintf("Error reading request body: %v", err))
+		return
+	}
+	defer r.Body.Close()
+
+	var desired Permission
+	if err := json.Unmarshal(body, &desired); err != nil {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, fmt.Sprintf("Invalid request body: %v", err))
+		return
+	}
+	if desired.Permission == "" {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, "Invalid request body: permission is required")
+		return
+	}
+
+	_, permission, ok := h.validatePermission(w, r, owner, authHeader, body, desired.Permission)
+	if !ok {
+		return
+	}
+
+	h.Logger(r.Context()).Debug().Msgf("Comparing permission %s of user %s with repository %s/%s", permission, username, owner, repo)
+
+	var collaborator *repoCollaborator
+	var invitation *GitHubInvitation
+
+	status, err := h.checkCollaboratorStatus(r.Context(), owner, repo, username, authHeader)
+	if err != nil {
+		h.writeErrorResponse(w, r, handlers.StatusForError(err), fmt.Sprintf("Error checking collaborator status: %v", err))
+		return
+	}
+	if status == StatusCollaborator {
+		collaborator, ok, err = h.getCollaborator(w, r, owner, repo, username, authHeader)
+		if err != nil {
+			h.writeErrorResponse(w, r, handlers.StatusForError(err), fmt.Sprintf("Error getting user permission: %v", err))
+			return
+		}
+		if !ok {
+			return // GitHub error already forwarded
+		}
+	} else {
+		var found bool
+		invitation, found, err = h.findUserInvitation(r.Context(), owner, repo, username, authHeader)
+		if err != nil {
+			h.writeErrorResponse(w, r, handlers.StatusForError(err), fmt.Sprintf("Error checking invitations: %v", err))
+			return
+		}
+		if !found {
+			invitation = nil
+		}
+	}
+
+	diff := diffCollaborator(permission, collaborator, invitation, h.expiredInvitationPolicy())
+	finalBody, err := json.Marshal(diff)
+	if err != nil {
+		h.writeErrorResponse(w, r, http.StatusInternalServerError, fmt.Sprintf("Error marshaling diff: %v", err))
+		return
+	}
+	h.writeJSONResponse(w, http.StatusOK, finalBody)
+	h.Logger(r.Context()).Debug().Msgf("User %s of repository %s/%s is %s, in sync: %v, action: %s", username, owner, repo, diff.State, diff.InSync, diff.Action)
+}
+
+// getCollaborator gets the role of a collaborator.
+// It returns false when the GitHub error has been forwarded.
+func (h *diffHandler) getCollaborator(w http.ResponseWriter, r *http.Request, owner, repo, username, authHeader string) (*repoCollaborator, bool, error) {
+	url := githuburl.Join("repos", owner, repo, "collaborators", username, "permission")
+	resp, err := h.makeGitHubRequest(r.Context(), "GET", url, authHeader, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		h.forwardGitHubError(w, r, resp, "getting user permission")
+		return nil, false, nil
+	}
+
+	var permission RepoPermissions
+	if err := json.NewDecoder(resp.Body).Decode(&permission); err != nil {
+		return nil, false, fmt.Errorf("failed to unmarshal permission: %w", err)
+	}
+	login := permission.User.Login
+	if login == "" {
+		login = username
+	}
+	return &repoCollaborator{Login: login, RoleName: permission.RoleName}, true, nil
+}
+
+// diffCollaborator compares the desired (canonical) permission of a user with its current collaborator or invitation,
+// either of which may be nil. Permissions are compared in the request vocabulary, custom roles case-insensitively.
+func diffCollaborator(desired string, collaborator *repoCollaborator, invitation *GitHubInvitation, policy handlers.ExpiredInvitationPolicy) CollaboratorDiff {
+	diff := CollaboratorDiff{Desired: desired, Changes: []FieldChange{}}
+
+	switch {
+	case collaborator != nil:
+		diff.State = StateCollaborator
+		diff.Permission = roles.NormalizeRoleName(collaborator.RoleName)
+		diff.Action = ActionUpdate
+
+	case invitation != nil:
+		diff.State = StateInvitation
+		diff.Permission = roles.NormalizeRoleName(invitation.Permissions)
+		diff.InvitationID = invitation.ID
+		diff.Action = ActionUpdateInvitation
+		if invitation.Expired {
+			// An expired invitation has to be sent again (or reported), whatever its permission
+			diff.State = StateExpiredInvitation
+			diff.Action = ActionReinvite
+			if policy == handlers.ExpiredInvitationReport {
+				diff.Action = ActionReportExpired
+			}
+			diff.Changes = append(diff.Changes, FieldChange{Field: "state", Current: StateExpiredInvitation, Desired: StateInvitation})
+		}
+
+	default:
+		diff.State = StateAbsent
+		diff.Action = ActionAdd
+		diff.Changes = append(diff.Changes, FieldChange{Field: "state", Current: StateAbsent, Desired: StateCollaborator})
+	}
+
+	if !strings.EqualFold(diff.Permission, desired) {
+		diff.Changes = append(diff.Changes, FieldChange{Field: "permission", Current: diff.Permission, Desired: desired})
+	}
+	diff.InSync = len(diff.Changes) == 0
+	if diff.InSync {
+		diff.Action = ActionNone
+	}
+	return diff
+}
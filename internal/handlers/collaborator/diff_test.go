@@ -0,0 +1,198 @@
+package collaborator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/handlers"
+	"github.com/rs/zerolog"
+)
+
+func TestDiffCollaborator(t *testing.T) {
+	tests := []struct {
+		name            string
+		desired         string
+		collaborator    *repoCollaborator
+		invitation      *GitHubInvitation
+		policy          handlers.ExpiredInvitationPolicy
+		expectedState   string
+		expectedAction  string
+		expectedChanges []string
+	}{
+		{
+			name:           "collaborator in sync",
+			desired:        "push",
+			collaborator:   &repoCollaborator{Login: "alice", RoleName: "write"},
+			expectedState:  StateCollaborator,
+			expectedAction: ActionNone,
+		},
+		{
+			name:           "custom role in sync",
+			desired:        "Security Reviewer",
+			collaborator:   &repoCollaborator{Login: "alice", RoleName: "security reviewer"},
+			expectedState:  StateCollaborator,
+			expectedAction: ActionNone,
+		},
+		{
+			name:            "collaborator permission changed",
+			desired:         "admin",
+			collaborator:    &repoCollaborator{Login: "alice", RoleName: "read"},
+			expectedState:   StateCollaborator,
+			expectedAction:  ActionUpdate,
+			expectedChanges: []string{"permission: pull -> admin"},
+		},
+		{
+			name:           "invitation pending",
+			desired:        "pull",
+			invitation:     &GitHubInvitation{ID: 4, Permissions: "read"},
+			expectedState:  StateInvitation,
+			expectedAction: ActionNone,
+		},
+		{
+			name:            "invitation permission changed",
+			desired:         "maintain",
+			invitation:      &GitHubInvitation{ID: 4, Permissions: "read"},
+			expectedState:   StateInvitation,
+			expectedAction:  ActionUpdateInvitation,
+			expectedChanges: []string{"permission: pull -> maintain"},
+		},
+		{
+			name:            "expired invitation",
+			desired:         "pull",
+			invitation:      &GitHubInvitation{ID: 4, Permissions: "read", Expired: true},
+			policy:          handlers.ExpiredInvitationReinvite,
+			expectedState:   StateExpiredInvitation,
+			expectedAction:  ActionReinvite,
+			expectedChanges: []string{"state: expired_invitation -> invitation"},
+		},
+		{
+			name:            "expired invitation with report policy",
+			desired:         "push",
+			invitation:      &GitHubInvitation{ID: 4, Permissions: "read", Expired: true},
+			policy:          handlers.ExpiredInvitationReport,
+			expectedState:   StateExpiredInvitation,
+			expectedAction:  ActionReportExpired,
+			expectedChanges: []string{"state: expired_invitation -> invitation", "permission: pull -> push"},
+		},
+		{
+			name:            "absent",
+			desired:         "triage",
+			expectedState:   StateAbsent,
+			expectedAction:  ActionAdd,
+			expectedChanges: []string{"state: absent -> collaborator", "permission:  -> triage"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff := diffCollaborator(tt.desired, tt.collaborator, tt.invitation, tt.policy)
+
+			var changes []string
+			for _, change := range diff.Changes {
+				changes = append(changes, fmt.Sprintf("%s: %s -> %s", change.Field, change.Current, change.Desired))
+			}
+			if diff.State != tt.expectedState || diff.Action != tt.expectedAction || fmt.Sprint(changes) != fmt.Sprint(tt.expectedChanges) {
+				t.Errorf("got state %s, action %s, changes %v; want %s, %s, %v", diff.State, diff.Action, changes, tt.expectedState, tt.expectedAction, tt.expectedChanges)
+			}
+			if diff.InSync != (len(tt.expectedChanges) == 0) {
+				t.Errorf("expected in_sync %v, got %v", len(tt.expectedChanges) == 0, diff.InSync)
+			}
+		})
+	}
+}
+
+func TestDiffHandler_ServeHTTP(t *testing.T) {
+	invitationsURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/invitations?per_page=30&page=1", testOwner, testRepo)
+
+	tests := []struct {
+		name           string
+		body           string
+		setupMock      func(*mockHTTPClient)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name: "collaborator in sync",
+			body: `{"permission": "push"}`,
+			setupMock: func(m *mockHTTPClient) {
+				m.setResponse(collaboratorExternalURL, http.StatusNoContent, "")
+				m.setResponse(permissionExternalURL, http.StatusOK, `{"permission": "write", "role_name": "write", "user": {"login": "testuser"}}`)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"in_sync":true,"state":"collaborator","action":"none","permission":"push","desired":"push","changes":[]}`,
+		},
+		{
+			name: "pending invitation with another permission",
+			body: `{"permission": "admin"}`,
+			setupMock: func(m *mockHTTPClient) {
+				m.setResponse(invitationsURL, http.StatusOK, `[{"id": 7, "invitee": {"login": "testuser"}, "permissions": "write"}]`)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"in_sync":false,"state":"invitation","action":"update_invitation","permission":"push","desired":"admin","invitation_id":7,"changes":[{"field":"permission","current":"push","desired":"admin"}]}`,
+		},
+		{
+			name: "absent",
+			body: `{"permission": "pull"}`,
+			setupMock: func(m *mockHTTPClient) {
+				m.setResponse(invitationsURL, http.StatusOK, `[]`)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"state":"absent","action":"add"`,
+		},
+		{
+			name: "permission lookup forbidden",
+			body: `{"permission": "push"}`,
+			setupMock: func(m *mockHTTPClient) {
+				m.setResponse(collaboratorExternalURL, http.StatusNoContent, "")
+				m.setResponse(permissionExternalURL, http.StatusForbidden, `{"message": "Resource not accessible"}`)
+			},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   `"upstream_message":"Resource not accessible"`,
+		},
+		{
+			name:           "missing permission",
+			body:           `{}`,
+			setupMock:      func(m *mockHTTPClient) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "permission is required",
+		},
+		{
+			name:           "invalid body",
+			body:           `not json`,
+			setupMock:      func(m *mockHTTPClient) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Invalid request body",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := newMockHTTPClient()
+			tt.setupMock(mockClient)
+
+			logger := zerolog.New(io.Discard)
+			mux := http.NewServeMux()
+			mux.Handle("POST /repository/{owner}/{repo}/collaborators/{username}/diff", DiffCollaborator(handlers.HandlerOptions{Client: mockClient, Log: &logger}))
+
+			req := httptest.NewRequest("POST", fmt.Sprintf("/repository/%s/%s/collaborators/%s/diff", testOwner, testRepo, testUsername), strings.NewReader(tt.body))
+			req.Header.Set("Authorization", testToken)
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus || !strings.Contains(rr.Body.String(), tt.expectedBody) {
+				t.Errorf("expected %d with %s, got %d: %s", tt.expectedStatus, tt.expectedBody, rr.Code, rr.Body.String())
+			}
+			if rr.Code == http.StatusOK {
+				var diff CollaboratorDiff
+				if err := json.Unmarshal(rr.Body.Bytes(), &diff); err != nil {
+					t.Errorf("failed to unmarshal diff: %v", err)
+				}
+			}
+		})
+	}
+}
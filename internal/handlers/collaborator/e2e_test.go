@@ -0,0 +1,298 @@
+package collaborator
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/fakegithub"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/handlers"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/invitations"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/roles"
+	"github.com/rs/zerolog"
+)
+
+// newE2EServer returns a mux serving the collaborator handlers against the fake GitHub API
+func newE2EServer(fake *fakegithub.Server, policy handlers.ExpiredInvitationPolicy) *http.ServeMux {
+	logger := zerolog.New(io.Discard)
+	opts := handlers.HandlerOptions{
+		Client:                  fake.Client(),
+		Log:                     &logger,
+		Roles:                   roles.NewResolver(fake.Client(), time.Minute),
+		ExpiredInvitationPolicy: policy,
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /repository/{owner}/{repo}/collaborators/{username}/permission", GetCollaborator(opts))
+	mux.Handle("POST /repository/{owner}/{repo}/collaborators/{username}", PostCollaborator(opts))
+	mux.Handle("PATCH /repository/{owner}/{repo}/collaborators/{username}", PatchCollaborator(opts))
+	mux.Handle("DELETE /repository/{owner}/{repo}/collaborators/{username}", DeleteCollaborator(opts))
+	mux.Handle("PUT /repository/{owner}/{repo}/collaborators", PutCollaborators(opts))
+	return mux
+}
+
+func serveE2E(mux *http.ServeMux, method, path, body string) *httptest.ResponseRecorder {
+	var reqBody io.Reader
+	if body != "" {
+		reqBody = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, path, reqBody)
+	req.Header.Set("Authorization", testToken)
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	return rr
+}
+
+func newE2EFake() *fakegithub.Server {
+	fake := fakegithub.New()
+	fake.RequireToken(strings.TrimPrefix(testToken, "token "))
+	fake.AddOrg(testOwner, "member")
+	fake.AddCustomRole(testOwner, "Security Engineer", fakegithub.RoleMaintain)
+	fake.AddRepo(testOwner, testRepo)
+	fake.AddUser(testUsername)
+	return fake
+}
+
+func TestE2E_CollaboratorLifecycle(t *testing.T) {
+	fake := newE2EFake()
+	defer fake.Close()
+	mux := newE2EServer(fake, handlers.ExpiredInvitationReinvite)
+
+	const path = "/repository/" + testOwner + "/" + testRepo + "/collaborators/"
+
+	if rr := serveE2E(mux, "GET", path+testUsername+"/permission", ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 before the invitation, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	if rr := serveE2E(mux, "POST", path+testUsername, `{"permission": "pull"}`); rr.Code != http.StatusAccepted {
+		t.Fatalf("expected 202 for the invitation, got %d: %s", rr.Code, rr.Body.String())
+	}
+	invitation, exists := fake.Invitation(testOwner, testRepo, testUsername)
+	if !exists || invitation.Permissions != fakegithub.RoleRead {
+		t.Fatalf("expected a read invitation, got %+v", invitation)
+	}
+
+	rr := serveE2E(mux, "GET", path+testUsername+"/permission?include_pending=true", "")
+	if rr.Code != http.StatusAccepted || !strings.Contains(rr.Body.String(), `"permission":"pull"`) {
+		t.Errorf("expected the pending invitation, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	if rr := serveE2E(mux, "PATCH", path+testUsername, `{"permission": "push"}`); rr.Code != http.StatusAccepted {
+		t.Fatalf("expected 202 updating the invitation, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if invitation, _ := fake.Invitation(testOwner, testRepo, testUsername); invitation.Permissions != fakegithub.RoleWrite {
+		t.Errorf("expected the invitation to be updated to write, got %s", invitation.Permissions)
+	}
+
+	// The user accepts the invitation
+	fake.AddCollaborator(testOwner, testRepo, testUsername, fakegithub.RoleMaintain)
+
+	rr = serveE2E(mux, "GET", path+testUsername+"/permission", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 for a collaborator, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var permission map[string]interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &permission); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if permission["permission"] != "maintain" {
+		t.Errorf("expected the maintain role despite the legacy permission, got %v", permission["permission"])
+	}
+
+	if rr := serveE2E(mux, "PATCH", path+testUsername, `{"permission": "security engineer"}`); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 updating to a custom role, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if role, _ := fake.Collaborator(testOwner, testRepo, testUsername); role != "Security Engineer" {
+		t.Errorf("expected the custom role, got %s", role)
+	}
+
+	if rr := serveE2E(mux, "DELETE", path+testUsername, ""); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 removing the collaborator, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if _, exists := fake.Collaborator(testOwner, testRepo, testUsername); exists {
+		t.Errorf("expected the collaborator to be removed")
+	}
+}
+
+func TestE2E_ExpiredInvitation(t *testing.T) {
+	tests := []struct {
+		name           string
+		policy         handlers.ExpiredInvitationPolicy
+		expectedStatus int
+		expectReplaced bool
+	}{
+		{name: "reinvite", policy: handlers.ExpiredInvitationReinvite, expectedStatus: http.StatusAccepted, expectReplaced: true},
+		{name: "report", policy: handlers.ExpiredInvitationReport, expectedStatus: http.StatusGone, expectReplaced: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newE2EFake()
+			defer fake.Close()
+			mux := newE2EServer(fake, tt.policy)
+			expiredID := fake.AddInvitation(testOwner, testRepo, testUsername, fakegithub.RoleRead, true)
+
+			rr := serveE2E(mux, "POST", "/repository/"+testOwner+"/"+testRepo+"/collaborators/"+testUsername, `{"permission": "admin"}`)
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+
+			invitation, exists := fake.Invitation(testOwner, testRepo, testUsername)
+			if !exists {
+				t.Fatalf("expected an invitation")
+			}
+			if replaced := invitation.ID != expiredID; replaced != tt.expectReplaced {
+				t.Errorf("expected replaced=%v, got invitation %+v", tt.expectReplaced, invitation)
+			}
+			if tt.expectReplaced && (invitation.Expired || invitation.Permissions != fakegithub.RoleAdmin) {
+				t.Errorf("expected a new admin invitation, got %+v", invitation)
+			}
+		})
+	}
+}
+
+func TestE2E_Reconcile(t *testing.T) {
+	fake := newE2EFake()
+	defer fake.Close()
+	mux := newE2EServer(fake, handlers.ExpiredInvitationReinvite)
+
+	fake.AddUser("keep")
+	fake.AddUser("upgrade")
+	fake.AddUser("stale")
+	fake.AddCollaborator(testOwner, testRepo, "keep", fakegithub.RoleRead)
+	fake.AddCollaborator(testOwner, testRepo, "upgrade", fakegithub.RoleRead)
+	fake.AddCollaborator(testOwner, testRepo, "stale", fakegithub.RoleWrite)
+
+	body := `{"collaborators": [
+		{"username": "keep", "permission": "pull"},
+		{"username": "upgrade", "permission": "admin"},
+		{"username": "member", "permission": "triage"},
+		{"username": "` + testUsername + `", "permission": "push"}
+	]}`
+	rr := serveE2E(mux, "PUT", "/repository/"+testOwner+"/"+testRepo+"/collaborators", body)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var response BulkCollaboratorsResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	results := make(map[string]string)
+	for _, result := range response.Results {
+		results[result.Username] = result.Result
+	}
+	expected := map[string]string{
+		"keep":       BulkUnchanged,
+		"upgrade":    BulkUpdated,
+		"member":     BulkAdded,
+		testUsername: BulkInvited,
+		"stale":      BulkRemoved,
+	}
+	for username, result := range expected {
+		if results[username] != result {
+			t.Errorf("%s: expected %s, got %s", username, result, results[username])
+		}
+	}
+
+	if role, _ := fake.Collaborator(testOwner, testRepo, "upgrade"); role != fakegithub.RoleAdmin {
+		t.Errorf("expected upgrade to be admin, got %s", role)
+	}
+	if _, exists := fake.Collaborator(testOwner, testRepo, "stale"); exists {
+		t.Errorf("expected stale to be removed")
+	}
+
+	// A second run has nothing left to do
+	rr = serveE2E(mux, "PUT", "/repository/"+testOwner+"/"+testRepo+"/collaborators", body)
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	for _, result := range response.Results {
+		if result.Result != BulkUnchanged && result.Result != BulkPending {
+			t.Errorf("%s: expected no change on the second run, got %s", result.Username, result.Result)
+		}
+	}
+}
+
+func TestE2E_ReconcilePersonalRepository(t *testing.T) {
+	fake := newE2EFake()
+	defer fake.Close()
+	mux := newE2EServer(fake, handlers.ExpiredInvitationReinvite)
+
+	// The owner of a personal repository is listed as a direct collaborator
+	fake.AddUser("octo-owner")
+	fake.AddRepo("octo-owner", "dotfiles")
+	fake.AddCollaborator("octo-owner", "dotfiles", "stale", fakegithub.RoleWrite)
+
+	rr := serveE2E(mux, "PUT", "/repository/octo-owner/dotfiles/collaborators", `{"collaborators": []}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var response BulkCollaboratorsResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(response.Results) != 1 || response.Results[0].Username != "stale" || response.Results[0].Result != BulkRemoved {
+		t.Errorf("expected only stale to be removed, got %+v", response.Results)
+	}
+	for _, request := range fake.Requests() {
+		if request == "DELETE /repos/octo-owner/dotfiles/collaborators/octo-owner" {
+			t.Errorf("expected the owner not to be removed")
+		}
+	}
+}
+
+func TestE2E_InvitationIndex(t *testing.T) {
+	fake := newE2EFake()
+	defer fake.Close()
+	fake.AddInvitation(testOwner, testRepo, testUsername, fakegithub.RoleRead, false)
+
+	logger := zerolog.New(io.Discard)
+	opts := handlers.HandlerOptions{
+		Client:      fake.Client(),
+		Log:         &logger,
+		Invitations: invitations.NewIndex(fake.Client(), time.Minute),
+	}
+	mux := http.NewServeMux()
+	mux.Handle("GET /repository/{owner}/{repo}/collaborators/{username}/permission", GetCollaborator(opts))
+	mux.Handle("PATCH /repository/{owner}/{repo}/collaborators/{username}", PatchCollaborator(opts))
+
+	const path = "/repository/" + testOwner + "/" + testRepo + "/collaborators/" + testUsername
+	invitationLists := func() int {
+		count := 0
+		for _, request := range fake.Requests() {
+			if strings.HasPrefix(request, "GET /repos/"+testOwner+"/"+testRepo+"/invitations") {
+				count++
+			}
+		}
+		return count
+	}
+
+	for range 2 {
+		rr := serveE2E(mux, "GET", path+"/permission?include_pending=true", "")
+		if rr.Code != http.StatusAccepted || !strings.Contains(rr.Body.String(), `"permission":"pull"`) {
+			t.Fatalf("expected the pending invitation, got %d: %s", rr.Code, rr.Body.String())
+		}
+	}
+	if lists := invitationLists(); lists != 1 {
+		t.Errorf("expected the invitations to be listed once, got %d", lists)
+	}
+
+	// Updating the invitation invalidates the index, so the new permission is reported
+	if rr := serveE2E(mux, "PATCH", path, `{"permission": "push"}`); rr.Code != http.StatusAccepted {
+		t.Fatalf("expected 202 updating the invitation, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr := serveE2E(mux, "GET", path+"/permission?include_pending=true", "")
+	if rr.Code != http.StatusAccepted || !strings.Contains(rr.Body.String(), `"permission":"push"`) {
+		t.Errorf("expected the updated invitation, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if lists := invitationLists(); lists != 2 {
+		t.Errorf("expected the invitations to be listed again after the update, got %d lists", lists)
+	}
+}
@@ -0,0 +1,116 @@
+package collaborator
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/cassette"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/handlers"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/roles"
+	"github.com/rs/zerolog"
+)
+
+// newCassetteOptions returns handler options replaying the named cassette of testdata/cassettes.
+// With CASSETTE_MODE=record the requests are sent to GitHub with the GITHUB_TOKEN token and the cassette is rewritten.
+func newCassetteOptions(t *testing.T, name string) (handlers.HandlerOptions, string) {
+	t.Helper()
+
+	mode, err := cassette.ModeFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	authHeader := testToken
+	if mode == cassette.ModeRecord {
+		authHeader = "token " + os.Getenv("GITHUB_TOKEN")
+	}
+
+	recorder, err := cassette.New(filepath.Join("testdata", "cassettes", name+".yaml"), mode, http.DefaultClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := recorder.Stop(); err != nil {
+			t.Error(err)
+		}
+		if unused := recorder.Unused(); len(unused) > 0 {
+			t.Errorf("recorded interactions were not replayed: %v", unused)
+		}
+	})
+
+	logger := zerolog.New(io.Discard)
+	return handlers.HandlerOptions{
+		Client: recorder,
+		Log:    &logger,
+		Roles:  roles.NewResolver(recorder, time.Minute),
+	}, authHeader
+}
+
+func TestRegression_Cassettes(t *testing.T) {
+	tests := []struct {
+		cassette       string
+		handler        func(handlers.HandlerOptions) handlers.Handler
+		pattern        string
+		path           string
+		body           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			cassette:       "maintain_reported_as_write",
+			handler:        GetCollaborator,
+			pattern:        "GET /repository/{owner}/{repo}/collaborators/{username}/permission",
+			path:           "/repository/testowner/testrepo/collaborators/testuser/permission",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"permission":"maintain"`,
+		},
+		{
+			cassette:       "custom_role_case_insensitive",
+			handler:        PatchCollaborator,
+			pattern:        "PATCH /repository/{owner}/{repo}/collaborators/{username}",
+			path:           "/repository/testowner/testrepo/collaborators/testuser",
+			body:           `{"permission": "security engineer"}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   "with permission Security Engineer",
+		},
+		{
+			cassette:       "expired_invitation_returned",
+			handler:        PostCollaborator,
+			pattern:        "POST /repository/{owner}/{repo}/collaborators/{username}",
+			path:           "/repository/testowner/testrepo/collaborators/testuser",
+			body:           `{"permission": "pull"}`,
+			expectedStatus: http.StatusAccepted,
+			expectedBody:   "Expired invitation replaced",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cassette, func(t *testing.T) {
+			opts, authHeader := newCassetteOptions(t, tt.cassette)
+
+			mux := http.NewServeMux()
+			mux.Handle(tt.pattern, tt.handler(opts))
+
+			var reqBody io.Reader
+			if tt.body != "" {
+				reqBody = strings.NewReader(tt.body)
+			}
+			req := httptest.NewRequest(strings.Fields(tt.pattern)[0], tt.path, reqBody)
+			req.Header.Set("Authorization", authHeader)
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v: %s", rr.Code, tt.expectedStatus, rr.Body.String())
+			}
+			if !strings.Contains(rr.Body.String(), tt.expectedBody) {
+				t.Errorf("expected body to contain %q, got %s", tt.expectedBody, rr.Body.String())
+			}
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	teamrepo "github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/handlers/teamRepo"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/roles"
 	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/utils"
 )
 
@@ -44,6 +45,7 @@ push                  	write                               write
 admin                 	admin                               admin
 maintain              	write                               maintain
 triage                	read                                triage
+<custom role>			<base role of the custom role>		<custom role>
 */
 
 // CorrectGitHubPermissionField corrects the permission field in GitHub API responses
@@ -60,21 +62,8 @@ func CorrectGitHubUserPermissionField(body []byte) ([]byte, error) {
 	if !exists {
 		return body, nil // No roleName field to correct
 	}
-	var permission string
-	switch roleName {
-	case "read":
-		permission = "pull"
-	case "write":
-		permission = "push"
-	case "admin":
-		permission = "admin"
-	case "maintain":
-		permission = "maintain"
-	case "triage":
-		permission = "triage"
-	default:
-		permission = roleName // Use the roleName as is if it doesn't match any known roles
-	}
+	// Custom roles (unknown role names) are used as is
+	permission := roles.NormalizeRoleName(roleName)
 	if permission == "" {
 		return body, nil // No permission to correct
 	}
@@ -144,7 +133,7 @@ func parseInvitations(inviteBody []byte) ([]GitHubInvitation, error) {
 
 // getUserInvitationFromPage checks if a username exists in a page of invitations
 // returns the invitation (if found) along with a boolean indicating if it was found
-// Here we could potentially check if the invitation is expired or not, if needed
+// Expired invitations are returned as well, callers handle them according to the ExpiredInvitationPolicy
 func getUserInvitationFromPage(inviteBody []byte, username string) (*GitHubInvitation, bool) {
 	invitations, err := parseInvitations(inviteBody)
 	if err != nil {
@@ -179,21 +168,8 @@ func CorrectGitHubUserPermissionsFieldReqBody(body []byte) ([]byte, error) {
 	}
 
 	// Map the permission to the permissions field
-	var permissions string
-	switch permission {
-	case "pull":
-		permissions = "read"
-	case "push":
-		permissions = "write"
-	case "admin":
-		permissions = "admin"
-	case "maintain":
-		permissions = "maintain"
-	case "triage":
-		permissions = "triage"
-	default:
-		permissions = permission // Use the permission as is if it doesn't match any known roles
-	}
+	// Custom roles (unknown permissions) are used as is
+	permissions := roles.InvitationPermission(permission)
 
 	// Update the data map with the new permissions field
 	if data["permissions"] == nil {
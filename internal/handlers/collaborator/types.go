@@ -1,5 +1,7 @@
 package collaborator
 
+import "github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/handlers"
+
 type RepoPermissions struct {
 	HTMLURL     string      `json:"html_url"`
 	ID          int         `json:"id"` // user ID
@@ -49,3 +51,57 @@ type Message struct {
 type Permission struct {
 	Permission string `json:"permission"`
 }
+
+type ExpiredInvitation struct {
+	handlers.ErrorResponse
+	Expired      bool   `json:"expired"`
+	InvitationID int64  `json:"invitation_id"`
+	CreatedAt    string `json:"created_at"`
+}
+
+type PendingInvitation struct {
+	Message      string `json:"message"`
+	Permission   string `json:"permission"`
+	InvitationID int64  `json:"invitation_id"`
+	CreatedAt    string `json:"created_at"`
+	Expired      bool   `json:"expired"`
+}
+
+type DesiredCollaborator struct {
+	Username   string `json:"username"`
+	Permission string `json:"permission"`
+}
+
+type BulkCollaboratorsRequest struct {
+	Collaborators []DesiredCollaborator `json:"collaborators"`
+}
+
+type BulkResult struct {
+	Username     string `json:"username"`
+	Permission   string `json:"permission"`
+	Result       string `json:"result"`
+	Status       int    `json:"status,omitempty"` // GitHub API status code of the last request
+	InvitationID int64  `json:"invitation_id,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+type BulkCollaboratorsResponse struct {
+	Results []BulkResult   `json:"results"`
+	Summary map[string]int `json:"summary"` // number of users by result
+}
+
+type FieldChange struct {
+	Field   string `json:"field"`
+	Current string `json:"current"`
+	Desired string `json:"desired"`
+}
+
+type CollaboratorDiff struct {
+	InSync       bool          `json:"in_sync"`
+	State        string        `json:"state"`                   // collaborator, invitation, expired_invitation or absent
+	Action       string        `json:"action"`                  // action needed to reach the desired state
+	Permission   string        `json:"permission,omitempty"`    // current permission, normalized
+	Desired      string        `json:"desired"`                 // desired permission, canonicalized
+	InvitationID int64         `json:"invitation_id,omitempty"` // pending invitation, if any
+	Changes      []FieldChange `json:"changes"`
+}
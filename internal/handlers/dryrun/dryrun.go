@@ -0,0 +1,199 @@
+package dryrun
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/handlers"
+)
+
+// HeaderName is the request header enabling the dry-run mode, as an alternative to the dry_run query parameter
+const HeaderName = "X-Dry-Run"
+
+// Request is an upstream request that would be sent to the GitHub API
+type Request struct {
+	Method string          `json:"method"`
+	URL    string          `json:"url"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// Report is the response of a handler served in dry-run mode
+type Report struct {
+	DryRun         bool            `json:"dry_run"`
+	ExpectedStatus int             `json:"expected_status"`
+	ExpectedBody   json.RawMessage `json:"expected_body,omitempty"`
+	Requests       []Request       `json:"requests"`
+}
+
+// Enabled reports whether the dry-run mode is requested, with the dry_run query parameter or the X-Dry-Run header
+func Enabled(r *http.Request) (bool, error) {
+	value := r.URL.Query().Get("dry_run")
+	if value == "" {
+		value = r.Header.Get(HeaderName)
+	}
+	if value == "" {
+		return false, nil
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid dry_run %q", value)
+	}
+	return enabled, nil
+}
+
+// Handler wraps a mutating handler to support the dry-run mode.
+// Without dry-run, requests are served by the handler built with the given options.
+// With dry-run, a handler is built for the request with a client that sends read-only (GET) requests upstream
+// and records the mutating ones, answering them with the response GitHub returns on success.
+// The response is a Report with the recorded requests and the response the handler would have returned.
+func Handler(opts handlers.HandlerOptions, newHandler func(handlers.HandlerOptions) handlers.Handler) http.Handler {
+	handler := newHandler(opts)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		enabled, err := Enabled(r)
+		if err != nil {
+			opts.Logger(r.Context()).Debug().Err(err).Msg("Invalid dry_run parameter")
+			handlers.WriteError(w, r, http.StatusBadRequest, fmt.Sprintf("Error reading dry_run: %v", err))
+			return
+		}
+		if !enabled {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		client := &Client{Client: opts.Client}
+		dryRunOpts := opts
+		dryRunOpts.Client = client
+
+		recorder := handlers.NewResponseRecorder(nil, true)
+		newHandler(dryRunOpts).ServeHTTP(recorder, r)
+
+		report := Report{
+			DryRun:         true,
+			ExpectedStatus: recorder.StatusCode(),
+			Requests:       client.Requests(),
+		}
+		if len(recorder.Body()) > 0 {
+			report.ExpectedBody = rawJSON(recorder.Body())
+		}
+
+		body, err := json.Marshal(report)
+		if err != nil {
+			handlers.WriteError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error marshaling dry-run report: %v", err))
+			return
+		}
+		opts.Logger(r.Context()).Debug().Int("recorded_requests", len(report.Requests)).Int("expected_status", report.ExpectedStatus).Msg("Dry-run completed")
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	})
+}
+
+// collaboratorURL matches the GitHub API URL of a repository collaborator
+var collaboratorURL = regexp.MustCompile(`^https://api\.github\.com/repos/[^/]+/[^/]+/collaborators/[^/?]+$`)
+
+// Client is an HTTP client that sends read-only requests and records mutating ones
+type Client struct {
+	Client handlers.HTTPClient
+
+	mu       sync.Mutex
+	requests []Request
+}
+
+// Do implements the HTTPClient interface
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	if req.Method == http.MethodGet || req.Method == http.MethodHead {
+		return c.Client.Do(req)
+	}
+
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+		req.Body.Close()
+	}
+
+	c.mu.Lock()
+	c.requests = append(c.requests, Request{Method: req.Method, URL: req.URL.String(), Body: rawJSON(body)})
+	c.mu.Unlock()
+
+	statusCode, err := c.expectedStatus(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// GitHub echoes the resource on success, the request body is the closest approximation
+	responseBody := body
+	if statusCode == http.StatusNoContent || len(responseBody) == 0 {
+		responseBody = nil
+	}
+	return &http.Response{
+		StatusCode: statusCode,
+		Status:     fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode)),
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader(responseBody)),
+		Request:    req,
+	}, nil
+}
+
+// Requests returns the recorded mutating requests
+func (c *Client) Requests() []Request {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Request{}, c.requests...)
+}
+
+// expectedStatus returns the status code GitHub returns on success for a mutating request.
+// Adding a collaborator returns 204 for existing collaborators and 201 when an invitation is sent,
+// so the collaborator status is checked with a read-only request.
+func (c *Client) expectedStatus(req *http.Request) (int, error) {
+	switch req.Method {
+	case http.MethodPut:
+		if !collaboratorURL.MatchString(req.URL.String()) {
+			return http.StatusNoContent, nil
+		}
+		check, err := http.NewRequestWithContext(req.Context(), http.MethodGet, req.URL.String(), nil)
+		if err != nil {
+			return 0, fmt.Errorf("failed to create request: %w", err)
+		}
+		check.Header = req.Header.Clone()
+		check.Header.Del("Content-Type")
+		resp, err := c.Client.Do(check)
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusNoContent {
+			return http.StatusNoContent, nil
+		}
+		return http.StatusCreated, nil
+	case http.MethodPost:
+		return http.StatusCreated, nil
+	case http.MethodPatch:
+		return http.StatusOK, nil
+	default:
+		return http.StatusNoContent, nil
+	}
+}
+
+// rawJSON returns the body as raw JSON, or as a JSON string when it is not valid JSON
+func rawJSON(body []byte) json.RawMessage {
+	if len(body) == 0 {
+		return nil
+	}
+	if json.Valid(body) {
+		return json.RawMessage(body)
+	}
+	quoted, _ := json.Marshal(string(body))
+	return quoted
+}
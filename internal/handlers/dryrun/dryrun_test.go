@@ -0,0 +1,168 @@
+package dryrun
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/handlers"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/handlers/collaborator"
+	"github.com/rs/zerolog"
+)
+
+// mockHTTPClient returns configured responses by "METHOD URL" and records the requests
+type mockHTTPClient struct {
+	responses map[string]int
+	requests  []string
+}
+
+func (m *mockHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	key := req.Method + " " + req.URL.String()
+	m.requests = append(m.requests, key)
+
+	statusCode, exists := m.responses[key]
+	if !exists {
+		statusCode = http.StatusNotFound
+	}
+	return &http.Response{
+		StatusCode: statusCode,
+		Body:       io.NopCloser(strings.NewReader(`{"message": "Not Found"}`)),
+		Header:     make(http.Header),
+	}, nil
+}
+
+const testCollaboratorURL = "https://api.github.com/repos/testowner/testrepo/collaborators/testuser"
+
+func newTestHandler(client *mockHTTPClient, newHandler func(handlers.HandlerOptions) handlers.Handler) http.Handler {
+	logger := zerolog.New(io.Discard)
+	return Handler(handlers.HandlerOptions{Client: client, Log: &logger}, newHandler)
+}
+
+func TestHandler_DryRun(t *testing.T) {
+	tests := []struct {
+		name             string
+		method           string
+		target           string
+		header           string
+		newHandler       func(handlers.HandlerOptions) handlers.Handler
+		responses        map[string]int
+		expectedStatus   int
+		expectedReport   *Report
+		expectedUpstream []string
+	}{
+		{
+			name:       "POST without dry-run is sent upstream",
+			method:     "POST",
+			target:     "/repository/testowner/testrepo/collaborators/testuser",
+			newHandler: collaborator.PostCollaborator,
+			responses: map[string]int{
+				"PUT " + testCollaboratorURL: http.StatusNoContent,
+			},
+			expectedStatus:   http.StatusNoContent,
+			expectedUpstream: []string{"PUT " + testCollaboratorURL},
+		},
+		{
+			name:           "POST with dry_run query parameter expects an invitation",
+			method:         "POST",
+			target:         "/repository/testowner/testrepo/collaborators/testuser?dry_run=true",
+			newHandler:     collaborator.PostCollaborator,
+			expectedStatus: http.StatusOK,
+			expectedReport: &Report{
+				DryRun:         true,
+				ExpectedStatus: http.StatusAccepted,
+				Requests:       []Request{{Method: "PUT", URL: testCollaboratorURL, Body: json.RawMessage(`{"permission": "push"}`)}},
+			},
+			expectedUpstream: []string{"GET " + testCollaboratorURL},
+		},
+		{
+			name:       "POST with dry-run header for an existing collaborator",
+			method:     "POST",
+			target:     "/repository/testowner/testrepo/collaborators/testuser",
+			header:     "true",
+			newHandler: collaborator.PostCollaborator,
+			responses: map[string]int{
+				"GET " + testCollaboratorURL: http.StatusNoContent,
+			},
+			expectedStatus: http.StatusOK,
+			expectedReport: &Report{
+				DryRun:         true,
+				ExpectedStatus: http.StatusNoContent,
+				Requests:       []Request{{Method: "PUT", URL: testCollaboratorURL, Body: json.RawMessage(`{"permission": "push"}`)}},
+			},
+			expectedUpstream: []string{"GET " + testCollaboratorURL},
+		},
+		{
+			name:       "DELETE with dry-run runs the read-side checks",
+			method:     "DELETE",
+			target:     "/repository/testowner/testrepo/collaborators/testuser?dry_run=1",
+			newHandler: collaborator.DeleteCollaborator,
+			responses: map[string]int{
+				"GET " + testCollaboratorURL: http.StatusNoContent,
+			},
+			expectedStatus: http.StatusOK,
+			expectedReport: &Report{
+				DryRun:         true,
+				ExpectedStatus: http.StatusOK,
+				Requests:       []Request{{Method: "DELETE", URL: testCollaboratorURL}},
+			},
+			expectedUpstream: []string{"GET " + testCollaboratorURL},
+		},
+		{
+			name:           "invalid dry_run",
+			method:         "DELETE",
+			target:         "/repository/testowner/testrepo/collaborators/testuser?dry_run=maybe",
+			newHandler:     collaborator.DeleteCollaborator,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &mockHTTPClient{responses: tt.responses}
+
+			mux := http.NewServeMux()
+			mux.Handle(tt.method+" /repository/{owner}/{repo}/collaborators/{username}", newTestHandler(client, tt.newHandler))
+
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(`{"permission": "push"}`))
+			req.Header.Set("Authorization", "token test")
+			if tt.header != "" {
+				req.Header.Set(HeaderName, tt.header)
+			}
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v, body %s", rr.Code, tt.expectedStatus, rr.Body.String())
+			}
+			if strings.Join(client.requests, ",") != strings.Join(tt.expectedUpstream, ",") {
+				t.Errorf("unexpected upstream requests: got %v want %v", client.requests, tt.expectedUpstream)
+			}
+			if tt.expectedReport == nil {
+				return
+			}
+
+			var report Report
+			if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+				t.Fatalf("failed to unmarshal report: %v", err)
+			}
+			if !report.DryRun || report.ExpectedStatus != tt.expectedReport.ExpectedStatus {
+				t.Errorf("unexpected report: got %+v, want %+v", report, tt.expectedReport)
+			}
+			if len(report.Requests) != len(tt.expectedReport.Requests) {
+				t.Fatalf("unexpected recorded requests %+v", report.Requests)
+			}
+			for i, expected := range tt.expectedReport.Requests {
+				got := report.Requests[i]
+				if got.Method != expected.Method || got.URL != expected.URL {
+					t.Errorf("unexpected recorded request %+v, want %+v", got, expected)
+				}
+				if len(expected.Body) > 0 && !strings.Contains(string(got.Body), "push") {
+					t.Errorf("unexpected recorded body %s", got.Body)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+const (
+	// ContentTypeProblemJSON is the media type of RFC 9457 problem details, used for errors when accepted by the client
+	ContentTypeProblemJSON = "application/problem+json"
+	// RequestIDHeader is the header carrying the ID of a request, reported in error responses
+	RequestIDHeader = "X-Request-Id"
+)
+
+// Error codes, stable identifiers of the error classes reported in the `code` field
+const (
+	CodeBadRequest          = "bad_request"
+	CodeUnauthorized        = "unauthorized"
+	CodeForbidden           = "forbidden"
+	CodePolicyViolation     = "policy_violation"
+	CodeNotFound            = "not_found"
+	CodeConflict            = "conflict"
+	CodeGone                = "gone"
+	CodeUnprocessableEntity = "unprocessable_entity"
+	CodeRateLimited         = "rate_limited"
+	CodeTimeout             = "timeout"
+	CodeInternal            = "internal_error"
+	CodeUpstream            = "upstream_error"
+)
+
+// ErrorResponse is the body of every error response of the plugin.
+// Upstream fields are set when the error comes from the GitHub API.
+type ErrorResponse struct {
+	Code             string `json:"code"`
+	Message          string `json:"message"`
+	UpstreamStatus   int    `json:"upstream_status,omitempty"`
+	UpstreamMessage  string `json:"upstream_message,omitempty"`
+	DocumentationURL string `json:"documentation_url,omitempty"`
+	RequestID        string `json:"request_id,omitempty"`
+	PolicyRule       string `json:"policy_rule,omitempty"` // Rule of the plugin policy that rejected the request
+}
+
+// problemResponse is an ErrorResponse in the problem details format, the error fields are extension members
+type problemResponse struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail"`
+	ErrorResponse
+}
+
+// CodeForStatus returns the error code of a status code
+func CodeForStatus(statusCode int) string {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusGone:
+		return CodeGone
+	case http.StatusUnprocessableEntity:
+		return CodeUnprocessableEntity
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	case http.StatusGatewayTimeout:
+		return CodeTimeout
+	}
+	if statusCode >= http.StatusInternalServerError {
+		return CodeInternal
+	}
+	return CodeBadRequest
+}
+
+// UpstreamError builds the error of a non-successful GitHub API response.
+// The GitHub message and documentation URL are read from the response body, when it is JSON.
+func UpstreamError(statusCode int, body []byte, message string) ErrorResponse {
+	e := ErrorResponse{
+		Code:           CodeForStatus(statusCode),
+		Message:        message,
+		UpstreamStatus: statusCode,
+	}
+	if statusCode >= http.StatusInternalServerError {
+		e.Code = CodeUpstream
+	}
+
+	var upstream struct {
+		Message          string `json:"message"`
+		DocumentationURL string `json:"documentation_url"`
+	}
+	if err := json.Unmarshal(body, &upstream); err == nil {
+		e.UpstreamMessage = upstream.Message
+		e.DocumentationURL = upstream.DocumentationURL
+	} else {
+		e.UpstreamMessage = strings.TrimSpace(string(body))
+	}
+	if e.UpstreamMessage == "" {
+		e.UpstreamMessage = http.StatusText(statusCode)
+	}
+	return e
+}
+
+// WriteError writes an error response with the code of the status code
+func WriteError(w http.ResponseWriter, r *http.Request, statusCode int, message string) {
+	WriteErrorResponse(w, r, statusCode, ErrorResponse{Code: CodeForStatus(statusCode), Message: message})
+}
+
+// WriteUpstreamError writes the error of a non-successful GitHub API response, with the GitHub status code
+func WriteUpstreamError(w http.ResponseWriter, r *http.Request, statusCode int, body []byte, message string) {
+	WriteErrorResponse(w, r, statusCode, UpstreamError(statusCode, body, message))
+}
+
+// WriteErrorResponse writes an error response, as problem details when the client accepts application/problem+json.
+// The request ID is taken from the response header, if already set, or from the request header.
+func WriteErrorResponse(w http.ResponseWriter, r *http.Request, statusCode int, e ErrorResponse) {
+	if e.Code == "" {
+		e.Code = CodeForStatus(statusCode)
+	}
+	if e.RequestID == "" {
+		e.RequestID = w.Header().Get(RequestIDHeader)
+	}
+	if e.RequestID == "" && r != nil {
+		e.RequestID = r.Header.Get(RequestIDHeader)
+	}
+
+	var body []byte
+	contentType := "application/json"
+	if r != nil && strings.Contains(r.Header.Get("Accept"), ContentTypeProblemJSON) {
+		contentType = ContentTypeProblemJSON
+		typeURI := "about:blank"
+		if e.DocumentationURL != "" {
+			typeURI = e.DocumentationURL
+		}
+		body, _ = json.Marshal(problemResponse{
+			Type:          typeURI,
+			Title:         http.StatusText(statusCode),
+			Status:        statusCode,
+			Detail:        e.Message,
+			ErrorResponse: e,
+		})
+	} else {
+		body, _ = json.Marshal(e)
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Del("Content-Length")
+	w.WriteHeader(statusCode)
+	w.Write(body)
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCodeForStatus(t *testing.T) {
+	tests := []struct {
+		statusCode int
+		expected   string
+	}{
+		{http.StatusBadRequest, CodeBadRequest},
+		{http.StatusUnauthorized, CodeUnauthorized},
+		{http.StatusForbidden, CodeForbidden},
+		{http.StatusNotFound, CodeNotFound},
+		{http.StatusConflict, CodeConflict},
+		{http.StatusGone, CodeGone},
+		{http.StatusUnprocessableEntity, CodeUnprocessableEntity},
+		{http.StatusTooManyRequests, CodeRateLimited},
+		{http.StatusInternalServerError, CodeInternal},
+		{http.StatusBadGateway, CodeInternal},
+		{http.StatusMethodNotAllowed, CodeBadRequest},
+	}
+
+	for _, tt := range tests {
+		if code := CodeForStatus(tt.statusCode); code != tt.expected {
+			t.Errorf("CodeForStatus(%d) = %q, want %q", tt.statusCode, code, tt.expected)
+		}
+	}
+}
+
+func TestUpstreamError(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		body       string
+		expected   ErrorResponse
+	}{
+		{
+			name:       "GitHub JSON error",
+			statusCode: http.StatusNotFound,
+			body:       `{"message": "Not Found", "documentation_url": "https://docs.github.com/rest"}`,
+			expected: ErrorResponse{
+				Code:             CodeNotFound,
+				Message:          "failed",
+				UpstreamStatus:   http.StatusNotFound,
+				UpstreamMessage:  "Not Found",
+				DocumentationURL: "https://docs.github.com/rest",
+			},
+		},
+		{
+			name:       "plain text body",
+			statusCode: http.StatusForbidden,
+			body:       "forbidden\n",
+			expected:   ErrorResponse{Code: CodeForbidden, Message: "failed", UpstreamStatus: http.StatusForbidden, UpstreamMessage: "forbidden"},
+		},
+		{
+			name:       "empty body",
+			statusCode: http.StatusUnprocessableEntity,
+			expected:   ErrorResponse{Code: CodeUnprocessableEntity, Message: "failed", UpstreamStatus: http.StatusUnprocessableEntity, UpstreamMessage: "Unprocessable Entity"},
+		},
+		{
+			name:       "server error",
+			statusCode: http.StatusBadGateway,
+			body:       `{"message": "Server Error"}`,
+			expected:   ErrorResponse{Code: CodeUpstream, Message: "failed", UpstreamStatus: http.StatusBadGateway, UpstreamMessage: "Server Error"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if e := UpstreamError(tt.statusCode, []byte(tt.body), "failed"); e != tt.expected {
+				t.Errorf("got %+v, want %+v", e, tt.expected)
+			}
+		})
+	}
+}
+
+func TestWriteErrorResponse(t *testing.T) {
+	tests := []struct {
+		name                string
+		accept              string
+		requestID           string
+		responseRequestID   string
+		expectedContentType string
+		expectedRequestID   string
+	}{
+		{
+			name:                "JSON",
+			requestID:           "req-1",
+			expectedContentType: "application/json",
+			expectedRequestID:   "req-1",
+		},
+		{
+			name:                "problem details",
+			accept:              "application/problem+json, application/json",
+			expectedContentType: ContentTypeProblemJSON,
+		},
+		{
+			name:                "request ID of the response",
+			requestID:           "req-1",
+			responseRequestID:   "req-2",
+			expectedContentType: "application/json",
+			expectedRequestID:   "req-2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			if tt.requestID != "" {
+				req.Header.Set(RequestIDHeader, tt.requestID)
+			}
+			rr := httptest.NewRecorder()
+			if tt.responseRequestID != "" {
+				rr.Header().Set(RequestIDHeader, tt.responseRequestID)
+			}
+			rr.Header().Set("Content-Length", "1234")
+
+			WriteUpstreamError(rr, req, http.StatusNotFound, []byte(`{"message": "Not Found", "documentation_url": "https://docs.github.com/rest"}`), "Team not found")
+
+			if rr.Code != http.StatusNotFound {
+				t.Errorf("expected status %d, got %d", http.StatusNotFound, rr.Code)
+			}
+			if contentType := rr.Header().Get("Content-Type"); contentType != tt.expectedContentType {
+				t.Errorf("expected Content-Type %q, got %q", tt.expectedContentType, contentType)
+			}
+			if rr.Header().Get("Content-Length") != "" {
+				t.Errorf("expected Content-Length to be removed")
+			}
+
+			var body map[string]any
+			if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+				t.Fatalf("failed to parse body %s: %v", rr.Body.String(), err)
+			}
+			if body["code"] != CodeNotFound || body["message"] != "Team not found" || body["upstream_status"] != float64(http.StatusNotFound) || body["upstream_message"] != "Not Found" {
+				t.Errorf("unexpected error fields %v", body)
+			}
+			if requestID, _ := body["request_id"].(string); requestID != tt.expectedRequestID {
+				t.Errorf("expected request_id %q, got %q", tt.expectedRequestID, requestID)
+			}
+
+			if tt.expectedContentType == ContentTypeProblemJSON {
+				if body["type"] != "https://docs.github.com/rest" || body["title"] != "Not Found" || body["status"] != float64(http.StatusNotFound) || body["detail"] != "Team not found" {
+					t.Errorf("unexpected problem details %v", body)
+				}
+			} else if _, ok := body["type"]; ok {
+				t.Errorf("expected no problem details members, got %v", body)
+			}
+		})
+	}
+}
@@ -1,7 +1,14 @@
 package handlers
 
 import (
+	"context"
+	"fmt"
 	"net/http"
+
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/invitations"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/policy"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/roles"
+	"github.com/rs/zerolog"
 )
 
 // HTTPClient interface allows mocking of HTTP client
@@ -9,18 +16,56 @@ type HTTPClient interface {
 	Do(req *http.Request) (*http.Response, error)
 }
 
-// Logger interface allows mocking of logger
-type Logger interface {
-	Print(v ...interface{})
-	Printf(format string, v ...interface{})
-	Println(v ...interface{})
+// ExpiredInvitationPolicy defines how handlers deal with expired repository invitations
+type ExpiredInvitationPolicy string
+
+const (
+	// ExpiredInvitationReinvite deletes the expired invitation and sends a new one (default)
+	ExpiredInvitationReinvite ExpiredInvitationPolicy = "reinvite"
+	// ExpiredInvitationReport reports the expired invitation with 410 Gone and `expired: true`
+	ExpiredInvitationReport ExpiredInvitationPolicy = "report"
+)
+
+// ParseExpiredInvitationPolicy validates an expired invitation policy, an empty value means the default one
+func ParseExpiredInvitationPolicy(value string) (ExpiredInvitationPolicy, error) {
+	switch ExpiredInvitationPolicy(value) {
+	case "", ExpiredInvitationReinvite:
+		return ExpiredInvitationReinvite, nil
+	case ExpiredInvitationReport:
+		return ExpiredInvitationReport, nil
+	default:
+		return "", fmt.Errorf("invalid expired invitation policy %q, expected %q or %q", value, ExpiredInvitationReinvite, ExpiredInvitationReport)
+	}
 }
 
 type HandlerOptions struct {
-	Client HTTPClient // HTTPClient interface
-	Log    Logger     // Logger interface
+	Client                  HTTPClient              // HTTPClient interface
+	Log                     *zerolog.Logger         // Base logger, handlers log with the logger of the request (see Logger)
+	Roles                   *roles.Resolver         // Custom repository roles resolver (optional, custom roles are not validated when nil)
+	Invitations             *invitations.Index      // Invitation index cache (optional, invitations are listed on every lookup when nil)
+	ExpiredInvitationPolicy ExpiredInvitationPolicy // How expired invitations are handled (default: reinvite)
+	BulkConcurrency         int                     // Maximum concurrent GitHub requests of bulk endpoints (default: DefaultBulkConcurrency)
+	Policy                  *policy.Store           // Allow/deny policy (optional, everything is allowed when nil)
 }
 
+// nopLogger is the logger of handlers built without one
+var nopLogger = zerolog.Nop()
+
+// Logger returns the logger of the request of ctx, with its request-scoped fields (see RequestLogger),
+// or the base logger outside of a request
+func (o HandlerOptions) Logger(ctx context.Context) *zerolog.Logger {
+	if logger := loggerFromContext(ctx); logger != nil {
+		return logger
+	}
+	if o.Log != nil {
+		return o.Log
+	}
+	return &nopLogger
+}
+
+// DefaultBulkConcurrency is the number of concurrent GitHub requests of bulk endpoints when not configured
+const DefaultBulkConcurrency = 5
+
 // Handler interface
 type Handler interface {
 	ServeHTTP(w http.ResponseWriter, r *http.Request)
@@ -0,0 +1,208 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/githuburl"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/handlers"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// DefaultCheckInterval is how often readiness is checked when not configured
+	DefaultCheckInterval = 30 * time.Second
+	// DefaultCheckTimeout bounds each readiness check
+	DefaultCheckTimeout = 5 * time.Second
+)
+
+// Names of the readiness checks
+const (
+	CheckGitHub      = "github"      // GitHub API reachable
+	CheckCredentials = "credentials" // Configured token accepted by GitHub
+	CheckRateLimit   = "rate_limit"  // Remaining quota of the configured token above the threshold
+)
+
+// CheckerConfig configures the readiness checks
+type CheckerConfig struct {
+	TokenFile    string        // File of a GitHub token whose validity and quota are checked (optional, read on every check)
+	MinRemaining int           // Not ready when the token has fewer remaining core requests (0 to disable)
+	Timeout      time.Duration // Timeout of each check (default DefaultCheckTimeout)
+}
+
+// Result of a readiness check
+type Result struct {
+	Name    string `json:"name"`
+	OK      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
+}
+
+// Status is the readiness computed by the last checks
+type Status struct {
+	Ready     bool      `json:"ready"`
+	CheckedAt time.Time `json:"checked_at,omitzero"`
+	Checks    []Result  `json:"checks"`
+}
+
+// Checker checks in the background that GitHub is reachable and, when a token is configured, that GitHub accepts it
+// and that its remaining rate limit is above the threshold. Probes read the result of the last checks.
+type Checker struct {
+	client handlers.HTTPClient
+	config CheckerConfig
+	log    *zerolog.Logger
+	now    func() time.Time
+
+	mu     sync.RWMutex
+	status Status
+}
+
+// NewChecker creates a Checker, not ready until its first checks
+func NewChecker(client handlers.HTTPClient, config CheckerConfig, log *zerolog.Logger) *Checker {
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultCheckTimeout
+	}
+	return &Checker{
+		client: client,
+		config: config,
+		log:    log,
+		now:    time.Now,
+		status: Status{Checks: []Result{{Name: CheckGitHub, Message: "not checked yet"}}},
+	}
+}
+
+// Status returns the result of the last checks
+func (c *Checker) Status() Status {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.status
+}
+
+// Run checks readiness now and then every interval until the context is done
+func (c *Checker) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultCheckInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		c.Check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check runs the checks and stores their result, logging the readiness changes
+func (c *Checker) Check(ctx context.Context) Status {
+	ctx, cancel := context.WithTimeout(ctx, c.config.Timeout)
+	defer cancel()
+
+	status := Status{Ready: true, CheckedAt: c.now().UTC(), Checks: c.runChecks(ctx)}
+	for _, result := range status.Checks {
+		status.Ready = status.Ready && result.OK
+	}
+
+	c.mu.Lock()
+	previous := c.status
+	c.status = status
+	c.mu.Unlock()
+
+	if status.Ready && !previous.Ready {
+		c.log.Info().Msg("Readiness checks passed")
+	} else if !status.Ready && (previous.Ready || previous.CheckedAt.IsZero()) {
+		c.log.Warn().Interface("checks", status.Checks).Msg("Readiness checks failed")
+	}
+	return status
+}
+
+// rateLimitResponse is the part of the GitHub /rate_limit response used by the checks
+type rateLimitResponse struct {
+	Resources struct {
+		Core struct {
+			Limit     int   `json:"limit"`
+			Remaining int   `json:"remaining"`
+			Reset     int64 `json:"reset"`
+		} `json:"core"`
+	} `json:"resources"`
+}
+
+// runChecks checks GitHub with GET /rate_limit, which does not count against the rate limit:
+// anonymously without token, otherwise with the token, checking its validity and its remaining quota
+func (c *Checker) runChecks(ctx context.Context) []Result {
+	token, err := c.readToken()
+	if err != nil {
+		return []Result{{Name: CheckCredentials, Message: err.Error()}}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, githuburl.Join("rate_limit"), nil)
+	if err != nil {
+		return []Result{{Name: CheckGitHub, Message: err.Error()}}
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return []Result{{Name: CheckGitHub, Message: fmt.Sprintf("GitHub API unreachable: %v", err)}}
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return []Result{{Name: CheckGitHub, Message: fmt.Sprintf("failed to read GitHub API response: %v", err)}}
+	}
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return []Result{{Name: CheckGitHub, Message: fmt.Sprintf("GitHub API returned error %d", resp.StatusCode)}}
+	}
+
+	results := []Result{{Name: CheckGitHub, OK: true}}
+	if token == "" {
+		return results
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return append(results, Result{Name: CheckCredentials, Message: "GitHub rejected the token: invalid, expired or revoked"})
+	}
+	if resp.StatusCode != http.StatusOK {
+		return append(results, Result{Name: CheckCredentials, Message: fmt.Sprintf("GitHub API returned error %d when checking the token", resp.StatusCode)})
+	}
+	results = append(results, Result{Name: CheckCredentials, OK: true})
+
+	if c.config.MinRemaining <= 0 {
+		return results
+	}
+	var rateLimit rateLimitResponse
+	if err := json.Unmarshal(body, &rateLimit); err != nil {
+		return append(results, Result{Name: CheckRateLimit, Message: fmt.Sprintf("failed to parse GitHub rate limit: %v", err)})
+	}
+	core := rateLimit.Resources.Core
+	message := fmt.Sprintf("%d of %d requests remaining, reset at %s", core.Remaining, core.Limit, time.Unix(core.Reset, 0).UTC().Format(time.RFC3339))
+	return append(results, Result{Name: CheckRateLimit, OK: core.Remaining >= c.config.MinRemaining, Message: message})
+}
+
+// readToken reads the token file, if configured: it is read on every check so that rotated tokens are picked up
+func (c *Checker) readToken() (string, error) {
+	if c.config.TokenFile == "" {
+		return "", nil
+	}
+	content, err := os.ReadFile(c.config.TokenFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the token file: %w", err)
+	}
+	token := strings.TrimSpace(string(content))
+	if token == "" {
+		return "", fmt.Errorf("the token file %s is empty", c.config.TokenFile)
+	}
+	return token, nil
+}
@@ -1,12 +1,9 @@
 package health
 
 import (
-	"context"
+	"encoding/json"
 	"net/http"
 	"sync/atomic"
-	"time"
-
-	"github.com/rs/zerolog/log"
 )
 
 // LivenessHandler implements Kubernetes liveness probe
@@ -24,47 +21,41 @@ func LivenessHandler(healthy *int32) http.HandlerFunc {
 }
 
 // ReadinessHandler implements Kubernetes readiness probe
-// Returns 200 if the application is ready to serve traffic
-// For a proxy service like this one, this includes checking connectivity to GitHub API
-func ReadinessHandler(ready *int32, client *http.Client) http.HandlerFunc {
+// Returns 200 if the application is ready to serve traffic: it is serving (not shutting down) and the last checks
+// of the checker passed. Probes do not call GitHub, the checker does in the background.
+// With the `verbose` query parameter, the response is the JSON breakdown of the checks.
+func ReadinessHandler(ready *int32, checker *Checker) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// First check if the service is marked as ready
-		if atomic.LoadInt32(ready) == 0 {
-			w.WriteHeader(http.StatusServiceUnavailable)
-			w.Write([]byte("Service Not Ready"))
-			return
+		status := checker.Status()
+		serving := Result{Name: "serving", OK: atomic.LoadInt32(ready) == 1}
+		if !serving.OK {
+			serving.Message = "server is starting or shutting down"
 		}
+		status.Checks = append([]Result{serving}, status.Checks...)
+		status.Ready = status.Ready && serving.OK
 
-		// For a GitHub API proxy, we verify we can reach GitHub
-		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
-		defer cancel()
-
-		req, err := http.NewRequestWithContext(ctx, "GET", "https://api.github.com", nil)
-		if err != nil {
-			log.Debug().Err(err).Msg("failed to create GitHub API request for readiness check")
-			w.WriteHeader(http.StatusServiceUnavailable)
-			w.Write([]byte("GitHub API Unreachable"))
-			return
+		statusCode := http.StatusOK
+		if !status.Ready {
+			statusCode = http.StatusServiceUnavailable
 		}
 
-		resp, err := client.Do(req)
-		if err != nil {
-			log.Debug().Err(err).Msg("failed to reach GitHub API for readiness check")
-			w.WriteHeader(http.StatusServiceUnavailable)
-			w.Write([]byte("GitHub API Unreachable"))
+		if r.URL.Query().Has("verbose") {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(statusCode)
+			json.NewEncoder(w).Encode(status)
 			return
 		}
-		defer resp.Body.Close()
 
-		// GitHub API should respond with some 2xx or 4xx status (4xx is still fine, means GitHub API is up)
-		if resp.StatusCode >= 200 && resp.StatusCode < 500 {
-			w.WriteHeader(http.StatusOK)
+		w.WriteHeader(statusCode)
+		if status.Ready {
 			w.Write([]byte("Ready"))
 			return
 		}
-
-		log.Debug().Int("status", resp.StatusCode).Msg("GitHub API returned unexpected status for readiness check")
-		w.WriteHeader(http.StatusServiceUnavailable)
-		w.Write([]byte("GitHub API Error"))
+		for _, result := range status.Checks {
+			if !result.OK {
+				w.Write([]byte("Not Ready: " + result.Name + ": " + result.Message))
+				return
+			}
+		}
 	}
 }
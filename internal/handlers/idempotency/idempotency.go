@@ -0,0 +1,232 @@
+package idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/handlers"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/handlers/dryrun"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/utils"
+)
+
+const (
+	// HeaderName is the request header carrying the idempotency key
+	HeaderName = "Idempotency-Key"
+	// ReplayedHeaderName is the response header set on replayed responses
+	ReplayedHeaderName = "Idempotent-Replayed"
+	// maxKeyLength is the maximum length of an idempotency key
+	maxKeyLength = 255
+	// maxEntries is the maximum number of keys kept: beyond it, requests with a new key are rejected until keys expire
+	maxEntries = 10000
+	// sweepInterval is how often the expired keys are dropped
+	sweepInterval = time.Minute
+)
+
+// errFull is returned for new keys when the store holds maxEntries keys
+var errFull = errors.New("too many idempotency keys")
+
+// response is a stored response of a completed request
+type response struct {
+	statusCode  int
+	contentType string
+	body        []byte
+}
+
+type entry struct {
+	fingerprint string
+	response    *response // nil while the request is in progress
+	expires     time.Time
+}
+
+// Store keeps the responses of requests with an idempotency key for a configurable window.
+// Entries are keyed by token hash and idempotency key, so that different tokens cannot replay each other's responses.
+type Store struct {
+	ttl        time.Duration
+	maxEntries int
+	now        func() time.Time
+
+	mu        sync.Mutex
+	entries   map[string]*entry
+	lastSweep time.Time
+}
+
+// NewStore creates a Store keeping responses for the given TTL
+func NewStore(ttl time.Duration) *Store {
+	return &Store{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		now:        time.Now,
+		entries:    make(map[string]*entry),
+	}
+}
+
+// begin looks up the key: it returns the stored entry for repeated keys,
+// otherwise it marks the key as in progress and returns nil (errFull when the store is full)
+func (s *Store) begin(key, fingerprint string) (*entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	existing, exists := s.entries[key]
+	if exists && now.Before(existing.expires) {
+		return existing, nil
+	}
+	if !exists && len(s.entries) >= s.maxEntries {
+		s.lastSweep = time.Time{}
+		s.sweep(now)
+		if len(s.entries) >= s.maxEntries {
+			return nil, errFull
+		}
+	}
+
+	s.entries[key] = &entry{fingerprint: fingerprint, expires: now.Add(s.ttl)}
+	return nil, nil
+}
+
+// sweep drops the expired keys, every sweepInterval. It must be called with the lock held.
+func (s *Store) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+
+	for key, e := range s.entries {
+		if !now.Before(e.expires) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+// complete stores the response of an in progress key
+func (s *Store) complete(key string, resp *response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, exists := s.entries[key]; exists {
+		e.response = resp
+	}
+}
+
+// abort removes an in progress key, so that the request can be retried
+func (s *Store) abort(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+}
+
+// Handler wraps a mutating handler to replay the response of requests with an already seen Idempotency-Key.
+// A key reused with a different request (method, path or body) is rejected with 422,
+// a key whose request is still in progress with 409, and a new key with 503 when the store is full.
+// Only successful responses and client errors that a retry would get again are stored: server errors (5xx),
+// timeouts and rate limits (429, and GitHub rate limit 403s) are not, so that the request can be retried.
+// Dry-run requests are not stored at all.
+func Handler(store *Store, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		idempotencyKey := r.Header.Get(HeaderName)
+		if idempotencyKey == "" || store == nil || store.ttl <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if dryRun, err := dryrun.Enabled(r); err != nil || dryRun {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(idempotencyKey) > maxKeyLength {
+			handlers.WriteError(w, r, http.StatusBadRequest, fmt.Sprintf("Invalid %s: longer than %d characters", HeaderName, maxKeyLength))
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			handlers.WriteError(w, r, http.StatusBadRequest, fmt.Sprintf("Error reading request body: %v", err))
+			return
+		}
+		r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		key := utils.HashToken(r.Header.Get("Authorization")) + "/" + idempotencyKey
+		fingerprint := requestFingerprint(r, body)
+
+		existing, err := store.begin(key, fingerprint)
+		if err != nil {
+			w.Header().Set("Retry-After", strconv.Itoa(int(sweepInterval.Seconds())))
+			handlers.WriteError(w, r, http.StatusServiceUnavailable, fmt.Sprintf("Cannot store %s %s: %v, retry later", HeaderName, idempotencyKey, err))
+			return
+		}
+		if existing != nil {
+			switch {
+			case existing.fingerprint != fingerprint:
+				handlers.WriteError(w, r, http.StatusUnprocessableEntity, fmt.Sprintf("%s %s has already been used for a different request", HeaderName, idempotencyKey))
+			case existing.response == nil:
+				handlers.WriteError(w, r, http.StatusConflict, fmt.Sprintf("A request with %s %s is still in progress", HeaderName, idempotencyKey))
+			default:
+				if existing.response.contentType != "" {
+					w.Header().Set("Content-Type", existing.response.contentType)
+				}
+				w.Header().Set(ReplayedHeaderName, "true")
+				w.WriteHeader(existing.response.statusCode)
+				w.Write(existing.response.body)
+			}
+			return
+		}
+
+		// The key is released when next panics, as for server errors, so that the request can be retried:
+		// the panic goes on once the deferred call returns
+		stored := false
+		defer func() {
+			if !stored {
+				store.abort(key)
+			}
+		}()
+
+		recorder := handlers.NewResponseRecorder(w, true)
+		next.ServeHTTP(recorder, r)
+
+		if !storable(recorder.StatusCode(), recorder.Body()) {
+			return
+		}
+		stored = true
+		store.complete(key, &response{
+			statusCode:  recorder.StatusCode(),
+			contentType: w.Header().Get("Content-Type"),
+			body:        recorder.Body(),
+		})
+	})
+}
+
+// storable reports whether a response would be the same when the request is retried:
+// successful responses and client errors other than timeouts and rate limits
+func storable(statusCode int, body []byte) bool {
+	switch {
+	case statusCode >= 200 && statusCode < 300:
+		return true
+	case statusCode == http.StatusRequestTimeout, statusCode == http.StatusTooEarly, statusCode == http.StatusTooManyRequests:
+		return false
+	case statusCode == http.StatusForbidden:
+		// GitHub reports primary and secondary rate limits with 403 as well
+		var e handlers.ErrorResponse
+		return json.Unmarshal(body, &e) != nil || !strings.Contains(strings.ToLower(e.UpstreamMessage), "rate limit")
+	}
+	return statusCode >= 400 && statusCode < 500
+}
+
+// requestFingerprint identifies a request by method, URL and body
+func requestFingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(r.Method + " " + r.URL.RequestURI() + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
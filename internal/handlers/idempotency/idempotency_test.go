@@ -0,0 +1,285 @@
+package idempotency
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// countingHandler answers with the configured status and counts the calls
+type countingHandler struct {
+	statusCode int
+	calls      int
+	started    chan struct{}
+	block      chan struct{}
+}
+
+func (h *countingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.calls++
+	if h.block != nil {
+		close(h.started)
+		<-h.block
+	}
+	body, _ := io.ReadAll(r.Body)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(h.statusCode)
+	w.Write([]byte(fmt.Sprintf(`{"message": "call %d", "body": %q}`, h.calls, body)))
+}
+
+func newRequest(method, target, key, token, body string) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Authorization", token)
+	if key != "" {
+		req.Header.Set(HeaderName, key)
+	}
+	return req
+}
+
+func serve(handler http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestHandler_Replay(t *testing.T) {
+	next := &countingHandler{statusCode: http.StatusAccepted}
+	handler := Handler(NewStore(time.Hour), next)
+
+	first := serve(handler, newRequest("POST", "/repository/o/r/collaborators/u", "key-1", "token a", `{"permission": "push"}`))
+	second := serve(handler, newRequest("POST", "/repository/o/r/collaborators/u", "key-1", "token a", `{"permission": "push"}`))
+
+	if next.calls != 1 {
+		t.Fatalf("expected the handler to be called once, got %d", next.calls)
+	}
+	if second.Code != http.StatusAccepted || second.Body.String() != first.Body.String() {
+		t.Errorf("unexpected replayed response %d %s, want %d %s", second.Code, second.Body.String(), first.Code, first.Body.String())
+	}
+	if second.Header().Get(ReplayedHeaderName) != "true" || first.Header().Get(ReplayedHeaderName) != "" {
+		t.Errorf("expected only the replayed response to have the %s header", ReplayedHeaderName)
+	}
+	if second.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("expected the content type to be replayed, got %s", second.Header().Get("Content-Type"))
+	}
+}
+
+func TestHandler_Keys(t *testing.T) {
+	tests := []struct {
+		name           string
+		second         *http.Request
+		expectedStatus int
+		expectedCalls  int
+	}{
+		{
+			name:           "different body is rejected",
+			second:         newRequest("POST", "/repository/o/r/collaborators/u", "key-1", "token a", `{"permission": "admin"}`),
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedCalls:  1,
+		},
+		{
+			name:           "different path is rejected",
+			second:         newRequest("POST", "/repository/o/r/collaborators/other", "key-1", "token a", `{"permission": "push"}`),
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedCalls:  1,
+		},
+		{
+			name:           "different token has its own keys",
+			second:         newRequest("POST", "/repository/o/r/collaborators/u", "key-1", "token b", `{"permission": "push"}`),
+			expectedStatus: http.StatusAccepted,
+			expectedCalls:  2,
+		},
+		{
+			name:           "different key is served",
+			second:         newRequest("POST", "/repository/o/r/collaborators/u", "key-2", "token a", `{"permission": "push"}`),
+			expectedStatus: http.StatusAccepted,
+			expectedCalls:  2,
+		},
+		{
+			name:           "request without key is served",
+			second:         newRequest("POST", "/repository/o/r/collaborators/u", "", "token a", `{"permission": "push"}`),
+			expectedStatus: http.StatusAccepted,
+			expectedCalls:  2,
+		},
+		{
+			name:           "dry-run request is not replayed",
+			second:         newRequest("POST", "/repository/o/r/collaborators/u?dry_run=true", "key-1", "token a", `{"permission": "push"}`),
+			expectedStatus: http.StatusAccepted,
+			expectedCalls:  2,
+		},
+		{
+			name:           "too long key",
+			second:         newRequest("POST", "/repository/o/r/collaborators/u", strings.Repeat("k", 256), "token a", `{"permission": "push"}`),
+			expectedStatus: http.StatusBadRequest,
+			expectedCalls:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := &countingHandler{statusCode: http.StatusAccepted}
+			handler := Handler(NewStore(time.Hour), next)
+
+			serve(handler, newRequest("POST", "/repository/o/r/collaborators/u", "key-1", "token a", `{"permission": "push"}`))
+			rr := serve(handler, tt.second)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tt.expectedStatus)
+			}
+			if next.calls != tt.expectedCalls {
+				t.Errorf("expected %d calls, got %d", tt.expectedCalls, next.calls)
+			}
+		})
+	}
+}
+
+func TestHandler_ServerErrorsAreNotStored(t *testing.T) {
+	next := &countingHandler{statusCode: http.StatusInternalServerError}
+	handler := Handler(NewStore(time.Hour), next)
+
+	serve(handler, newRequest("DELETE", "/team/orgs/o/teams/t", "key-1", "token a", ""))
+	serve(handler, newRequest("DELETE", "/team/orgs/o/teams/t", "key-1", "token a", ""))
+
+	if next.calls != 2 {
+		t.Errorf("expected server errors to be retried, got %d calls", next.calls)
+	}
+}
+
+func TestHandler_RetryableErrorsAreNotStored(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		body       string
+		stored     bool
+	}{
+		{name: "too many requests", statusCode: http.StatusTooManyRequests, body: `{"code": "rate_limited", "message": "Too many requests"}`},
+		{name: "GitHub rate limit", statusCode: http.StatusForbidden, body: `{"code": "forbidden", "upstream_status": 403, "upstream_message": "API rate limit exceeded for user ID 1."}`},
+		{name: "GitHub secondary rate limit", statusCode: http.StatusForbidden, body: `{"code": "forbidden", "upstream_status": 403, "upstream_message": "You have exceeded a secondary rate limit."}`},
+		{name: "request timeout", statusCode: http.StatusRequestTimeout},
+		{name: "forbidden", statusCode: http.StatusForbidden, body: `{"code": "forbidden", "upstream_status": 403, "upstream_message": "Must have admin rights to Repository."}`, stored: true},
+		{name: "unprocessable entity", statusCode: http.StatusUnprocessableEntity, body: `{"code": "unprocessable_entity"}`, stored: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			handler := Handler(NewStore(time.Hour), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.statusCode)
+				w.Write([]byte(tt.body))
+			}))
+
+			serve(handler, newRequest("DELETE", "/team/orgs/o/teams/t", "key-1", "token a", ""))
+			rr := serve(handler, newRequest("DELETE", "/team/orgs/o/teams/t", "key-1", "token a", ""))
+
+			replayed := rr.Header().Get(ReplayedHeaderName) == "true"
+			if replayed != tt.stored || (calls == 1) != tt.stored {
+				t.Errorf("expected stored %v, got replayed %v after %d calls", tt.stored, replayed, calls)
+			}
+		})
+	}
+}
+
+func TestHandler_PanicsAreNotStored(t *testing.T) {
+	next := &countingHandler{statusCode: http.StatusOK}
+	panicking := true
+	handler := Handler(NewStore(time.Hour), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if panicking {
+			panic(http.ErrAbortHandler)
+		}
+		next.ServeHTTP(w, r)
+	}))
+
+	func() {
+		defer func() {
+			if recovered := recover(); recovered != http.ErrAbortHandler {
+				t.Errorf("expected the panic to go on, got %v", recovered)
+			}
+		}()
+		serve(handler, newRequest("POST", "/team/orgs/o/teams", "key-1", "token a", `{"name": "t"}`))
+	}()
+
+	// The retry is served, not rejected as in progress
+	panicking = false
+	rr := serve(handler, newRequest("POST", "/team/orgs/o/teams", "key-1", "token a", `{"name": "t"}`))
+	if rr.Code != http.StatusOK || next.calls != 1 || rr.Header().Get(ReplayedHeaderName) != "" {
+		t.Errorf("expected the retry after a panic to be served, got %d after %d calls", rr.Code, next.calls)
+	}
+}
+
+func TestHandler_InProgress(t *testing.T) {
+	next := &countingHandler{statusCode: http.StatusOK, started: make(chan struct{}), block: make(chan struct{})}
+	handler := Handler(NewStore(time.Hour), next)
+
+	done := make(chan struct{})
+	go func() {
+		serve(handler, newRequest("PATCH", "/team/orgs/o/teams/t", "key-1", "token a", `{}`))
+		close(done)
+	}()
+	<-next.started
+
+	rr := serve(handler, newRequest("PATCH", "/team/orgs/o/teams/t", "key-1", "token a", `{}`))
+	close(next.block)
+	<-done
+
+	if rr.Code != http.StatusConflict {
+		t.Errorf("expected 409 for a request in progress, got %d", rr.Code)
+	}
+
+	rr = serve(handler, newRequest("PATCH", "/team/orgs/o/teams/t", "key-1", "token a", `{}`))
+	if rr.Code != http.StatusOK || rr.Header().Get(ReplayedHeaderName) != "true" {
+		t.Errorf("expected the completed response to be replayed, got %d", rr.Code)
+	}
+}
+
+func TestStore_Expiration(t *testing.T) {
+	store := NewStore(time.Minute)
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	next := &countingHandler{statusCode: http.StatusOK}
+	handler := Handler(store, next)
+
+	serve(handler, newRequest("PATCH", "/team/orgs/o/teams/t", "key-1", "token a", `{}`))
+	now = now.Add(2 * time.Minute)
+	serve(handler, newRequest("PATCH", "/team/orgs/o/teams/t", "key-1", "token a", `{}`))
+
+	if next.calls != 2 {
+		t.Errorf("expected expired keys to be served again, got %d calls", next.calls)
+	}
+	if len(store.entries) != 1 {
+		t.Errorf("expected expired entries to be removed, got %d entries", len(store.entries))
+	}
+}
+
+func TestStore_Full(t *testing.T) {
+	store := NewStore(time.Minute)
+	store.maxEntries = 2
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	next := &countingHandler{statusCode: http.StatusOK}
+	handler := Handler(store, next)
+
+	serve(handler, newRequest("PATCH", "/team/orgs/o/teams/t", "key-1", "token a", `{}`))
+	serve(handler, newRequest("PATCH", "/team/orgs/o/teams/t", "key-2", "token a", `{}`))
+
+	rr := serve(handler, newRequest("PATCH", "/team/orgs/o/teams/t", "key-3", "token a", `{}`))
+	if rr.Code != http.StatusServiceUnavailable || rr.Header().Get("Retry-After") == "" {
+		t.Errorf("expected 503 with Retry-After for a new key in a full store, got %d", rr.Code)
+	}
+	rr = serve(handler, newRequest("PATCH", "/team/orgs/o/teams/t", "key-1", "token a", `{}`))
+	if rr.Code != http.StatusOK || rr.Header().Get(ReplayedHeaderName) != "true" {
+		t.Errorf("expected stored keys to be replayed in a full store, got %d", rr.Code)
+	}
+
+	// Expired keys make room for new ones
+	now = now.Add(2 * time.Minute)
+	rr = serve(handler, newRequest("PATCH", "/team/orgs/o/teams/t", "key-3", "token a", `{}`))
+	if rr.Code != http.StatusOK || next.calls != 3 {
+		t.Errorf("expected the new key to be served once the others expired, got %d after %d calls", rr.Code, next.calls)
+	}
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/redact"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/requeststats"
+	"github.com/rs/zerolog"
+)
+
+// loggerKey is the context key of the logger of a request
+type loggerKey struct{}
+
+// logFields are the path parameters added to the logger of a request
+var logFields = []string{"owner", "repo", "username", "org", "team_slug"}
+
+// statsHook adds the upstream calls made so far to every event of the request logger
+type statsHook struct {
+	stats *requeststats.Stats
+}
+
+// Run implements the zerolog.Hook interface
+func (h statsHook) Run(e *zerolog.Event, level zerolog.Level, message string) {
+	calls, duration := h.stats.Calls()
+	e.Int("upstream_calls", calls).Dur("upstream_duration", duration)
+}
+
+// loggerFromContext returns the logger of the request of ctx, nil outside of a request served with RequestLogger
+func loggerFromContext(ctx context.Context) *zerolog.Logger {
+	logger, _ := ctx.Value(loggerKey{}).(*zerolog.Logger)
+	return logger
+}
+
+// RequestLogger serves the requests of a route with a logger carrying the request-scoped fields: the request ID,
+// the method, the route pattern, the path parameters and the number and duration of the GitHub API calls made so far.
+// Handlers get it with HandlerOptions.Logger.
+func RequestLogger(opts HandlerOptions, pattern string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Built from the base logger, so that nested requests (e.g. audit reads) do not repeat the fields
+		base := opts.Log
+		if base == nil {
+			base = &nopLogger
+		}
+		fields := base.With().
+			Str("method", r.Method).
+			Str("route", pattern)
+		if requestID := r.Header.Get(RequestIDHeader); requestID != "" {
+			fields = fields.Str("request_id", requestID)
+		}
+		for _, name := range logFields {
+			if value := r.PathValue(name); value != "" {
+				fields = fields.Str(name, value)
+			}
+		}
+
+		// The stats are shared with the outer middlewares that created them, e.g. the access log
+		ctx, stats := r.Context(), requeststats.FromContext(r.Context())
+		if stats == nil {
+			ctx, stats = requeststats.NewContext(ctx)
+		}
+		logger := fields.Logger().Hook(statsHook{stats: stats})
+		next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, loggerKey{}, &logger)))
+	})
+}
+
+// LogStatus returns an event of logger with the level of a response status: errors for 5xx, debug messages otherwise
+func LogStatus(logger *zerolog.Logger, statusCode int) *zerolog.Event {
+	event := logger.Debug()
+	if statusCode >= http.StatusInternalServerError {
+		event = logger.Error()
+	}
+	return event.Int("status", statusCode)
+}
+
+// instrumentedClient traces the GitHub API calls of the requests served with RequestID and RequestLogger
+type instrumentedClient struct {
+	client HTTPClient
+}
+
+// InstrumentClient returns a client tracing its calls in the request they are made for:
+// the ID of the request is sent as X-Request-Id, and each call is added to the upstream stats of the request
+// and logged with the X-GitHub-Request-Id of its response
+func InstrumentClient(client HTTPClient) HTTPClient {
+	return &instrumentedClient{client: client}
+}
+
+// Do implements the HTTPClient interface
+func (c *instrumentedClient) Do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	if requestID := RequestIDFromContext(ctx); requestID != "" && req.Header.Get(RequestIDHeader) == "" {
+		req = req.Clone(ctx)
+		req.Header.Set(RequestIDHeader, requestID)
+	}
+	stats := requeststats.FromContext(ctx)
+	if stats == nil {
+		return c.client.Do(req)
+	}
+
+	start := time.Now()
+	resp, err := c.client.Do(req)
+	duration := time.Since(start)
+
+	var githubRequestID string
+	if err == nil {
+		githubRequestID = resp.Header.Get(GitHubRequestIDHeader)
+	}
+	stats.AddCall(duration, githubRequestID)
+
+	if logger := loggerFromContext(ctx); logger != nil {
+		event := logger.Debug().Str("upstream_method", req.Method).Str("upstream_url", redact.String(req.URL.String())).Dur("duration", duration)
+		if err != nil {
+			event = event.Err(err)
+		} else {
+			event = event.Int("upstream_status", resp.StatusCode)
+		}
+		if githubRequestID != "" {
+			event = event.Str("github_request_id", githubRequestID)
+		}
+		event.Msg("GitHub API call")
+	}
+	return resp, err
+}
+
+// LogRequestBody logs the body of the requests served by next, redacted: secret-like fields and tokens are never logged
+func LogRequestBody(opts HandlerOptions, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			WriteError(w, r, http.StatusBadRequest, "Error reading request body: "+redact.String(err.Error()))
+			return
+		}
+		r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		if len(bytes.TrimSpace(body)) > 0 {
+			event := opts.Logger(r.Context()).Debug()
+			// Bodies that are not JSON are logged as strings, so that the log line stays valid JSON
+			if json.Valid(body) {
+				event = event.RawJSON("body", redact.JSON(body))
+			} else {
+				event = event.Str("body", redact.String(string(body)))
+			}
+			event.Msg("Request body")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
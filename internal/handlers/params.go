@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/githuburl"
+)
+
+// pathParams are the path parameters put into GitHub API URLs, with the naming rules they must follow
+var pathParams = []struct {
+	name string
+	kind githuburl.Kind
+}{
+	{name: "owner", kind: githuburl.Login},
+	{name: "repo", kind: githuburl.Repository},
+	{name: "username", kind: githuburl.Login},
+	{name: "org", kind: githuburl.Login},
+	{name: "team_slug", kind: githuburl.TeamSlug},
+}
+
+// ValidatePathParams rejects with 400 the requests whose path parameters are not valid GitHub names,
+// before any GitHub API call is made. Parameters not defined by the route are not checked.
+func ValidatePathParams(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, param := range pathParams {
+			value := r.PathValue(param.name)
+			if value == "" {
+				continue
+			}
+			if err := githuburl.Validate(param.kind, value); err != nil {
+				WriteError(w, r, http.StatusBadRequest, "Invalid path parameter "+param.name+": "+err.Error())
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestValidatePathParams(t *testing.T) {
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "valid", path: "/repository/octocat/hello-world/collaborators/mona", expectedStatus: http.StatusOK},
+		{name: "escaped slash", path: "/repository/octocat/..%2F..%2Forgs/collaborators/mona", expectedStatus: http.StatusBadRequest, expectedBody: "Invalid path parameter repo"},
+		{name: "escaped query", path: "/repository/octocat/hello-world/collaborators/mona%3Fper_page=1", expectedStatus: http.StatusBadRequest, expectedBody: "Invalid path parameter username"},
+		{name: "dot segment", path: "/repository/octocat/%2E%2E/collaborators/mona", expectedStatus: http.StatusBadRequest, expectedBody: "Invalid path parameter repo"},
+		{name: "invalid owner", path: "/repository/-octocat/hello-world/collaborators/mona", expectedStatus: http.StatusBadRequest, expectedBody: "Invalid path parameter owner"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			mux := http.NewServeMux()
+			mux.Handle("GET /repository/{owner}/{repo}/collaborators/{username}", ValidatePathParams(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+			})))
+
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, httptest.NewRequest("GET", tt.path, nil))
+
+			if rr.Code != tt.expectedStatus || !strings.Contains(rr.Body.String(), tt.expectedBody) {
+				t.Errorf("expected %d with %q, got %d: %s", tt.expectedStatus, tt.expectedBody, rr.Code, rr.Body.String())
+			}
+			if called != (tt.expectedStatus == http.StatusOK) {
+				t.Errorf("expected the handler to be called: %v", tt.expectedStatus == http.StatusOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/githuburl"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/policy"
+)
+
+// WritePolicyViolation writes the 403 Forbidden response of a request rejected by the policy, with the rule that fired
+func WritePolicyViolation(w http.ResponseWriter, r *http.Request, v *policy.Violation) {
+	WriteErrorResponse(w, r, http.StatusForbidden, ErrorResponse{
+		Code:       CodePolicyViolation,
+		Message:    "Forbidden by policy: " + v.Message,
+		PolicyRule: v.Rule,
+	})
+}
+
+// RestrictTargets rejects with 403 the requests whose organization or repository is not allowed by the policy for the route.
+// It is meant for read-only routes, mutating routes use EnforcePolicy.
+func RestrictTargets(opts HandlerOptions, route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if v := opts.Policy.Policy().CheckTargets(route, policyTargets(r)); v != nil {
+			WritePolicyViolation(w, r, v)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// EnforcePolicy rejects with 403 the mutating requests not allowed by the policy for the route:
+// requests on organizations or repositories that are not allowed, grants of permissions above the caps
+// and removals of protected users. Requests are checked before any change is sent to GitHub, dry-run ones included.
+func EnforcePolicy(opts HandlerOptions, route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := opts.Policy.Policy()
+		if p == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		hasBody := r.Method == http.MethodPost || r.Method == http.MethodPatch || r.Method == http.MethodPut
+		var body []byte
+		if hasBody {
+			var err error
+			body, err = io.ReadAll(r.Body)
+			if err != nil {
+				WriteError(w, r, http.StatusBadRequest, fmt.Sprintf("Error reading request body: %v", err))
+				return
+			}
+			r.Body.Close()
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		targets := append(policyTargets(r), policyBodyTargets(r, route, body)...)
+		if v := p.CheckTargets(route, targets); v != nil {
+			WritePolicyViolation(w, r, v)
+			return
+		}
+
+		if username := r.PathValue("username"); r.Method == http.MethodDelete && username != "" {
+			if v := p.CheckRemoval(targets, username); v != nil {
+				WritePolicyViolation(w, r, v)
+				return
+			}
+		}
+
+		if hasBody {
+			for _, grant := range policyGrants(opts, r, route, body) {
+				v, err := p.CheckGrant(route, targets, grant)
+				if err != nil {
+					WriteError(w, r, StatusForError(err), fmt.Sprintf("Error checking policy: %v", err))
+					return
+				}
+				if v != nil {
+					WritePolicyViolation(w, r, v)
+					return
+				}
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// policyTargets returns the organization and the repository of a request, from its path parameters
+func policyTargets(r *http.Request) []string {
+	var targets []string
+	if org := r.PathValue("org"); org != "" {
+		targets = append(targets, org)
+	}
+	if owner, repo := r.PathValue("owner"), r.PathValue("repo"); owner != "" && repo != "" {
+		targets = append(targets, owner+"/"+repo)
+	}
+	return targets
+}
+
+// policyBodyTargets returns the repositories a request body grants access to: the `repo_names` of teams.
+// Names without an owner belong to the organization of the team.
+func policyBodyTargets(r *http.Request, route string, body []byte) []string {
+	if route != policy.RouteTeam || len(body) == 0 {
+		return nil
+	}
+	var request struct {
+		RepoNames []string `json:"repo_names"`
+	}
+	if json.Unmarshal(body, &request) != nil {
+		return nil
+	}
+	targets := make([]string, 0, len(request.RepoNames))
+	for _, name := range request.RepoNames {
+		if !strings.Contains(name, "/") {
+			name = r.PathValue("org") + "/" + name
+		}
+		targets = append(targets, name)
+	}
+	return targets
+}
+
+// policyGrants returns the permissions granted by a request body.
+// Malformed bodies have no grants: they are rejected by the handlers.
+func policyGrants(opts HandlerOptions, r *http.Request, route string, body []byte) []policy.Grant {
+	owner := r.PathValue("owner")
+	authHeader := r.Header.Get("Authorization")
+
+	switch route {
+	case policy.RouteCollaborator:
+		var request struct {
+			Permission string `json:"permission"`
+		}
+		if len(body) > 0 && json.Unmarshal(body, &request) != nil {
+			return nil
+		}
+		return []policy.Grant{newGrant(opts, r.Context(), owner, r.PathValue("username"), authHeader, request.Permission)}
+	case policy.RouteCollaborators:
+		var request struct {
+			Collaborators []struct {
+				Username   string `json:"username"`
+				Permission string `json:"permission"`
+			} `json:"collaborators"`
+		}
+		if json.Unmarshal(body, &request) != nil {
+			return nil
+		}
+		grants := make([]policy.Grant, 0, len(request.Collaborators))
+		for _, collaborator := range request.Collaborators {
+			grants = append(grants, newGrant(opts, r.Context(), owner, collaborator.Username, authHeader, collaborator.Permission))
+		}
+		return grants
+	case policy.RouteTeamRepository:
+		var request struct {
+			Permission string `json:"permission"`
+		}
+		if len(body) > 0 && json.Unmarshal(body, &request) != nil {
+			return nil
+		}
+		grant := newGrant(opts, r.Context(), owner, "", authHeader, request.Permission)
+		grant.Outside = nil // Teams are not outside collaborators
+		return []policy.Grant{grant}
+	case policy.RouteTeam:
+		var request struct {
+			Permission string   `json:"permission"`
+			RepoNames  []string `json:"repo_names"`
+		}
+		if len(body) == 0 || json.Unmarshal(body, &request) != nil || len(request.RepoNames) == 0 {
+			return nil
+		}
+		// GitHub adds the repo_names with `pull` when no permission is given
+		if request.Permission == "" {
+			request.Permission = "pull"
+		}
+		grant := newGrant(opts, r.Context(), r.PathValue("org"), "", authHeader, request.Permission)
+		grant.Outside = nil
+		return []policy.Grant{grant}
+	}
+	return nil
+}
+
+// newGrant builds the grant of a permission to a user of a repository of owner.
+// GitHub grants `push` when no permission is given.
+func newGrant(opts HandlerOptions, ctx context.Context, owner, username, authHeader, permission string) policy.Grant {
+	if permission == "" {
+		permission = "push"
+	}
+	return policy.Grant{
+		Permission: permission,
+		BaseRole: func() (string, error) {
+			if opts.Roles == nil {
+				return "", nil
+			}
+			customRoles, err := opts.Roles.CustomRoles(ctx, owner, authHeader)
+			if err != nil {
+				return "", err
+			}
+			for _, customRole := range customRoles {
+				if strings.EqualFold(customRole.Name, permission) {
+					return customRole.BaseRole, nil
+				}
+			}
+			return "", nil
+		},
+		Outside: func() (bool, error) {
+			return isOutsideCollaborator(ctx, opts.Client, owner, username, authHeader)
+		},
+	}
+}
+
+// isOutsideCollaborator reports whether a user is not a member of the organization owning a repository.
+// Users are outside collaborators of the repositories owned by personal accounts as well.
+func isOutsideCollaborator(ctx context.Context, client HTTPClient, owner, username, authHeader string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, githuburl.Join("orgs", owner, "members", username), nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %w", err)
+	}
+	if authHeader != "" {
+		req.Header.Set("Authorization", authHeader)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to check the membership of %s in %s: %w", username, owner, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	switch resp.StatusCode {
+	case http.StatusNoContent:
+		return false, nil
+	case http.StatusNotFound:
+		return true, nil
+	default:
+		return false, fmt.Errorf("unexpected status code checking the membership of %s in %s: %d", username, owner, resp.StatusCode)
+	}
+}
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/policy"
+	"github.com/rs/zerolog"
+)
+
+const testPolicy = `
+allow:
+  - name: krateo
+    targets: ["krateo*"]
+deny:
+  - name: no-infra
+    targets: ["krateoplatformops/infra"]
+permissions:
+  - name: no-admin
+    max: maintain
+  - name: outside-read-only
+    outside_collaborators: true
+    max: pull
+protected_users:
+  - name: break-glass
+    users: ["krateo-admin"]
+`
+
+// membershipClient answers the organization membership checks, members get 204 and other users 404
+type membershipClient struct {
+	members  map[string]bool
+	requests []string
+}
+
+func (c *membershipClient) Do(req *http.Request) (*http.Response, error) {
+	c.requests = append(c.requests, req.Method+" "+req.URL.String())
+	status := http.StatusNotFound
+	if c.members[req.URL.Path] {
+		status = http.StatusNoContent
+	}
+	return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader(""))}, nil
+}
+
+func newTestPolicyStore(t *testing.T) *policy.Store {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(filename, []byte(testPolicy), 0o600); err != nil {
+		t.Fatalf("failed to write policy: %v", err)
+	}
+	logger := zerolog.New(io.Discard)
+	store, err := policy.NewStore(filename, &logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return store
+}
+
+func TestEnforcePolicy(t *testing.T) {
+	tests := []struct {
+		name             string
+		method           string
+		path             string
+		body             string
+		expectedStatus   int
+		expectedRule     string
+		expectedRequests int
+	}{
+		{name: "allowed grant to member", method: "POST", path: "/repository/krateoplatformops/website/collaborators/member", body: `{"permission": "maintain"}`, expectedStatus: http.StatusOK, expectedRequests: 1},
+		{name: "admin to member", method: "POST", path: "/repository/krateoplatformops/website/collaborators/member", body: `{"permission": "admin"}`, expectedStatus: http.StatusForbidden, expectedRule: "no-admin"},
+		{name: "write to outside collaborator", method: "PATCH", path: "/repository/krateoplatformops/website/collaborators/mona", body: `{"permission": "write"}`, expectedStatus: http.StatusForbidden, expectedRule: "outside-read-only", expectedRequests: 1},
+		{name: "default permission to outside collaborator", method: "POST", path: "/repository/krateoplatformops/website/collaborators/mona", expectedStatus: http.StatusForbidden, expectedRule: "outside-read-only", expectedRequests: 1},
+		{name: "read to outside collaborator", method: "POST", path: "/repository/krateoplatformops/website/collaborators/mona", body: `{"permission": "read"}`, expectedStatus: http.StatusOK, expectedRequests: 1},
+		{name: "org not allowed", method: "POST", path: "/repository/octocat/hello-world/collaborators/member", body: `{"permission": "read"}`, expectedStatus: http.StatusForbidden, expectedRule: "allow"},
+		{name: "denied repository", method: "DELETE", path: "/repository/krateoplatformops/infra/collaborators/member", expectedStatus: http.StatusForbidden, expectedRule: "no-infra"},
+		{name: "protected user", method: "DELETE", path: "/repository/krateoplatformops/website/collaborators/Krateo-Admin", expectedStatus: http.StatusForbidden, expectedRule: "break-glass"},
+		{name: "removal", method: "DELETE", path: "/repository/krateoplatformops/website/collaborators/mona", expectedStatus: http.StatusOK},
+		{name: "malformed body left to the handler", method: "POST", path: "/repository/krateoplatformops/website/collaborators/mona", body: `{`, expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &membershipClient{members: map[string]bool{"/orgs/krateoplatformops/members/member": true}}
+			opts := HandlerOptions{Client: client, Policy: newTestPolicyStore(t)}
+
+			var received string
+			mux := http.NewServeMux()
+			mux.Handle("/repository/{owner}/{repo}/collaborators/{username}", EnforcePolicy(opts, policy.RouteCollaborator, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				received = string(body)
+			})))
+
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tt.expectedRule != "" {
+				if !strings.Contains(rr.Body.String(), `"code":"policy_violation"`) || !strings.Contains(rr.Body.String(), `"policy_rule":"`+tt.expectedRule+`"`) {
+					t.Errorf("expected violation of rule %s, got %s", tt.expectedRule, rr.Body.String())
+				}
+			} else if received != tt.body {
+				t.Errorf("expected the handler to receive the body %q, got %q", tt.body, received)
+			}
+			if len(client.requests) != tt.expectedRequests {
+				t.Errorf("expected %d membership checks, got %v", tt.expectedRequests, client.requests)
+			}
+		})
+	}
+}
+
+func TestEnforcePolicy_Bulk(t *testing.T) {
+	client := &membershipClient{members: map[string]bool{"/orgs/krateoplatformops/members/member": true}}
+	opts := HandlerOptions{Client: client, Policy: newTestPolicyStore(t)}
+
+	mux := http.NewServeMux()
+	mux.Handle("PUT /repository/{owner}/{repo}/collaborators", EnforcePolicy(opts, policy.RouteCollaborators, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	body := `{"collaborators": [{"username": "member", "permission": "maintain"}, {"username": "mona", "permission": "triage"}]}`
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("PUT", "/repository/krateoplatformops/website/collaborators", strings.NewReader(body)))
+
+	if rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), `"policy_rule":"outside-read-only"`) || !strings.Contains(rr.Body.String(), "triage") {
+		t.Errorf("expected violation of rule outside-read-only for triage, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestEnforcePolicy_TeamRepository(t *testing.T) {
+	client := &membershipClient{}
+	opts := HandlerOptions{Client: client, Policy: newTestPolicyStore(t)}
+
+	mux := http.NewServeMux()
+	mux.Handle("/teamrepository/orgs/{org}/teams/{team_slug}/repos/{owner}/{repo}", EnforcePolicy(opts, policy.RouteTeamRepository, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	tests := []struct {
+		name           string
+		path           string
+		body           string
+		expectedStatus int
+	}{
+		{name: "write to team", path: "/teamrepository/orgs/krateoplatformops/teams/devs/repos/krateoplatformops/website", body: `{"permission": "push"}`, expectedStatus: http.StatusOK},
+		{name: "admin to team", path: "/teamrepository/orgs/krateoplatformops/teams/devs/repos/krateoplatformops/website", body: `{"permission": "admin"}`, expectedStatus: http.StatusForbidden},
+		{name: "repository not allowed", path: "/teamrepository/orgs/krateoplatformops/teams/devs/repos/octocat/hello-world", body: `{"permission": "pull"}`, expectedStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, httptest.NewRequest("PUT", tt.path, strings.NewReader(tt.body)))
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+		})
+	}
+	if len(client.requests) != 0 {
+		t.Errorf("expected no membership checks for teams, got %v", client.requests)
+	}
+}
+
+func TestEnforcePolicy_TeamRepoNames(t *testing.T) {
+	client := &membershipClient{}
+	opts := HandlerOptions{Client: client, Policy: newTestPolicyStore(t)}
+
+	mux := http.NewServeMux()
+	mux.Handle("/team/orgs/{org}/teams", EnforcePolicy(opts, policy.RouteTeam, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	mux.Handle("/team/orgs/{org}/teams/{team_slug}", EnforcePolicy(opts, policy.RouteTeam, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		expectedStatus int
+		expectedRule   string
+	}{
+		{name: "allowed repositories", method: "POST", path: "/team/orgs/krateoplatformops/teams", body: `{"name": "devs", "repo_names": ["website", "krateoplatformops/docs"]}`, expectedStatus: http.StatusOK},
+		{name: "no repositories", method: "POST", path: "/team/orgs/krateoplatformops/teams", body: `{"name": "devs"}`, expectedStatus: http.StatusOK},
+		{name: "denied repository", method: "POST", path: "/team/orgs/krateoplatformops/teams", body: `{"name": "devs", "repo_names": ["website", "infra"]}`, expectedStatus: http.StatusForbidden, expectedRule: "no-infra"},
+		{name: "denied full name on update", method: "PATCH", path: "/team/orgs/krateoplatformops/teams/devs", body: `{"repo_names": ["krateoplatformops/infra"]}`, expectedStatus: http.StatusForbidden, expectedRule: "no-infra"},
+		{name: "repository not allowed", method: "POST", path: "/team/orgs/krateoplatformops/teams", body: `{"name": "devs", "repo_names": ["octocat/hello-world"]}`, expectedStatus: http.StatusForbidden, expectedRule: "allow"},
+		{name: "permission above the cap", method: "POST", path: "/team/orgs/krateoplatformops/teams", body: `{"name": "devs", "repo_names": ["website"], "permission": "admin"}`, expectedStatus: http.StatusForbidden, expectedRule: "no-admin"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tt.expectedRule != "" && !strings.Contains(rr.Body.String(), `"policy_rule":"`+tt.expectedRule+`"`) {
+				t.Errorf("expected violation of rule %s, got %s", tt.expectedRule, rr.Body.String())
+			}
+		})
+	}
+	if len(client.requests) != 0 {
+		t.Errorf("expected no membership checks for teams, got %v", client.requests)
+	}
+}
+
+func TestRestrictTargets(t *testing.T) {
+	opts := HandlerOptions{Client: &membershipClient{}, Policy: newTestPolicyStore(t)}
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /team/orgs/{org}/teams/{team_slug}", RestrictTargets(opts, policy.RouteTeam, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/team/orgs/krateoplatformops/teams/devs", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/team/orgs/octocat/teams/devs", nil))
+	if rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), `"policy_rule":"allow"`) {
+		t.Errorf("expected violation of rule allow, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestEnforcePolicy_NoPolicy(t *testing.T) {
+	called := false
+	handler := EnforcePolicy(HandlerOptions{}, policy.RouteCollaborator, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/repository/octocat/hello-world/collaborators/mona", strings.NewReader(`{"permission": "admin"}`)))
+	if !called || rr.Code != http.StatusOK {
+		t.Errorf("expected the request to be served without policy, got %d", rr.Code)
+	}
+}
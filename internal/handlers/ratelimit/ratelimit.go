@@ -0,0 +1,281 @@
+// Package ratelimit limits the requests each caller sends to the plugin, so that a single tenant cannot exhaust
+// the GitHub rate limit of a shared token nor starve the other callers.
+//
+// Callers are identified by the hash of their Authorization header once GitHub has accepted it, otherwise by their IP address,
+// so that a client cannot get a fresh bucket for every request by sending made-up credentials.
+// Each caller has a token bucket and a maximum number of in-flight requests for every route pattern of the ServeMux.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/handlers"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/requeststats"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/utils"
+)
+
+const (
+	// sweepInterval is how often the state of idle callers is dropped
+	sweepInterval = time.Minute
+	// maxBuckets is the maximum number of caller states kept: beyond it, new callers share the overflow bucket of the route
+	maxBuckets = 10000
+	// maxKnownTokens is the maximum number of tokens identifying their callers: beyond it, new tokens are identified by IP address
+	maxKnownTokens = 10000
+	// knownTokenTTL is how long a token identifies its caller after its last accepted request
+	knownTokenTTL = time.Hour
+)
+
+// overflowCaller is the caller of the requests whose state cannot be kept because of maxBuckets
+const overflowCaller = "overflow"
+
+// Limit is the limit of the requests of a caller on a route
+type Limit struct {
+	Rate        float64 // Requests per second, refilling the bucket (no rate limit when 0)
+	Burst       int     // Size of the bucket
+	MaxInFlight int     // Maximum concurrent requests (no limit when 0)
+}
+
+// ParseLimit parses a limit written as `rate:burst:max_in_flight`, e.g. `10:20:5`
+func ParseLimit(value string) (Limit, error) {
+	parts := strings.Split(strings.TrimSpace(value), ":")
+	if len(parts) != 3 {
+		return Limit{}, fmt.Errorf("invalid limit %q, expected rate:burst:max_in_flight", value)
+	}
+
+	rate, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil || rate < 0 || math.IsInf(rate, 0) || math.IsNaN(rate) {
+		return Limit{}, fmt.Errorf("invalid rate %q in limit %q", parts[0], value)
+	}
+	burst, err := strconv.Atoi(parts[1])
+	if err != nil || burst < 0 {
+		return Limit{}, fmt.Errorf("invalid burst %q in limit %q", parts[1], value)
+	}
+	if rate > 0 && burst < 1 {
+		return Limit{}, fmt.Errorf("burst must be at least 1 with a rate in limit %q", value)
+	}
+	maxInFlight, err := strconv.Atoi(parts[2])
+	if err != nil || maxInFlight < 0 {
+		return Limit{}, fmt.Errorf("invalid max in flight %q in limit %q", parts[2], value)
+	}
+	return Limit{Rate: rate, Burst: burst, MaxInFlight: maxInFlight}, nil
+}
+
+// ParseRouteLimits parses the limits of route patterns, written as `pattern=limit` separated by semicolons,
+// e.g. `PUT /repository/{owner}/{repo}/collaborators=0.5:2:1;GET /healthz=0:0:0`.
+// Patterns are the ones the routes are registered with.
+func ParseRouteLimits(value string) (map[string]Limit, error) {
+	limits := make(map[string]Limit)
+	for _, entry := range strings.Split(value, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		i := strings.LastIndex(entry, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid route limit %q, expected pattern=rate:burst:max_in_flight", entry)
+		}
+		pattern := strings.TrimSpace(entry[:i])
+		if pattern == "" {
+			return nil, fmt.Errorf("invalid route limit %q, the pattern is empty", entry)
+		}
+		limit, err := ParseLimit(entry[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		limits[pattern] = limit
+	}
+	return limits, nil
+}
+
+// bucket is the state of a caller on a route
+type bucket struct {
+	tokens   float64
+	last     time.Time
+	inFlight int
+}
+
+// Limiter keeps the state of the callers of each route
+type Limiter struct {
+	defaults Limit
+	routes   map[string]Limit
+	now      func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	known     map[string]time.Time // Hashes of the tokens accepted by GitHub, with the time of their last accepted request
+	lastSweep time.Time
+}
+
+// New creates a Limiter applying the limits of the route patterns, and the default limit to the other routes
+func New(defaults Limit, routes map[string]Limit) *Limiter {
+	return &Limiter{
+		defaults: defaults,
+		routes:   routes,
+		now:      time.Now,
+		buckets:  make(map[string]*bucket),
+		known:    make(map[string]time.Time),
+	}
+}
+
+// limit returns the limit of a route pattern
+func (l *Limiter) limit(pattern string) Limit {
+	if limit, ok := l.routes[pattern]; ok {
+		return limit
+	}
+	return l.defaults
+}
+
+// acquire takes a token and an in-flight slot of a caller on a route.
+// It returns the function releasing the slot, or how long the caller should wait before retrying.
+func (l *Limiter) acquire(pattern, caller string) (func(), time.Duration, bool) {
+	limit := l.limit(pattern)
+	if limit.Rate == 0 && limit.MaxInFlight == 0 {
+		return func() {}, 0, true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	key := pattern + "\x00" + caller
+	b, ok := l.buckets[key]
+	if !ok && len(l.buckets) >= maxBuckets {
+		l.lastSweep = time.Time{}
+		l.sweep(now)
+		if len(l.buckets) >= maxBuckets {
+			key = pattern + "\x00" + overflowCaller
+			b, ok = l.buckets[key]
+		}
+	}
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), last: now}
+		l.buckets[key] = b
+	}
+	refill(b, limit, now)
+
+	if limit.MaxInFlight > 0 && b.inFlight >= limit.MaxInFlight {
+		return nil, time.Second, false
+	}
+	if limit.Rate > 0 {
+		if b.tokens < 1 {
+			return nil, time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second)), false
+		}
+		b.tokens--
+	}
+
+	b.inFlight++
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			b.inFlight--
+		})
+	}, 0, true
+}
+
+// refill adds the tokens earned since the last request, up to the burst
+func refill(b *bucket, limit Limit, now time.Time) {
+	if limit.Rate > 0 {
+		b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	}
+	b.last = now
+}
+
+// sweep drops the state of the callers that are back to a full bucket and have no request in flight, every sweepInterval.
+// It must be called with the lock held.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		pattern, _, _ := strings.Cut(key, "\x00")
+		limit := l.limit(pattern)
+		refill(b, limit, now)
+		if b.inFlight == 0 && b.tokens >= float64(limit.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+	for tokenHash, lastAccepted := range l.known {
+		if now.Sub(lastAccepted) >= knownTokenTTL {
+			delete(l.known, tokenHash)
+		}
+	}
+}
+
+// callerKey identifies the caller of a request: by token hash when GitHub has accepted the token, otherwise by IP address.
+// It also returns the token hash, empty without Authorization header.
+func (l *Limiter) callerKey(r *http.Request) (string, string) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return "ip:" + host, ""
+	}
+
+	tokenHash := utils.HashToken(authHeader)
+	l.mu.Lock()
+	_, known := l.known[tokenHash]
+	l.mu.Unlock()
+	if known {
+		return "token:" + tokenHash, tokenHash
+	}
+	return "ip:" + host, tokenHash
+}
+
+// accepted records that GitHub accepted a token, which identifies its caller from then on
+func (l *Limiter) accepted(tokenHash string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, known := l.known[tokenHash]; known || len(l.known) < maxKnownTokens {
+		l.known[tokenHash] = l.now()
+	}
+}
+
+// Handler limits the requests served by mux, by caller and route pattern.
+// Requests over the limits are rejected with 429 Too Many Requests and a Retry-After header.
+func Handler(limiter *Limiter, mux *http.ServeMux) http.Handler {
+	if limiter == nil {
+		return mux
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, pattern := mux.Handler(r)
+
+		caller, tokenHash := limiter.callerKey(r)
+		release, retryAfter, ok := limiter.acquire(pattern, caller)
+		if !ok {
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			if seconds < 1 {
+				seconds = 1
+			}
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			handlers.WriteError(w, r, http.StatusTooManyRequests, fmt.Sprintf("Too many requests, retry after %d seconds", seconds))
+			return
+		}
+		defer release()
+
+		if tokenHash == "" {
+			mux.ServeHTTP(w, r)
+			return
+		}
+		recorder := handlers.NewResponseRecorder(w, false)
+		mux.ServeHTTP(recorder, r)
+		// The token is accepted when the request succeeded after calling GitHub with it
+		if calls, _ := requeststats.FromContext(r.Context()).Calls(); calls > 0 && recorder.StatusCode() < http.StatusMultipleChoices {
+			limiter.accepted(tokenHash)
+		}
+	})
+}
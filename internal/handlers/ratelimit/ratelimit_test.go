@@ -0,0 +1,290 @@
+package ratelimit
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/requeststats"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		value         string
+		expected      Limit
+		expectedError string
+	}{
+		{value: "10:20:5", expected: Limit{Rate: 10, Burst: 20, MaxInFlight: 5}},
+		{value: "0.5:1:0", expected: Limit{Rate: 0.5, Burst: 1}},
+		{value: "0:0:0", expected: Limit{}},
+		{value: "10:20", expectedError: "expected rate:burst:max_in_flight"},
+		{value: "-1:20:5", expectedError: "invalid rate"},
+		{value: "10:x:5", expectedError: "invalid burst"},
+		{value: "10:0:5", expectedError: "burst must be at least 1"},
+		{value: "10:20:-1", expectedError: "invalid max in flight"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			limit, err := ParseLimit(tt.value)
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Errorf("expected error containing %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if limit != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, limit)
+			}
+		})
+	}
+}
+
+func TestParseRouteLimits(t *testing.T) {
+	limits, err := ParseRouteLimits("PUT /repository/{owner}/{repo}/collaborators=0.5:2:1; GET /healthz=0:0:0;")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(limits) != 2 || limits["PUT /repository/{owner}/{repo}/collaborators"] != (Limit{Rate: 0.5, Burst: 2, MaxInFlight: 1}) {
+		t.Errorf("unexpected limits %+v", limits)
+	}
+
+	for _, value := range []string{"GET /healthz", "=1:1:1", "GET /healthz=1:1"} {
+		if _, err := ParseRouteLimits(value); err == nil {
+			t.Errorf("expected an error for %q", value)
+		}
+	}
+}
+
+func TestLimiter_Rate(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	limiter := New(Limit{Rate: 2, Burst: 3}, nil)
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		release, _, ok := limiter.acquire("GET /a", "token:x")
+		if !ok {
+			t.Fatalf("request %d rejected within the burst", i)
+		}
+		release()
+	}
+
+	_, retryAfter, ok := limiter.acquire("GET /a", "token:x")
+	if ok || retryAfter != 500*time.Millisecond {
+		t.Errorf("expected a rejection with a 500ms retry, got %v, %v", ok, retryAfter)
+	}
+
+	// Other callers and routes have their own buckets
+	if _, _, ok := limiter.acquire("GET /a", "token:y"); !ok {
+		t.Error("expected another caller to be served")
+	}
+	if _, _, ok := limiter.acquire("GET /b", "token:x"); !ok {
+		t.Error("expected another route to be served")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if _, _, ok := limiter.acquire("GET /a", "token:x"); !ok {
+		t.Error("expected a request to be served after the refill")
+	}
+}
+
+func TestLimiter_InFlight(t *testing.T) {
+	limiter := New(Limit{MaxInFlight: 2}, map[string]Limit{"GET /healthz": {}})
+
+	first, _, ok := limiter.acquire("GET /a", "ip:10.0.0.1")
+	if !ok {
+		t.Fatal("first request rejected")
+	}
+	if _, _, ok := limiter.acquire("GET /a", "ip:10.0.0.1"); !ok {
+		t.Fatal("second request rejected")
+	}
+	if _, retryAfter, ok := limiter.acquire("GET /a", "ip:10.0.0.1"); ok || retryAfter != time.Second {
+		t.Errorf("expected the third concurrent request to be rejected, got %v, %v", ok, retryAfter)
+	}
+
+	first()
+	first() // Releasing twice frees a single slot
+	if _, _, ok := limiter.acquire("GET /a", "ip:10.0.0.1"); !ok {
+		t.Error("expected a request to be served after a release")
+	}
+	if _, _, ok := limiter.acquire("GET /a", "ip:10.0.0.1"); ok {
+		t.Error("expected the slot to be released once")
+	}
+
+	// Unlimited route
+	for i := 0; i < 5; i++ {
+		if _, _, ok := limiter.acquire("GET /healthz", "ip:10.0.0.1"); !ok {
+			t.Fatal("expected the unlimited route to be served")
+		}
+	}
+}
+
+func TestLimiter_Sweep(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	limiter := New(Limit{Rate: 1, Burst: 1, MaxInFlight: 1}, nil)
+	limiter.now = func() time.Time { return now }
+
+	release, _, _ := limiter.acquire("GET /a", "token:busy")
+	idle, _, _ := limiter.acquire("GET /a", "token:idle")
+	idle()
+
+	now = now.Add(2 * sweepInterval)
+	limiter.acquire("GET /b", "token:other")
+
+	if _, ok := limiter.buckets["GET /a\x00token:idle"]; ok {
+		t.Error("expected the idle caller to be dropped")
+	}
+	if _, ok := limiter.buckets["GET /a\x00token:busy"]; !ok {
+		t.Error("expected the caller with a request in flight to be kept")
+	}
+	release()
+}
+
+// newGitHubMux returns a mux whose repository route calls GitHub, which rejects the tokens starting with "Bearer fake"
+func newGitHubMux(block chan struct{}) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /repository/{owner}/{repo}", func(w http.ResponseWriter, r *http.Request) {
+		requeststats.FromContext(r.Context()).AddCall(time.Millisecond, "")
+		if strings.HasPrefix(r.Header.Get("Authorization"), "Bearer fake") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("block") != "" {
+			<-block
+		}
+	})
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {})
+	return mux
+}
+
+// newServe returns a function serving a request with the stats the access log adds to its context
+func newServe(handler http.Handler) func(path, auth, remoteAddr string) *httptest.ResponseRecorder {
+	return func(path, auth, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = remoteAddr
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		ctx, _ := requeststats.NewContext(req.Context())
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req.WithContext(ctx))
+		return rr
+	}
+}
+
+func TestHandler(t *testing.T) {
+	block := make(chan struct{})
+	handler := Handler(New(Limit{Rate: 100, Burst: 100, MaxInFlight: 1}, map[string]Limit{"GET /healthz": {}}), newGitHubMux(block))
+	serve := newServe(handler)
+
+	// Tokens identify their callers once accepted by GitHub
+	for _, auth := range []string{"Bearer one", "Bearer two"} {
+		if rr := serve("/repository/krateo/a", auth, "10.0.0.1:1234"); rr.Code != http.StatusOK {
+			t.Fatalf("expected the first request to be served, got %d", rr.Code)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		serve("/repository/krateo/a?block=1", "Bearer one", "10.0.0.1:1234")
+		close(done)
+	}()
+
+	// Wait for the blocked request to hold the slot of the caller
+	deadline := time.Now().Add(5 * time.Second)
+	var rr *httptest.ResponseRecorder
+	for {
+		rr = serve("/repository/krateo/b", "Bearer one", "10.0.0.2:1234")
+		if rr.Code == http.StatusTooManyRequests || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "1" || !strings.Contains(rr.Body.String(), `"code":"rate_limited"`) {
+		t.Errorf("expected 429 with Retry-After, got %d %q: %s", rr.Code, rr.Header().Get("Retry-After"), rr.Body.String())
+	}
+
+	// Other tokens, anonymous callers and unlimited routes are served
+	if rr := serve("/repository/krateo/b", "Bearer two", "10.0.0.1:1234"); rr.Code != http.StatusOK {
+		t.Errorf("expected another token to be served, got %d", rr.Code)
+	}
+	if rr := serve("/repository/krateo/b", "", "10.0.0.1:1234"); rr.Code != http.StatusOK {
+		t.Errorf("expected an anonymous caller to be served, got %d", rr.Code)
+	}
+	if rr := serve("/healthz", "Bearer one", "10.0.0.1:1234"); rr.Code != http.StatusOK {
+		t.Errorf("expected the health check to be served, got %d", rr.Code)
+	}
+
+	close(block)
+	<-done
+	if rr := serve("/repository/krateo/b", "Bearer one", "10.0.0.1:1234"); rr.Code != http.StatusOK {
+		t.Errorf("expected the caller to be served after its request completed, got %d", rr.Code)
+	}
+}
+
+func TestHandler_UnknownCredentials(t *testing.T) {
+	limiter := New(Limit{Rate: 1, Burst: 2}, nil)
+	now := time.Unix(1700000000, 0)
+	limiter.now = func() time.Time { return now }
+	serve := newServe(Handler(limiter, newGitHubMux(nil)))
+
+	// Made-up tokens do not get a bucket each: their requests are limited by IP address
+	for i := range 2 {
+		if rr := serve("/repository/krateo/a", fmt.Sprintf("Bearer fake-%d", i), "10.0.0.1:1234"); rr.Code != http.StatusUnauthorized {
+			t.Fatalf("expected request %d to reach GitHub, got %d", i, rr.Code)
+		}
+	}
+	for _, auth := range []string{"Bearer fake-2", "not a credential", "Bearer one"} {
+		if rr := serve("/repository/krateo/a", auth, "10.0.0.1:1234"); rr.Code != http.StatusTooManyRequests {
+			t.Errorf("expected the unknown credentials %q to share the bucket of the IP address, got %d", auth, rr.Code)
+		}
+	}
+	if len(limiter.known) != 0 {
+		t.Errorf("expected the rejected tokens not to be known, got %d", len(limiter.known))
+	}
+
+	// An accepted token gets its own bucket
+	now = now.Add(time.Second)
+	if rr := serve("/repository/krateo/a", "Bearer one", "10.0.0.1:1234"); rr.Code != http.StatusOK {
+		t.Fatalf("expected the token to be served after the refill, got %d", rr.Code)
+	}
+	for i := range 2 {
+		if rr := serve("/repository/krateo/a", "Bearer one", "10.0.0.1:1234"); rr.Code != http.StatusOK {
+			t.Errorf("expected request %d of the accepted token to be served, got %d", i, rr.Code)
+		}
+	}
+
+	// Known tokens are forgotten after their TTL
+	now = now.Add(knownTokenTTL + sweepInterval)
+	limiter.acquire("GET /repository/{owner}/{repo}", "ip:10.0.0.2")
+	if len(limiter.known) != 0 {
+		t.Errorf("expected the token to be forgotten, got %d known tokens", len(limiter.known))
+	}
+}
+
+func TestLimiter_MaxBuckets(t *testing.T) {
+	limiter := New(Limit{MaxInFlight: 1}, nil)
+
+	for i := range maxBuckets {
+		if _, _, ok := limiter.acquire("GET /a", fmt.Sprintf("ip:10.0.%d.%d", i/256, i%256)); !ok {
+			t.Fatalf("request %d rejected", i)
+		}
+	}
+
+	// New callers share the overflow bucket once the state of maxBuckets callers is kept
+	if _, _, ok := limiter.acquire("GET /a", "ip:192.168.0.1"); !ok {
+		t.Fatal("expected the first caller over the limit to be served")
+	}
+	if _, _, ok := limiter.acquire("GET /a", "ip:192.168.0.2"); ok {
+		t.Error("expected the callers over the limit to share the overflow bucket")
+	}
+	if len(limiter.buckets) != maxBuckets+1 {
+		t.Errorf("expected %d buckets, got %d", maxBuckets+1, len(limiter.buckets))
+	}
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+)
+
+// ResponseRecorder writes a response through to a ResponseWriter while keeping its status code and size,
+// and a copy of its body when asked to. Without ResponseWriter, the response is only recorded.
+type ResponseRecorder struct {
+	http.ResponseWriter
+	statusCode  int
+	bytes       int64
+	wroteHeader bool
+	keepBody    bool
+	header      http.Header
+	body        bytes.Buffer
+}
+
+// NewResponseRecorder creates a ResponseRecorder of the response written to w (recorded only when w is nil),
+// keeping a copy of the body when keepBody is true
+func NewResponseRecorder(w http.ResponseWriter, keepBody bool) *ResponseRecorder {
+	r := &ResponseRecorder{ResponseWriter: w, statusCode: http.StatusOK, keepBody: keepBody || w == nil}
+	if w == nil {
+		r.header = make(http.Header)
+	}
+	return r
+}
+
+// StatusCode returns the status code of the response, 200 when none was written
+func (r *ResponseRecorder) StatusCode() int {
+	return r.statusCode
+}
+
+// Bytes returns the number of body bytes written
+func (r *ResponseRecorder) Bytes() int64 {
+	return r.bytes
+}
+
+// Body returns the copy of the body, empty unless kept
+func (r *ResponseRecorder) Body() []byte {
+	return r.body.Bytes()
+}
+
+func (r *ResponseRecorder) Header() http.Header {
+	if r.ResponseWriter == nil {
+		return r.header
+	}
+	return r.ResponseWriter.Header()
+}
+
+func (r *ResponseRecorder) WriteHeader(statusCode int) {
+	if !r.wroteHeader {
+		r.statusCode = statusCode
+		r.wroteHeader = true
+	}
+	if r.ResponseWriter != nil {
+		r.ResponseWriter.WriteHeader(statusCode)
+	}
+}
+
+func (r *ResponseRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	n := len(b)
+	var err error
+	if r.ResponseWriter != nil {
+		n, err = r.ResponseWriter.Write(b)
+	}
+	if r.keepBody {
+		r.body.Write(b[:n])
+	}
+	r.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap returns the underlying ResponseWriter, for http.ResponseController
+func (r *ResponseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
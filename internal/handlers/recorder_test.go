@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResponseRecorder(t *testing.T) {
+	rr := httptest.NewRecorder()
+	recorder := NewResponseRecorder(rr, true)
+	recorder.Header().Set("Content-Type", "application/json")
+	recorder.WriteHeader(http.StatusCreated)
+	recorder.WriteHeader(http.StatusOK)
+	recorder.Write([]byte(`{"id": 1}`))
+
+	if recorder.StatusCode() != http.StatusCreated || recorder.Bytes() != 9 || string(recorder.Body()) != `{"id": 1}` {
+		t.Errorf("expected 201 with 9 bytes kept, got %d with %d bytes %q", recorder.StatusCode(), recorder.Bytes(), recorder.Body())
+	}
+	if rr.Code != http.StatusCreated || rr.Body.String() != `{"id": 1}` || rr.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("expected the response to be written through, got %d %q", rr.Code, rr.Body.String())
+	}
+	if recorder.Unwrap() != rr {
+		t.Error("expected Unwrap to return the underlying ResponseWriter")
+	}
+
+	// The body is only kept when asked to
+	recorder = NewResponseRecorder(httptest.NewRecorder(), false)
+	recorder.Write([]byte("ok"))
+	if recorder.StatusCode() != http.StatusOK || recorder.Bytes() != 2 || len(recorder.Body()) != 0 {
+		t.Errorf("expected 200 with 2 bytes not kept, got %d with %d bytes %q", recorder.StatusCode(), recorder.Bytes(), recorder.Body())
+	}
+
+	// Without ResponseWriter, the response is only recorded
+	recorder = NewResponseRecorder(nil, false)
+	recorder.Header().Set("Content-Type", "text/plain")
+	recorder.WriteHeader(http.StatusNotFound)
+	recorder.Write([]byte("not found"))
+	if recorder.StatusCode() != http.StatusNotFound || string(recorder.Body()) != "not found" || recorder.Header().Get("Content-Type") != "text/plain" {
+		t.Errorf("expected the response to be recorded, got %d %q", recorder.StatusCode(), recorder.Body())
+	}
+}
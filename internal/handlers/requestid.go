@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+)
+
+// GitHubRequestIDHeader is the header carrying the ID GitHub gives to each API request
+const GitHubRequestIDHeader = "X-GitHub-Request-Id"
+
+// requestIDKey is the context key of the ID of a request
+type requestIDKey struct{}
+
+// requestIDPattern matches the request IDs accepted from the callers, others are replaced by a generated one
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestID identifies the requests served by next: the X-Request-Id of the caller is kept when valid, otherwise a new ID is generated.
+// The ID is returned on every response, set on the request for the handlers, logs and audit records, and sent to GitHub
+// with the API calls of the request (see InstrumentClient).
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if !requestIDPattern.MatchString(requestID) {
+			requestID = newRequestID()
+		}
+
+		r.Header.Set(RequestIDHeader, requestID)
+		w.Header().Set(RequestIDHeader, requestID)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, requestID)))
+	})
+}
+
+// RequestIDFromContext returns the ID of the request of ctx, empty outside of a request served with RequestID
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// newRequestID returns a random 128-bit ID
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,132 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/handlers"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/requeststats"
+	"github.com/rs/zerolog"
+)
+
+func TestRequestID(t *testing.T) {
+	generated := regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+	tests := []struct {
+		name     string
+		header   string
+		expected string // Empty for a generated ID
+	}{
+		{name: "caller ID", header: "reconcile-7f3a:2", expected: "reconcile-7f3a:2"},
+		{name: "missing ID", header: ""},
+		{name: "invalid ID", header: "id with spaces\nand a new line"},
+		{name: "too long ID", header: strings.Repeat("a", 129)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen, fromContext string
+			handler := handlers.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = r.Header.Get(handlers.RequestIDHeader)
+				fromContext = handlers.RequestIDFromContext(r.Context())
+				handlers.WriteError(w, r, http.StatusNotFound, "not found")
+			}))
+
+			req := httptest.NewRequest("GET", "/team/orgs/krateo/teams/devs", nil)
+			if tt.header != "" {
+				req.Header.Set(handlers.RequestIDHeader, tt.header)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			requestID := rr.Header().Get(handlers.RequestIDHeader)
+			if tt.expected != "" && requestID != tt.expected {
+				t.Errorf("expected request ID %q, got %q", tt.expected, requestID)
+			}
+			if tt.expected == "" && !generated.MatchString(requestID) {
+				t.Errorf("expected a generated request ID, got %q", requestID)
+			}
+			if seen != requestID || fromContext != requestID {
+				t.Errorf("expected the handler to see request ID %q, got %q in the header and %q in the context", requestID, seen, fromContext)
+			}
+
+			var response handlers.ErrorResponse
+			json.Unmarshal(rr.Body.Bytes(), &response)
+			if response.RequestID != requestID {
+				t.Errorf("expected the error response to report request ID %q, got %q", requestID, response.RequestID)
+			}
+		})
+	}
+
+	// Generated IDs are unique
+	ids := map[string]bool{}
+	handler := handlers.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for range 100 {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+		ids[rr.Header().Get(handlers.RequestIDHeader)] = true
+	}
+	if len(ids) != 100 {
+		t.Errorf("expected 100 distinct request IDs, got %d", len(ids))
+	}
+}
+
+// githubClient answers every call with a GitHub request ID and records the request IDs it receives
+type githubClient struct {
+	received []string
+}
+
+func (c *githubClient) Do(req *http.Request) (*http.Response, error) {
+	c.received = append(c.received, req.Header.Get(handlers.RequestIDHeader))
+	header := make(http.Header)
+	header.Set(handlers.GitHubRequestIDHeader, "0400:1A2B:3C4D")
+	return &http.Response{StatusCode: http.StatusOK, Header: header, Body: io.NopCloser(strings.NewReader("{}")), Request: req}, nil
+}
+
+func TestRequestID_PropagatedToGitHub(t *testing.T) {
+	var out bytes.Buffer
+	logger := zerolog.New(&out).Level(zerolog.DebugLevel)
+	github := &githubClient{}
+	opts := handlers.HandlerOptions{Client: handlers.InstrumentClient(github), Log: &logger}
+
+	pattern := "GET /team/orgs/{org}/teams/{team_slug}"
+	mux := http.NewServeMux()
+	mux.Handle(pattern, handlers.RequestLogger(opts, pattern, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, _ := http.NewRequestWithContext(r.Context(), "GET", "https://api.github.com/orgs/krateo/teams/devs", nil)
+		opts.Client.Do(req)
+
+		if ids := requeststats.FromContext(r.Context()).GitHubRequestIDs(); len(ids) != 1 || ids[0] != "0400:1A2B:3C4D" {
+			t.Errorf("expected the GitHub request ID to be recorded, got %v", ids)
+		}
+	})))
+
+	req := httptest.NewRequest("GET", "/team/orgs/krateo/teams/devs", nil)
+	req.Header.Set(handlers.RequestIDHeader, "reconcile-1")
+	handlers.RequestID(mux).ServeHTTP(httptest.NewRecorder(), req)
+
+	if len(github.received) != 1 || github.received[0] != "reconcile-1" {
+		t.Errorf("expected the request ID to be sent to GitHub, got %v", github.received)
+	}
+
+	var entry map[string]any
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatalf("expected a JSON log line, got %q: %v", out.String(), err)
+	}
+	if entry["request_id"] != "reconcile-1" || entry["github_request_id"] != "0400:1A2B:3C4D" || entry["upstream_status"] != float64(200) {
+		t.Errorf("expected the GitHub API call to be logged against the request ID, got %s", out.String())
+	}
+
+	// Calls made outside of a request are sent unchanged
+	github.received = nil
+	outside, _ := http.NewRequest("GET", "https://api.github.com/rate_limit", nil)
+	opts.Client.Do(outside)
+	if github.received[0] != "" || outside.Header.Get(handlers.RequestIDHeader) != "" {
+		t.Errorf("expected no request ID outside of a request, got %q", github.received[0])
+	}
+}
@@ -0,0 +1,106 @@
+package team
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/fakegithub"
+)
+
+func newE2EFake() *fakegithub.Server {
+	fake := fakegithub.New()
+	fake.RequireToken(strings.TrimPrefix(testToken, "token "))
+	fake.AddOrg(testOrg)
+	return fake
+}
+
+func decodeTeam(t *testing.T, body []byte) map[string]interface{} {
+	t.Helper()
+
+	var data map[string]interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		t.Fatalf("failed to decode response %s: %v", body, err)
+	}
+	return data
+}
+
+func TestE2E_TeamLifecycle(t *testing.T) {
+	fake := newE2EFake()
+	defer fake.Close()
+	opts := newTestOptions(fake.Client())
+	fake.AddTeam(testOrg, "Parent Team", "")
+
+	const teamsPath = "/team/orgs/" + testOrg + "/teams"
+
+	rr := serve("POST /team/orgs/{org}/teams", PostTeam(opts), "POST", teamsPath, `{"name": "Test Team", "parent_slug": "`+testParentSlug+`"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if data := decodeTeam(t, rr.Body.Bytes()); data["parent_slug"] != testParentSlug || data["privacy"] != "closed" {
+		t.Errorf("expected a closed team nested in %s, got %v %v", testParentSlug, data["parent_slug"], data["privacy"])
+	}
+
+	rr = serve("GET /team/orgs/{org}/teams/{team_slug}", GetTeam(opts), "GET", teamsPath+"/"+testTeamSlug, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	teamID := int64(decodeTeam(t, rr.Body.Bytes())["id"].(float64))
+
+	rr = serve("PATCH /team/orgs/{org}/teams/{team_slug}", PatchTeam(opts), "PATCH", teamsPath+"/"+testTeamSlug, `{"name": "Renamed Team", "parent_slug": null, "privacy": "secret"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	renamed, exists := fake.Team(testOrg, "renamed-team")
+	if !exists || renamed.Parent != nil || renamed.Privacy != "secret" {
+		t.Fatalf("expected a secret root team renamed-team, got %+v", renamed)
+	}
+
+	// After a rename the team is found by ID through the old slug
+	rr = serve("GET /team/orgs/{org}/teams/{team_slug}", GetTeam(opts), "GET", teamsPath+"/"+testTeamSlug+"?team_id="+strconv.FormatInt(teamID, 10), "")
+	if rr.Code != http.StatusOK || decodeTeam(t, rr.Body.Bytes())["slug"] != "renamed-team" {
+		t.Errorf("expected the renamed team by ID, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = serve("DELETE /team/orgs/{org}/teams/{team_slug}", DeleteTeam(opts), "DELETE", teamsPath+"/renamed-team", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if _, exists := fake.Team(testOrg, "renamed-team"); exists {
+		t.Errorf("expected the team to be deleted")
+	}
+
+	rr = serve("GET /team/orgs/{org}/teams/{team_slug}", GetTeam(opts), "GET", teamsPath+"/renamed-team", "")
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 after the deletion, got %d", rr.Code)
+	}
+}
+
+func TestE2E_TeamValidation(t *testing.T) {
+	fake := newE2EFake()
+	defer fake.Close()
+	opts := newTestOptions(fake.Client())
+	fake.AddTeam(testOrg, "Test Team", "")
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+	}{
+		{name: "duplicate name", body: `{"name": "Test Team"}`, expectedStatus: http.StatusUnprocessableEntity},
+		{name: "unknown parent", body: `{"name": "Child", "parent_slug": "missing"}`, expectedStatus: http.StatusUnprocessableEntity},
+		{name: "invalid parent slug", body: `{"name": "Child", "parent_slug": "../members"}`, expectedStatus: http.StatusBadRequest},
+		{name: "secret nested team", body: `{"name": "Child", "parent_slug": "test-team", "privacy": "secret"}`, expectedStatus: http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := serve("POST /team/orgs/{org}/teams", PostTeam(opts), "POST", "/team/orgs/"+testOrg+"/teams", tt.body)
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package team
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/githuburl"
+)
+
+// ErrSecretNestedTeam is returned when a nested team is requested with `secret` privacy,
+// which GitHub does not allow (nested teams, and their parents, must be `closed`)
+var ErrSecretNestedTeam = errors.New("a team with a parent team cannot have privacy 'secret', use 'closed'")
+
+// githubError carries a non-successful GitHub API response so that handlers can forward it as is
+type githubError struct {
+	StatusCode int
+	Body       []byte
+}
+
+func (e *githubError) Error() string {
+	return fmt.Sprintf("GitHub API returned status %d", e.StatusCode)
+}
+
+/*
+The following are utility functions to deal with the GitHub Teams API discrepancies
+
+Field in CR		Field in GitHub REQUEST			Field in GitHub RESPONSE
+parent_slug		parent_team_id (numeric)		parent (object, with `slug`)
+privacy			privacy (default: secret)		privacy (closed when nested)
+*/
+
+// NormalizeTeamResponse adds the `parent_slug` field at root level of a GitHub team response.
+// `parent_slug` is null when the team has no parent.
+func NormalizeTeamResponse(body []byte) ([]byte, error) {
+	var data map[string]interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	data["parent_slug"] = nil
+	if parent, ok := data["parent"].(map[string]interface{}); ok {
+		if slug, ok := parent["slug"].(string); ok && slug != "" {
+			data["parent_slug"] = slug
+		}
+	}
+
+	return json.Marshal(data)
+}
+
+// ReadParentSlug reads the `parent_slug` field from a request body.
+// The returned boolean reports whether the field was present at all:
+// a present but empty (or null) `parent_slug` means that the parent must be removed.
+func ReadParentSlug(body []byte) (string, bool, error) {
+	var data map[string]interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return "", false, fmt.Errorf("failed to unmarshal request body: %w", err)
+	}
+
+	value, exists := data["parent_slug"]
+	if !exists {
+		return "", false, nil
+	}
+	if value == nil {
+		return "", true, nil
+	}
+
+	slug, ok := value.(string)
+	if !ok {
+		return "", false, fmt.Errorf("field parent_slug must be a string")
+	}
+	if slug != "" {
+		if err := githuburl.Validate(githuburl.TeamSlug, slug); err != nil {
+			return "", false, fmt.Errorf("field parent_slug: %w", err)
+		}
+	}
+	return slug, true, nil
+}
+
+// PrepareTeamRequestBody translates a plugin request body into the body expected by the GitHub Teams API.
+// When parentSet is true, `parent_slug` is replaced by `parent_team_id` (null when parentID is 0).
+// Since GitHub rejects nested teams that are not `closed`, privacy defaults to `closed` when a parent is set.
+func PrepareTeamRequestBody(body []byte, parentSet bool, parentID int64) ([]byte, error) {
+	var data map[string]interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal request body: %w", err)
+	}
+
+	delete(data, "parent_slug")
+
+	if parentSet {
+		if parentID == 0 {
+			data["parent_team_id"] = nil
+		} else {
+			data["parent_team_id"] = parentID
+
+			privacy, _ := data["privacy"].(string)
+			switch privacy {
+			case "":
+				data["privacy"] = "closed"
+			case "secret":
+				return nil, ErrSecretNestedTeam
+			}
+		}
+	}
+
+	return json.Marshal(data)
+}
+
+// readTeamIdentity reads the `id` and `slug` fields from a GitHub team response
+func readTeamIdentity(body []byte) (int64, string, error) {
+	var identity struct {
+		ID   int64  `json:"id"`
+		Slug string `json:"slug"`
+	}
+	if err := json.Unmarshal(body, &identity); err != nil {
+		return 0, "", fmt.Errorf("failed to unmarshal team: %w", err)
+	}
+	return identity.ID, identity.Slug, nil
+}
+
+// readStringField reads a mandatory, non-empty string field from a request body
+func readStringField(body []byte, fieldName string) (string, error) {
+	var data map[string]interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return "", fmt.Errorf("failed to unmarshal request body: %w", err)
+	}
+
+	value, ok := data[fieldName].(string)
+	if !ok || value == "" {
+		return "", fmt.Errorf("field %s not found", fieldName)
+	}
+	return value, nil
+}
+
+// function to add a field to the response body
+func addFieldToResponse(body []byte, fieldName string, fieldValue interface{}) ([]byte, error) {
+	var data map[string]interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	data[fieldName] = fieldValue
+
+	return json.Marshal(data)
+}
@@ -0,0 +1,518 @@
+package team
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/githuburl"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/handlers"
+)
+
+// Handler constructors
+func GetTeam(opts handlers.HandlerOptions) handlers.Handler {
+	return &getHandler{baseHandler: newBaseHandler(opts)}
+}
+
+func PostTeam(opts handlers.HandlerOptions) handlers.Handler {
+	return &postHandler{baseHandler: newBaseHandler(opts)}
+}
+
+func PatchTeam(opts handlers.HandlerOptions) handlers.Handler {
+	return &patchHandler{baseHandler: newBaseHandler(opts)}
+}
+
+func DeleteTeam(opts handlers.HandlerOptions) handlers.Handler {
+	return &deleteHandler{baseHandler: newBaseHandler(opts)}
+}
+
+// Interface compliance verification
+var _ handlers.Handler = &getHandler{}
+var _ handlers.Handler = &postHandler{}
+var _ handlers.Handler = &patchHandler{}
+var _ handlers.Handler = &deleteHandler{}
+
+// Base handler with common functionality
+type baseHandler struct {
+	handlers.HandlerOptions
+}
+
+// Constructor for the base handler
+func newBaseHandler(opts handlers.HandlerOptions) *baseHandler {
+	return &baseHandler{HandlerOptions: opts}
+}
+
+// Handler types embedding the base handler
+type getHandler struct {
+	*baseHandler
+}
+
+type postHandler struct {
+	*baseHandler
+}
+
+type patchHandler struct {
+	*baseHandler
+}
+
+type deleteHandler struct {
+	*baseHandler
+}
+
+// resolvedTeam is the result of a team lookup
+type resolvedTeam struct {
+	Body        []byte // raw GitHub team response
+	ID          int64
+	Slug        string // current slug of the team
+	RenamedFrom string // slug used in the request, set only when the team has been renamed
+}
+
+// Common methods, defined once on baseHandler
+func (h *baseHandler) makeGitHubRequest(ctx context.Context, method, url, authHeader string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if authHeader != "" {
+		req.Header.Set("Authorization", authHeader)
+	}
+
+	if body != nil && len(body) > 0 {
+		req.Header.Set("Content-Type", "application/json")
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.ContentLength = int64(len(body))
+	}
+
+	resp, err := h.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute request: %w", err)
+	}
+
+	return resp, nil
+}
+
+// getGitHubResource performs a GET request and returns the response body.
+// found is false when GitHub answers 404, any other non-200 status is returned as a *githubError.
+func (h *baseHandler) getGitHubResource(ctx context.Context, url, authHeader string) ([]byte, bool, error) {
+	resp, err := h.makeGitHubRequest(ctx, "GET", url, authHeader, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return body, true, nil
+	case http.StatusNotFound:
+		return nil, false, nil
+	default:
+		return nil, false, &githubError{StatusCode: resp.StatusCode, Body: body}
+	}
+}
+
+// resolveTeam looks up a team by slug and, when the stable team ID is known, falls back to a lookup by ID.
+// This allows to follow a team after a rename (which changes the slug) and to avoid
+// mistaking a new team that took over an old slug for the managed one.
+func (h *baseHandler) resolveTeam(ctx context.Context, org, teamSlug string, teamID int64, authHeader string) (*resolvedTeam, bool, error) {
+	url := githuburl.Join("orgs", org, "teams", teamSlug)
+	body, found, err := h.getGitHubResource(ctx, url, authHeader)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if found {
+		id, slug, err := readTeamIdentity(body)
+		if err != nil {
+			return nil, false, err
+		}
+		if teamID == 0 || id == teamID {
+			return &resolvedTeam{Body: body, ID: id, Slug: slug}, true, nil
+		}
+		h.Logger(ctx).Debug().Msgf("Team slug %s in organization %s belongs to team ID %d, looking up team ID %d", teamSlug, org, id, teamID)
+	}
+
+	if teamID == 0 {
+		return nil, false, nil
+	}
+
+	body, found, err = h.getTeamByID(ctx, org, teamID, authHeader)
+	if err != nil || !found {
+		return nil, found, err
+	}
+
+	id, slug, err := readTeamIdentity(body)
+	if err != nil {
+		return nil, false, err
+	}
+
+	team := &resolvedTeam{Body: body, ID: id, Slug: slug}
+	if slug != teamSlug {
+		h.Logger(ctx).Debug().Msgf("Team ID %d in organization %s has been renamed from %s to %s", teamID, org, teamSlug, slug)
+		team.RenamedFrom = teamSlug
+	}
+	return team, true, nil
+}
+
+// getTeamByID gets a team through its stable numeric ID, which requires the numeric ID of the organization
+func (h *baseHandler) getTeamByID(ctx context.Context, org string, teamID int64, authHeader string) ([]byte, bool, error) {
+	orgBody, found, err := h.getGitHubResource(ctx, githuburl.Join("orgs", org), authHeader)
+	if err != nil || !found {
+		return nil, found, err
+	}
+
+	orgID, _, err := readTeamIdentity(orgBody)
+	if err != nil {
+		return nil, false, err
+	}
+
+	url := githuburl.Join("organizations", strconv.FormatInt(orgID, 10), "team", strconv.FormatInt(teamID, 10))
+	return h.getGitHubResource(ctx, url, authHeader)
+}
+
+// resolveParentTeamID translates the `parent_slug` of a request body into a numeric team ID.
+// It returns whether the parent has to be set (or removed, when the returned ID is 0).
+func (h *baseHandler) resolveParentTeamID(ctx context.Context, org, authHeader string, body []byte) (bool, int64, error) {
+	parentSlug, parentSet, err := ReadParentSlug(body)
+	if err != nil || !parentSet || parentSlug == "" {
+		return parentSet, 0, err
+	}
+
+	url := githuburl.Join("orgs", org, "teams", parentSlug)
+	parentBody, found, err := h.getGitHubResource(ctx, url, authHeader)
+	if err != nil {
+		return true, 0, err
+	}
+	if !found {
+		return true, 0, fmt.Errorf("parent team %s not found in organization %s", parentSlug, org)
+	}
+
+	parentID, _, err := readTeamIdentity(parentBody)
+	if err != nil {
+		return true, 0, err
+	}
+	return true, parentID, nil
+}
+
+// prepareRequestBody resolves the parent team and translates the request body for the GitHub Teams API
+func (h *baseHandler) prepareRequestBody(w http.ResponseWriter, r *http.Request, org, authHeader string, body []byte) ([]byte, bool) {
+	parentSet, parentID, err := h.resolveParentTeamID(r.Context(), org, authHeader, body)
+	if err != nil {
+		if h.forwardGitHubError(w, r, err) {
+			return nil, false
+		}
+		var invalidName *githuburl.Error
+		if errors.As(err, &invalidName) {
+			h.writeErrorResponse(w, r, http.StatusBadRequest, fmt.Sprintf("Invalid request body: %v", err))
+			return nil, false
+		}
+		h.writeErrorResponse(w, r, http.StatusUnprocessableEntity, fmt.Sprintf("Error resolving parent team: %v", err))
+		return nil, false
+	}
+
+	upstreamBody, err := PrepareTeamRequestBody(body, parentSet, parentID)
+	if err != nil {
+		h.writeErrorResponse(w, r, http.StatusUnprocessableEntity, fmt.Sprintf("Error preparing request body: %v", err))
+		return nil, false
+	}
+	return upstreamBody, true
+}
+
+func (h *baseHandler) writeErrorResponse(w http.ResponseWriter, r *http.Request, statusCode int, message string) {
+	handlers.LogStatus(h.Logger(r.Context()), statusCode).Msg(message)
+	handlers.WriteError(w, r, statusCode, message)
+}
+
+func (h *baseHandler) writeJSONResponse(w http.ResponseWriter, statusCode int, body []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(body)
+}
+
+func (h *baseHandler) writeMessageResponse(w http.ResponseWriter, r *http.Request, statusCode int, message string) {
+	h.Logger(r.Context()).Debug().Msg(message)
+	finalBody, err := addFieldToResponse([]byte("{}"), "message", message)
+	if err != nil {
+		h.Logger(r.Context()).Warn().Msgf("Failed to add message field: %v", err)
+		finalBody = []byte("{}")
+	}
+	h.writeJSONResponse(w, statusCode, finalBody)
+}
+
+// writeTeamResponse normalizes a GitHub team response and writes it along with a message
+func (h *baseHandler) writeTeamResponse(w http.ResponseWriter, r *http.Request, statusCode int, body []byte, message string) {
+	normalizedBody, err := NormalizeTeamResponse(body)
+	if err != nil {
+		h.Logger(r.Context()).Warn().Msgf("Failed to process response, returning original: %v", err)
+		h.writeJSONResponse(w, statusCode, body)
+		return
+	}
+
+	finalBody, err := addFieldToResponse(normalizedBody, "message", message)
+	if err != nil {
+		h.Logger(r.Context()).Warn().Msgf("Failed to add message field, returning normalized response: %v", err)
+		finalBody = normalizedBody
+	}
+	h.writeJSONResponse(w, statusCode, finalBody)
+}
+
+// forwardGitHubError forwards a GitHub API error response, if err carries one
+func (h *baseHandler) forwardGitHubError(w http.ResponseWriter, r *http.Request, err error) bool {
+	var ghErr *githubError
+	if !errors.As(err, &ghErr) {
+		return false
+	}
+
+	h.Logger(r.Context()).Warn().Msgf("GitHub API returned error %d", ghErr.StatusCode)
+	handlers.WriteUpstreamError(w, r, ghErr.StatusCode, ghErr.Body, fmt.Sprintf("GitHub API returned error %d", ghErr.StatusCode))
+	return true
+}
+
+// readTeamID reads the optional `team_id` query parameter
+func readTeamID(r *http.Request) (int64, error) {
+	value := r.URL.Query().Get("team_id")
+	if value == "" {
+		return 0, nil
+	}
+	teamID, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || teamID <= 0 {
+		return 0, fmt.Errorf("invalid team_id %q", value)
+	}
+	return teamID, nil
+}
+
+// lookupTeam reads the team identity from the request and resolves it, writing the response when it cannot be resolved
+func (h *baseHandler) lookupTeam(w http.ResponseWriter, r *http.Request) (*resolvedTeam, bool) {
+	org := r.PathValue("org")
+	teamSlug := r.PathValue("team_slug")
+	authHeader := r.Header.Get("Authorization")
+
+	teamID, err := readTeamID(r)
+	if err != nil {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, fmt.Sprintf("Error reading team_id query parameter: %v", err))
+		return nil, false
+	}
+
+	team, found, err := h.resolveTeam(r.Context(), org, teamSlug, teamID, authHeader)
+	if err != nil {
+		if !h.forwardGitHubError(w, r, err) {
+			h.writeErrorResponse(w, r, handlers.StatusForError(err), fmt.Sprintf("Error getting team: %v", err))
+		}
+		return nil, false
+	}
+
+	if !found {
+		h.writeErrorResponse(w, r, http.StatusNotFound, fmt.Sprintf("Team %s not found in organization %s", teamSlug, org))
+		return nil, false
+	}
+
+	return team, true
+}
+
+// GET handler implementation
+// @Summary Get a team
+// @Description Get a team of an organization, following renames when the team ID is provided
+// @ID get-team
+// @Param org path string true "Organization of the team"
+// @Param team_slug path string true "Slug of the team"
+// @Param team_id query int false "Stable ID of the team, used to detect renames"
+// @Produce json
+// @Success 200 {object} team.Team
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden by the plugin policy (policy_violation, with the rule in policy_rule)"
+// @Failure 404 {object} handlers.ErrorResponse "Team not found"
+// @Router /team/orgs/{org}/teams/{team_slug} [get]
+func (h *getHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	org := r.PathValue("org")
+	teamSlug := r.PathValue("team_slug")
+
+	h.Logger(r.Context()).Debug().Msgf("Getting team %s in organization %s", teamSlug, org)
+
+	team, ok := h.lookupTeam(w, r)
+	if !ok {
+		return
+	}
+
+	message := fmt.Sprintf("Team %s found in organization %s", team.Slug, org)
+	if team.RenamedFrom != "" {
+		message = fmt.Sprintf("Team %s found in organization %s (renamed from %s)", team.Slug, org, team.RenamedFrom)
+	}
+	h.writeTeamResponse(w, r, http.StatusOK, team.Body, message)
+	h.Logger(r.Context()).Debug().Msgf("Successfully retrieved team %s", team.Slug)
+}
+
+// POST handler implementation
+// @Summary Create a team
+// @Description Create a team in an organization, the parent team is given by slug
+// @ID post-team
+// @Param org path string true "Organization of the team"
+// @Param team body team.TeamRequest true "Team to create"
+// @Param dry_run query bool false "Return the upstream requests that would be sent, without sending them (also X-Dry-Run header)"
+// @Param Idempotency-Key header string false "Key to replay the response of a retried request"
+// @Accept json
+// @Produce json
+// @Success 201 {object} team.Team "Team created"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden by the plugin policy (policy_violation, with the rule in policy_rule)"
+// @Failure 422 {object} handlers.ErrorResponse "Parent team not found or invalid privacy"
+// @Router /team/orgs/{org}/teams [post]
+func (h *postHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	org := r.PathValue("org")
+	authHeader := r.Header.Get("Authorization")
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, fmt.Sprintf("Error reading request body: %v", err))
+		return
+	}
+	defer r.Body.Close()
+
+	name, err := readStringField(body, "name")
+	if err != nil {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, fmt.Sprintf("Error reading name from request body: %v", err))
+		return
+	}
+
+	h.Logger(r.Context()).Debug().Msgf("Creating team %s in organization %s", name, org)
+
+	upstreamBody, ok := h.prepareRequestBody(w, r, org, authHeader, body)
+	if !ok {
+		return
+	}
+
+	url := githuburl.Join("orgs", org, "teams")
+	resp, err := h.makeGitHubRequest(r.Context(), "POST", url, authHeader, upstreamBody)
+	if err != nil {
+		h.writeErrorResponse(w, r, handlers.StatusForError(err), fmt.Sprintf("Error creating team: %v", err))
+		return
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		h.writeErrorResponse(w, r, handlers.StatusForError(err), fmt.Sprintf("Error creating team: %v", err))
+		return
+	}
+
+	if resp.StatusCode != http.StatusCreated {
+		h.forwardGitHubError(w, r, &githubError{StatusCode: resp.StatusCode, Body: respBody})
+		return
+	}
+
+	h.writeTeamResponse(w, r, http.StatusCreated, respBody, fmt.Sprintf("Team %s created successfully in organization %s", name, org))
+	h.Logger(r.Context()).Debug().Msgf("Successfully created team %s", name)
+}
+
+// PATCH handler implementation
+// @Summary Update a team
+// @Description Update a team of an organization, the parent team is given by slug (empty or null to remove it)
+// @ID patch-team
+// @Param org path string true "Organization of the team"
+// @Param team_slug path string true "Slug of the team"
+// @Param team_id query int false "Stable ID of the team, used to detect renames"
+// @Param team body team.TeamRequest true "Team fields to update"
+// @Param dry_run query bool false "Return the upstream requests that would be sent, without sending them (also X-Dry-Run header)"
+// @Param Idempotency-Key header string false "Key to replay the response of a retried request"
+// @Accept json
+// @Produce json
+// @Success 200 {object} team.Team "Team updated successfully"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden by the plugin policy (policy_violation, with the rule in policy_rule)"
+// @Failure 404 {object} handlers.ErrorResponse "Team not found"
+// @Failure 422 {object} handlers.ErrorResponse "Parent team not found or invalid privacy"
+// @Router /team/orgs/{org}/teams/{team_slug} [patch]
+func (h *patchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	org := r.PathValue("org")
+	teamSlug := r.PathValue("team_slug")
+	authHeader := r.Header.Get("Authorization")
+
+	h.Logger(r.Context()).Debug().Msgf("Updating team %s in organization %s", teamSlug, org)
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, fmt.Sprintf("Error reading request body: %v", err))
+		return
+	}
+	defer r.Body.Close()
+
+	team, ok := h.lookupTeam(w, r)
+	if !ok {
+		return
+	}
+
+	upstreamBody, ok := h.prepareRequestBody(w, r, org, authHeader, body)
+	if !ok {
+		return
+	}
+
+	url := githuburl.Join("orgs", org, "teams", team.Slug)
+	resp, err := h.makeGitHubRequest(r.Context(), "PATCH", url, authHeader, upstreamBody)
+	if err != nil {
+		h.writeErrorResponse(w, r, handlers.StatusForError(err), fmt.Sprintf("Error updating team: %v", err))
+		return
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		h.writeErrorResponse(w, r, handlers.StatusForError(err), fmt.Sprintf("Error updating team: %v", err))
+		return
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		h.forwardGitHubError(w, r, &githubError{StatusCode: resp.StatusCode, Body: respBody})
+		return
+	}
+
+	h.writeTeamResponse(w, r, http.StatusOK, respBody, fmt.Sprintf("Team %s updated successfully in organization %s", team.Slug, org))
+	h.Logger(r.Context()).Debug().Msgf("Successfully updated team %s", team.Slug)
+}
+
+// DELETE handler implementation
+// @Summary Delete a team
+// @Description Delete a team of an organization, following renames when the team ID is provided
+// @ID delete-team
+// @Param org path string true "Organization of the team"
+// @Param team_slug path string true "Slug of the team"
+// @Param team_id query int false "Stable ID of the team, used to detect renames"
+// @Param dry_run query bool false "Return the upstream requests that would be sent, without sending them (also X-Dry-Run header)"
+// @Param Idempotency-Key header string false "Key to replay the response of a retried request"
+// @Produce json
+// @Success 200 {object} team.Message "Team deleted successfully"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden by the plugin policy (policy_violation, with the rule in policy_rule)"
+// @Failure 404 {object} handlers.ErrorResponse "Team not found"
+// @Router /team/orgs/{org}/teams/{team_slug} [delete]
+func (h *deleteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	org := r.PathValue("org")
+	teamSlug := r.PathValue("team_slug")
+	authHeader := r.Header.Get("Authorization")
+
+	h.Logger(r.Context()).Debug().Msgf("Deleting team %s in organization %s", teamSlug, org)
+
+	team, ok := h.lookupTeam(w, r)
+	if !ok {
+		return
+	}
+
+	url := githuburl.Join("orgs", org, "teams", team.Slug)
+	resp, err := h.makeGitHubRequest(r.Context(), "DELETE", url, authHeader, nil)
+	if err != nil {
+		h.writeErrorResponse(w, r, handlers.StatusForError(err), fmt.Sprintf("Error deleting team: %v", err))
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		respBody, _ := io.ReadAll(resp.Body)
+		h.forwardGitHubError(w, r, &githubError{StatusCode: resp.StatusCode, Body: respBody})
+		return
+	}
+
+	h.writeMessageResponse(w, r, http.StatusOK, fmt.Sprintf("Team %s deleted successfully from organization %s", team.Slug, org))
+}
@@ -0,0 +1,598 @@
+package team
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/handlers"
+	"github.com/rs/zerolog"
+)
+
+// mockHTTPClient implements http.Client's Do method for testing
+// this is needed for external API calls in the handler
+// it allows us to simulate responses and errors without making real HTTP requests (e.g., for GitHub API calls).
+// Responses are keyed by method and URL since the Teams API uses the same URL for GET, PATCH and DELETE.
+type mockHTTPClient struct {
+	responses map[string]mockResponse
+	errors    map[string]error
+	requests  []*http.Request
+	bodies    []string
+}
+
+type mockResponse struct {
+	statusCode int
+	body       string
+}
+
+// newMockHTTPClient creates a new instance of mockHTTPClient
+// with empty maps for responses and errors
+// and an empty slice for requests.
+func newMockHTTPClient() *mockHTTPClient {
+	return &mockHTTPClient{
+		responses: make(map[string]mockResponse),
+		errors:    make(map[string]error),
+		requests:  make([]*http.Request, 0),
+	}
+}
+
+// Do implements the http.Client Do method for mockHTTPClient.
+// It simulates sending an HTTP request and returns a response or an error
+func (m *mockHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	// Store the request (and its body) for verification
+	m.requests = append(m.requests, req)
+	body := ""
+	if req.Body != nil {
+		b, _ := io.ReadAll(req.Body)
+		body = string(b)
+	}
+	m.bodies = append(m.bodies, body)
+
+	key := req.Method + " " + req.URL.String()
+
+	// Check if there's an error configured for this URL
+	if err, exists := m.errors[key]; exists {
+		return nil, err
+	}
+
+	// Return configured response or default 404
+	if resp, exists := m.responses[key]; exists {
+		return &http.Response{
+			StatusCode: resp.statusCode,
+			Body:       io.NopCloser(strings.NewReader(resp.body)),
+			Header:     make(http.Header),
+		}, nil
+	}
+
+	// Default response
+	return &http.Response{
+		StatusCode: http.StatusNotFound,
+		Body:       io.NopCloser(strings.NewReader(`{"message": "Not Found"}`)),
+		Header:     make(http.Header),
+	}, nil
+}
+
+// setResponse allows setting a predefined response for a specific method and URL
+func (m *mockHTTPClient) setResponse(method, url string, statusCode int, body string) {
+	m.responses[method+" "+url] = mockResponse{statusCode: statusCode, body: body}
+}
+
+func (m *mockHTTPClient) setError(method, url string, err error) {
+	m.errors[method+" "+url] = err
+}
+
+func (m *mockHTTPClient) getRequestCount() int {
+	return len(m.requests)
+}
+
+// lastBody returns the body sent with the last request having the given method
+func (m *mockHTTPClient) lastBody(method string) string {
+	for i := len(m.requests) - 1; i >= 0; i-- {
+		if m.requests[i].Method == method {
+			return m.bodies[i]
+		}
+	}
+	return ""
+}
+
+// Test data constants
+const (
+	testOrg        = "testorg"
+	testOrgID      = 1000
+	testTeamSlug   = "test-team"
+	testTeamID     = 42
+	testParentSlug = "parent-team"
+	testParentID   = 7
+	testToken      = "token test-token-123"
+)
+
+var (
+	teamExternalURL       = fmt.Sprintf("https://api.github.com/orgs/%s/teams/%s", testOrg, testTeamSlug)
+	renamedExternalURL    = fmt.Sprintf("https://api.github.com/orgs/%s/teams/%s", testOrg, "renamed-team")
+	parentExternalURL     = fmt.Sprintf("https://api.github.com/orgs/%s/teams/%s", testOrg, testParentSlug)
+	teamsExternalURL      = fmt.Sprintf("https://api.github.com/orgs/%s/teams", testOrg)
+	orgExternalURL        = fmt.Sprintf("https://api.github.com/orgs/%s", testOrg)
+	teamByIDExternalURL   = fmt.Sprintf("https://api.github.com/organizations/%d/team/%d", testOrgID, testTeamID)
+	validOrgResp          = fmt.Sprintf(`{"login": "%s", "id": %d}`, testOrg, testOrgID)
+	validParentResp       = fmt.Sprintf(`{"id": %d, "slug": "%s", "name": "Parent Team", "privacy": "closed", "parent": null}`, testParentID, testParentSlug)
+	validTeamResp         = fmt.Sprintf(`{"id": %d, "slug": "%s", "name": "Test Team", "privacy": "secret", "parent": null}`, testTeamID, testTeamSlug)
+	validNestedTeamResp   = fmt.Sprintf(`{"id": %d, "slug": "%s", "name": "Test Team", "privacy": "closed", "parent": {"id": %d, "slug": "%s"}}`, testTeamID, testTeamSlug, testParentID, testParentSlug)
+	validRenamedTeamResp  = fmt.Sprintf(`{"id": %d, "slug": "renamed-team", "name": "Renamed Team", "privacy": "secret", "parent": null}`, testTeamID)
+	otherTeamWithSlugResp = fmt.Sprintf(`{"id": 99, "slug": "%s", "name": "Test Team", "privacy": "secret", "parent": null}`, testTeamSlug)
+)
+
+func newTestOptions(client handlers.HTTPClient) handlers.HandlerOptions {
+	logger := zerolog.New(io.Discard).With().Timestamp().Logger()
+	return handlers.HandlerOptions{
+		Client: client,
+		Log:    &logger,
+	}
+}
+
+// serve executes a request through a ServeMux so that path values are properly set
+func serve(pattern string, h handlers.Handler, method, path, body string) *httptest.ResponseRecorder {
+	mux := http.NewServeMux()
+	mux.Handle(pattern, h)
+
+	var reqBody io.Reader
+	if body != "" {
+		reqBody = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, path, reqBody)
+	req.Header.Set("Authorization", testToken)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	return rr
+}
+
+// Test handler constructors
+func TestConstructors(t *testing.T) {
+	client := &http.Client{}
+	logger := zerolog.New(os.Stdout).With().Timestamp().Logger()
+	opts := handlers.HandlerOptions{
+		Client: client,
+		Log:    &logger,
+	}
+
+	if h, ok := GetTeam(opts).(*getHandler); !ok || h.Client != client {
+		t.Error("GetTeam should return a *getHandler with the provided client")
+	}
+	if _, ok := PostTeam(opts).(*postHandler); !ok {
+		t.Error("PostTeam should return a *postHandler")
+	}
+	if _, ok := PatchTeam(opts).(*patchHandler); !ok {
+		t.Error("PatchTeam should return a *patchHandler")
+	}
+	if _, ok := DeleteTeam(opts).(*deleteHandler); !ok {
+		t.Error("DeleteTeam should return a *deleteHandler")
+	}
+}
+
+// GET Handler Tests
+func TestGetHandler_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name                 string
+		query                string
+		setupMock            func(*mockHTTPClient)
+		expectedStatus       int
+		expectedBodyContains []string
+		expectedRequestCount int
+	}{
+		{
+			name: "team without parent",
+			setupMock: func(m *mockHTTPClient) {
+				m.setResponse("GET", teamExternalURL, http.StatusOK, validTeamResp)
+			},
+			expectedStatus:       http.StatusOK,
+			expectedBodyContains: []string{`"parent_slug":null`, `"slug":"test-team"`},
+			expectedRequestCount: 1,
+		},
+		{
+			name: "nested team reports parent_slug",
+			setupMock: func(m *mockHTTPClient) {
+				m.setResponse("GET", teamExternalURL, http.StatusOK, validNestedTeamResp)
+			},
+			expectedStatus:       http.StatusOK,
+			expectedBodyContains: []string{`"parent_slug":"parent-team"`},
+			expectedRequestCount: 1,
+		},
+		{
+			name: "team not found",
+			setupMock: func(m *mockHTTPClient) {
+			},
+			expectedStatus:       http.StatusNotFound,
+			expectedBodyContains: []string{"Team test-team not found in organization testorg"},
+			expectedRequestCount: 1,
+		},
+		{
+			name:  "renamed team is found through its ID",
+			query: fmt.Sprintf("?team_id=%d", testTeamID),
+			setupMock: func(m *mockHTTPClient) {
+				m.setResponse("GET", orgExternalURL, http.StatusOK, validOrgResp)
+				m.setResponse("GET", teamByIDExternalURL, http.StatusOK, validRenamedTeamResp)
+			},
+			expectedStatus:       http.StatusOK,
+			expectedBodyContains: []string{`"slug":"renamed-team"`, "renamed from test-team"},
+			expectedRequestCount: 3,
+		},
+		{
+			name:  "slug taken over by another team",
+			query: fmt.Sprintf("?team_id=%d", testTeamID),
+			setupMock: func(m *mockHTTPClient) {
+				m.setResponse("GET", teamExternalURL, http.StatusOK, otherTeamWithSlugResp)
+				m.setResponse("GET", orgExternalURL, http.StatusOK, validOrgResp)
+				m.setResponse("GET", teamByIDExternalURL, http.StatusOK, validRenamedTeamResp)
+			},
+			expectedStatus:       http.StatusOK,
+			expectedBodyContains: []string{fmt.Sprintf(`"id":%d`, testTeamID), `"slug":"renamed-team"`},
+			expectedRequestCount: 3,
+		},
+		{
+			name:  "team deleted and ID not found",
+			query: fmt.Sprintf("?team_id=%d", testTeamID),
+			setupMock: func(m *mockHTTPClient) {
+				m.setResponse("GET", orgExternalURL, http.StatusOK, validOrgResp)
+			},
+			expectedStatus:       http.StatusNotFound,
+			expectedBodyContains: []string{"not found"},
+			expectedRequestCount: 3,
+		},
+		{
+			name:                 "invalid team_id",
+			query:                "?team_id=abc",
+			setupMock:            func(m *mockHTTPClient) {},
+			expectedStatus:       http.StatusBadRequest,
+			expectedBodyContains: []string{"Error reading team_id query parameter"},
+			expectedRequestCount: 0,
+		},
+		{
+			name: "github api error is forwarded",
+			setupMock: func(m *mockHTTPClient) {
+				m.setResponse("GET", teamExternalURL, http.StatusForbidden, `{"message": "Must have admin rights"}`)
+			},
+			expectedStatus:       http.StatusForbidden,
+			expectedBodyContains: []string{"Must have admin rights"},
+			expectedRequestCount: 1,
+		},
+		{
+			name: "network error",
+			setupMock: func(m *mockHTTPClient) {
+				m.setError("GET", teamExternalURL, fmt.Errorf("network error"))
+			},
+			expectedStatus:       http.StatusInternalServerError,
+			expectedBodyContains: []string{"Error getting team"},
+			expectedRequestCount: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := newMockHTTPClient()
+			tt.setupMock(mockClient)
+
+			path := fmt.Sprintf("/team/orgs/%s/teams/%s%s", testOrg, testTeamSlug, tt.query)
+			rr := serve("GET /team/orgs/{org}/teams/{team_slug}", GetTeam(newTestOptions(mockClient)), "GET", path, "")
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tt.expectedStatus)
+			}
+			for _, want := range tt.expectedBodyContains {
+				if !strings.Contains(rr.Body.String(), want) {
+					t.Errorf("handler response body does not contain expected content.\nGot: %s\nWant to contain: %s", rr.Body.String(), want)
+				}
+			}
+			if mockClient.getRequestCount() != tt.expectedRequestCount {
+				t.Errorf("expected %d requests, got %d", tt.expectedRequestCount, mockClient.getRequestCount())
+			}
+		})
+	}
+}
+
+// POST Handler Tests
+func TestPostHandler_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name                 string
+		requestBody          string
+		setupMock            func(*mockHTTPClient)
+		expectedStatus       int
+		expectedBodyContains string
+		expectedUpstreamBody map[string]interface{}
+		expectedRequestCount int
+	}{
+		{
+			name:        "team without parent",
+			requestBody: `{"name": "Test Team", "privacy": "secret"}`,
+			setupMock: func(m *mockHTTPClient) {
+				m.setResponse("POST", teamsExternalURL, http.StatusCreated, validTeamResp)
+			},
+			expectedStatus:       http.StatusCreated,
+			expectedBodyContains: "created successfully",
+			expectedUpstreamBody: map[string]interface{}{"name": "Test Team", "privacy": "secret"},
+			expectedRequestCount: 1,
+		},
+		{
+			name:        "nested team gets parent_team_id and closed privacy",
+			requestBody: `{"name": "Test Team", "parent_slug": "parent-team"}`,
+			setupMock: func(m *mockHTTPClient) {
+				m.setResponse("GET", parentExternalURL, http.StatusOK, validParentResp)
+				m.setResponse("POST", teamsExternalURL, http.StatusCreated, validNestedTeamResp)
+			},
+			expectedStatus:       http.StatusCreated,
+			expectedBodyContains: `"parent_slug":"parent-team"`,
+			expectedUpstreamBody: map[string]interface{}{"name": "Test Team", "privacy": "closed", "parent_team_id": float64(testParentID)},
+			expectedRequestCount: 2,
+		},
+		{
+			name:                 "nested team with secret privacy is rejected",
+			requestBody:          `{"name": "Test Team", "privacy": "secret", "parent_slug": "parent-team"}`,
+			setupMock:            func(m *mockHTTPClient) { m.setResponse("GET", parentExternalURL, http.StatusOK, validParentResp) },
+			expectedStatus:       http.StatusUnprocessableEntity,
+			expectedBodyContains: "cannot have privacy 'secret'",
+			expectedRequestCount: 1,
+		},
+		{
+			name:                 "parent team not found",
+			requestBody:          `{"name": "Test Team", "parent_slug": "parent-team"}`,
+			setupMock:            func(m *mockHTTPClient) {},
+			expectedStatus:       http.StatusUnprocessableEntity,
+			expectedBodyContains: "parent team parent-team not found",
+			expectedRequestCount: 1,
+		},
+		{
+			name:                 "missing name",
+			requestBody:          `{"privacy": "closed"}`,
+			setupMock:            func(m *mockHTTPClient) {},
+			expectedStatus:       http.StatusBadRequest,
+			expectedBodyContains: "Error reading name from request body",
+			expectedRequestCount: 0,
+		},
+		{
+			name:        "github api error is forwarded",
+			requestBody: `{"name": "Test Team"}`,
+			setupMock: func(m *mockHTTPClient) {
+				m.setResponse("POST", teamsExternalURL, http.StatusUnprocessableEntity, `{"message": "Validation Failed"}`)
+			},
+			expectedStatus:       http.StatusUnprocessableEntity,
+			expectedBodyContains: "Validation Failed",
+			expectedRequestCount: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := newMockHTTPClient()
+			tt.setupMock(mockClient)
+
+			path := fmt.Sprintf("/team/orgs/%s/teams", testOrg)
+			rr := serve("POST /team/orgs/{org}/teams", PostTeam(newTestOptions(mockClient)), "POST", path, tt.requestBody)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tt.expectedStatus)
+			}
+			if !strings.Contains(rr.Body.String(), tt.expectedBodyContains) {
+				t.Errorf("handler response body does not contain expected content.\nGot: %s\nWant to contain: %s", rr.Body.String(), tt.expectedBodyContains)
+			}
+			if mockClient.getRequestCount() != tt.expectedRequestCount {
+				t.Errorf("expected %d requests, got %d", tt.expectedRequestCount, mockClient.getRequestCount())
+			}
+			if tt.expectedUpstreamBody != nil {
+				var got map[string]interface{}
+				if err := json.Unmarshal([]byte(mockClient.lastBody("POST")), &got); err != nil {
+					t.Fatalf("failed to unmarshal upstream body: %v", err)
+				}
+				for key, want := range tt.expectedUpstreamBody {
+					if got[key] != want {
+						t.Errorf("upstream body field %s = %v, want %v", key, got[key], want)
+					}
+				}
+				if _, exists := got["parent_slug"]; exists {
+					t.Error("upstream body should not contain parent_slug")
+				}
+			}
+		})
+	}
+}
+
+// PATCH Handler Tests
+func TestPatchHandler_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name                 string
+		query                string
+		requestBody          string
+		setupMock            func(*mockHTTPClient)
+		expectedStatus       int
+		expectedBodyContains string
+		expectedUpstreamBody map[string]interface{}
+		expectedRequestCount int
+	}{
+		{
+			name:        "update description",
+			requestBody: `{"description": "new"}`,
+			setupMock: func(m *mockHTTPClient) {
+				m.setResponse("GET", teamExternalURL, http.StatusOK, validTeamResp)
+				m.setResponse("PATCH", teamExternalURL, http.StatusOK, validTeamResp)
+			},
+			expectedStatus:       http.StatusOK,
+			expectedBodyContains: "updated successfully",
+			expectedUpstreamBody: map[string]interface{}{"description": "new"},
+			expectedRequestCount: 2,
+		},
+		{
+			name:        "remove parent",
+			requestBody: `{"parent_slug": null}`,
+			setupMock: func(m *mockHTTPClient) {
+				m.setResponse("GET", teamExternalURL, http.StatusOK, validNestedTeamResp)
+				m.setResponse("PATCH", teamExternalURL, http.StatusOK, validTeamResp)
+			},
+			expectedStatus:       http.StatusOK,
+			expectedBodyContains: `"parent_slug":null`,
+			expectedUpstreamBody: map[string]interface{}{"parent_team_id": nil},
+			expectedRequestCount: 2,
+		},
+		{
+			name:        "renamed team is patched through its current slug",
+			query:       fmt.Sprintf("?team_id=%d", testTeamID),
+			requestBody: `{"description": "new"}`,
+			setupMock: func(m *mockHTTPClient) {
+				m.setResponse("GET", orgExternalURL, http.StatusOK, validOrgResp)
+				m.setResponse("GET", teamByIDExternalURL, http.StatusOK, validRenamedTeamResp)
+				m.setResponse("PATCH", renamedExternalURL, http.StatusOK, validRenamedTeamResp)
+			},
+			expectedStatus:       http.StatusOK,
+			expectedBodyContains: `"slug":"renamed-team"`,
+			expectedRequestCount: 4,
+		},
+		{
+			name:                 "team not found",
+			requestBody:          `{"description": "new"}`,
+			setupMock:            func(m *mockHTTPClient) {},
+			expectedStatus:       http.StatusNotFound,
+			expectedBodyContains: "not found",
+			expectedRequestCount: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := newMockHTTPClient()
+			tt.setupMock(mockClient)
+
+			path := fmt.Sprintf("/team/orgs/%s/teams/%s%s", testOrg, testTeamSlug, tt.query)
+			rr := serve("PATCH /team/orgs/{org}/teams/{team_slug}", PatchTeam(newTestOptions(mockClient)), "PATCH", path, tt.requestBody)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tt.expectedStatus)
+			}
+			if !strings.Contains(rr.Body.String(), tt.expectedBodyContains) {
+				t.Errorf("handler response body does not contain expected content.\nGot: %s\nWant to contain: %s", rr.Body.String(), tt.expectedBodyContains)
+			}
+			if mockClient.getRequestCount() != tt.expectedRequestCount {
+				t.Errorf("expected %d requests, got %d", tt.expectedRequestCount, mockClient.getRequestCount())
+			}
+			if tt.expectedUpstreamBody != nil {
+				var got map[string]interface{}
+				if err := json.Unmarshal([]byte(mockClient.lastBody("PATCH")), &got); err != nil {
+					t.Fatalf("failed to unmarshal upstream body: %v", err)
+				}
+				for key, want := range tt.expectedUpstreamBody {
+					if value, exists := got[key]; !exists || value != want {
+						t.Errorf("upstream body field %s = %v, want %v", key, value, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+// DELETE Handler Tests
+func TestDeleteHandler_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name                 string
+		setupMock            func(*mockHTTPClient)
+		expectedStatus       int
+		expectedBodyContains string
+		expectedRequestCount int
+	}{
+		{
+			name: "successful deletion",
+			setupMock: func(m *mockHTTPClient) {
+				m.setResponse("GET", teamExternalURL, http.StatusOK, validTeamResp)
+				m.setResponse("DELETE", teamExternalURL, http.StatusNoContent, "")
+			},
+			expectedStatus:       http.StatusOK,
+			expectedBodyContains: "deleted successfully",
+			expectedRequestCount: 2,
+		},
+		{
+			name:                 "team not found",
+			setupMock:            func(m *mockHTTPClient) {},
+			expectedStatus:       http.StatusNotFound,
+			expectedBodyContains: "not found",
+			expectedRequestCount: 1,
+		},
+		{
+			name: "github api error is forwarded",
+			setupMock: func(m *mockHTTPClient) {
+				m.setResponse("GET", teamExternalURL, http.StatusOK, validTeamResp)
+				m.setResponse("DELETE", teamExternalURL, http.StatusForbidden, `{"message": "Must have admin rights"}`)
+			},
+			expectedStatus:       http.StatusForbidden,
+			expectedBodyContains: "Must have admin rights",
+			expectedRequestCount: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := newMockHTTPClient()
+			tt.setupMock(mockClient)
+
+			path := fmt.Sprintf("/team/orgs/%s/teams/%s", testOrg, testTeamSlug)
+			rr := serve("DELETE /team/orgs/{org}/teams/{team_slug}", DeleteTeam(newTestOptions(mockClient)), "DELETE", path, "")
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tt.expectedStatus)
+			}
+			if !strings.Contains(rr.Body.String(), tt.expectedBodyContains) {
+				t.Errorf("handler response body does not contain expected content.\nGot: %s\nWant to contain: %s", rr.Body.String(), tt.expectedBodyContains)
+			}
+			if mockClient.getRequestCount() != tt.expectedRequestCount {
+				t.Errorf("expected %d requests, got %d", tt.expectedRequestCount, mockClient.getRequestCount())
+			}
+		})
+	}
+}
+
+func TestPrepareTeamRequestBody(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		parentSet bool
+		parentID  int64
+		expected  map[string]interface{}
+		expectErr bool
+	}{
+		{name: "parent untouched", body: `{"name": "a", "privacy": "secret"}`, expected: map[string]interface{}{"name": "a", "privacy": "secret"}},
+		{name: "parent set, privacy defaults to closed", body: `{"parent_slug": "p"}`, parentSet: true, parentID: 3, expected: map[string]interface{}{"parent_team_id": float64(3), "privacy": "closed"}},
+		{name: "parent set, explicit closed privacy", body: `{"parent_slug": "p", "privacy": "closed"}`, parentSet: true, parentID: 3, expected: map[string]interface{}{"parent_team_id": float64(3), "privacy": "closed"}},
+		{name: "parent removed", body: `{"parent_slug": ""}`, parentSet: true, expected: map[string]interface{}{"parent_team_id": nil}},
+		{name: "parent set with secret privacy", body: `{"parent_slug": "p", "privacy": "secret"}`, parentSet: true, parentID: 3, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := PrepareTeamRequestBody([]byte(tt.body), tt.parentSet, tt.parentID)
+			if tt.expectErr {
+				if err == nil {
+					t.Fatal("expected error but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var got map[string]interface{}
+			if err := json.Unmarshal(out, &got); err != nil {
+				t.Fatalf("failed to unmarshal output: %v", err)
+			}
+			if len(got) != len(tt.expected) {
+				t.Errorf("got %v, want %v", got, tt.expected)
+			}
+			for key, want := range tt.expected {
+				if value, exists := got[key]; !exists || value != want {
+					t.Errorf("field %s = %v, want %v", key, value, want)
+				}
+			}
+		})
+	}
+}
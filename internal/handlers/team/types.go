@@ -0,0 +1,52 @@
+package team
+
+type Parent struct {
+	ID                  int    `json:"id"`
+	NodeID              string `json:"node_id"`
+	URL                 string `json:"url"`
+	HTMLURL             string `json:"html_url"`
+	Name                string `json:"name"`
+	Slug                string `json:"slug"`
+	Description         string `json:"description"`
+	Privacy             string `json:"privacy"`
+	NotificationSetting string `json:"notification_setting"`
+	Permission          string `json:"permission"`
+	MembersURL          string `json:"members_url"`
+	RepositoriesURL     string `json:"repositories_url"`
+}
+
+type Team struct {
+	ID                  int     `json:"id"`
+	NodeID              string  `json:"node_id"`
+	URL                 string  `json:"url"`
+	HTMLURL             string  `json:"html_url"`
+	Name                string  `json:"name"`
+	Slug                string  `json:"slug"`
+	Description         string  `json:"description"`
+	Privacy             string  `json:"privacy"`
+	NotificationSetting string  `json:"notification_setting"`
+	Permission          string  `json:"permission"`
+	MembersURL          string  `json:"members_url"`
+	RepositoriesURL     string  `json:"repositories_url"`
+	Parent              *Parent `json:"parent"`
+	ParentSlug          *string `json:"parent_slug"` // Added
+	MembersCount        int     `json:"members_count"`
+	ReposCount          int     `json:"repos_count"`
+	CreatedAt           string  `json:"created_at"`
+	UpdatedAt           string  `json:"updated_at"`
+	Message             string  `json:"message"`
+}
+
+type TeamRequest struct {
+	Name                string   `json:"name"`
+	Description         string   `json:"description,omitempty"`
+	Privacy             string   `json:"privacy,omitempty"`
+	NotificationSetting string   `json:"notification_setting,omitempty"`
+	Maintainers         []string `json:"maintainers,omitempty"`
+	RepoNames           []string `json:"repo_names,omitempty"`
+	ParentSlug          *string  `json:"parent_slug,omitempty"`
+}
+
+type Message struct {
+	Message string `json:"message"`
+}
@@ -0,0 +1,94 @@
+package teamrepo
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/fakegithub"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/handlers"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/roles"
+	"github.com/rs/zerolog"
+)
+
+const teamRepoPattern = "/teamrepository/orgs/{org}/teams/{team_slug}/repos/{owner}/{repo}"
+
+// serveE2E executes a request against the team repository handlers served with the fake GitHub API
+func serveE2E(opts handlers.HandlerOptions, method, body string) *httptest.ResponseRecorder {
+	mux := http.NewServeMux()
+	mux.Handle("GET "+teamRepoPattern, GetTeamRepo(opts))
+	mux.Handle("POST "+teamRepoPattern, PostTeamRepo(opts))
+	mux.Handle("PATCH "+teamRepoPattern, PatchTeamRepo(opts))
+	mux.Handle("DELETE "+teamRepoPattern, DeleteTeamRepo(opts))
+
+	var reqBody io.Reader
+	if body != "" {
+		reqBody = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, "/teamrepository/orgs/"+testOrg+"/teams/"+testTeamSlug+"/repos/"+testOwner+"/"+testRepo, reqBody)
+	req.Header.Set("Authorization", testToken)
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestE2E_TeamRepoLifecycle(t *testing.T) {
+	fake := fakegithub.New()
+	defer fake.Close()
+	fake.RequireToken(strings.TrimPrefix(testToken, "token "))
+	fake.AddOrg(testOrg)
+	fake.AddOrg(testOwner)
+	fake.AddCustomRole(testOrg, "Security Engineer", fakegithub.RoleMaintain)
+	fake.AddRepo(testOwner, testRepo)
+	fake.AddTeam(testOrg, "Test Team", "")
+
+	logger := zerolog.New(io.Discard)
+	opts := handlers.HandlerOptions{
+		Client: fake.Client(),
+		Log:    &logger,
+		Roles:  roles.NewResolver(fake.Client(), time.Minute),
+	}
+
+	if rr := serveE2E(opts, "GET", ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 before the repository is added, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	if rr := serveE2E(opts, "POST", `{"permission": "triage"}`); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 adding the repository, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if role, _ := fake.TeamRepo(testOrg, testTeamSlug, testOwner, testRepo); role != fakegithub.RoleTriage {
+		t.Errorf("expected role triage, got %s", role)
+	}
+
+	if rr := serveE2E(opts, "PATCH", `{"permission": "security engineer"}`); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 updating to a custom role, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr := serveE2E(opts, "GET", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &data); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if data["permission"] != "Security Engineer" || data["owner"] != testOwner {
+		t.Errorf("expected the custom role for %s, got %v %v", testOwner, data["permission"], data["owner"])
+	}
+
+	if rr := serveE2E(opts, "PATCH", `{"permission": "owner"}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422 for an unknown permission, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	if rr := serveE2E(opts, "DELETE", ""); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 removing the repository, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if _, exists := fake.TeamRepo(testOrg, testTeamSlug, testOwner, testRepo); exists {
+		t.Errorf("expected the repository to be removed from the team")
+	}
+}
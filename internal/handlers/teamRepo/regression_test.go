@@ -0,0 +1,92 @@
+package teamrepo
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/cassette"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/handlers"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/roles"
+	"github.com/rs/zerolog"
+)
+
+// newCassetteOptions returns handler options replaying the named cassette of testdata/cassettes.
+// With CASSETTE_MODE=record the requests are sent to GitHub with the GITHUB_TOKEN token and the cassette is rewritten.
+func newCassetteOptions(t *testing.T, name string) (handlers.HandlerOptions, string) {
+	t.Helper()
+
+	mode, err := cassette.ModeFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	authHeader := testToken
+	if mode == cassette.ModeRecord {
+		authHeader = "token " + os.Getenv("GITHUB_TOKEN")
+	}
+
+	recorder, err := cassette.New(filepath.Join("testdata", "cassettes", name+".yaml"), mode, http.DefaultClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := recorder.Stop(); err != nil {
+			t.Error(err)
+		}
+		if unused := recorder.Unused(); len(unused) > 0 {
+			t.Errorf("recorded interactions were not replayed: %v", unused)
+		}
+	})
+
+	logger := zerolog.New(io.Discard)
+	return handlers.HandlerOptions{
+		Client: recorder,
+		Log:    &logger,
+		Roles:  roles.NewResolver(recorder, time.Minute),
+	}, authHeader
+}
+
+func TestRegression_Cassettes(t *testing.T) {
+	tests := []struct {
+		cassette       string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			cassette:       "custom_role_lowercase",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"permission":"Security Engineer"`,
+		},
+		{
+			cassette:       "team_without_access",
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `"code":"not_found","message":"GitHub API returned error 404 when getting team permission","upstream_status":404,"upstream_message":"Not Found"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cassette, func(t *testing.T) {
+			opts, authHeader := newCassetteOptions(t, tt.cassette)
+
+			mux := http.NewServeMux()
+			mux.Handle("GET "+teamRepoPattern, GetTeamRepo(opts))
+
+			req := httptest.NewRequest("GET", "/teamrepository/orgs/"+testOrg+"/teams/"+testTeamSlug+"/repos/"+testOwner+"/"+testRepo, nil)
+			req.Header.Set("Authorization", authHeader)
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v: %s", rr.Code, tt.expectedStatus, rr.Body.String())
+			}
+			if !strings.Contains(rr.Body.String(), tt.expectedBody) {
+				t.Errorf("expected body to contain %q, got %s", tt.expectedBody, rr.Body.String())
+			}
+		})
+	}
+}
@@ -1,13 +1,15 @@
 package teamrepo
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
-	"strings"
 
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/githuburl"
 	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/handlers"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/roles"
 )
 
 func GetTeamRepo(opts handlers.HandlerOptions) handlers.Handler {
@@ -16,12 +18,45 @@ func GetTeamRepo(opts handlers.HandlerOptions) handlers.Handler {
 	}
 }
 
+func PostTeamRepo(opts handlers.HandlerOptions) handlers.Handler {
+	return &postHandler{
+		HandlerOptions: opts,
+	}
+}
+
+func PatchTeamRepo(opts handlers.HandlerOptions) handlers.Handler {
+	return &patchHandler{
+		HandlerOptions: opts,
+	}
+}
+
+func DeleteTeamRepo(opts handlers.HandlerOptions) handlers.Handler {
+	return &deleteHandler{
+		HandlerOptions: opts,
+	}
+}
+
 var _ handlers.Handler = &handler{}
+var _ handlers.Handler = &postHandler{}
+var _ handlers.Handler = &patchHandler{}
+var _ handlers.Handler = &deleteHandler{}
 
 type handler struct {
 	handlers.HandlerOptions
 }
 
+type postHandler struct {
+	handlers.HandlerOptions
+}
+
+type patchHandler struct {
+	handlers.HandlerOptions
+}
+
+type deleteHandler struct {
+	handlers.HandlerOptions
+}
+
 // @Summary Get the permission of a team in a repository
 // @Description Get the permission of a team in a repository
 // @ID get-team-repo-permission
@@ -31,6 +66,7 @@ type handler struct {
 // @Param repo path string true "Name of the repository"
 // @Produce json
 // @Success 200 {object} teamrepo.TeamRepoPermissions
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden by the plugin policy (policy_violation, with the rule in policy_rule)"
 // @Router /teamrepository/orgs/{org}/teams/{team_slug}/repos/{owner}/{repo} [get]
 // GET /teamrepository/orgs/{org}/teams/{team_slug}/repos/{owner}/{repo}
 func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -39,16 +75,17 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	owner := r.PathValue("owner")
 	repo := r.PathValue("repo")
 
-	h.Log.Println("Calling GitHub TeamRepository API")
+	h.Logger(r.Context()).Debug().Msg("Calling GitHub TeamRepository API")
 
 	auth_header := r.Header.Get("Authorization")
 
 	// https://docs.github.com/en/rest/teams/teams?apiVersion=2022-11-28#check-team-permissions-for-a-repository
 	// /orgs/krateoplatformops/teams/krateo-team/repos/krateoplatformops/azuredevops-oas3
-	req, err := http.NewRequest("GET", "https://api.github.com/orgs/"+org+"/teams/"+teamSlug+"/repos/"+owner+"/"+repo, nil)
+	req, err := http.NewRequestWithContext(r.Context(), "GET", teamRepoURL(org, teamSlug, owner, repo), nil)
 	if err != nil {
-		h.Log.Println(err)
-		w.Write([]byte(fmt.Sprint("Error: ", err)))
+		h.Logger(r.Context()).Error().Err(err).Msg("Error creating request")
+		handlers.WriteError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error creating request: %v", err))
+		return
 	}
 	req.Header.Add("Accept", "application/vnd.github.v3.repository+json")
 
@@ -58,15 +95,18 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	resp, err := h.Client.Do(req)
 	if err != nil {
-		h.Log.Print(err)
-		w.Write([]byte(fmt.Sprint("Error: ", err)))
+		h.Logger(r.Context()).Warn().Err(err).Msg("Error calling GitHub API")
+		handlers.WriteError(w, r, handlers.StatusForError(err), fmt.Sprintf("Error calling GitHub API: %v", err))
+		return
 	}
+	defer resp.Body.Close()
 
 	// read response body
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		h.Log.Print(err)
-		w.Write([]byte(fmt.Sprint("Error: ", err)))
+		h.Logger(r.Context()).Warn().Err(err).Msg("Error reading response body")
+		handlers.WriteError(w, r, handlers.StatusForError(err), fmt.Sprintf("Error reading response body: %v", err))
+		return
 	}
 
 	head := resp.Header.Clone()
@@ -78,45 +118,243 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		http.Error(w, string(body), resp.StatusCode)
+		h.Logger(r.Context()).Warn().Msgf("GitHub API returned error %d when getting team permission", resp.StatusCode)
+		handlers.WriteUpstreamError(w, r, resp.StatusCode, body, fmt.Sprintf("GitHub API returned error %d when getting team permission", resp.StatusCode))
 		return
 	}
 
 	var repoPermissions Repository
 	err = json.Unmarshal(body, &repoPermissions)
 	if err != nil {
-		h.Log.Print(err)
-		w.Write([]byte(fmt.Sprint("Error: ", err)))
+		h.Logger(r.Context()).Error().Err(err).Msg("Error parsing GitHub response")
+		handlers.WriteError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error parsing GitHub response: %v", err))
+		return
 	}
 
 	var expected map[string]any
 
 	err = json.Unmarshal(body, &expected)
 	if err != nil {
-		h.Log.Print(err)
-		w.Write([]byte(fmt.Sprint("Error: ", err)))
+		h.Logger(r.Context()).Error().Err(err).Msg("Error parsing GitHub response")
+		handlers.WriteError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error parsing GitHub response: %v", err))
+		return
 	}
 
 	delete(expected, "permissions")
 	delete(expected, "owner")
 
 	expected["owner"] = owner
-	if strings.EqualFold(repoPermissions.RoleName, "read") {
-		expected["permission"] = "pull"
-	} else if strings.EqualFold(repoPermissions.RoleName, "write") {
-		expected["permission"] = "push"
-	} else {
-		expected["permission"] = repoPermissions.RoleName
+	expected["permission"] = roles.NormalizeRoleName(repoPermissions.RoleName)
+
+	// Report custom roles with the name defined in the organization, so that it matches the requested one
+	if h.Roles != nil && !roles.IsBaseRole(repoPermissions.RoleName) {
+		canonical, known, err := h.Roles.Canonicalize(r.Context(), org, auth_header, repoPermissions.RoleName)
+		if err != nil {
+			h.Logger(r.Context()).Warn().Msgf("Failed to resolve custom repository roles, reporting role %s as is: %v", repoPermissions.RoleName, err)
+		} else if known {
+			expected["permission"] = canonical
+		}
 	}
 
 	b, err := json.Marshal(expected)
 	if err != nil {
-		h.Log.Print(err)
-		w.Write([]byte(fmt.Sprint("Error: ", err)))
+		h.Logger(r.Context()).Error().Err(err).Msg("Error marshaling response")
+		handlers.WriteError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error marshaling response: %v", err))
+		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Del("Content-Length")
 	w.Write(b)
+}
+
+// teamRepoURL returns the GitHub API URL of the team permissions on a repository
+func teamRepoURL(org, teamSlug, owner, repo string) string {
+	return githuburl.Join("orgs", org, "teams", teamSlug, "repos", owner, repo)
+}
+
+// putTeamRepoPermission adds a repository to a team, or updates the team's permission on the repository.
+// It returns the status code to answer with and, for errors, the error to write.
+// Custom repository roles are accepted and sent with the name defined in the organization.
+func putTeamRepoPermission(opts handlers.HandlerOptions, r *http.Request) (int, *handlers.ErrorResponse) {
+	org := r.PathValue("org")
+	teamSlug := r.PathValue("team_slug")
+	owner := r.PathValue("owner")
+	repo := r.PathValue("repo")
+	authHeader := r.Header.Get("Authorization")
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return http.StatusBadRequest, newError(http.StatusBadRequest, fmt.Sprintf("Error reading request body: %v", err))
+	}
+	defer r.Body.Close()
+
+	var request struct {
+		Permission string `json:"permission"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil || request.Permission == "" {
+		return http.StatusBadRequest, newError(http.StatusBadRequest, "Error reading permission from request body")
+	}
+
+	permission := request.Permission
+	if opts.Roles != nil {
+		canonical, known, err := opts.Roles.Canonicalize(r.Context(), org, authHeader, permission)
+		if err != nil {
+			return handlers.StatusForError(err), newError(handlers.StatusForError(err), fmt.Sprintf("Error resolving custom repository roles: %v", err))
+		}
+		if !known {
+			return http.StatusUnprocessableEntity, newError(http.StatusUnprocessableEntity, fmt.Sprintf("Unknown permission %s: it is neither a base role nor a custom repository role of %s", permission, org))
+		}
+		permission = canonical
+	}
+
+	upstreamBody, err := json.Marshal(map[string]string{"permission": permission})
+	if err != nil {
+		return http.StatusInternalServerError, newError(http.StatusInternalServerError, fmt.Sprintf("Error marshaling request body: %v", err))
+	}
+
+	req, err := http.NewRequestWithContext(r.Context(), "PUT", teamRepoURL(org, teamSlug, owner, repo), bytes.NewReader(upstreamBody))
+	if err != nil {
+		return http.StatusInternalServerError, newError(http.StatusInternalServerError, fmt.Sprintf("Error creating request: %v", err))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(authHeader) > 0 {
+		req.Header.Set("Authorization", authHeader)
+	}
 
+	resp, err := opts.Client.Do(req)
+	if err != nil {
+		return handlers.StatusForError(err), newError(handlers.StatusForError(err), fmt.Sprintf("Error calling GitHub API: %v", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		respBody, _ := io.ReadAll(resp.Body)
+		upstreamErr := handlers.UpstreamError(resp.StatusCode, respBody, fmt.Sprintf("GitHub API returned error %d when setting team permission", resp.StatusCode))
+		return resp.StatusCode, &upstreamErr
+	}
+	return http.StatusNoContent, nil
+}
+
+// newError returns the error response of a status code
+func newError(statusCode int, message string) *handlers.ErrorResponse {
+	return &handlers.ErrorResponse{Code: handlers.CodeForStatus(statusCode), Message: message}
+}
+
+// writeMessage writes a JSON body with a single message field
+func writeMessage(w http.ResponseWriter, statusCode int, message string) {
+	b, _ := json.Marshal(map[string]string{"message": message})
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(b)
+}
+
+// @Summary Add a repository to a team
+// @Description Add a repository to a team with the given permission (base role or custom repository role)
+// @ID post-team-repo
+// @Param org path string true "Organization of the team"
+// @Param team_slug path string true "Slug of the team"
+// @Param owner path string true "Owner of the repository"
+// @Param repo path string true "Name of the repository"
+// @Param permission body teamrepo.Permission true "Permission to grant to the team"
+// @Param dry_run query bool false "Return the upstream requests that would be sent, without sending them (also X-Dry-Run header)"
+// @Param Idempotency-Key header string false "Key to replay the response of a retried request"
+// @Accept json
+// @Produce json
+// @Success 204 "Repository added to the team"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden by the plugin policy (policy_violation, with the rule in policy_rule)"
+// @Failure 422 {object} handlers.ErrorResponse "Unknown permission"
+// @Router /teamrepository/orgs/{org}/teams/{team_slug}/repos/{owner}/{repo} [post]
+// POST /teamrepository/orgs/{org}/teams/{team_slug}/repos/{owner}/{repo}
+func (h *postHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.Logger(r.Context()).Debug().Msgf("Adding repository %s/%s to team %s", r.PathValue("owner"), r.PathValue("repo"), r.PathValue("team_slug"))
+
+	statusCode, errResp := putTeamRepoPermission(h.HandlerOptions, r)
+	if errResp != nil {
+		h.Logger(r.Context()).Warn().Msgf("Error adding repository to team, status: %d: %s", statusCode, errResp.Message)
+		handlers.WriteErrorResponse(w, r, statusCode, *errResp)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary Update the permission of a team in a repository
+// @Description Update the permission of a team in a repository (base role or custom repository role)
+// @ID patch-team-repo
+// @Param org path string true "Organization of the team"
+// @Param team_slug path string true "Slug of the team"
+// @Param owner path string true "Owner of the repository"
+// @Param repo path string true "Name of the repository"
+// @Param permission body teamrepo.Permission true "New permission of the team"
+// @Param dry_run query bool false "Return the upstream requests that would be sent, without sending them (also X-Dry-Run header)"
+// @Param Idempotency-Key header string false "Key to replay the response of a retried request"
+// @Accept json
+// @Produce json
+// @Success 200 {object} teamrepo.Message "Permission updated successfully"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden by the plugin policy (policy_violation, with the rule in policy_rule)"
+// @Failure 422 {object} handlers.ErrorResponse "Unknown permission"
+// @Router /teamrepository/orgs/{org}/teams/{team_slug}/repos/{owner}/{repo} [patch]
+// PATCH /teamrepository/orgs/{org}/teams/{team_slug}/repos/{owner}/{repo}
+func (h *patchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	teamSlug := r.PathValue("team_slug")
+	h.Logger(r.Context()).Debug().Msgf("Updating permission of team %s in repository %s/%s", teamSlug, r.PathValue("owner"), r.PathValue("repo"))
+
+	statusCode, errResp := putTeamRepoPermission(h.HandlerOptions, r)
+	if errResp != nil {
+		h.Logger(r.Context()).Warn().Msgf("Error updating team permission, status: %d: %s", statusCode, errResp.Message)
+		handlers.WriteErrorResponse(w, r, statusCode, *errResp)
+		return
+	}
+
+	writeMessage(w, http.StatusOK, fmt.Sprintf("Permission updated successfully for team %s", teamSlug))
+}
+
+// @Summary Remove a repository from a team
+// @Description Remove a repository from a team
+// @ID delete-team-repo
+// @Param org path string true "Organization of the team"
+// @Param team_slug path string true "Slug of the team"
+// @Param owner path string true "Owner of the repository"
+// @Param repo path string true "Name of the repository"
+// @Param dry_run query bool false "Return the upstream requests that would be sent, without sending them (also X-Dry-Run header)"
+// @Param Idempotency-Key header string false "Key to replay the response of a retried request"
+// @Produce json
+// @Success 200 {object} teamrepo.Message "Repository removed from the team"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden by the plugin policy (policy_violation, with the rule in policy_rule)"
+// @Router /teamrepository/orgs/{org}/teams/{team_slug}/repos/{owner}/{repo} [delete]
+// DELETE /teamrepository/orgs/{org}/teams/{team_slug}/repos/{owner}/{repo}
+func (h *deleteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	org := r.PathValue("org")
+	teamSlug := r.PathValue("team_slug")
+	owner := r.PathValue("owner")
+	repo := r.PathValue("repo")
+	authHeader := r.Header.Get("Authorization")
+
+	h.Logger(r.Context()).Debug().Msgf("Removing repository %s/%s from team %s", owner, repo, teamSlug)
+
+	req, err := http.NewRequestWithContext(r.Context(), "DELETE", teamRepoURL(org, teamSlug, owner, repo), nil)
+	if err != nil {
+		handlers.WriteError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error creating request: %v", err))
+		return
+	}
+	if len(authHeader) > 0 {
+		req.Header.Set("Authorization", authHeader)
+	}
+
+	resp, err := h.Client.Do(req)
+	if err != nil {
+		h.Logger(r.Context()).Warn().Err(err).Msg("Error calling GitHub API")
+		handlers.WriteError(w, r, handlers.StatusForError(err), fmt.Sprintf("Error calling GitHub API: %v", err))
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		body, _ := io.ReadAll(resp.Body)
+		h.Logger(r.Context()).Warn().Msgf("GitHub API returned error %d when removing repository from team", resp.StatusCode)
+		handlers.WriteUpstreamError(w, r, resp.StatusCode, body, fmt.Sprintf("GitHub API returned error %d when removing repository from team", resp.StatusCode))
+		return
+	}
 
-	return
+	writeMessage(w, http.StatusOK, fmt.Sprintf("Repository %s/%s removed successfully from team %s", owner, repo, teamSlug))
 }
@@ -8,8 +8,10 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/handlers"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/roles"
 	"github.com/rs/zerolog"
 )
 
@@ -405,3 +407,145 @@ func TestHandler_ServeHTTP(t *testing.T) {
 		})
 	}
 }
+
+func TestMutatingHandlers_ServeHTTP(t *testing.T) {
+	customRolesURL := fmt.Sprintf("https://api.github.com/orgs/%s/custom-repository-roles", testOrg)
+	customRolesResp := `{"total_count": 1, "custom_roles": [{"id": 1, "name": "Security Engineer", "base_role": "maintain"}]}`
+
+	tests := []struct {
+		name                 string
+		method               string
+		newHandler           func(handlers.HandlerOptions) handlers.Handler
+		requestBody          string
+		setupMock            func(*mockHTTPClient)
+		expectedStatus       int
+		expectedBodyContains string
+		expectedUpstreamBody string
+		expectedRequestCount int
+	}{
+		{
+			name:        "POST adds repository to team",
+			method:      "POST",
+			newHandler:  PostTeamRepo,
+			requestBody: `{"permission": "push"}`,
+			setupMock: func(m *mockHTTPClient) {
+				m.setResponse(teamRepoExternalURL, http.StatusNoContent, "")
+			},
+			expectedStatus:       http.StatusNoContent,
+			expectedUpstreamBody: `{"permission":"push"}`,
+			expectedRequestCount: 1,
+		},
+		{
+			name:        "PATCH with custom role sends its canonical name",
+			method:      "PATCH",
+			newHandler:  PatchTeamRepo,
+			requestBody: `{"permission": "security engineer"}`,
+			setupMock: func(m *mockHTTPClient) {
+				m.setResponse(customRolesURL, http.StatusOK, customRolesResp)
+				m.setResponse(teamRepoExternalURL, http.StatusNoContent, "")
+			},
+			expectedStatus:       http.StatusOK,
+			expectedBodyContains: "Permission updated successfully",
+			expectedUpstreamBody: `{"permission":"Security Engineer"}`,
+			expectedRequestCount: 2,
+		},
+		{
+			name:        "PATCH with unknown role",
+			method:      "PATCH",
+			newHandler:  PatchTeamRepo,
+			requestBody: `{"permission": "auditor"}`,
+			setupMock: func(m *mockHTTPClient) {
+				m.setResponse(customRolesURL, http.StatusOK, customRolesResp)
+			},
+			expectedStatus:       http.StatusUnprocessableEntity,
+			expectedBodyContains: "Unknown permission auditor",
+			expectedRequestCount: 1,
+		},
+		{
+			name:                 "POST without permission",
+			method:               "POST",
+			newHandler:           PostTeamRepo,
+			requestBody:          `{}`,
+			setupMock:            func(m *mockHTTPClient) {},
+			expectedStatus:       http.StatusBadRequest,
+			expectedBodyContains: "Error reading permission from request body",
+			expectedRequestCount: 0,
+		},
+		{
+			name:        "POST forwards GitHub errors",
+			method:      "POST",
+			newHandler:  PostTeamRepo,
+			requestBody: `{"permission": "push"}`,
+			setupMock: func(m *mockHTTPClient) {
+				m.setResponse(teamRepoExternalURL, http.StatusForbidden, `{"message": "Must have admin rights"}`)
+			},
+			expectedStatus:       http.StatusForbidden,
+			expectedBodyContains: "Must have admin rights",
+			expectedRequestCount: 1,
+		},
+		{
+			name:       "DELETE removes repository from team",
+			method:     "DELETE",
+			newHandler: DeleteTeamRepo,
+			setupMock: func(m *mockHTTPClient) {
+				m.setResponse(teamRepoExternalURL, http.StatusNoContent, "")
+			},
+			expectedStatus:       http.StatusOK,
+			expectedBodyContains: "removed successfully",
+			expectedRequestCount: 1,
+		},
+		{
+			name:                 "DELETE forwards not found",
+			method:               "DELETE",
+			newHandler:           DeleteTeamRepo,
+			setupMock:            func(m *mockHTTPClient) {},
+			expectedStatus:       http.StatusNotFound,
+			expectedBodyContains: "Not Found",
+			expectedRequestCount: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := newMockHTTPClient()
+			tt.setupMock(mockClient)
+
+			logger := zerolog.New(io.Discard).With().Timestamp().Logger()
+			opts := handlers.HandlerOptions{
+				Client: mockClient,
+				Log:    &logger,
+				Roles:  roles.NewResolver(mockClient, time.Minute),
+			}
+
+			mux := http.NewServeMux()
+			mux.Handle(tt.method+" /teamrepository/orgs/{org}/teams/{team_slug}/repos/{owner}/{repo}", tt.newHandler(opts))
+
+			path := fmt.Sprintf("/teamrepository/orgs/%s/teams/%s/repos/%s/%s", testOrg, testTeamSlug, testOwner, testRepo)
+			req := httptest.NewRequest(tt.method, path, strings.NewReader(tt.requestBody))
+			req.Header.Set("Authorization", testToken)
+
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tt.expectedStatus)
+			}
+			if !strings.Contains(rr.Body.String(), tt.expectedBodyContains) {
+				t.Errorf("handler response body does not contain expected content.\nGot: %s\nWant to contain: %s", rr.Body.String(), tt.expectedBodyContains)
+			}
+			if mockClient.getRequestCount() != tt.expectedRequestCount {
+				t.Errorf("expected %d requests, got %d", tt.expectedRequestCount, mockClient.getRequestCount())
+			}
+			if tt.expectedUpstreamBody != "" {
+				req := mockClient.getLastRequest()
+				if req.Method != "PUT" {
+					t.Errorf("expected PUT upstream request, got %s", req.Method)
+				}
+				body, _ := io.ReadAll(req.Body)
+				if string(body) != tt.expectedUpstreamBody {
+					t.Errorf("upstream body = %s, want %s", body, tt.expectedUpstreamBody)
+				}
+			}
+		})
+	}
+}
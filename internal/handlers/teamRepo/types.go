@@ -203,3 +203,11 @@ type TeamRepoPermissions struct {
 	Watchers            int      `json:"watchers"`
 	WatchersCount       int      `json:"watchers_count"`
 }
+
+type Permission struct {
+	Permission string `json:"permission"`
+}
+
+type Message struct {
+	Message string `json:"message"`
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+// IsTimeout reports whether err is caused by an expired deadline, of the request or of a single upstream call
+func IsTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// StatusForError returns the status code reporting a failed upstream call:
+// 504 Gateway Timeout when a deadline expired, 500 Internal Server Error otherwise
+func StatusForError(err error) int {
+	if IsTimeout(err) {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
+// RequestTimeout sets a deadline on the context of the requests served by next, bounding all the upstream calls of a request.
+// A timeout of zero or less disables the deadline.
+func RequestTimeout(timeout time.Duration, next http.Handler) http.Handler {
+	if timeout <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
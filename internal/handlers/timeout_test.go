@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestStatusForError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{name: "deadline exceeded", err: fmt.Errorf("failed to execute request: %w", context.DeadlineExceeded), expected: http.StatusGatewayTimeout},
+		{name: "client timeout", err: &url.Error{Op: "Get", URL: "https://api.github.com", Err: timeoutError{}}, expected: http.StatusGatewayTimeout},
+		{name: "cancelled", err: context.Canceled, expected: http.StatusInternalServerError},
+		{name: "other error", err: errors.New("connection refused"), expected: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status := StatusForError(tt.err); status != tt.expected {
+				t.Errorf("expected %d, got %d", tt.expected, status)
+			}
+		})
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	var deadline time.Time
+	var hasDeadline bool
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deadline, hasDeadline = r.Context().Deadline()
+	})
+
+	RequestTimeout(0, next).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if hasDeadline {
+		t.Errorf("expected no deadline when the timeout is disabled")
+	}
+
+	start := time.Now()
+	RequestTimeout(time.Minute, next).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if !hasDeadline || deadline.Before(start.Add(time.Minute)) || deadline.After(time.Now().Add(time.Minute)) {
+		t.Errorf("expected a deadline in one minute, got %v (set: %v)", deadline, hasDeadline)
+	}
+}
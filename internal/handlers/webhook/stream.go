@@ -0,0 +1,125 @@
+package webhook
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/events"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/handlers"
+)
+
+// keepAliveInterval is the interval of the comments sent to keep idle streams open through proxies
+const keepAliveInterval = 30 * time.Second
+
+// EventsHandler returns the server-sent events stream of the changes published to broker.
+// The stream names repositories, teams and users: callers must present token as a bearer token.
+func EventsHandler(opts handlers.HandlerOptions, token string, broker *events.Broker) handlers.Handler {
+	return &eventsHandler{
+		HandlerOptions: opts,
+		token:          []byte(token),
+		broker:         broker,
+	}
+}
+
+var _ handlers.Handler = &eventsHandler{}
+
+type eventsHandler struct {
+	handlers.HandlerOptions
+	token  []byte
+	broker *events.Broker
+}
+
+// @Summary Stream the changes reported by GitHub webhooks
+// @Description Server-sent events stream of the plugin resources changed out-of-band, one `events.Event` per message with the delivery ID as event ID. Reconnecting clients get the missed events with the Last-Event-ID header.
+// @ID get-webhook-events
+// @Param Authorization header string true "Bearer token configured with EVENTS_TOKEN"
+// @Param Last-Event-ID header string false "ID of the last event received"
+// @Produce text/event-stream
+// @Success 200 {object} events.Event "Stream of events"
+// @Failure 401 {object} handlers.ErrorResponse "Missing or invalid bearer token"
+// @Router /webhooks/events [get]
+// GET /webhooks/events
+func (h *eventsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(r) {
+		h.Logger(r.Context()).Warn().Msg("Rejected event stream request with missing or invalid bearer token")
+		handlers.WriteError(w, r, http.StatusUnauthorized, "Missing or invalid bearer token")
+		return
+	}
+
+	controller := http.NewResponseController(w)
+	// The stream outlives the write timeout of the server
+	if err := controller.SetWriteDeadline(time.Time{}); err != nil && err != http.ErrNotSupported {
+		h.Logger(r.Context()).Warn().Msgf("Failed to disable the write deadline of the event stream: %v", err)
+	}
+
+	missed, next, unsubscribe := h.broker.Subscribe(r.Header.Get("Last-Event-ID"))
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	for _, event := range missed {
+		if err := writeEvent(w, event); err != nil {
+			return
+		}
+	}
+	if err := controller.Flush(); err != nil {
+		h.Logger(r.Context()).Warn().Msgf("Event stream does not support flushing: %v", err)
+		return
+	}
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-next:
+			if !ok {
+				// The broker is closed on shutdown
+				return
+			}
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+		if err := controller.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// authorized reports whether the request carries the configured bearer token (never when none is configured)
+func (h *eventsHandler) authorized(r *http.Request) bool {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || len(h.token) == 0 {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimSpace(token)), h.token) == 1
+}
+
+// writeEvent writes an event as a server-sent event message
+func writeEvent(w http.ResponseWriter, event events.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if event.ID != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", event.ID); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+	return err
+}
@@ -0,0 +1,245 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/events"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/handlers"
+)
+
+const (
+	// Path is the path GitHub delivers the webhooks to. It is authenticated by the signature of the payloads,
+	// not by a client certificate, which GitHub cannot present.
+	Path = "/webhooks/github"
+	// SignatureHeader is the header carrying the HMAC-SHA256 signature of the payload
+	SignatureHeader = "X-Hub-Signature-256"
+	// EventHeader is the header carrying the name of the event
+	EventHeader = "X-GitHub-Event"
+	// DeliveryHeader is the header carrying the unique ID of a delivery, kept by redeliveries
+	DeliveryHeader = "X-GitHub-Delivery"
+)
+
+// maxPayloadSize is the maximum size of a webhook payload accepted, as documented by GitHub
+const maxPayloadSize = 25 << 20
+
+// maxDeliveries is the number of recent delivery IDs remembered to ignore redeliveries
+const maxDeliveries = 1024
+
+// Account is a user or an organization of a webhook payload
+type Account struct {
+	Login string `json:"login"`
+}
+
+// Repository is a repository of a webhook payload
+type Repository struct {
+	Name  string  `json:"name"`
+	Owner Account `json:"owner"`
+}
+
+// Team is a team of a webhook payload
+type Team struct {
+	Slug string `json:"slug"`
+}
+
+// Payload is the part of a webhook payload used by the receiver
+type Payload struct {
+	Action       string      `json:"action"`
+	Repository   *Repository `json:"repository"`
+	Member       *Account    `json:"member"`
+	Invitee      *Account    `json:"invitee"`
+	Team         *Team       `json:"team"`
+	Organization *Account    `json:"organization"`
+}
+
+// Message is the body of the webhook responses
+type Message struct {
+	Message string `json:"message"`
+}
+
+// Handler returns the receiver of GitHub webhooks signed with secret.
+// Events changing the collaborators or the invitations of a repository invalidate its cached invitations,
+// and the changes of plugin resources are published to broker (optional).
+func Handler(opts handlers.HandlerOptions, secret string, broker *events.Broker) handlers.Handler {
+	return &handler{
+		HandlerOptions: opts,
+		secret:         []byte(secret),
+		broker:         broker,
+		deliveries:     make(map[string]struct{}),
+	}
+}
+
+var _ handlers.Handler = &handler{}
+
+type handler struct {
+	handlers.HandlerOptions
+	secret []byte
+	broker *events.Broker
+
+	mu            sync.Mutex
+	deliveries    map[string]struct{}
+	deliveryOrder []string
+}
+
+// @Summary Receive a GitHub webhook
+// @Description Receive a GitHub webhook signed with the configured secret. `member`, `repository_invitation`, `repository`, `team` and `membership` events are published on /webhooks/events, redeliveries are ignored.
+// @ID post-webhook
+// @Param X-GitHub-Event header string true "Name of the event"
+// @Param X-Hub-Signature-256 header string true "HMAC-SHA256 signature of the payload"
+// @Param X-GitHub-Delivery header string false "Unique ID of the delivery"
+// @Accept json
+// @Produce json
+// @Success 200 {object} webhook.Message "Event processed or ignored"
+// @Failure 400 {object} handlers.ErrorResponse "Invalid payload"
+// @Failure 401 {object} handlers.ErrorResponse "Missing or invalid signature"
+// @Router /webhooks/github [post]
+// POST /webhooks/github
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPayloadSize))
+	if err != nil {
+		handlers.WriteError(w, r, http.StatusBadRequest, fmt.Sprintf("Error reading payload: %v", err))
+		return
+	}
+	defer r.Body.Close()
+
+	if !ValidSignature(h.secret, body, r.Header.Get(SignatureHeader)) {
+		h.Logger(r.Context()).Warn().Msgf("Rejected webhook with missing or invalid %s", SignatureHeader)
+		handlers.WriteError(w, r, http.StatusUnauthorized, fmt.Sprintf("Missing or invalid %s", SignatureHeader))
+		return
+	}
+
+	event := r.Header.Get(EventHeader)
+	if event == "ping" {
+		writeMessage(w, "pong")
+		return
+	}
+
+	var payload Payload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		handlers.WriteError(w, r, http.StatusBadRequest, fmt.Sprintf("Error parsing payload: %v", err))
+		return
+	}
+
+	deliveryID := r.Header.Get(DeliveryHeader)
+	if !h.firstDelivery(deliveryID) {
+		h.Logger(r.Context()).Debug().Msgf("Ignored redelivery %s of %s event", deliveryID, event)
+		writeMessage(w, fmt.Sprintf("Delivery %s already processed", deliveryID))
+		return
+	}
+
+	switch event {
+	case "member", "repository_invitation", "repository":
+		if payload.Repository != nil && h.Invitations != nil {
+			h.Invitations.Invalidate(payload.Repository.Owner.Login, payload.Repository.Name)
+			h.Logger(r.Context()).Debug().Msgf("Invalidated invitations of %s/%s on %s %s event", payload.Repository.Owner.Login, payload.Repository.Name, event, payload.Action)
+		}
+	}
+
+	paths := ResourcePaths(event, payload)
+	if len(paths) == 0 {
+		writeMessage(w, fmt.Sprintf("Event %s ignored", event))
+		return
+	}
+
+	if h.broker != nil {
+		h.broker.Publish(events.Event{
+			ID:         deliveryID,
+			Event:      event,
+			Action:     payload.Action,
+			Paths:      paths,
+			ReceivedAt: time.Now().UTC(),
+		})
+	}
+	h.Logger(r.Context()).Debug().Msgf("Received %s %s event affecting %s", event, payload.Action, strings.Join(paths, ", "))
+	writeMessage(w, fmt.Sprintf("Event %s affects %s", event, strings.Join(paths, ", ")))
+}
+
+// ResourcePaths returns the paths of the plugin resources affected by an event, none for events that are not handled
+func ResourcePaths(event string, payload Payload) []string {
+	repository := payload.Repository
+	switch event {
+	case "member":
+		if repository != nil && payload.Member != nil {
+			return []string{collaboratorPath(repository, payload.Member.Login)}
+		}
+	case "repository_invitation":
+		if repository != nil && payload.Invitee != nil {
+			return []string{collaboratorPath(repository, payload.Invitee.Login)}
+		}
+	case "repository":
+		if repository != nil {
+			return []string{fmt.Sprintf("/repository/%s/%s/collaborators", repository.Owner.Login, repository.Name)}
+		}
+	case "team", "membership":
+		if payload.Organization == nil || payload.Team == nil {
+			return nil
+		}
+		paths := []string{fmt.Sprintf("/team/orgs/%s/teams/%s", payload.Organization.Login, payload.Team.Slug)}
+		if event == "team" && repository != nil {
+			paths = append(paths, fmt.Sprintf("/teamrepository/orgs/%s/teams/%s/repos/%s/%s", payload.Organization.Login, payload.Team.Slug, repository.Owner.Login, repository.Name))
+		}
+		return paths
+	}
+	return nil
+}
+
+// collaboratorPath returns the path reading a collaborator, the only GET route of collaborators
+func collaboratorPath(repository *Repository, username string) string {
+	return fmt.Sprintf("/repository/%s/%s/collaborators/%s/permission", repository.Owner.Login, repository.Name, username)
+}
+
+// firstDelivery records a delivery ID, reporting whether it was not received before.
+// Deliveries without an ID are always processed.
+func (h *handler) firstDelivery(deliveryID string) bool {
+	if deliveryID == "" {
+		return true
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, seen := h.deliveries[deliveryID]; seen {
+		return false
+	}
+	h.deliveries[deliveryID] = struct{}{}
+	h.deliveryOrder = append(h.deliveryOrder, deliveryID)
+	if len(h.deliveryOrder) > maxDeliveries {
+		delete(h.deliveries, h.deliveryOrder[0])
+		h.deliveryOrder = h.deliveryOrder[1:]
+	}
+	return true
+}
+
+// ValidSignature reports whether signature is the `sha256=` HMAC of the payload with secret
+func ValidSignature(secret, payload []byte, signature string) bool {
+	if len(secret) == 0 {
+		return false
+	}
+	hexDigest, found := strings.CutPrefix(signature, "sha256=")
+	if !found {
+		return false
+	}
+	digest, err := hex.DecodeString(hexDigest)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	return hmac.Equal(digest, mac.Sum(nil))
+}
+
+func writeMessage(w http.ResponseWriter, message string) {
+	b, _ := json.Marshal(Message{Message: message})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
@@ -0,0 +1,165 @@
+// Package invitations caches the pending invitations of repositories, indexed by invitee.
+//
+// Looking up the invitation of a user requires paging through all the invitations of the repository:
+// the Index lists them once per repository and token, and serves the lookups from memory until the TTL expires
+// or the repository is invalidated (e.g. by a webhook or by a change made by the plugin itself).
+package invitations
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/githuburl"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/requeststats"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/utils"
+)
+
+// perPage is the page size used to list the invitations, the maximum allowed by GitHub
+const perPage = 100
+
+type httpDoer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+type cacheEntry struct {
+	invitations map[string]json.RawMessage
+	expires     time.Time
+}
+
+// Index fetches and caches the pending invitations of repositories.
+// Entries are keyed by repository and token hash, since different tokens may see different repositories.
+type Index struct {
+	client httpDoer
+	ttl    time.Duration
+	now    func() time.Time
+
+	mu          sync.Mutex
+	cache       map[string]map[string]cacheEntry // repository → token hash → entry
+	generations map[string]uint64                // repository → number of invalidations
+}
+
+// NewIndex creates an Index caching the invitations of a repository for the given TTL
+func NewIndex(client httpDoer, ttl time.Duration) *Index {
+	return &Index{
+		client:      client,
+		ttl:         ttl,
+		now:         time.Now,
+		cache:       make(map[string]map[string]cacheEntry),
+		generations: make(map[string]uint64),
+	}
+}
+
+// Lookup returns the invitation of a user to a repository, as returned by GitHub.
+// Invitations that cannot be listed (e.g. the token has no admin access) result in found being false.
+func (i *Index) Lookup(ctx context.Context, owner, repo, authHeader, username string) (json.RawMessage, bool, error) {
+	repoKey := repositoryKey(owner, repo)
+	tokenKey := utils.HashToken(authHeader)
+
+	i.mu.Lock()
+	entry, exists := i.cache[repoKey][tokenKey]
+	generation := i.generations[repoKey]
+	i.mu.Unlock()
+
+	if exists && i.now().Before(entry.expires) {
+		requeststats.FromContext(ctx).AddCacheHit()
+	} else {
+		invitations, listed, err := i.fetchInvitations(ctx, owner, repo, authHeader)
+		if err != nil || !listed {
+			return nil, false, err
+		}
+		entry = cacheEntry{invitations: invitations, expires: i.now().Add(i.ttl)}
+
+		// Invitations listed before an invalidation may be stale: they answer this lookup but are not cached
+		i.mu.Lock()
+		if i.generations[repoKey] == generation {
+			if i.cache[repoKey] == nil {
+				i.cache[repoKey] = make(map[string]cacheEntry)
+			}
+			i.cache[repoKey][tokenKey] = entry
+		}
+		i.mu.Unlock()
+	}
+
+	invitation, found := entry.invitations[strings.ToLower(username)]
+	return invitation, found, nil
+}
+
+// Invalidate removes the cached invitations of a repository, for all tokens
+func (i *Index) Invalidate(owner, repo string) {
+	repoKey := repositoryKey(owner, repo)
+
+	i.mu.Lock()
+	delete(i.cache, repoKey)
+	i.generations[repoKey]++
+	i.mu.Unlock()
+}
+
+// fetchInvitations lists all the invitations of a repository, indexed by the lowercase login of the invitee.
+// listed is false when GitHub does not answer 200 OK.
+func (i *Index) fetchInvitations(ctx context.Context, owner, repo, authHeader string) (map[string]json.RawMessage, bool, error) {
+	invitations := make(map[string]json.RawMessage)
+
+	for page := 1; ; page++ {
+		req, err := http.NewRequestWithContext(ctx, "GET", githuburl.Join("repos", owner, repo, "invitations")+fmt.Sprintf("?per_page=%d&page=%d", perPage, page), nil)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to create request: %w", err)
+		}
+		if authHeader != "" {
+			req.Header.Set("Authorization", authHeader)
+		}
+
+		body, listed, err := i.getPage(req)
+		if err != nil || !listed {
+			return nil, listed, err
+		}
+
+		var pageInvitations []json.RawMessage
+		if err := json.Unmarshal(body, &pageInvitations); err != nil {
+			return nil, false, fmt.Errorf("failed to unmarshal invitations: %w", err)
+		}
+		for _, invitation := range pageInvitations {
+			var parsed struct {
+				Invitee struct {
+					Login string `json:"login"`
+				} `json:"invitee"`
+			}
+			if err := json.Unmarshal(invitation, &parsed); err != nil || parsed.Invitee.Login == "" {
+				continue
+			}
+			invitations[strings.ToLower(parsed.Invitee.Login)] = invitation
+		}
+
+		// A page shorter than perPage is the last one
+		if len(pageInvitations) < perPage {
+			return invitations, true, nil
+		}
+	}
+}
+
+func (i *Index) getPage(req *http.Request) ([]byte, bool, error) {
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read response body: %w", err)
+	}
+	return body, true, nil
+}
+
+func repositoryKey(owner, repo string) string {
+	return strings.ToLower(owner) + "/" + strings.ToLower(repo)
+}
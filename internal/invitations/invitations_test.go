@@ -0,0 +1,191 @@
+package invitations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/requeststats"
+)
+
+// mockHTTPClient answers the requests with the configured responses by URL and counts them
+type mockHTTPClient struct {
+	responses map[string]string
+	status    int
+	err       error
+	requests  []string
+	onRequest func()
+}
+
+func (m *mockHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	m.requests = append(m.requests, req.URL.String())
+	if m.onRequest != nil {
+		m.onRequest()
+	}
+	if m.err != nil {
+		return nil, m.err
+	}
+	status := m.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	return &http.Response{
+		StatusCode: status,
+		Body:       io.NopCloser(strings.NewReader(m.responses[req.URL.String()])),
+		Header:     make(http.Header),
+	}, nil
+}
+
+const (
+	testOwner = "testowner"
+	testRepo  = "testrepo"
+	testToken = "token test-token-123"
+)
+
+func pageURL(page int) string {
+	return fmt.Sprintf("https://api.github.com/repos/%s/%s/invitations?per_page=%d&page=%d", testOwner, testRepo, perPage, page)
+}
+
+func invitationsJSON(logins ...string) string {
+	items := make([]string, len(logins))
+	for i, login := range logins {
+		items[i] = fmt.Sprintf(`{"id": %d, "invitee": {"login": %q}, "permissions": "write"}`, i+1, login)
+	}
+	return "[" + strings.Join(items, ",") + "]"
+}
+
+func TestIndex_Lookup(t *testing.T) {
+	fullPage := make([]string, perPage)
+	for i := range fullPage {
+		fullPage[i] = fmt.Sprintf("user%d", i)
+	}
+	client := &mockHTTPClient{responses: map[string]string{
+		pageURL(1): invitationsJSON(fullPage...),
+		pageURL(2): invitationsJSON("TestUser"),
+	}}
+	index := NewIndex(client, time.Minute)
+
+	tests := []struct {
+		username      string
+		expectedFound bool
+	}{
+		{username: "testuser", expectedFound: true},
+		{username: "user42", expectedFound: true},
+		{username: "someone", expectedFound: false},
+	}
+
+	ctx, stats := requeststats.NewContext(context.Background())
+	for _, tt := range tests {
+		invitation, found, err := index.Lookup(ctx, testOwner, testRepo, testToken, tt.username)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if found != tt.expectedFound || (found && !strings.Contains(string(invitation), `"permissions": "write"`)) {
+			t.Errorf("%s: got found=%v, invitation %s", tt.username, found, invitation)
+		}
+	}
+	if len(client.requests) != 2 {
+		t.Errorf("expected the two pages to be listed once, got requests %v", client.requests)
+	}
+	if hits := stats.CacheHits(); hits != 2 {
+		t.Errorf("expected 2 cache hits in the request stats, got %d", hits)
+	}
+}
+
+func TestIndex_Expiration(t *testing.T) {
+	client := &mockHTTPClient{responses: map[string]string{pageURL(1): invitationsJSON("testuser")}}
+	index := NewIndex(client, time.Minute)
+	now := time.Now()
+	index.now = func() time.Time { return now }
+
+	lookup := func() {
+		if _, found, err := index.Lookup(context.Background(), testOwner, testRepo, testToken, "testuser"); err != nil || !found {
+			t.Fatalf("expected the invitation, got found=%v, err=%v", found, err)
+		}
+	}
+
+	lookup()
+	lookup()
+	if len(client.requests) != 1 {
+		t.Fatalf("expected 1 request before the TTL expires, got %d", len(client.requests))
+	}
+
+	now = now.Add(2 * time.Minute)
+	lookup()
+	if len(client.requests) != 2 {
+		t.Errorf("expected the invitations to be listed again after the TTL, got %d requests", len(client.requests))
+	}
+
+	// Different tokens are cached separately
+	if _, _, err := index.Lookup(context.Background(), testOwner, testRepo, "token other", "testuser"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(client.requests) != 3 {
+		t.Errorf("expected a request for another token, got %d requests", len(client.requests))
+	}
+}
+
+func TestIndex_Invalidate(t *testing.T) {
+	client := &mockHTTPClient{responses: map[string]string{pageURL(1): invitationsJSON("testuser")}}
+	index := NewIndex(client, time.Minute)
+
+	if _, _, err := index.Lookup(context.Background(), testOwner, testRepo, testToken, "testuser"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	client.responses[pageURL(1)] = invitationsJSON()
+	index.Invalidate("TestOwner", "TestRepo")
+
+	if _, found, err := index.Lookup(context.Background(), testOwner, testRepo, testToken, "testuser"); err != nil || found {
+		t.Errorf("expected the invitation to be gone after the invalidation, got found=%v, err=%v", found, err)
+	}
+	if len(client.requests) != 2 {
+		t.Errorf("expected the invitations to be listed again, got %d requests", len(client.requests))
+	}
+}
+
+func TestIndex_InvalidateDuringFetch(t *testing.T) {
+	client := &mockHTTPClient{responses: map[string]string{pageURL(1): invitationsJSON("testuser")}}
+	index := NewIndex(client, time.Minute)
+	client.onRequest = func() { index.Invalidate(testOwner, testRepo) }
+
+	for range 2 {
+		if _, found, err := index.Lookup(context.Background(), testOwner, testRepo, testToken, "testuser"); err != nil || !found {
+			t.Fatalf("expected the invitation, got found=%v, err=%v", found, err)
+		}
+	}
+	if len(client.requests) != 2 {
+		t.Errorf("expected invitations listed before an invalidation not to be cached, got %d requests", len(client.requests))
+	}
+}
+
+func TestIndex_NotListed(t *testing.T) {
+	tests := []struct {
+		name        string
+		client      *mockHTTPClient
+		expectError bool
+	}{
+		{name: "forbidden", client: &mockHTTPClient{status: http.StatusForbidden}},
+		{name: "network error", client: &mockHTTPClient{err: errors.New("network error")}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index := NewIndex(tt.client, time.Minute)
+			for range 2 {
+				_, found, err := index.Lookup(context.Background(), testOwner, testRepo, testToken, "testuser")
+				if found || (err != nil) != tt.expectError {
+					t.Errorf("unexpected result found=%v, err=%v", found, err)
+				}
+			}
+			if len(tt.client.requests) != 2 {
+				t.Errorf("expected failed listings not to be cached, got %d requests", len(tt.client.requests))
+			}
+		})
+	}
+}
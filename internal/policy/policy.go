@@ -0,0 +1,356 @@
+// Package policy restricts what the plugin may do on behalf of its callers, beyond what their tokens allow.
+//
+// A policy file lists the organizations and repositories each route may touch (allow and deny rules),
+// caps the permissions that can be granted and protects users (e.g. break-glass admins) from removal.
+// The Store reloads the file when it changes.
+package policy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Routes of the plugin the rules apply to
+const (
+	RouteCollaborator   = "collaborator"   // /repository/{owner}/{repo}/collaborators/{username}
+	RouteCollaborators  = "collaborators"  // /repository/{owner}/{repo}/collaborators (reconciliation)
+	RouteTeamRepository = "teamrepository" // /teamrepository/orgs/{org}/teams/{team_slug}/repos/{owner}/{repo}
+	RouteTeam           = "team"           // /team/orgs/{org}/teams/{team_slug}
+)
+
+var knownRoutes = []string{RouteCollaborator, RouteCollaborators, RouteTeamRepository, RouteTeam}
+
+// baseRoleRanks orders the base roles, from the least to the most privileged
+var baseRoleRanks = map[string]int{
+	"pull":     1,
+	"triage":   2,
+	"push":     3,
+	"maintain": 4,
+	"admin":    5,
+}
+
+// Policy is the content of a policy file. The empty policy allows everything.
+type Policy struct {
+	Allow          []TargetRule     `yaml:"allow"`
+	Deny           []TargetRule     `yaml:"deny"`
+	Permissions    []PermissionRule `yaml:"permissions"`
+	ProtectedUsers []ProtectedRule  `yaml:"protected_users"`
+}
+
+// TargetRule matches the organizations and repositories touched by the requests of some routes.
+// Targets are case-insensitive glob patterns: `org` matches an organization (or owner) and all its repositories,
+// `owner/repo` matches repositories.
+type TargetRule struct {
+	Name    string   `yaml:"name"`
+	Routes  []string `yaml:"routes"` // All routes when empty
+	Targets []string `yaml:"targets"`
+}
+
+// PermissionRule caps the permission that can be granted on the matching targets
+type PermissionRule struct {
+	Name    string   `yaml:"name"`
+	Routes  []string `yaml:"routes"`  // All routes when empty
+	Targets []string `yaml:"targets"` // All targets when empty
+	Max     string   `yaml:"max"`     // Most privileged base role that can be granted
+	// OutsideCollaborators restricts the rule to users who are not members of the organization owning the repository
+	OutsideCollaborators bool `yaml:"outside_collaborators"`
+}
+
+// ProtectedRule protects users from removal on the matching targets
+type ProtectedRule struct {
+	Name    string   `yaml:"name"`
+	Users   []string `yaml:"users"`
+	Targets []string `yaml:"targets"` // All targets when empty
+}
+
+// Violation is a request rejected by a rule
+type Violation struct {
+	Rule    string
+	Message string
+}
+
+func (v *Violation) Error() string {
+	return fmt.Sprintf("policy rule %s: %s", v.Rule, v.Message)
+}
+
+// Grant is a permission requested for a user or a team.
+// The facts that only some rules need are resolved lazily.
+type Grant struct {
+	Permission string
+	// BaseRole returns the base role of a custom repository role (empty when unknown)
+	BaseRole func() (string, error)
+	// Outside reports whether the grantee is an outside collaborator, nil for teams
+	Outside func() (bool, error)
+}
+
+// Load reads and validates a policy file
+func Load(filename string) (*Policy, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy: %w", err)
+	}
+	return Parse(content)
+}
+
+// Parse parses and validates a policy
+func Parse(content []byte) (*Policy, error) {
+	var p Policy
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&p); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse policy: %w", err)
+	}
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("invalid policy: %w", err)
+	}
+	return &p, nil
+}
+
+func (p *Policy) validate() error {
+	names := make(map[string]bool)
+	checkRule := func(section, name string, routes, targets []string) error {
+		if name == "" {
+			return fmt.Errorf("%s rule without name", section)
+		}
+		if names[name] {
+			return fmt.Errorf("duplicate rule name %s", name)
+		}
+		names[name] = true
+		for _, route := range routes {
+			if !contains(knownRoutes, route) {
+				return fmt.Errorf("rule %s: unknown route %q, expected one of %s", name, route, strings.Join(knownRoutes, ", "))
+			}
+		}
+		for _, target := range targets {
+			if _, err := path.Match(target, ""); err != nil || strings.Count(target, "/") > 1 {
+				return fmt.Errorf("rule %s: invalid target pattern %q", name, target)
+			}
+		}
+		return nil
+	}
+
+	for _, rule := range p.Allow {
+		if err := checkRule("allow", rule.Name, rule.Routes, rule.Targets); err != nil {
+			return err
+		}
+	}
+	for _, rule := range p.Deny {
+		if err := checkRule("deny", rule.Name, rule.Routes, rule.Targets); err != nil {
+			return err
+		}
+	}
+	for _, rule := range p.Permissions {
+		if err := checkRule("permissions", rule.Name, rule.Routes, rule.Targets); err != nil {
+			return err
+		}
+		if _, ok := baseRoleRanks[normalizeRole(rule.Max)]; !ok {
+			return fmt.Errorf("rule %s: max must be a base role (pull, triage, push, maintain or admin, read and write being aliases), got %q", rule.Name, rule.Max)
+		}
+	}
+	for _, rule := range p.ProtectedUsers {
+		if err := checkRule("protected_users", rule.Name, nil, rule.Targets); err != nil {
+			return err
+		}
+		if len(rule.Users) == 0 {
+			return fmt.Errorf("rule %s: users are required", rule.Name)
+		}
+	}
+	return nil
+}
+
+// CheckTargets checks that the targets of a request (`org` or `owner/repo`) may be touched by the route.
+// Deny rules take precedence. When allow rules apply to the route, every target must match one of them,
+// except for the targets of a shape they have no pattern for (e.g. the org of a team repository when only repositories are allowed).
+func (p *Policy) CheckTargets(route string, targets []string) *Violation {
+	if p == nil {
+		return nil
+	}
+
+	for _, rule := range p.Deny {
+		if !appliesTo(rule.Routes, route) {
+			continue
+		}
+		for _, target := range targets {
+			if matchesAny(rule.Targets, target) {
+				return &Violation{Rule: rule.Name, Message: fmt.Sprintf("%s is denied for route %s", target, route)}
+			}
+		}
+	}
+
+	var allowRules []TargetRule
+	for _, rule := range p.Allow {
+		if appliesTo(rule.Routes, route) {
+			allowRules = append(allowRules, rule)
+		}
+	}
+	if len(allowRules) == 0 {
+		return nil
+	}
+	constrained := false
+	for _, target := range targets {
+		allowed, applicable := false, false
+		for _, rule := range allowRules {
+			applicable = applicable || appliesToShape(rule.Targets, target)
+			if matchesAny(rule.Targets, target) {
+				allowed = true
+				break
+			}
+		}
+		if !applicable {
+			continue // e.g. the org of a team repository request, when only repositories are allowed
+		}
+		constrained = true
+		if !allowed {
+			return &Violation{Rule: "allow", Message: fmt.Sprintf("%s is not allowed by any rule for route %s", target, route)}
+		}
+	}
+	if !constrained && len(targets) > 0 {
+		return &Violation{Rule: "allow", Message: fmt.Sprintf("%s is not allowed by any rule for route %s", strings.Join(targets, ", "), route)}
+	}
+	return nil
+}
+
+// CheckGrant checks that a permission can be granted on the targets.
+// Custom roles are ranked as their base role, and rejected by the caps when it is unknown.
+func (p *Policy) CheckGrant(route string, targets []string, grant Grant) (*Violation, error) {
+	if p == nil {
+		return nil, nil
+	}
+
+	rank, ranked := baseRoleRanks[normalizeRole(grant.Permission)]
+	for _, rule := range p.Permissions {
+		if !appliesTo(rule.Routes, route) || !targetsMatch(rule.Targets, targets) {
+			continue
+		}
+		if rule.OutsideCollaborators {
+			if grant.Outside == nil {
+				continue // Teams are not outside collaborators
+			}
+			outside, err := grant.Outside()
+			if err != nil {
+				return nil, err
+			}
+			if !outside {
+				continue
+			}
+		}
+
+		if !ranked && grant.BaseRole != nil {
+			baseRole, err := grant.BaseRole()
+			if err != nil {
+				return nil, err
+			}
+			rank, ranked = baseRoleRanks[normalizeRole(baseRole)]
+		}
+		if !ranked || rank > baseRoleRanks[normalizeRole(rule.Max)] {
+			subject := "permission"
+			if rule.OutsideCollaborators {
+				subject = "permission for outside collaborators"
+			}
+			return &Violation{Rule: rule.Name, Message: fmt.Sprintf("%s exceeds the maximum %s %s", grant.Permission, subject, rule.Max)}, nil
+		}
+	}
+	return nil, nil
+}
+
+// CheckRemoval checks that a user can be removed from the targets
+func (p *Policy) CheckRemoval(targets []string, username string) *Violation {
+	if p == nil {
+		return nil
+	}
+
+	for _, rule := range p.ProtectedUsers {
+		if !targetsMatch(rule.Targets, targets) {
+			continue
+		}
+		for _, user := range rule.Users {
+			if strings.EqualFold(user, username) {
+				return &Violation{Rule: rule.Name, Message: fmt.Sprintf("user %s is protected and cannot be removed", username)}
+			}
+		}
+	}
+	return nil
+}
+
+// appliesTo reports whether a rule with the given routes applies to route
+func appliesTo(routes []string, route string) bool {
+	return len(routes) == 0 || contains(routes, route)
+}
+
+// targetsMatch reports whether any target matches the patterns, which match everything when empty.
+// Caps and protected users restrict requests, so they apply as soon as one of their targets is touched.
+func targetsMatch(patterns, targets []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, target := range targets {
+		if matchesAny(patterns, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAny reports whether a target (`org` or `owner/repo`) matches one of the patterns of its shape.
+// Patterns without a slash match the organization (or owner) of the target, patterns with a slash only repositories.
+func matchesAny(patterns []string, target string) bool {
+	target = strings.ToLower(target)
+	owner, _, _ := strings.Cut(target, "/")
+	for _, pattern := range patterns {
+		if !patternAppliesTo(pattern, target) {
+			continue
+		}
+		pattern = strings.ToLower(pattern)
+		subject := target
+		if !strings.Contains(pattern, "/") {
+			subject = owner
+		}
+		if matched, _ := path.Match(pattern, subject); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// appliesToShape reports whether one of the patterns can match a target of the shape of target
+func appliesToShape(patterns []string, target string) bool {
+	for _, pattern := range patterns {
+		if patternAppliesTo(pattern, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// patternAppliesTo reports whether a pattern can match a target of the shape of target:
+// repository patterns (`owner/repo`) never match an organization target
+func patternAppliesTo(pattern, target string) bool {
+	return !strings.Contains(pattern, "/") || strings.Contains(target, "/")
+}
+
+// normalizeRole maps the base role names to the request vocabulary (`read` → `pull`, `write` → `push`)
+func normalizeRole(role string) string {
+	switch role = strings.ToLower(role); role {
+	case "read":
+		return "pull"
+	case "write":
+		return "push"
+	}
+	return role
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,271 @@
+package policy
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const testPolicy = `
+allow:
+  - name: krateo-orgs
+    targets: ["krateo*", "partner/shared-*"]
+deny:
+  - name: no-infra
+    targets: ["krateoplatformops/infra"]
+  - name: no-team-changes-in-sandbox
+    routes: [team]
+    targets: ["krateo-sandbox"]
+permissions:
+  - name: no-admin
+    max: maintain
+  - name: outside-read-only
+    routes: [collaborator, collaborators]
+    outside_collaborators: true
+    max: read
+protected_users:
+  - name: break-glass
+    users: ["Krateo-Admin"]
+    targets: ["krateoplatformops"]
+`
+
+func mustParse(t *testing.T, content string) *Policy {
+	t.Helper()
+	p, err := Parse([]byte(content))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return p
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name          string
+		content       string
+		expectedError string
+	}{
+		{name: "empty", content: ""},
+		{name: "valid", content: testPolicy},
+		{name: "unknown field", content: "allowed: []", expectedError: "field allowed not found"},
+		{name: "missing name", content: "allow: [{targets: [krateo]}]", expectedError: "allow rule without name"},
+		{name: "duplicate name", content: "allow: [{name: a, targets: [x]}]\ndeny: [{name: a, targets: [y]}]", expectedError: "duplicate rule name a"},
+		{name: "unknown route", content: "deny: [{name: a, routes: [repos], targets: [x]}]", expectedError: `unknown route "repos"`},
+		{name: "invalid pattern", content: "deny: [{name: a, targets: ['x[']}]", expectedError: `invalid target pattern "x["`},
+		{name: "too many slashes", content: "deny: [{name: a, targets: [a/b/c]}]", expectedError: `invalid target pattern "a/b/c"`},
+		{name: "invalid max", content: "permissions: [{name: a, max: owner}]", expectedError: `max must be a base role`},
+		{name: "custom role as max", content: "permissions: [{name: a, max: auditor}]", expectedError: `got "auditor"`},
+		{name: "protected without users", content: "protected_users: [{name: a}]", expectedError: "users are required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.content))
+			if tt.expectedError == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+				t.Errorf("expected error containing %q, got %v", tt.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestCheckTargets(t *testing.T) {
+	p := mustParse(t, testPolicy)
+
+	tests := []struct {
+		name         string
+		route        string
+		targets      []string
+		expectedRule string
+	}{
+		{name: "allowed org", route: RouteCollaborator, targets: []string{"krateoplatformops/website"}},
+		{name: "case insensitive", route: RouteCollaborator, targets: []string{"KrateoPlatformOps/Website"}},
+		{name: "allowed repository pattern", route: RouteCollaborator, targets: []string{"partner/shared-docs"}},
+		{name: "other repository of partner", route: RouteCollaborator, targets: []string{"partner/private"}, expectedRule: "allow"},
+		{name: "unknown org", route: RouteCollaborator, targets: []string{"octocat/hello-world"}, expectedRule: "allow"},
+		{name: "denied repository", route: RouteCollaborators, targets: []string{"krateoplatformops/infra"}, expectedRule: "no-infra"},
+		{name: "denied for route", route: RouteTeam, targets: []string{"krateo-sandbox"}, expectedRule: "no-team-changes-in-sandbox"},
+		{name: "not denied for other routes", route: RouteTeamRepository, targets: []string{"krateo-sandbox", "krateo-sandbox/demo"}},
+		{name: "every target must be allowed", route: RouteTeamRepository, targets: []string{"krateoplatformops", "octocat/hello-world"}, expectedRule: "allow"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := p.CheckTargets(tt.route, tt.targets)
+			if tt.expectedRule == "" {
+				if v != nil {
+					t.Errorf("unexpected violation: %v", v)
+				}
+				return
+			}
+			if v == nil || v.Rule != tt.expectedRule {
+				t.Errorf("expected violation of rule %s, got %v", tt.expectedRule, v)
+			}
+		})
+	}
+}
+
+func TestCheckTargets_NoAllowRules(t *testing.T) {
+	p := mustParse(t, "deny: [{name: no-infra, targets: [krateoplatformops/infra]}]")
+
+	if v := p.CheckTargets(RouteCollaborator, []string{"octocat/hello-world"}); v != nil {
+		t.Errorf("unexpected violation: %v", v)
+	}
+	if v := (*Policy)(nil).CheckTargets(RouteCollaborator, []string{"krateoplatformops/infra"}); v != nil {
+		t.Errorf("unexpected violation of the nil policy: %v", v)
+	}
+}
+
+func TestCheckGrant(t *testing.T) {
+	p := mustParse(t, testPolicy)
+	targets := []string{"krateoplatformops/website"}
+	member := func() (bool, error) { return false, nil }
+	outside := func() (bool, error) { return true, nil }
+	baseRole := func(role string) func() (string, error) {
+		return func() (string, error) { return role, nil }
+	}
+
+	tests := []struct {
+		name         string
+		route        string
+		grant        Grant
+		expectedRule string
+		expectedErr  string
+	}{
+		{name: "maintain to member", route: RouteCollaborator, grant: Grant{Permission: "maintain", Outside: member}},
+		{name: "admin to member", route: RouteCollaborator, grant: Grant{Permission: "admin", Outside: member}, expectedRule: "no-admin"},
+		{name: "admin to team", route: RouteTeamRepository, grant: Grant{Permission: "ADMIN"}, expectedRule: "no-admin"},
+		{name: "write to team", route: RouteTeamRepository, grant: Grant{Permission: "push"}},
+		{name: "read to outside collaborator", route: RouteCollaborator, grant: Grant{Permission: "read", Outside: outside}},
+		{name: "write to outside collaborator", route: RouteCollaborators, grant: Grant{Permission: "write", Outside: outside}, expectedRule: "outside-read-only"},
+		{name: "custom role of base maintain", route: RouteCollaborator, grant: Grant{Permission: "release-manager", BaseRole: baseRole("maintain"), Outside: member}},
+		{name: "custom role of base admin", route: RouteCollaborator, grant: Grant{Permission: "owner-like", BaseRole: baseRole("admin"), Outside: member}, expectedRule: "no-admin"},
+		{name: "unknown custom role", route: RouteCollaborator, grant: Grant{Permission: "mystery", BaseRole: baseRole(""), Outside: member}, expectedRule: "no-admin"},
+		{
+			name:        "membership error",
+			route:       RouteCollaborator,
+			grant:       Grant{Permission: "pull", Outside: func() (bool, error) { return false, errors.New("boom") }},
+			expectedErr: "boom",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := p.CheckGrant(tt.route, targets, tt.grant)
+			if tt.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedErr) {
+					t.Errorf("expected error %q, got %v", tt.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.expectedRule == "" {
+				if v != nil {
+					t.Errorf("unexpected violation: %v", v)
+				}
+				return
+			}
+			if v == nil || v.Rule != tt.expectedRule {
+				t.Errorf("expected violation of rule %s, got %v", tt.expectedRule, v)
+			}
+		})
+	}
+}
+
+func TestCheckGrant_OutsideResolvedOnlyWhenNeeded(t *testing.T) {
+	p := mustParse(t, "permissions: [{name: no-admin, max: maintain}]")
+
+	_, err := p.CheckGrant(RouteCollaborator, []string{"krateo/website"}, Grant{
+		Permission: "push",
+		Outside: func() (bool, error) {
+			t.Error("membership resolved without an outside collaborators rule")
+			return false, nil
+		},
+	})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestCheckRemoval(t *testing.T) {
+	p := mustParse(t, testPolicy)
+
+	if v := p.CheckRemoval([]string{"krateoplatformops/website"}, "krateo-admin"); v == nil || v.Rule != "break-glass" {
+		t.Errorf("expected violation of rule break-glass, got %v", v)
+	}
+	if v := p.CheckRemoval([]string{"krateo-sandbox/website"}, "krateo-admin"); v != nil {
+		t.Errorf("unexpected violation outside of the protected targets: %v", v)
+	}
+	if v := p.CheckRemoval([]string{"krateoplatformops/website"}, "mona"); v != nil {
+		t.Errorf("unexpected violation for an unprotected user: %v", v)
+	}
+}
+
+func TestTeamRepositoryTargets(t *testing.T) {
+	// Team repository requests target the org of the team and the repository: repository patterns only match the latter
+	p := mustParse(t, `
+allow:
+  - name: website-only
+    routes: [teamrepository, team]
+    targets: ["krateoplatformops/website", "partner/*"]
+deny:
+  - name: no-partner-private
+    targets: ["partner/private"]
+permissions:
+  - name: website-read-only
+    routes: [teamrepository]
+    targets: ["krateoplatformops/website"]
+    max: read
+protected_users:
+  - name: website-owner
+    users: ["mona"]
+    targets: ["krateoplatformops/website"]
+`)
+	website := []string{"krateoplatformops", "krateoplatformops/website"}
+
+	targetTests := []struct {
+		name         string
+		route        string
+		targets      []string
+		expectedRule string
+	}{
+		{name: "allowed repository", route: RouteTeamRepository, targets: website},
+		{name: "allowed repository pattern", route: RouteTeamRepository, targets: []string{"partner", "partner/docs"}},
+		{name: "repository not allowed", route: RouteTeamRepository, targets: []string{"krateoplatformops", "krateoplatformops/infra"}, expectedRule: "allow"},
+		{name: "denied repository", route: RouteTeamRepository, targets: []string{"partner", "partner/private"}, expectedRule: "no-partner-private"},
+		{name: "team route without org pattern", route: RouteTeam, targets: []string{"krateoplatformops"}, expectedRule: "allow"},
+	}
+	for _, tt := range targetTests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := p.CheckTargets(tt.route, tt.targets)
+			if tt.expectedRule == "" {
+				if v != nil {
+					t.Errorf("unexpected violation: %v", v)
+				}
+				return
+			}
+			if v == nil || v.Rule != tt.expectedRule {
+				t.Errorf("expected violation of rule %s, got %v", tt.expectedRule, v)
+			}
+		})
+	}
+
+	if v, err := p.CheckGrant(RouteTeamRepository, website, Grant{Permission: "push"}); err != nil || v == nil || v.Rule != "website-read-only" {
+		t.Errorf("expected violation of rule website-read-only, got %v (error %v)", v, err)
+	}
+	if v, err := p.CheckGrant(RouteTeamRepository, website, Grant{Permission: "pull"}); err != nil || v != nil {
+		t.Errorf("unexpected violation: %v (error %v)", v, err)
+	}
+	if v := p.CheckRemoval(website, "Mona"); v == nil || v.Rule != "website-owner" {
+		t.Errorf("expected violation of rule website-owner, got %v", v)
+	}
+	if v := p.CheckRemoval([]string{"krateoplatformops", "krateoplatformops/infra"}, "mona"); v != nil {
+		t.Errorf("unexpected violation outside of the protected targets: %v", v)
+	}
+}
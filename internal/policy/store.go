@@ -0,0 +1,99 @@
+package policy
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// DefaultReloadInterval is how often the policy file is checked for changes when not configured
+const DefaultReloadInterval = 10 * time.Second
+
+// Store holds the policy of a file and reloads it when the file changes.
+// A nil Store has no policy and allows everything.
+type Store struct {
+	filename string
+	log      *zerolog.Logger
+
+	mu      sync.RWMutex
+	policy  *Policy
+	modTime time.Time
+	size    int64
+}
+
+// NewStore loads the policy file, failing when it is missing or invalid
+func NewStore(filename string, log *zerolog.Logger) (*Store, error) {
+	s := &Store{filename: filename, log: log}
+	if _, err := s.reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Policy returns the current policy
+func (s *Store) Policy() *Policy {
+	if s == nil {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.policy
+}
+
+// Watch checks the policy file for changes every interval until the context is done.
+// A changed file that cannot be loaded is logged and the previous policy is kept.
+func (s *Store) Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultReloadInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := s.reload()
+			if err != nil {
+				s.log.Error().Err(err).Str("file", s.filename).Msg("Failed to reload policy, keeping the previous one")
+			} else if reloaded {
+				s.log.Info().Str("file", s.filename).Msg("Policy reloaded")
+			}
+		}
+	}
+}
+
+// reload loads the policy file when it changed since the last load, reporting whether it did
+func (s *Store) reload() (bool, error) {
+	info, err := os.Stat(s.filename)
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.RLock()
+	unchanged := s.policy != nil && info.ModTime().Equal(s.modTime) && info.Size() == s.size
+	s.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	p, err := Load(s.filename)
+	if err != nil {
+		// Remember the failed version, so that it is not reported again until the file changes
+		s.mu.Lock()
+		if s.policy != nil {
+			s.modTime, s.size = info.ModTime(), info.Size()
+		}
+		s.mu.Unlock()
+		return false, err
+	}
+
+	s.mu.Lock()
+	s.policy, s.modTime, s.size = p, info.ModTime(), info.Size()
+	s.mu.Unlock()
+	return true, nil
+}
@@ -0,0 +1,109 @@
+package policy
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func writePolicy(t *testing.T, filename, content string, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(filename, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write policy: %v", err)
+	}
+	// Set the modification time explicitly, file systems may have a coarse resolution
+	if err := os.Chtimes(filename, modTime, modTime); err != nil {
+		t.Fatalf("failed to set modification time: %v", err)
+	}
+}
+
+func TestStore_Reload(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+	filename := filepath.Join(t.TempDir(), "policy.yaml")
+	start := time.Now().Add(-time.Hour)
+	writePolicy(t, filename, "deny: [{name: first, targets: [krateo]}]", start)
+
+	store, err := NewStore(filename, &logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v := store.Policy().CheckTargets(RouteCollaborator, []string{"krateo/website"}); v == nil || v.Rule != "first" {
+		t.Fatalf("expected violation of rule first, got %v", v)
+	}
+
+	// Unchanged file
+	if reloaded, err := store.reload(); reloaded || err != nil {
+		t.Errorf("expected no reload, got %v, %v", reloaded, err)
+	}
+
+	// Changed file
+	writePolicy(t, filename, "deny: [{name: second, targets: [krateo]}]", start.Add(time.Minute))
+	if reloaded, err := store.reload(); !reloaded || err != nil {
+		t.Fatalf("expected a reload, got %v, %v", reloaded, err)
+	}
+	if v := store.Policy().CheckTargets(RouteCollaborator, []string{"krateo/website"}); v == nil || v.Rule != "second" {
+		t.Errorf("expected violation of rule second, got %v", v)
+	}
+
+	// Invalid file: the previous policy is kept, and the error is reported once
+	writePolicy(t, filename, "deny: [{targets: [krateo]}]", start.Add(2*time.Minute))
+	if _, err := store.reload(); err == nil {
+		t.Error("expected an error for the invalid policy")
+	}
+	if _, err := store.reload(); err != nil {
+		t.Errorf("expected the invalid policy to be reported once, got %v", err)
+	}
+	if v := store.Policy().CheckTargets(RouteCollaborator, []string{"krateo/website"}); v == nil || v.Rule != "second" {
+		t.Errorf("expected the previous policy to be kept, got %v", v)
+	}
+}
+
+func TestStore_Watch(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+	filename := filepath.Join(t.TempDir(), "policy.yaml")
+	start := time.Now().Add(-time.Hour)
+	writePolicy(t, filename, "", start)
+
+	store, err := NewStore(filename, &logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go store.Watch(ctx, 10*time.Millisecond)
+
+	writePolicy(t, filename, "deny: [{name: watched, targets: [krateo]}]", start.Add(time.Minute))
+	deadline := time.Now().Add(5 * time.Second)
+	for store.Policy().CheckTargets(RouteCollaborator, []string{"krateo/website"}) == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("policy not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestNewStore_Errors(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+	dir := t.TempDir()
+
+	if _, err := NewStore(filepath.Join(dir, "missing.yaml"), &logger); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+
+	filename := filepath.Join(dir, "invalid.yaml")
+	writePolicy(t, filename, "allow: [{name: a, routes: [unknown]}]", time.Now())
+	if _, err := NewStore(filename, &logger); err == nil {
+		t.Error("expected an error for an invalid policy")
+	}
+
+	var nilStore *Store
+	if nilStore.Policy() != nil {
+		t.Error("expected no policy for a nil store")
+	}
+}
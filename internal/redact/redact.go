@@ -0,0 +1,124 @@
+// Package redact removes credentials from what the plugin writes to its logs:
+// Authorization values, GitHub tokens, credentials in URLs and the values of secret-like fields.
+//
+// The Writer redacts every log line before it is written, whatever the handler that logged it;
+// String and JSON redact single values, e.g. request bodies before they are logged or audited.
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Placeholder replaces the redacted values
+const Placeholder = "[REDACTED]"
+
+// secretKeyPattern matches the names of secret-like fields, `*_hash` fields (e.g. token hashes) are not secret
+var secretKeyPattern = regexp.MustCompile(`(?i)(token|secret|password|passwd|authorization|api_?key|private_?key|credential|cookie)`)
+
+var (
+	// GitHub tokens: personal access tokens, OAuth, user-to-server, server-to-server and refresh tokens
+	githubTokenPattern = regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{20,}|github_pat_[A-Za-z0-9_]{20,})`)
+	// Authorization schemes followed by their credentials
+	schemePattern = regexp.MustCompile(`(?i)\b(bearer|token|basic)(\s+)[A-Za-z0-9._~+/=:-]{8,}`)
+	// Header values, as written by fmt (`Authorization:[...]`) or in JSON (`"Authorization":"..."`)
+	headerPattern = regexp.MustCompile(`(?i)((?:authorization|cookie|x-hub-signature(?:-256)?)\\?"?\s*[:=]\s*\[?\\?"?)[^\s,\]}"\\]+(?:\s+[^\s,\]}"\\]+)?`)
+	// Credentials in URL query parameters
+	queryPattern = regexp.MustCompile(`(?i)([?&](?:access_token|token|client_secret|password|secret|api_key|key|sig|signature|code)=)[^&\s"'\\]+`)
+	// Credentials in URL user info
+	userInfoPattern = regexp.MustCompile(`(://[^/\s:@"\\]+:)[^@\s/"\\]+@`)
+	// JSON fields, and JSON fields escaped in a JSON string (e.g. a body in a log message)
+	jsonFieldPattern        = regexp.MustCompile(`"([A-Za-z0-9_.-]+)"(\s*:\s*)"((?:[^"\\]|\\.)*)"`)
+	escapedJSONFieldPattern = regexp.MustCompile(`\\"([A-Za-z0-9_.-]+)\\"(\s*:\s*)\\"(.*?)\\"`)
+)
+
+// isSecretKey reports whether a field name is secret-like
+func isSecretKey(key string) bool {
+	return secretKeyPattern.MatchString(key) && !strings.HasSuffix(strings.ToLower(key), "hash")
+}
+
+// String redacts the credentials of a text
+func String(s string) string {
+	s = githubTokenPattern.ReplaceAllString(s, Placeholder)
+	s = headerPattern.ReplaceAllString(s, "${1}"+Placeholder)
+	s = schemePattern.ReplaceAllString(s, "${1}${2}"+Placeholder)
+	s = queryPattern.ReplaceAllString(s, "${1}"+Placeholder)
+	s = userInfoPattern.ReplaceAllString(s, "${1}"+Placeholder+"@")
+	s = redactFields(jsonFieldPattern, s, `"%s"%s"`+Placeholder+`"`)
+	s = redactFields(escapedJSONFieldPattern, s, `\"%s\"%s\"`+Placeholder+`\"`)
+	return s
+}
+
+// redactFields replaces the values of the secret-like fields matched by pattern
+func redactFields(pattern *regexp.Regexp, s, replacement string) string {
+	return pattern.ReplaceAllStringFunc(s, func(match string) string {
+		groups := pattern.FindStringSubmatch(match)
+		if !isSecretKey(groups[1]) {
+			return match
+		}
+		return strings.Replace(strings.Replace(replacement, "%s", groups[1], 1), "%s", groups[2], 1)
+	})
+}
+
+// JSON redacts a JSON document: the values of secret-like fields are replaced and the other strings are redacted as text.
+// Content that is not JSON is redacted as text.
+func JSON(body []byte) []byte {
+	var value any
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return []byte(String(string(body)))
+	}
+
+	redacted, err := json.Marshal(redactValue(value))
+	if err != nil {
+		return []byte(String(string(body)))
+	}
+	return redacted
+}
+
+func redactValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, field := range v {
+			if _, isString := field.(string); isString && isSecretKey(key) {
+				v[key] = Placeholder
+				continue
+			}
+			v[key] = redactValue(field)
+		}
+		return v
+	case []any:
+		for i, item := range v {
+			v[i] = redactValue(item)
+		}
+		return v
+	case string:
+		return String(v)
+	default:
+		return v
+	}
+}
+
+// Writer redacts everything written to an io.Writer, such as the output of a logger.
+// Each write is redacted on its own: loggers write one line per call.
+type Writer struct {
+	w io.Writer
+}
+
+// NewWriter returns a Writer redacting what is written to w
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Write redacts p and writes it to the underlying writer.
+// It reports len(p) on success, since the redacted content may have a different length.
+func (w *Writer) Write(p []byte) (int, error) {
+	if _, err := w.w.Write([]byte(String(string(p)))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
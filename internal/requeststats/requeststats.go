@@ -0,0 +1,91 @@
+// Package requeststats counts what serving a request costs: the GitHub API calls it makes, with their total duration
+// and the IDs GitHub gave them, and the cache hits that spared some.
+//
+// The stats are carried by the context of the request, so that the clients and caches serving it can update them
+// without knowing about the request. All the methods are safe for concurrent use, and for a nil *Stats
+// (contexts without stats) on which they do nothing.
+package requeststats
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// statsKey is the context key of the stats of a request
+type statsKey struct{}
+
+// Stats of a request
+type Stats struct {
+	mu               sync.Mutex
+	calls            int
+	duration         time.Duration
+	githubRequestIDs []string
+	cacheHits        int
+}
+
+// NewContext returns a context carrying new stats
+func NewContext(ctx context.Context) (context.Context, *Stats) {
+	stats := &Stats{}
+	return context.WithValue(ctx, statsKey{}, stats), stats
+}
+
+// FromContext returns the stats of the request of ctx, nil when it carries none
+func FromContext(ctx context.Context) *Stats {
+	stats, _ := ctx.Value(statsKey{}).(*Stats)
+	return stats
+}
+
+// AddCall counts a GitHub API call, with the X-GitHub-Request-Id of its response (empty when there is none)
+func (s *Stats) AddCall(duration time.Duration, githubRequestID string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	s.duration += duration
+	if githubRequestID != "" {
+		s.githubRequestIDs = append(s.githubRequestIDs, githubRequestID)
+	}
+}
+
+// AddCacheHit counts a lookup answered from a cache
+func (s *Stats) AddCacheHit() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cacheHits++
+}
+
+// Calls returns the number of GitHub API calls and their total duration
+func (s *Stats) Calls() (int, time.Duration) {
+	if s == nil {
+		return 0, 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls, s.duration
+}
+
+// GitHubRequestIDs returns the X-GitHub-Request-Id of the GitHub API calls
+func (s *Stats) GitHubRequestIDs() []string {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.githubRequestIDs...)
+}
+
+// CacheHits returns the number of cache hits
+func (s *Stats) CacheHits() int {
+	if s == nil {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cacheHits
+}
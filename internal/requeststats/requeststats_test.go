@@ -0,0 +1,52 @@
+package requeststats
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	ctx, stats := NewContext(context.Background())
+	if FromContext(ctx) != stats {
+		t.Fatal("expected the stats to be carried by the context")
+	}
+
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			githubRequestID := ""
+			if i == 0 {
+				githubRequestID = "0400:1"
+			}
+			FromContext(ctx).AddCall(10*time.Millisecond, githubRequestID)
+			FromContext(ctx).AddCacheHit()
+		}()
+	}
+	wg.Wait()
+
+	if calls, duration := stats.Calls(); calls != 10 || duration != 100*time.Millisecond {
+		t.Errorf("expected 10 calls lasting 100ms, got %d lasting %v", calls, duration)
+	}
+	if hits := stats.CacheHits(); hits != 10 {
+		t.Errorf("expected 10 cache hits, got %d", hits)
+	}
+	if ids := stats.GitHubRequestIDs(); !reflect.DeepEqual(ids, []string{"0400:1"}) {
+		t.Errorf("expected the GitHub request IDs of the responses having one, got %v", ids)
+	}
+}
+
+func TestStats_WithoutStats(t *testing.T) {
+	// Contexts without stats are ignored
+	stats := FromContext(context.Background())
+	stats.AddCall(time.Second, "0400:1")
+	stats.AddCacheHit()
+
+	if calls, duration := stats.Calls(); calls != 0 || duration != 0 || stats.CacheHits() != 0 || stats.GitHubRequestIDs() != nil {
+		t.Errorf("expected empty stats, got %d calls lasting %v", calls, duration)
+	}
+}
@@ -0,0 +1,274 @@
+package roles
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/githuburl"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/requeststats"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/utils"
+)
+
+/*
+The following are utility functions to deal with GitHub permissions discrepancies in the API responses
+
+'permission' in CR		'role_name' in GitHub RESPONSE		'permissions' in Invitation REQUEST
+pull              		read                                read
+push                  	write                               write
+admin                 	admin                               admin
+maintain              	maintain                            maintain
+triage                	triage                              triage
+<custom role>			<custom role>						<custom role>
+*/
+
+// NormalizeRoleName maps a role name reported by GitHub to the permission value used in requests (and CRs).
+// Unknown role names (e.g. custom repository roles) are returned as is.
+func NormalizeRoleName(roleName string) string {
+	switch strings.ToLower(roleName) {
+	case "read", "pull":
+		return "pull"
+	case "write", "push":
+		return "push"
+	case "admin", "maintain", "triage":
+		return strings.ToLower(roleName)
+	default:
+		return roleName
+	}
+}
+
+// InvitationPermission maps a permission value used in requests to the value expected by the Invitations API.
+// Unknown permissions (e.g. custom repository roles) are returned as is.
+func InvitationPermission(permission string) string {
+	switch strings.ToLower(permission) {
+	case "pull", "read":
+		return "read"
+	case "push", "write":
+		return "write"
+	case "admin", "maintain", "triage":
+		return strings.ToLower(permission)
+	default:
+		return permission
+	}
+}
+
+// IsBaseRole reports whether the role is one of the GitHub base repository roles
+func IsBaseRole(role string) bool {
+	switch strings.ToLower(role) {
+	case "pull", "read", "push", "write", "admin", "maintain", "triage":
+		return true
+	default:
+		return false
+	}
+}
+
+// CustomRole represents a GitHub organization custom repository role
+type CustomRole struct {
+	ID          int64    `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	BaseRole    string   `json:"base_role"`
+	Permissions []string `json:"permissions"`
+}
+
+type customRolesResponse struct {
+	TotalCount  int          `json:"total_count"`
+	CustomRoles []CustomRole `json:"custom_roles"`
+}
+
+type httpDoer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// minRefetchInterval is the minimum interval between the fetches of the custom roles of an organization
+// triggered by unknown roles, so that requests with unknown roles cannot flood GitHub
+const minRefetchInterval = 30 * time.Second
+
+// sweepInterval is how often the expired entries are dropped from the cache
+const sweepInterval = time.Minute
+
+type cacheEntry struct {
+	roles   []CustomRole
+	fetched time.Time
+	expires time.Time
+}
+
+// Resolver fetches and caches the custom repository roles of organizations.
+// Entries are keyed by organization and token hash, since different tokens may see different organizations.
+type Resolver struct {
+	client httpDoer
+	ttl    time.Duration
+	now    func() time.Time
+
+	mu        sync.Mutex
+	cache     map[string]cacheEntry
+	lastSweep time.Time
+}
+
+// NewResolver creates a Resolver caching custom roles for the given TTL
+func NewResolver(client httpDoer, ttl time.Duration) *Resolver {
+	return &Resolver{
+		client: client,
+		ttl:    ttl,
+		now:    time.Now,
+		cache:  make(map[string]cacheEntry),
+	}
+}
+
+// CustomRoles returns the custom repository roles of an organization.
+// Owners that do not support custom roles (users, non-enterprise organizations or tokens
+// without access) result in an empty list.
+func (r *Resolver) CustomRoles(ctx context.Context, org, authHeader string) ([]CustomRole, error) {
+	key := cacheKey(org, authHeader)
+
+	r.mu.Lock()
+	entry, exists := r.cache[key]
+	r.mu.Unlock()
+	if exists && r.now().Before(entry.expires) {
+		requeststats.FromContext(ctx).AddCacheHit()
+		return entry.roles, nil
+	}
+
+	customRoles, err := r.fetchCustomRoles(ctx, org, authHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	r.store(key, customRoles)
+	return customRoles, nil
+}
+
+// refetch fetches the custom roles of an organization again, unless they were fetched less than
+// minRefetchInterval ago. refetched is false when the cached roles are recent enough.
+func (r *Resolver) refetch(ctx context.Context, org, authHeader string) (customRoles []CustomRole, refetched bool, err error) {
+	key := cacheKey(org, authHeader)
+
+	r.mu.Lock()
+	entry, exists := r.cache[key]
+	if exists && r.now().Sub(entry.fetched) < minRefetchInterval {
+		r.mu.Unlock()
+		return nil, false, nil
+	}
+	// Concurrent misses do not refetch as well
+	previous := entry.fetched
+	entry.fetched = r.now()
+	r.cache[key] = entry
+	r.mu.Unlock()
+
+	customRoles, err = r.fetchCustomRoles(ctx, org, authHeader)
+	if err != nil {
+		// A failed fetch does not delay the next refetch
+		r.mu.Lock()
+		if current, exists := r.cache[key]; exists && current.fetched.Equal(entry.fetched) {
+			current.fetched = previous
+			r.cache[key] = current
+		}
+		r.mu.Unlock()
+		return nil, false, err
+	}
+	r.store(key, customRoles)
+	return customRoles, true, nil
+}
+
+// store caches the custom roles of key, dropping the expired entries every sweepInterval
+func (r *Resolver) store(key string, customRoles []CustomRole) {
+	now := r.now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if now.Sub(r.lastSweep) >= sweepInterval {
+		r.lastSweep = now
+		for k, entry := range r.cache {
+			// Entries being refetched are kept, so that concurrent misses do not refetch as well
+			if !now.Before(entry.expires) && now.Sub(entry.fetched) >= minRefetchInterval {
+				delete(r.cache, k)
+			}
+		}
+	}
+	r.cache[key] = cacheEntry{roles: customRoles, fetched: now, expires: now.Add(r.ttl)}
+}
+
+// cacheKey identifies the custom roles of an organization as seen by a token
+func cacheKey(org, authHeader string) string {
+	return strings.ToLower(org) + "/" + utils.HashToken(authHeader)
+}
+
+func (r *Resolver) fetchCustomRoles(ctx context.Context, org, authHeader string) ([]CustomRole, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", githuburl.Join("orgs", org, "custom-repository-roles"), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if authHeader != "" {
+		req.Header.Set("Authorization", authHeader)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusForbidden:
+		// Custom roles are not available for this owner
+		return []CustomRole{}, nil
+	default:
+		return nil, fmt.Errorf("unexpected status code getting custom repository roles: %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	var parsed customRolesResponse
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal custom repository roles: %w", err)
+	}
+	return parsed.CustomRoles, nil
+}
+
+// Canonicalize returns the permission value to use for a role name, in the request vocabulary:
+// base roles are normalized (`read` → `pull`, `write` → `push`) and custom roles are matched
+// case-insensitively and reported with the name defined in the organization.
+// known is false when the role is neither a base role nor a custom role of the organization.
+// A role missing from the cached custom roles may have been created since they were fetched:
+// they are fetched again, at most every minRefetchInterval, before the role is reported unknown.
+func (r *Resolver) Canonicalize(ctx context.Context, org, authHeader, role string) (string, bool, error) {
+	if IsBaseRole(role) {
+		return NormalizeRoleName(role), true, nil
+	}
+
+	customRoles, err := r.CustomRoles(ctx, org, authHeader)
+	if err != nil {
+		return role, false, err
+	}
+	if name, found := findRole(customRoles, role); found {
+		return name, true, nil
+	}
+
+	customRoles, refetched, err := r.refetch(ctx, org, authHeader)
+	if err != nil || !refetched {
+		return role, false, err
+	}
+	if name, found := findRole(customRoles, role); found {
+		return name, true, nil
+	}
+	return role, false, nil
+}
+
+// findRole returns the name of the custom role matching role case-insensitively
+func findRole(customRoles []CustomRole, role string) (string, bool) {
+	for _, customRole := range customRoles {
+		if strings.EqualFold(customRole.Name, role) {
+			return customRole.Name, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,262 @@
+package roles
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/requeststats"
+)
+
+// mockHTTPClient returns the same configured response for every request and counts them
+type mockHTTPClient struct {
+	statusCode int
+	body       string
+	err        error
+	requests   []*http.Request
+}
+
+func (m *mockHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	m.requests = append(m.requests, req)
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &http.Response{
+		StatusCode: m.statusCode,
+		Body:       io.NopCloser(strings.NewReader(m.body)),
+		Header:     make(http.Header),
+	}, nil
+}
+
+const (
+	testOrg   = "testorg"
+	testToken = "token test-token-123"
+)
+
+var customRolesResp = `{
+	"total_count": 1,
+	"custom_roles": [
+		{"id": 8030, "name": "Security Engineer", "description": "Able to contribute code and maintain security pipelines", "base_role": "maintain", "permissions": ["delete_alerts_code_scanning"]}
+	]
+}`
+
+func TestNormalizeRoleName(t *testing.T) {
+	tests := map[string]string{
+		"read":              "pull",
+		"write":             "push",
+		"admin":             "admin",
+		"maintain":          "maintain",
+		"triage":            "triage",
+		"Security Engineer": "Security Engineer",
+	}
+	for roleName, expected := range tests {
+		if got := NormalizeRoleName(roleName); got != expected {
+			t.Errorf("NormalizeRoleName(%q) = %q, want %q", roleName, got, expected)
+		}
+	}
+}
+
+func TestInvitationPermission(t *testing.T) {
+	tests := map[string]string{
+		"pull":              "read",
+		"push":              "write",
+		"admin":             "admin",
+		"maintain":          "maintain",
+		"triage":            "triage",
+		"Security Engineer": "Security Engineer",
+	}
+	for permission, expected := range tests {
+		if got := InvitationPermission(permission); got != expected {
+			t.Errorf("InvitationPermission(%q) = %q, want %q", permission, got, expected)
+		}
+	}
+}
+
+func TestResolver_Canonicalize(t *testing.T) {
+	tests := []struct {
+		name          string
+		role          string
+		client        *mockHTTPClient
+		expected      string
+		expectedKnown bool
+		expectError   bool
+		expectedCalls int
+	}{
+		{
+			name:          "base role does not need custom roles",
+			role:          "write",
+			client:        &mockHTTPClient{statusCode: http.StatusOK, body: customRolesResp},
+			expected:      "push",
+			expectedKnown: true,
+			expectedCalls: 0,
+		},
+		{
+			name:          "custom role is matched case-insensitively",
+			role:          "security engineer",
+			client:        &mockHTTPClient{statusCode: http.StatusOK, body: customRolesResp},
+			expected:      "Security Engineer",
+			expectedKnown: true,
+			expectedCalls: 1,
+		},
+		{
+			name:          "unknown role",
+			role:          "auditor",
+			client:        &mockHTTPClient{statusCode: http.StatusOK, body: customRolesResp},
+			expected:      "auditor",
+			expectedKnown: false,
+			expectedCalls: 1,
+		},
+		{
+			name:          "custom roles not available for the owner",
+			role:          "auditor",
+			client:        &mockHTTPClient{statusCode: http.StatusNotFound, body: `{"message": "Not Found"}`},
+			expected:      "auditor",
+			expectedKnown: false,
+			expectedCalls: 1,
+		},
+		{
+			name:          "unexpected status code",
+			role:          "auditor",
+			client:        &mockHTTPClient{statusCode: http.StatusInternalServerError, body: `{}`},
+			expected:      "auditor",
+			expectError:   true,
+			expectedCalls: 1,
+		},
+		{
+			name:          "network error",
+			role:          "auditor",
+			client:        &mockHTTPClient{err: fmt.Errorf("network error")},
+			expected:      "auditor",
+			expectError:   true,
+			expectedCalls: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver := NewResolver(tt.client, time.Minute)
+
+			got, known, err := resolver.Canonicalize(context.Background(), testOrg, testToken, tt.role)
+			if tt.expectError != (err != nil) {
+				t.Fatalf("unexpected error state: %v", err)
+			}
+			if got != tt.expected || known != tt.expectedKnown {
+				t.Errorf("Canonicalize(%q) = %q, %v, want %q, %v", tt.role, got, known, tt.expected, tt.expectedKnown)
+			}
+			if len(tt.client.requests) != tt.expectedCalls {
+				t.Errorf("expected %d requests, got %d", tt.expectedCalls, len(tt.client.requests))
+			}
+			if tt.expectedCalls > 0 {
+				req := tt.client.requests[0]
+				if req.URL.String() != "https://api.github.com/orgs/testorg/custom-repository-roles" {
+					t.Errorf("unexpected request URL %s", req.URL.String())
+				}
+				if req.Header.Get("Authorization") != testToken {
+					t.Errorf("unexpected Authorization header %s", req.Header.Get("Authorization"))
+				}
+			}
+		})
+	}
+}
+
+func TestResolver_CustomRolesCache(t *testing.T) {
+	client := &mockHTTPClient{statusCode: http.StatusOK, body: customRolesResp}
+	resolver := NewResolver(client, time.Minute)
+
+	now := time.Now()
+	resolver.now = func() time.Time { return now }
+
+	ctx, stats := requeststats.NewContext(context.Background())
+	for i := 0; i < 3; i++ {
+		if _, err := resolver.CustomRoles(ctx, testOrg, testToken); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if len(client.requests) != 1 {
+		t.Errorf("expected custom roles to be cached, got %d requests", len(client.requests))
+	}
+	if hits := stats.CacheHits(); hits != 2 {
+		t.Errorf("expected 2 cache hits in the request stats, got %d", hits)
+	}
+
+	// A different token has its own cache entry
+	if _, err := resolver.CustomRoles(context.Background(), testOrg, "token other"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(client.requests) != 2 {
+		t.Errorf("expected a request for a different token, got %d requests", len(client.requests))
+	}
+
+	// Entries expire after the TTL
+	now = now.Add(2 * time.Minute)
+	if _, err := resolver.CustomRoles(context.Background(), testOrg, testToken); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(client.requests) != 3 {
+		t.Errorf("expected expired entry to be refreshed, got %d requests", len(client.requests))
+	}
+	// and are dropped when another entry is stored
+	if _, exists := resolver.cache[cacheKey(testOrg, "token other")]; exists || len(resolver.cache) != 1 {
+		t.Errorf("expected the expired entry to be dropped, got %d entries", len(resolver.cache))
+	}
+}
+
+func TestResolver_CanonicalizeRefetchesUnknownRoles(t *testing.T) {
+	client := &mockHTTPClient{statusCode: http.StatusOK, body: customRolesResp}
+	resolver := NewResolver(client, 10*time.Minute)
+
+	now := time.Now()
+	resolver.now = func() time.Time { return now }
+
+	// Cached before the role is created
+	if _, known, err := resolver.Canonicalize(context.Background(), testOrg, testToken, "release manager"); err != nil || known {
+		t.Fatalf("expected the role to be unknown, got known %v (error %v)", known, err)
+	}
+	if len(client.requests) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(client.requests))
+	}
+
+	client.body = `{"total_count": 2, "custom_roles": [
+		{"id": 8030, "name": "Security Engineer", "base_role": "maintain"},
+		{"id": 8031, "name": "Release Manager", "base_role": "write"}
+	]}`
+
+	// Unknown roles do not refetch more than every minRefetchInterval
+	now = now.Add(minRefetchInterval / 2)
+	if _, known, err := resolver.Canonicalize(context.Background(), testOrg, testToken, "release manager"); err != nil || known {
+		t.Fatalf("expected the role to be unknown until the next refetch, got known %v (error %v)", known, err)
+	}
+	if len(client.requests) != 1 {
+		t.Fatalf("expected no refetch within the minimum interval, got %d requests", len(client.requests))
+	}
+
+	// The created role is found by a refetch, before the cached roles expire
+	now = now.Add(minRefetchInterval)
+	got, known, err := resolver.Canonicalize(context.Background(), testOrg, testToken, "release manager")
+	if err != nil || !known || got != "Release Manager" {
+		t.Fatalf("expected the created role to be found, got %q, %v (error %v)", got, known, err)
+	}
+	if len(client.requests) != 2 {
+		t.Fatalf("expected 1 refetch, got %d requests", len(client.requests))
+	}
+
+	// The refetched roles are cached
+	if got, known, _ := resolver.Canonicalize(context.Background(), testOrg, testToken, "Release Manager"); !known || got != "Release Manager" || len(client.requests) != 2 {
+		t.Errorf("expected the refetched roles to be cached, got %q, %v after %d requests", got, known, len(client.requests))
+	}
+
+	// A failed refetch does not delay the next one
+	now = now.Add(minRefetchInterval)
+	client.statusCode = http.StatusInternalServerError
+	if _, _, err := resolver.Canonicalize(context.Background(), testOrg, testToken, "Auditor"); err == nil {
+		t.Fatalf("expected the failed refetch to be reported")
+	}
+	client.statusCode = http.StatusOK
+	if _, _, err := resolver.Canonicalize(context.Background(), testOrg, testToken, "Auditor"); err != nil || len(client.requests) != 4 {
+		t.Errorf("expected a refetch after the failed one, got %d requests (error %v)", len(client.requests), err)
+	}
+}
@@ -0,0 +1,178 @@
+// Package tlsconfig builds the TLS configuration of the plugin server.
+//
+// The certificate, the key and the client CA bundle are read from files and reloaded when they change,
+// so that certificates rotated in place (e.g. by cert-manager) are served without a restart.
+// With a client CA bundle, the client certificates are verified against it (mutual TLS).
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/handlers"
+	"github.com/rs/zerolog"
+)
+
+// fileState identifies the version of a file
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+func statFiles(filenames ...string) ([]fileState, error) {
+	states := make([]fileState, 0, len(filenames))
+	for _, filename := range filenames {
+		info, err := os.Stat(filename)
+		if err != nil {
+			return nil, err
+		}
+		states = append(states, fileState{modTime: info.ModTime(), size: info.Size()})
+	}
+	return states, nil
+}
+
+func sameStates(a, b []fileState) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].modTime.Equal(b[i].modTime) || a[i].size != b[i].size {
+			return false
+		}
+	}
+	return true
+}
+
+// reloader keeps a value loaded from files, and loads it again when the files change.
+// A version that cannot be loaded is logged once and the previous value is kept.
+type reloader[T any] struct {
+	filenames []string
+	load      func() (T, error)
+	log       *zerolog.Logger
+
+	mu     sync.Mutex
+	value  T
+	states []fileState
+}
+
+func newReloader[T any](log *zerolog.Logger, load func() (T, error), filenames ...string) (*reloader[T], error) {
+	states, err := statFiles(filenames...)
+	if err != nil {
+		return nil, err
+	}
+	value, err := load()
+	if err != nil {
+		return nil, err
+	}
+	return &reloader[T]{filenames: filenames, load: load, log: log, value: value, states: states}, nil
+}
+
+// get returns the current value, reloaded if the files changed
+func (r *reloader[T]) get() T {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	states, err := statFiles(r.filenames...)
+	if err != nil || sameStates(states, r.states) {
+		return r.value
+	}
+
+	// Remember the version even when it cannot be loaded (e.g. a certificate without its new key yet):
+	// it is loaded again when one of the files changes
+	r.states = states
+	value, err := r.load()
+	if err != nil {
+		r.log.Error().Err(err).Strs("files", r.filenames).Msg("Failed to reload TLS files, keeping the previous ones")
+		return r.value
+	}
+	r.value = value
+	r.log.Info().Strs("files", r.filenames).Msg("TLS files reloaded")
+	return r.value
+}
+
+// New returns the TLS configuration serving the certificate of certFile and keyFile.
+// When clientCAFile is set, client certificates are verified against its CA bundle: the handshake accepts clients
+// without a certificate (e.g. the kubelet probes), RequireClientCertificate rejects their requests.
+func New(certFile, keyFile, clientCAFile string, log *zerolog.Logger) (*tls.Config, error) {
+	certificate, err := newReloader(log, func() (*tls.Certificate, error) {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+		}
+		return &cert, nil
+	}, certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var clientCAs *reloader[*x509.CertPool]
+	if clientCAFile != "" {
+		clientCAs, err = newReloader(log, func() (*x509.CertPool, error) {
+			return loadCertPool(clientCAFile)
+		}, clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	getCertificate := func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return certificate.get(), nil
+	}
+
+	// The configuration of each connection replaces the one of the server, which net/http sets up for HTTP/2
+	nextProtos := []string{"h2", "http/1.1"}
+
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: getCertificate,
+		NextProtos:     nextProtos,
+		// Each handshake gets the current client CA bundle
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			config := &tls.Config{
+				MinVersion:     tls.VersionTLS12,
+				GetCertificate: getCertificate,
+				NextProtos:     nextProtos,
+			}
+			if clientCAs != nil {
+				config.ClientAuth = tls.VerifyClientCertIfGiven
+				config.ClientCAs = clientCAs.get()
+			}
+			return config, nil
+		},
+	}, nil
+}
+
+// loadCertPool reads a PEM bundle of CA certificates
+func loadCertPool(filename string) (*x509.CertPool, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA bundle: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(content) {
+		return nil, fmt.Errorf("no certificate found in client CA bundle %s", filename)
+	}
+	return pool, nil
+}
+
+// RequireClientCertificate rejects with 401 the requests without a verified client certificate,
+// except those of the exempt paths (e.g. the health checks)
+func RequireClientCertificate(next http.Handler, exemptPaths ...string) http.Handler {
+	exempt := make(map[string]bool, len(exemptPaths))
+	for _, path := range exemptPaths {
+		exempt[path] = true
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !exempt[r.URL.Path] && (r.TLS == nil || len(r.TLS.VerifiedChains) == 0) {
+			handlers.WriteError(w, r, http.StatusUnauthorized, "A client certificate signed by the configured CA is required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,311 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// testCA is a locally generated certificate authority
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create CA certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a PEM certificate and key signed by the CA, for a server (with the localhost names) or a client
+func (ca *testCA) issue(t *testing.T, commonName string, serial int64, server bool) ([]byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if server {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		template.DNSNames = []string{"localhost"}
+		template.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// writeFile writes a file with an explicit modification time, file systems may have a coarse resolution
+func writeFile(t *testing.T, filename string, content []byte, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(filename, content, 0o600); err != nil {
+		t.Fatalf("failed to write %s: %v", filename, err)
+	}
+	if err := os.Chtimes(filename, modTime, modTime); err != nil {
+		t.Fatalf("failed to set modification time: %v", err)
+	}
+}
+
+// startServer serves a handler with the TLS configuration of the files
+func startServer(t *testing.T, certFile, keyFile, clientCAFile string, handler http.Handler) *httptest.Server {
+	t.Helper()
+	logger := zerolog.New(io.Discard)
+	config, err := New(certFile, keyFile, clientCAFile, &logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	server := httptest.NewUnstartedServer(handler)
+	server.TLS = config
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newClient returns a client trusting the CA, presenting the client certificate when given
+func newClient(t *testing.T, ca *testCA, clientCert, clientKey []byte) *http.Client {
+	t.Helper()
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(ca.pem)
+	config := &tls.Config{RootCAs: pool}
+	if clientCert != nil {
+		cert, err := tls.X509KeyPair(clientCert, clientKey)
+		if err != nil {
+			t.Fatalf("failed to load client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	// New connections for every request, so that each request makes a handshake
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: config, DisableKeepAlives: true}}
+}
+
+func servedSerial(t *testing.T, client *http.Client, url string) int64 {
+	t.Helper()
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	return resp.TLS.PeerCertificates[0].SerialNumber.Int64()
+}
+
+func TestNew_ReloadsCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	ca := newTestCA(t, "test CA")
+	start := time.Now().Add(-time.Hour)
+
+	cert, key := ca.issue(t, "localhost", 10, true)
+	writeFile(t, certFile, cert, start)
+	writeFile(t, keyFile, key, start)
+
+	server := startServer(t, certFile, keyFile, "", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	client := newClient(t, ca, nil, nil)
+
+	if serial := servedSerial(t, client, server.URL); serial != 10 {
+		t.Fatalf("expected certificate 10, got %d", serial)
+	}
+
+	// A certificate rotated without its key yet keeps the previous pair
+	rotatedCert, rotatedKey := ca.issue(t, "localhost", 11, true)
+	writeFile(t, certFile, rotatedCert, start.Add(time.Minute))
+	if serial := servedSerial(t, client, server.URL); serial != 10 {
+		t.Errorf("expected the previous certificate 10 while the key is not rotated, got %d", serial)
+	}
+
+	writeFile(t, keyFile, rotatedKey, start.Add(time.Minute))
+	if serial := servedSerial(t, client, server.URL); serial != 11 {
+		t.Errorf("expected the rotated certificate 11, got %d", serial)
+	}
+}
+
+func TestNew_HTTP2(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, clientCAFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), filepath.Join(dir, "ca.crt")
+	ca := newTestCA(t, "test CA")
+	cert, key := ca.issue(t, "localhost", 10, true)
+	writeFile(t, certFile, cert, time.Now())
+	writeFile(t, keyFile, key, time.Now())
+	writeFile(t, clientCAFile, ca.pem, time.Now())
+
+	logger := zerolog.New(io.Discard)
+	config, err := New(certFile, keyFile, clientCAFile, &logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	// Served as by the plugin, with ServeTLS
+	server := &http.Server{TLSConfig: config, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})}
+	go server.ServeTLS(listener, "", "")
+	t.Cleanup(func() { server.Close() })
+
+	client := newClient(t, ca, nil, nil)
+	client.Transport.(*http.Transport).ForceAttemptHTTP2 = true
+	resp, err := client.Get("https://" + listener.Addr().String())
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.ProtoMajor != 2 {
+		t.Errorf("expected HTTP/2, got %s", resp.Proto)
+	}
+}
+
+func TestNew_ClientCertificates(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, clientCAFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), filepath.Join(dir, "ca.crt")
+	serverCA := newTestCA(t, "server CA")
+	clientCA := newTestCA(t, "client CA")
+	otherCA := newTestCA(t, "other CA")
+	start := time.Now().Add(-time.Hour)
+
+	cert, key := serverCA.issue(t, "localhost", 10, true)
+	writeFile(t, certFile, cert, start)
+	writeFile(t, keyFile, key, start)
+	writeFile(t, clientCAFile, clientCA.pem, start)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	})
+	server := startServer(t, certFile, keyFile, clientCAFile, RequireClientCertificate(mux, "/healthz"))
+
+	controllerCert, controllerKey := clientCA.issue(t, "rest-dynamic-controller", 20, false)
+	strangerCert, strangerKey := otherCA.issue(t, "stranger", 30, false)
+
+	// Client certificate signed by the client CA
+	resp, err := newClient(t, serverCA, controllerCert, controllerKey).Get(server.URL + "/repository/krateo/test/collaborators/mona")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "rest-dynamic-controller" {
+		t.Errorf("expected the controller to be served, got %d: %s", resp.StatusCode, body)
+	}
+
+	// Client certificate signed by another CA: not sent (the server lists the accepted CAs) or rejected by the handshake
+	resp, err = newClient(t, serverCA, strangerCert, strangerKey).Get(server.URL + "/repository/krateo/test/collaborators/mona")
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("expected a certificate of another CA to be rejected, got %d", resp.StatusCode)
+		}
+	}
+
+	// No client certificate: rejected, except for the health checks
+	noCert := newClient(t, serverCA, nil, nil)
+	resp, err = noCert.Get(server.URL + "/repository/krateo/test/collaborators/mona")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized || !strings.Contains(string(body), "client certificate") {
+		t.Errorf("expected 401 without client certificate, got %d: %s", resp.StatusCode, body)
+	}
+
+	resp, err = noCert.Get(server.URL + "/healthz")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected the health check to be served without client certificate, got %d", resp.StatusCode)
+	}
+
+	// Rotated client CA bundle: the other CA is trusted from the next handshake
+	writeFile(t, clientCAFile, otherCA.pem, start.Add(time.Minute))
+	resp, err = newClient(t, serverCA, strangerCert, strangerKey).Get(server.URL + "/repository/krateo/test/collaborators/mona")
+	if err != nil {
+		t.Fatalf("expected the rotated CA to be trusted: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected the stranger to be served after the rotation, got %d", resp.StatusCode)
+	}
+}
+
+func TestNew_Errors(t *testing.T) {
+	logger := zerolog.New(io.Discard)
+	dir := t.TempDir()
+	ca := newTestCA(t, "test CA")
+	cert, key := ca.issue(t, "localhost", 10, true)
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writeFile(t, certFile, cert, time.Now())
+	writeFile(t, keyFile, key, time.Now())
+	invalidCA := filepath.Join(dir, "invalid.crt")
+	writeFile(t, invalidCA, []byte("not a certificate"), time.Now())
+
+	tests := []struct {
+		name          string
+		certFile      string
+		keyFile       string
+		clientCAFile  string
+		expectedError string
+	}{
+		{name: "missing certificate", certFile: filepath.Join(dir, "missing.crt"), keyFile: keyFile, expectedError: "no such file"},
+		{name: "key of another file", certFile: certFile, keyFile: certFile, expectedError: "failed to load TLS certificate"},
+		{name: "invalid client CA bundle", certFile: certFile, keyFile: keyFile, clientCAFile: invalidCA, expectedError: "no certificate found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.certFile, tt.keyFile, tt.clientCAFile, &logger)
+			if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+				t.Errorf("expected error containing %q, got %v", tt.expectedError, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,16 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// HashToken returns a SHA-256 hash (hex encoded) of an Authorization header value.
+// It allows to key per-caller state without keeping the token itself in memory or logs.
+func HashToken(authHeader string) string {
+	if authHeader == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(authHeader))
+	return hex.EncodeToString(sum[:])
+}
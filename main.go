@@ -2,8 +2,10 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"flag"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"os/signal"
@@ -12,10 +14,24 @@ import (
 	"time"
 
 	_ "github.com/krateoplatformops/github-rest-dynamic-controller-plugin/docs"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/coalesce"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/events"
 	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/handlers"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/handlers/accesslog"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/handlers/audit"
 	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/handlers/collaborator"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/handlers/dryrun"
 	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/handlers/health"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/handlers/idempotency"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/handlers/ratelimit"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/handlers/team"
 	teamrepo "github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/handlers/teamRepo"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/handlers/webhook"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/invitations"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/policy"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/redact"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/roles"
+	"github.com/krateoplatformops/github-rest-dynamic-controller-plugin/internal/tlsconfig"
 	"github.com/krateoplatformops/plumbing/env"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -50,6 +66,31 @@ func main() {
 	debugOn := flag.Bool("debug", env.Bool("DEBUG", true), "dump verbose output")
 	port := flag.Int("port", env.Int("PORT", 8080), "port to listen on")
 	noColor := flag.Bool("no-color", env.Bool("NO_COLOR", false), "disable color output")
+	logFormat := flag.String("log-format", env.String("LOG_FORMAT", "console"), "format of the logs: console or json")
+	customRolesCacheTTL := flag.Duration("custom-roles-cache-ttl", env.Duration("CUSTOM_ROLES_CACHE_TTL", 10*time.Minute), "how long the custom repository roles of an organization are cached")
+	expiredInvitationPolicy := flag.String("expired-invitation-policy", env.String("EXPIRED_INVITATION_POLICY", string(handlers.ExpiredInvitationReinvite)), "how expired invitations are handled: reinvite or report")
+	bulkConcurrency := flag.Int("bulk-concurrency", env.Int("BULK_CONCURRENCY", handlers.DefaultBulkConcurrency), "maximum concurrent GitHub requests of bulk endpoints")
+	upstreamTimeout := flag.Duration("upstream-timeout", env.Duration("UPSTREAM_TIMEOUT", 10*time.Second), "timeout of a single GitHub API call (0 to disable)")
+	requestTimeout := flag.Duration("request-timeout", env.Duration("REQUEST_TIMEOUT", 45*time.Second), "deadline of all the GitHub API calls of a request (0 to disable)")
+	invitationCacheTTL := flag.Duration("invitation-cache-ttl", env.Duration("INVITATION_CACHE_TTL", 5*time.Minute), "how long the invitations of a repository are cached (0 to disable)")
+	webhookSecret := flag.String("webhook-secret", env.String("WEBHOOK_SECRET", ""), "secret of the GitHub webhooks received on /webhooks/github (the endpoint is disabled when empty)")
+	eventsToken := flag.String("events-token", env.String("EVENTS_TOKEN", ""), "bearer token required to watch /webhooks/events (the stream is disabled when empty)")
+	coalesceRequests := flag.Bool("coalesce-requests", env.Bool("COALESCE_REQUESTS", true), "send identical concurrent GitHub GET requests only once")
+	auditLogFile := flag.String("audit-log-file", env.String("AUDIT_LOG_FILE", ""), "file the audit records of mutating requests are appended to, as JSON lines")
+	auditWebhookURL := flag.String("audit-webhook-url", env.String("AUDIT_WEBHOOK_URL", ""), "URL the audit records of mutating requests are posted to")
+	policyFile := flag.String("policy-file", env.String("POLICY_FILE", ""), "YAML file of the allow/deny policy of organizations, repositories and permissions (everything is allowed when empty)")
+	policyReloadInterval := flag.Duration("policy-reload-interval", env.Duration("POLICY_RELOAD_INTERVAL", policy.DefaultReloadInterval), "how often the policy file is checked for changes")
+	rateLimit := flag.String("rate-limit", env.String("RATE_LIMIT", "10:20:10"), "requests per second, burst and maximum in-flight requests of each caller on a route, as rate:burst:max_in_flight (0:0:0 to disable)")
+	routeRateLimits := flag.String("route-rate-limits", env.String("ROUTE_RATE_LIMITS", ""), "limits of specific route patterns, as pattern=rate:burst:max_in_flight separated by semicolons")
+	tlsCertFile := flag.String("tls-cert-file", env.String("TLS_CERT_FILE", ""), "certificate file served over TLS, reloaded when it changes (plain HTTP when empty)")
+	tlsKeyFile := flag.String("tls-key-file", env.String("TLS_KEY_FILE", ""), "key file of the TLS certificate, reloaded when it changes")
+	tlsClientCAFile := flag.String("tls-client-ca-file", env.String("TLS_CLIENT_CA_FILE", ""), "CA bundle verifying the client certificates, required on every route but the health checks (mutual TLS)")
+	accessLogSampleEvery := flag.Int("access-log-sample-every", env.Int("ACCESS_LOG_SAMPLE_EVERY", 1), "log one in every N requests in the access log (1 logs all of them, 0 only the failed and the slow ones)")
+	accessLogSlowThreshold := flag.Duration("access-log-slow-threshold", env.Duration("ACCESS_LOG_SLOW_THRESHOLD", 5*time.Second), "requests lasting at least this long are always logged in the access log (0 to disable)")
+	readinessCheckInterval := flag.Duration("readiness-check-interval", env.Duration("READINESS_CHECK_INTERVAL", health.DefaultCheckInterval), "how often readiness is checked against GitHub in the background")
+	readinessTokenFile := flag.String("readiness-token-file", env.String("READINESS_TOKEN_FILE", ""), "file of a GitHub token whose validity and rate limit are checked for readiness (GitHub reachability only when empty)")
+	readinessMinRateLimit := flag.Int("readiness-min-rate-limit", env.Int("READINESS_MIN_RATE_LIMIT", 100), "not ready when the token of the readiness checks has fewer remaining requests (0 to disable)")
+	idempotencyTTL := flag.Duration("idempotency-ttl", env.Duration("IDEMPOTENCY_TTL", 24*time.Hour), "how long responses of requests with an Idempotency-Key are replayed (0 to disable)")
 
 	flag.Parse()
 
@@ -64,45 +105,209 @@ func main() {
 		zerolog.SetGlobalLevel(zerolog.DebugLevel)
 	}
 
-	log.Logger = log.Output(zerolog.ConsoleWriter{
-		Out:     os.Stderr,
-		NoColor: *noColor,
-	}).With().Timestamp().Logger()
+	// Every log line is redacted: Authorization values, tokens and secret-like fields never reach the output
+	var logOutput io.Writer
+	switch *logFormat {
+	case "console":
+		logOutput = zerolog.ConsoleWriter{
+			Out:     os.Stderr,
+			NoColor: *noColor,
+		}
+	case "json":
+		logOutput = os.Stderr
+	default:
+		log.Fatal().Msgf("Invalid configuration: unknown log format %q, expected console or json", *logFormat)
+	}
+	log.Logger = log.Output(redact.NewWriter(logOutput)).With().Timestamp().Logger()
+
+	invitationPolicy, err := handlers.ParseExpiredInvitationPolicy(*expiredInvitationPolicy)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid configuration")
+	}
+
+	// Every GitHub API call is bounded by the upstream timeout, and by the deadline of the request it belongs to
+	httpClient := &http.Client{Timeout: *upstreamTimeout}
+
+	var client handlers.HTTPClient = httpClient
+	if *coalesceRequests {
+		client = coalesce.New(httpClient, *upstreamTimeout)
+	}
+	// GitHub API calls are counted in the logs of the request they belong to
+	client = handlers.InstrumentClient(client)
+
+	// Audit records of the mutating requests, disabled when no sink is configured
+	var auditSinks []audit.Sink
+	if *auditLogFile != "" {
+		fileSink, err := audit.NewFileSink(*auditLogFile)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Invalid configuration")
+		}
+		defer fileSink.Close()
+		auditSinks = append(auditSinks, fileSink)
+	}
+	if *auditWebhookURL != "" {
+		auditSinks = append(auditSinks, audit.NewWebhookSink(*auditWebhookURL, httpClient))
+	}
+	var auditor *audit.Auditor
+	if len(auditSinks) > 0 {
+		client = &audit.Client{Client: client}
+		auditor = audit.New(&log.Logger, mux, audit.NewIdentities(httpClient), auditSinks...)
+	}
+
+	// Invitations of a repository, cached until the TTL expires or a webhook reports a change
+	var invitationIndex *invitations.Index
+	if *invitationCacheTTL > 0 {
+		invitationIndex = invitations.NewIndex(client, *invitationCacheTTL)
+	}
+
+	// Limits of the requests of each caller, by route pattern. Health checks and the GitHub webhooks,
+	// authenticated by their signature, are not limited unless configured.
+	defaultLimit, err := ratelimit.ParseLimit(*rateLimit)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid configuration")
+	}
+	routeLimits := map[string]ratelimit.Limit{
+		"GET /healthz":         {},
+		"GET /readyz":          {},
+		"POST " + webhook.Path: {},
+	}
+	configuredLimits, err := ratelimit.ParseRouteLimits(*routeRateLimits)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid configuration")
+	}
+	for pattern, limit := range configuredLimits {
+		routeLimits[pattern] = limit
+	}
+	limiter := ratelimit.New(defaultLimit, routeLimits)
+
+	// Allow/deny policy, reloaded when the file changes
+	var policyStore *policy.Store
+	if *policyFile != "" {
+		policyStore, err = policy.NewStore(*policyFile, &log.Logger)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Invalid configuration")
+		}
+	}
 
 	opts := handlers.HandlerOptions{
-		Log:    &log.Logger,
-		Client: http.DefaultClient,
+		Log:                     &log.Logger,
+		Client:                  client,
+		Roles:                   roles.NewResolver(client, *customRolesCacheTTL),
+		Invitations:             invitationIndex,
+		ExpiredInvitationPolicy: invitationPolicy,
+		BulkConcurrency:         *bulkConcurrency,
+		Policy:                  policyStore,
+	}
+
+	// Responses of mutating requests with an Idempotency-Key, replayed for retries
+	idempotencyStore := idempotency.NewStore(*idempotencyTTL)
+	// Mutating requests are checked against the policy before anything else
+	mutating := func(route string, current audit.CurrentPath, newHandler func(handlers.HandlerOptions) handlers.Handler) http.Handler {
+		return handlers.EnforcePolicy(opts, route, handlers.LogRequestBody(opts, idempotency.Handler(idempotencyStore, audit.Handler(auditor, current, dryrun.Handler(opts, newHandler)))))
+	}
+	readOnly := func(route string, handler http.Handler) http.Handler {
+		return handlers.RestrictTargets(opts, route, handler)
+	}
+	collaboratorPermissionPath := func(r *http.Request) string {
+		return r.URL.Path + "/permission?include_pending=true"
 	}
 
 	// Health status flags
 	healthy := int32(0)
 	ready := int32(0)
 
-	// Business logic routes to handle some GitHub API's endpoints
+	// Business logic routes to handle some GitHub API's endpoints, with their path parameters validated before any GitHub API call
+	// and the request-scoped fields in their logs
+	api := func(pattern string, handler http.Handler) {
+		mux.Handle(pattern, handlers.RequestLogger(opts, pattern, handlers.ValidatePathParams(handler)))
+	}
 
 	// Collaborator
-	mux.Handle("GET /repository/{owner}/{repo}/collaborators/{username}/permission", collaborator.GetCollaborator(opts))
-	mux.Handle("POST /repository/{owner}/{repo}/collaborators/{username}", collaborator.PostCollaborator(opts))
-	mux.Handle("PATCH /repository/{owner}/{repo}/collaborators/{username}", collaborator.PatchCollaborator(opts))
-	mux.Handle("DELETE /repository/{owner}/{repo}/collaborators/{username}", collaborator.DeleteCollaborator(opts))
+	api("GET /repository/{owner}/{repo}/collaborators/{username}/permission", readOnly(policy.RouteCollaborator, collaborator.GetCollaborator(opts)))
+	api("POST /repository/{owner}/{repo}/collaborators/{username}", mutating(policy.RouteCollaborator, collaboratorPermissionPath, collaborator.PostCollaborator))
+	api("PATCH /repository/{owner}/{repo}/collaborators/{username}", mutating(policy.RouteCollaborator, collaboratorPermissionPath, collaborator.PatchCollaborator))
+	api("DELETE /repository/{owner}/{repo}/collaborators/{username}", mutating(policy.RouteCollaborator, collaboratorPermissionPath, collaborator.DeleteCollaborator))
+	api("PUT /repository/{owner}/{repo}/collaborators", handlers.EnforcePolicy(opts, policy.RouteCollaborators, handlers.LogRequestBody(opts, audit.Handler(auditor, nil, dryrun.Handler(opts, collaborator.PutCollaborators)))))
+	api("POST /repository/{owner}/{repo}/collaborators/{username}/diff", readOnly(policy.RouteCollaborator, collaborator.DiffCollaborator(opts)))
 
 	// TeamRepo
-	mux.Handle("GET /teamrepository/orgs/{org}/teams/{team_slug}/repos/{owner}/{repo}", teamrepo.GetTeamRepo(opts))
+	api("GET /teamrepository/orgs/{org}/teams/{team_slug}/repos/{owner}/{repo}", readOnly(policy.RouteTeamRepository, teamrepo.GetTeamRepo(opts)))
+	api("POST /teamrepository/orgs/{org}/teams/{team_slug}/repos/{owner}/{repo}", mutating(policy.RouteTeamRepository, audit.SamePath, teamrepo.PostTeamRepo))
+	api("PATCH /teamrepository/orgs/{org}/teams/{team_slug}/repos/{owner}/{repo}", mutating(policy.RouteTeamRepository, audit.SamePath, teamrepo.PatchTeamRepo))
+	api("DELETE /teamrepository/orgs/{org}/teams/{team_slug}/repos/{owner}/{repo}", mutating(policy.RouteTeamRepository, audit.SamePath, teamrepo.DeleteTeamRepo))
+
+	// Team
+	api("GET /team/orgs/{org}/teams/{team_slug}", readOnly(policy.RouteTeam, team.GetTeam(opts)))
+	api("POST /team/orgs/{org}/teams", mutating(policy.RouteTeam, nil, team.PostTeam))
+	api("PATCH /team/orgs/{org}/teams/{team_slug}", mutating(policy.RouteTeam, audit.SamePath, team.PatchTeam))
+	api("DELETE /team/orgs/{org}/teams/{team_slug}", mutating(policy.RouteTeam, audit.SamePath, team.DeleteTeam))
+
+	// Routes served without the request deadline
+	root := http.NewServeMux()
+	// Access log of the routes of mux, labelled by route pattern. Health checks are only logged when failed or slow.
+	accessLogConfig := accesslog.Config{
+		SampleEvery:   *accessLogSampleEvery,
+		SlowThreshold: *accessLogSlowThreshold,
+		QuietRoutes:   []string{"GET /healthz", "GET /readyz"},
+	}
+	root.Handle("/", accesslog.Handler(&log.Logger, accessLogConfig, mux, handlers.RequestTimeout(*requestTimeout, ratelimit.Handler(limiter, mux))))
+
+	// GitHub webhooks, and the stream of the changes they report
+	var broker *events.Broker
+	if *webhookSecret != "" {
+		broker = events.NewBroker(events.DefaultHistorySize)
+		mux.Handle("POST "+webhook.Path, handlers.RequestLogger(opts, "POST "+webhook.Path, webhook.Handler(opts, *webhookSecret, broker)))
+		if *eventsToken != "" {
+			root.Handle("GET /webhooks/events", handlers.RequestLogger(opts, "GET /webhooks/events", webhook.EventsHandler(opts, *eventsToken, broker)))
+		} else {
+			log.Info().Msg("EVENTS_TOKEN is not set, the stream of change events is disabled")
+		}
+	} else {
+		log.Info().Msg("WEBHOOK_SECRET is not set, the GitHub webhook receiver is disabled")
+	}
 
 	// Swagger UI
 	mux.Handle("/swagger/", httpSwagger.WrapHandler)
 
 	// Kubernetes health check endpoints
 	mux.HandleFunc("GET /healthz", health.LivenessHandler(&healthy))
-	mux.HandleFunc("GET /readyz", health.ReadinessHandler(&ready, opts.Client.(*http.Client)))
+	readiness := health.NewChecker(httpClient, health.CheckerConfig{
+		TokenFile:    *readinessTokenFile,
+		MinRemaining: *readinessMinRateLimit,
+	}, &log.Logger)
+	mux.HandleFunc("GET /readyz", health.ReadinessHandler(&ready, readiness))
+
+	// Optional TLS, with client certificates required when a client CA bundle is configured
+	var handler http.Handler = root
+	var tlsConfig *tls.Config
+	if *tlsCertFile != "" || *tlsKeyFile != "" || *tlsClientCAFile != "" {
+		if *tlsCertFile == "" || *tlsKeyFile == "" {
+			log.Fatal().Msg("Invalid configuration: TLS_CERT_FILE and TLS_KEY_FILE are both required to serve TLS")
+		}
+		tlsConfig, err = tlsconfig.New(*tlsCertFile, *tlsKeyFile, *tlsClientCAFile, &log.Logger)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Invalid configuration")
+		}
+		if *tlsClientCAFile != "" {
+			handler = tlsconfig.RequireClientCertificate(root, "/healthz", "/readyz", webhook.Path)
+		}
+	}
+
+	// Every request is identified, from the controller to GitHub, before anything can reject it
+	handler = handlers.RequestID(handler)
 
 	server := &http.Server{
 		Addr:         fmt.Sprintf(":%d", *port),
-		Handler:      mux,
+		Handler:      handler,
+		TLSConfig:    tlsConfig,
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 50 * time.Second,
 		IdleTimeout:  30 * time.Second,
 	}
+	if broker != nil {
+		// Shutdown does not cancel the requests in flight: end the event streams so that it does not wait for them
+		server.RegisterOnShutdown(broker.Close)
+	}
 
 	ctx, stop := signal.NotifyContext(context.Background(), []os.Signal{
 		os.Interrupt,
@@ -114,12 +319,22 @@ func main() {
 	}...)
 	defer stop()
 
+	if policyStore != nil {
+		go policyStore.Watch(ctx, *policyReloadInterval)
+	}
+	go readiness.Run(ctx, *readinessCheckInterval)
+
 	go func() {
 		// Mark as healthy and ready when server starts
 		atomic.StoreInt32(&healthy, 1)
 		atomic.StoreInt32(&ready, 1)
 
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		serve := server.ListenAndServe
+		if tlsConfig != nil {
+			// The certificate is served by the TLS configuration
+			serve = func() error { return server.ListenAndServeTLS("", "") }
+		}
+		if err := serve(); err != nil && err != http.ErrServerClosed {
 			log.Fatal().Err(err).Msgf("could not listen on %s", server.Addr)
 		}
 	}()